@@ -0,0 +1,227 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+//AuditLog writes a record of every statement that is not read-only (see
+//IsReadOnlyStatement), e.g. INSERT, UPDATE, DELETE, MERGE, TRUNCATE, DDL or
+//GRANT, to an append-only file, independently of the application's own
+//logging:
+//
+//	audit, err := sqlproxy.NewAuditLog("/var/log/myapp/sql-audit.log")
+//	audit.MaxSize = 100 << 20
+//	audit.Sync = true
+//	sql.Register("postgres-with-audit", sqlproxy.New("postgres",
+//		sqlproxy.WithCorrelation(identityFromContext),
+//		sqlproxy.WithHooks(audit.Hooks()),
+//	))
+//
+//Each record is a single line of JSON with the following keys:
+//
+//	time           - when the statement finished, in RFC 3339 format with nanoseconds
+//	connection_id  - see QueryEvent.ConnectionID
+//	query          - the query string
+//	args           - the bound arguments, redacted by RedactArg
+//	rows           - see QueryEvent.Rows
+//	error          - only if the statement failed
+//	tenant         - only if Driver.TenantFromContext is set
+//	caller         - only if Driver.CaptureCaller is set
+//	fields         - the result of the CorrelationHook, if any
+//
+//To record who issued a statement, put the identity (e.g. user name or
+//request ID) into the context given to ExecContext() etc., and extract it with
+//a CorrelationHook.
+//
+//Errors while writing to the audit log are logged through log/slog, since the
+//hooks cannot return them. If rotating the audit log fails, records are
+//written to the previous file until the next rotation succeeds. The exported fields must not be changed after the
+//hooks have been installed.
+type AuditLog struct {
+	//MaxSize (optional) is the size in bytes after which the audit log is
+	//rotated.
+	MaxSize int64
+	//MaxAge (optional) is the time after which the audit log is rotated.
+	MaxAge time.Duration
+	//Sync (optional) causes the file to be fsync()ed after each record.
+	Sync bool
+	//RedactArg (optional) renders a bound argument for the audit log. The
+	//default only records the argument's type (e.g. "string" or "int64"),
+	//since arguments can contain personal data or secrets.
+	RedactArg func(arg interface{}) string
+
+	path     string
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	now      func() time.Time //for unit tests
+}
+
+//NewAuditLog opens the audit log at the given path. If the file exists
+//already, new records are appended to it.
+func NewAuditLog(path string) (*AuditLog, error) {
+	a := &AuditLog{path: path, now: time.Now}
+	err := a.open()
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AuditLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	a.file = file
+	a.size = fi.Size()
+	a.openedAt = a.now()
+	return nil
+}
+
+//Rotate renames the current audit log to "<path>.<timestamp>" and starts a new
+//one. This happens automatically according to MaxSize and MaxAge, but can also
+//be triggered manually (e.g. on SIGHUP).
+func (a *AuditLog) Rotate() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.rotate()
+}
+
+//rotate switches to a new file. If this fails, a.file is left unchanged, so
+//that records can still be written to it.
+func (a *AuditLog) rotate() error {
+	rotatedPath := a.path + "." + a.now().UTC().Format("20060102T150405.000000000Z")
+	err := os.Rename(a.path, rotatedPath)
+	if err != nil {
+		return err
+	}
+	oldFile := a.file
+	err = a.open()
+	if err != nil {
+		//move the file back, so that the next attempt starts from the same state
+		if err := os.Rename(rotatedPath, a.path); err != nil {
+			slog.Error("cannot restore SQL audit log after failed rotation", "path", a.path, "error", err.Error())
+		}
+		return err
+	}
+	return oldFile.Close()
+}
+
+//Close closes the audit log. The hooks must not be used afterwards.
+func (a *AuditLog) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.file.Close()
+}
+
+//Hooks returns the hooks that write to this audit log. Use WithHooks() to
+//combine them with other hooks.
+func (a *AuditLog) Hooks() Hooks {
+	return Hooks{AfterQueryHook: a.record}
+}
+
+func (a *AuditLog) record(e QueryEvent) {
+	if IsReadOnlyStatement(e.Query) {
+		return
+	}
+	err := a.write(e)
+	if err != nil {
+		slog.Error("cannot write SQL audit log", "path", a.path, "error", err.Error())
+	}
+}
+
+type auditRecord struct {
+	Time         string            `json:"time"`
+	ConnectionID uint64            `json:"connection_id"`
+	Query        string            `json:"query"`
+	Args         []string          `json:"args"`
+	Rows         int64             `json:"rows"`
+	Error        string            `json:"error,omitempty"`
+	Tenant       string            `json:"tenant,omitempty"`
+	Caller       string            `json:"caller,omitempty"`
+	Fields       map[string]string `json:"fields,omitempty"`
+}
+
+func (a *AuditLog) write(e QueryEvent) error {
+	redact := a.RedactArg
+	if redact == nil {
+		redact = func(arg interface{}) string { return fmt.Sprintf("%T", arg) }
+	}
+	rec := auditRecord{
+		ConnectionID: e.ConnectionID,
+		Query:        e.Query,
+		Args:         make([]string, len(e.Args)),
+		Rows:         e.Rows,
+		Tenant:       e.Tenant,
+		Caller:       e.Caller,
+		Fields:       e.Fields,
+	}
+	for idx, arg := range e.Args {
+		rec.Args[idx] = redact(arg)
+	}
+	if e.Err != nil {
+		rec.Error = e.Err.Error()
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := a.now()
+	rec.Time = now.UTC().Format(time.RFC3339Nano)
+	buf, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	//rotate before writing, so that a rotated file never exceeds MaxSize
+	//(unless a single record does)
+	needsRotation := (a.MaxSize > 0 && a.size > 0 && a.size+int64(len(buf)) > a.MaxSize) ||
+		(a.MaxAge > 0 && now.Sub(a.openedAt) >= a.MaxAge)
+	var rotateErr error
+	if needsRotation {
+		rotateErr = a.rotate()
+		if rotateErr != nil {
+			rotateErr = fmt.Errorf("cannot rotate: %w", rotateErr)
+		}
+	}
+
+	n, err := a.file.Write(buf)
+	a.size += int64(n)
+	if err == nil && a.Sync {
+		err = a.file.Sync()
+	}
+	return errors.Join(rotateErr, err)
+}
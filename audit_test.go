@@ -0,0 +1,198 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_AuditLog(t *testing.T) {
+	tt := TT{t}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLog(path)
+	tt.Must(err)
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	audit.now = func() time.Time { return now }
+	audit.Sync = true
+	audit.MaxAge = time.Hour
+	audit.openedAt = now
+	hook := audit.Hooks().AfterQueryHook
+
+	hook(QueryEvent{Query: `SELECT * FROM users`, ConnectionID: 1})
+	hook(QueryEvent{
+		Query:        `UPDATE users SET password = $1 WHERE id = $2`,
+		Args:         []interface{}{"hunter2", int64(42)},
+		Rows:         1,
+		ConnectionID: 1,
+		Caller:       "main.changePassword (main.go:42)",
+		Fields:       map[string]string{"user": "admin"},
+	})
+	now = now.Add(2 * time.Hour)
+	hook(QueryEvent{
+		Query:        `WITH old AS (DELETE FROM sessions RETURNING *) SELECT COUNT(*) FROM old`,
+		Err:          errors.New("permission denied"),
+		ConnectionID: 2,
+	})
+	tt.Must(audit.Close())
+
+	matches, err := filepath.Glob(path + ".*")
+	tt.Must(err)
+	expectedRotated := []string{path + ".20260102T170405.000000000Z"}
+	if !reflect.DeepEqual(matches, expectedRotated) {
+		tt.Unexpected("rotated files", expectedRotated, matches)
+	}
+
+	expected := map[string]string{
+		expectedRotated[0]: `{"time":"2026-01-02T15:04:05Z","connection_id":1,"query":"UPDATE users SET password = $1 WHERE id = $2","args":["string","int64"],"rows":1,"caller":"main.changePassword (main.go:42)","fields":{"user":"admin"}}` + "\n",
+		path:               `{"time":"2026-01-02T17:04:05Z","connection_id":2,"query":"WITH old AS (DELETE FROM sessions RETURNING *) SELECT COUNT(*) FROM old","args":[],"rows":0,"error":"permission denied"}` + "\n",
+	}
+	for p, expectedContents := range expected {
+		buf, err := os.ReadFile(p)
+		tt.Must(err)
+		if string(buf) != expectedContents {
+			tt.Unexpected(filepath.Base(p), expectedContents, string(buf))
+		}
+	}
+}
+
+func Test_AuditLogMaxSize(t *testing.T) {
+	tt := TT{t}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLog(path)
+	tt.Must(err)
+	audit.MaxSize = 200
+	audit.RedactArg = formatArg
+	hook := audit.Hooks().AfterQueryHook
+	for idx := 0; idx < 5; idx++ {
+		hook(QueryEvent{Query: `INSERT INTO knowledge VALUES ($1, $2)`, Args: []interface{}{idx, "truth"}})
+	}
+	tt.Must(audit.Close())
+
+	matches, err := filepath.Glob(path + "*")
+	tt.Must(err)
+	lineCount := 0
+	for _, p := range matches {
+		buf, err := os.ReadFile(p)
+		tt.Must(err)
+		if len(buf) > 200 {
+			t.Errorf("expected %s to be at most 200 bytes, but is %d bytes", p, len(buf))
+		}
+		if !strings.Contains(string(buf), `,"\"truth\""]`) {
+			t.Errorf("expected args to be formatted by RedactArg in %s: %q", p, string(buf))
+		}
+		lineCount += strings.Count(string(buf), "\n")
+	}
+	if len(matches) < 2 || lineCount != 5 {
+		t.Errorf("expected 5 records across multiple files, got %d records in %v", lineCount, matches)
+	}
+}
+
+func Test_AuditLogStatementTypes(t *testing.T) {
+	tt := TT{t}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLog(path)
+	tt.Must(err)
+	hook := audit.Hooks().AfterQueryHook
+
+	//the audit log agrees with IsReadOnlyStatement
+	testCases := map[string]bool{
+		`SELECT * FROM users`:                         false,
+		`WITH x AS (SELECT 1) SELECT * FROM x`:        false,
+		`SHOW TABLES`:                                 false,
+		`SELECT 1; DELETE FROM users`:                 true,
+		`SELECT * INTO backup FROM users`:             true,
+		`GRANT SELECT ON users TO intern`:             true,
+		`REVOKE SELECT ON users FROM intern`:          true,
+		`COPY users FROM '/tmp/users.csv'`:            true,
+		`CALL cleanup_users()`:                        true,
+		`DO $$ BEGIN DELETE FROM users; END $$`:       true,
+		`SELECT * FROM users WHERE id = 1 FOR UPDATE`: true,
+	}
+	var expected []string
+	for query, isRecorded := range testCases {
+		hook(QueryEvent{Query: query})
+		if isRecorded {
+			expected = append(expected, query)
+		}
+	}
+	tt.Must(audit.Close())
+
+	buf, err := os.ReadFile(path)
+	tt.Must(err)
+	var actual []string
+	for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+		var rec auditRecord
+		tt.Must(json.Unmarshal([]byte(line), &rec))
+		actual = append(actual, rec.Query)
+	}
+	sort.Strings(expected)
+	sort.Strings(actual)
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("recorded statements", expected, actual)
+	}
+}
+
+func Test_AuditLogFailedRotation(t *testing.T) {
+	tt := TT{t}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLog(path)
+	tt.Must(err)
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	audit.now = func() time.Time { return now }
+	hook := audit.Hooks().AfterQueryHook
+	hook(QueryEvent{Query: `DELETE FROM users WHERE id = 1`})
+
+	//block the rotated file name with a non-empty directory, so that the
+	//rename fails
+	rotatedPath := path + ".20260102T150405.000000000Z"
+	tt.Must(os.MkdirAll(filepath.Join(rotatedPath, "blocker"), 0700))
+	if err := audit.Rotate(); err == nil {
+		t.Error("expected Rotate() to fail")
+	}
+
+	//records are still written to the previous file
+	hook(QueryEvent{Query: `DELETE FROM users WHERE id = 2`})
+	//once the obstacle is gone, rotation works again
+	tt.Must(os.RemoveAll(rotatedPath))
+	tt.Must(audit.Rotate())
+	hook(QueryEvent{Query: `DELETE FROM users WHERE id = 3`})
+	tt.Must(audit.Close())
+
+	expected := map[string]int{rotatedPath: 2, path: 1}
+	for p, expectedCount := range expected {
+		buf, err := os.ReadFile(p)
+		tt.Must(err)
+		if count := strings.Count(string(buf), "\n"); count != expectedCount {
+			tt.Unexpected("record count in "+filepath.Base(p), expectedCount, count)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//WithTransactionTag returns a context that tags the transactions started with
+//it (through sql.DB.BeginTx etc.). Transactions with the same tag are assumed
+//to be similar for the purposes of Driver.AutoReadOnlyTransactions, so the tag
+//should identify one specific unit of work in the application, e.g.
+//"list-invoices". The tag is reported in TransactionEvent.Tag.
+func WithTransactionTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, transactionTagKey{}, tag)
+}
+
+type transactionTagKey struct{}
+
+func transactionTagFromContext(ctx context.Context) string {
+	tag, _ := ctx.Value(transactionTagKey{}).(string)
+	return tag
+}
+
+const (
+	//autoReadOnlyThreshold is how many similar transactions in a row must
+	//have performed only reads before the next one is started as READ ONLY.
+	autoReadOnlyThreshold = 3
+	//autoReadOnlyBackoff is how long Driver.AutoReadOnlyTransactions is
+	//switched off after the proxied driver has rejected a read-only
+	//transaction.
+	autoReadOnlyBackoff = 10 * time.Minute
+)
+
+//transactionClassifier implements Driver.AutoReadOnlyTransactions.
+type transactionClassifier struct {
+	mutex   sync.Mutex
+	classes map[string]*transactionClass //key = transaction tag
+	//set when the proxied driver has rejected a read-only transaction (in
+	//UnixNano, or 0 if not disabled)
+	disabledUntil atomic.Int64
+	now           func() time.Time //for unit tests
+}
+
+//transactionClass contains the history of the transactions with one tag. It
+//is protected by the mutex in transactionClassifier.
+type transactionClass struct {
+	//the sorted fingerprints of the latest transaction
+	fingerprints string
+	//how many transactions with these fingerprints in a row performed only
+	//reads
+	readOnlyRuns int
+}
+
+//start returns the class of a transaction with the given tag, or nil if the
+//transaction is not tagged.
+func (tc *transactionClassifier) start(tag string) *transactionClass {
+	if tag == "" {
+		return nil
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	if tc.classes == nil {
+		tc.classes = make(map[string]*transactionClass)
+	}
+	class := tc.classes[tag]
+	if class == nil {
+		class = &transactionClass{}
+		tc.classes[tag] = class
+	}
+	return class
+}
+
+func (tc *transactionClassifier) timeNow() time.Time {
+	if tc.now != nil {
+		return tc.now()
+	}
+	return time.Now()
+}
+
+//isReadOnly returns whether the next transaction in this class shall be
+//started as READ ONLY.
+func (tc *transactionClassifier) isReadOnly(class *transactionClass) bool {
+	if tc.timeNow().UnixNano() < tc.disabledUntil.Load() {
+		return false
+	}
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return class.readOnlyRuns >= autoReadOnlyThreshold
+}
+
+//finish records the outcome of a transaction in this class.
+func (tc *transactionClassifier) finish(class *transactionClass, fingerprints map[string]bool, wrote bool) {
+	sorted := make([]string, 0, len(fingerprints))
+	for fp := range fingerprints {
+		sorted = append(sorted, fp)
+	}
+	sort.Strings(sorted)
+	joined := strings.Join(sorted, "\x00")
+
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	switch {
+	case wrote:
+		class.readOnlyRuns = 0
+	case joined == class.fingerprints:
+		class.readOnlyRuns++
+	default:
+		class.readOnlyRuns = 1
+	}
+	class.fingerprints = joined
+}
+
+//beginTxAutoReadOnly wraps beginTx to implement
+//Driver.AutoReadOnlyTransactions. The bool return value is whether the
+//transaction was started as READ ONLY because of its class.
+func (c *connection) beginTxAutoReadOnly(ctx context.Context, opts driver.TxOptions, class *transactionClass) (driver.Tx, bool, error) {
+	classifier := &c.driver.transactionClasses
+	_, supported := c.conn.(driver.ConnBeginTx)
+	if class == nil || opts.ReadOnly || !supported || !classifier.isReadOnly(class) {
+		tx, err := c.beginTx(ctx, opts)
+		return tx, false, err
+	}
+
+	readOnlyOpts := opts
+	readOnlyOpts.ReadOnly = true
+	tx, err := c.beginTx(ctx, readOnlyOpts)
+	if err == nil {
+		return tx, true, nil
+	}
+	if errors.Is(err, driver.ErrBadConn) || ctx.Err() != nil {
+		return nil, false, err
+	}
+	//if a read-write transaction works on the same connection, the proxied
+	//driver (or database) apparently does not support read-only transactions;
+	//otherwise the error is not specific to them and is reported as usual
+	tx, err = c.beginTx(ctx, opts)
+	if err == nil {
+		classifier.disabledUntil.Store(classifier.timeNow().Add(autoReadOnlyBackoff).UnixNano())
+	}
+	return tx, false, err
+}
+
+//classify records a statement executed within the transaction for
+//Driver.AutoReadOnlyTransactions.
+func (t *transaction) classify(query string) {
+	if t.fingerprints == nil {
+		t.fingerprints = make(map[string]bool)
+	}
+	t.fingerprints[Normalize(query)] = true
+	if !IsReadOnlyStatement(query) {
+		t.wrote = true
+	}
+}
@@ -0,0 +1,53 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+//sourceDir is the directory containing the source code of this package. Stack
+//frames in this directory belong to the proxy itself (except for tests).
+var sourceDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+//findCaller returns the first stack frame outside of database/sql and this
+//package, formatted as "function (file:line)". This is the application code
+//that issued the current statement.
+func findCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		isProxy := filepath.Dir(frame.File) == sourceDir && !strings.HasSuffix(frame.File, "_test.go")
+		if !isProxy && !strings.HasPrefix(frame.Function, "database/sql.") {
+			return frame.Function + " (" + frame.File + ":" + strconv.Itoa(frame.Line) + ")"
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,221 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+//OtherFingerprint is reported instead of the fingerprints that a
+//CardinalityLimiter does not track individually.
+const OtherFingerprint = "other"
+
+//cardinalityEvictionSamples is how many tracked keys are compared when
+//looking for a key to evict.
+const cardinalityEvictionSamples = 8
+
+//CardinalityLimiter caps how many distinct fingerprints (see Normalize) are
+//tracked individually by FingerprintStats or StatsdSink. Applications that
+//build SQL dynamically (e.g. with inlined literals that Normalize does not
+//recognize, or with generated table names) can otherwise produce an unbounded
+//number of fingerprints, and thus unbounded memory usage in the proxy and in
+//the metrics backend. For example:
+//
+//	stats := sqlproxy.NewFingerprintStats()
+//	stats.Limiter = sqlproxy.NewCardinalityLimiter(1000)
+//
+//Once the limit is reached, a new fingerprint is only tracked if it has been
+//seen more often recently than the least frequent of a few randomly sampled
+//tracked fingerprints, which is then evicted. (Sampling keeps the cost per
+//statement independent of the limit, at the price of sometimes evicting a
+//fingerprint that is not the least frequent one overall.) All other
+//statements are aggregated under OtherFingerprint. How often fingerprints were seen is estimated by a small
+//frequency sketch (a count-min sketch whose counters are halved
+//periodically, so that recent activity outweighs old activity), so memory
+//usage only depends on the limit, not on the number of distinct fingerprints.
+//
+//A CardinalityLimiter keeps track of what its owner tracks, so each
+//FingerprintStats or StatsdSink needs its own CardinalityLimiter.
+type CardinalityLimiter struct {
+	limit     int
+	mutex     sync.Mutex
+	tracked   map[string]struct{}
+	sketch    frequencySketch
+	overflows uint64
+	evictions uint64
+}
+
+//CardinalityStats is returned by CardinalityLimiter.Stats().
+type CardinalityStats struct {
+	//Limit is the maximum number of tracked fingerprints, Tracked is the
+	//number of currently tracked fingerprints.
+	Limit   int
+	Tracked int
+	//Overflows is the number of statements that were aggregated under
+	//OtherFingerprint.
+	Overflows uint64
+	//Evictions is the number of fingerprints that were evicted in favor of
+	//more frequent ones.
+	Evictions uint64
+}
+
+//NewCardinalityLimiter returns a CardinalityLimiter that tracks at most the
+//given number of fingerprints (at least 1).
+func NewCardinalityLimiter(limit int) *CardinalityLimiter {
+	limit = max(limit, 1)
+	return &CardinalityLimiter{
+		limit:   limit,
+		tracked: make(map[string]struct{}, limit),
+		sketch:  newFrequencySketch(limit),
+	}
+}
+
+//admit records an occurrence of the given key (usually a fingerprint) and
+//returns whether it is tracked. If another key had to be evicted to make room
+//for it, that key is returned as well, so that the owner can fold its data
+//into OtherFingerprint.
+func (l *CardinalityLimiter) admit(key string) (tracked bool, evicted string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	estimate := l.sketch.increment(key)
+	if _, exists := l.tracked[key]; exists {
+		return true, ""
+	}
+	if len(l.tracked) < l.limit {
+		l.tracked[key] = struct{}{}
+		return true, ""
+	}
+
+	//find the least frequent among a few tracked keys (map iteration starts
+	//at a random position, so this is a random sample)
+	victim, victimEstimate := "", uint32(0)
+	sampled := 0
+	for candidate := range l.tracked {
+		candidateEstimate := l.sketch.estimate(candidate)
+		if victim == "" || candidateEstimate < victimEstimate {
+			victim, victimEstimate = candidate, candidateEstimate
+		}
+		sampled++
+		if sampled == cardinalityEvictionSamples {
+			break
+		}
+	}
+	if estimate <= victimEstimate {
+		l.overflows++
+		return false, ""
+	}
+	delete(l.tracked, victim)
+	l.tracked[key] = struct{}{}
+	l.evictions++
+	return true, victim
+}
+
+//Stats returns how many fingerprints are tracked and how many statements and
+//fingerprints were aggregated under OtherFingerprint.
+func (l *CardinalityLimiter) Stats() CardinalityStats {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return CardinalityStats{
+		Limit:     l.limit,
+		Tracked:   len(l.tracked),
+		Overflows: l.overflows,
+		Evictions: l.evictions,
+	}
+}
+
+//reset forgets all tracked keys and their frequencies, but not the
+//statistics returned by Stats().
+func (l *CardinalityLimiter) reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.tracked = make(map[string]struct{}, l.limit)
+	l.sketch = newFrequencySketch(l.limit)
+}
+
+//frequencySketch is a count-min sketch: Each key increments one counter in
+//each row, and the smallest of these counters is an upper bound for how often
+//the key was seen. After a number of increments proportional to the size of
+//the sketch, all counters are halved, so that the estimates favor recent
+//activity.
+type frequencySketch struct {
+	seeds      [4]maphash.Seed
+	rows       [4][]uint32
+	mask       uint64
+	increments int
+	resetAfter int
+}
+
+func newFrequencySketch(limit int) frequencySketch {
+	width := 16
+	for width < 4*limit {
+		width *= 2
+	}
+	s := frequencySketch{
+		mask:       uint64(width - 1),
+		resetAfter: 10 * width,
+	}
+	for idx := range s.rows {
+		s.seeds[idx] = maphash.MakeSeed()
+		s.rows[idx] = make([]uint32, width)
+	}
+	return s
+}
+
+//indexes computes the counter index for the given key in each row, using an
+//independent hash function for each row.
+func (s *frequencySketch) indexes(key string) (result [4]uint64) {
+	for idx := range result {
+		result[idx] = maphash.String(s.seeds[idx], key) & s.mask
+	}
+	return result
+}
+
+func (s *frequencySketch) estimate(key string) uint32 {
+	var result uint32
+	for row, idx := range s.indexes(key) {
+		if row == 0 || s.rows[row][idx] < result {
+			result = s.rows[row][idx]
+		}
+	}
+	return result
+}
+
+//increment records an occurrence of the given key and returns the new
+//estimate for it.
+func (s *frequencySketch) increment(key string) uint32 {
+	s.increments++
+	if s.increments >= s.resetAfter {
+		for _, row := range s.rows {
+			for idx := range row {
+				row[idx] /= 2
+			}
+		}
+		s.increments = 0
+	}
+	var result uint32
+	for row, idx := range s.indexes(key) {
+		s.rows[row][idx]++
+		if row == 0 || s.rows[row][idx] < result {
+			result = s.rows[row][idx]
+		}
+	}
+	return result
+}
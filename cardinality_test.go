@@ -0,0 +1,160 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_CardinalityLimiter(t *testing.T) {
+	tt := TT{t}
+
+	l := NewCardinalityLimiter(2)
+	admit := func(key string, count int) (tracked bool, evicted string) {
+		for range count {
+			tracked, evicted = l.admit(key)
+		}
+		return tracked, evicted
+	}
+	admit("a", 3)
+	admit("b", 5)
+
+	//a new key is only tracked once it is more frequent than the least
+	//frequent tracked key
+	tracked, evicted := admit("c", 3)
+	if tracked || evicted != "" {
+		t.Errorf("expected c to be aggregated, got tracked = %t, evicted = %q", tracked, evicted)
+	}
+	tracked, evicted = admit("c", 1)
+	if !tracked || evicted != "a" {
+		t.Errorf("expected c to evict a, got tracked = %t, evicted = %q", tracked, evicted)
+	}
+	expected := CardinalityStats{Limit: 2, Tracked: 2, Overflows: 3, Evictions: 1}
+	if actual := l.Stats(); actual != expected {
+		tt.Unexpected("stats", expected, actual)
+	}
+
+	//the frequency sketch halves its counters periodically, so that keys that
+	//were frequent a long time ago can be evicted by keys that are frequent now
+	sketch := newFrequencySketch(2)
+	for range sketch.resetAfter - 1 {
+		sketch.increment("a")
+	}
+	if estimate := sketch.increment("a"); estimate != uint32(sketch.resetAfter/2) {
+		tt.Unexpected("estimate after aging", sketch.resetAfter/2, estimate)
+	}
+}
+
+func Test_FingerprintStatsWithLimiter(t *testing.T) {
+	tt := TT{t}
+
+	s := NewFingerprintStats(10 * time.Millisecond)
+	s.Limiter = NewCardinalityLimiter(1)
+	hook := s.Hooks().AfterQueryHook
+	for range 3 {
+		hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 1`, Duration: time.Millisecond, Rows: 1})
+	}
+	//statements with a new fingerprint are aggregated until they are more
+	//frequent than the tracked one, which is then aggregated as well
+	for range 4 {
+		hook(QueryEvent{Query: `SELECT * FROM groups`, Duration: 20 * time.Millisecond, Rows: 10})
+	}
+
+	buckets := []time.Duration{10 * time.Millisecond}
+	expected := []LatencyHistogram{
+		{
+			Fingerprint: `SELECT * FROM groups`,
+			Count:       1,
+			Sum:         20 * time.Millisecond,
+			Rows:        10,
+			Buckets:     buckets,
+			Counts:      []uint64{0, 1},
+			RowBuckets:  DefaultRowBuckets,
+			RowCounts:   []uint64{0, 0, 1, 0, 0, 0, 0, 0},
+			MaxRows:     10,
+		},
+		{
+			Fingerprint: OtherFingerprint,
+			Count:       6,
+			Sum:         63 * time.Millisecond,
+			Rows:        33,
+			Buckets:     buckets,
+			Counts:      []uint64{3, 3},
+			RowBuckets:  DefaultRowBuckets,
+			RowCounts:   []uint64{0, 3, 3, 0, 0, 0, 0, 0},
+			MaxRows:     10,
+		},
+	}
+	actual := s.Stats()
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("stats", expected, actual)
+	}
+
+	//Reset() also forgets which fingerprints were tracked
+	s.Reset()
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 2`})
+	if actual := s.Stats(); len(actual) != 1 || actual[0].Fingerprint != `SELECT * FROM users WHERE id = ?` {
+		t.Errorf("unexpected stats after Reset(): %#v", actual)
+	}
+}
+
+func Test_FingerprintStatsWithLimiterAndTenants(t *testing.T) {
+	tt := TT{t}
+
+	//the limit applies to fingerprints, not to combinations of tenant and
+	//fingerprint
+	s := NewFingerprintStats()
+	s.Limiter = NewCardinalityLimiter(1)
+	hook := s.Hooks().AfterQueryHook
+	hook(QueryEvent{Query: `SELECT * FROM users`, Tenant: "acme"})
+	hook(QueryEvent{Query: `SELECT * FROM users`, Tenant: "globex"})
+	for range 3 {
+		hook(QueryEvent{Query: `SELECT * FROM groups`, Tenant: "acme"})
+	}
+
+	//when a fingerprint is evicted, it is aggregated for all tenants
+	var actual []string
+	for _, h := range s.Stats() {
+		actual = append(actual, fmt.Sprintf("%s: %s (%d calls)", h.Tenant, h.Fingerprint, h.Count))
+	}
+	sort.Strings(actual)
+	expected := []string{
+		"acme: SELECT * FROM groups (1 calls)",
+		"acme: other (3 calls)",
+		"globex: other (1 calls)",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("stats", expected, actual)
+	}
+}
+
+func Test_StatsdSinkWithLimiter(t *testing.T) {
+	sink := &StatsdSink{DogStatsD: true, FingerprintTags: true, Limiter: NewCardinalityLimiter(1), prefix: "test"}
+	sink.format(QueryEvent{Query: `SELECT * FROM users`})
+	packet := sink.format(QueryEvent{Query: `SELECT * FROM groups`})
+	if !strings.Contains(packet, "|#type:select,fingerprint:other\n") {
+		t.Errorf("expected fingerprint to be aggregated, got %q", packet)
+	}
+}
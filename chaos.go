@@ -0,0 +1,168 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sync"
+)
+
+//Chaos makes a Driver randomly simulate broken connections, to exercise the
+//retry logic of database/sql and the transaction retry logic of the
+//application. For example:
+//
+//	chaos := sqlproxy.NewChaos(42)
+//	chaos.BadConnRate = 0.05
+//	chaos.BeginFailureRate = 0.05
+//	chaos.TransactionKillRate = 0.01
+//	sql.Register("postgres-chaos", sqlproxy.New("postgres", sqlproxy.WithChaos(chaos)))
+//
+//All random decisions are drawn from a single random number generator with the
+//given seed, so a single-threaded test run can be reproduced by using the same
+//seed again. (With concurrent statements, the order in which they draw from
+//the generator is not deterministic.) To find out where a reproduction
+//diverges from the original run, both can write their decisions to a
+//DecisionLog. A Chaos that is not created by NewChaos() (e.g.
+//&sqlproxy.Chaos{BadConnRate: 0.1}) uses a random seed, which can be obtained
+//from Seed(). The exported fields must not be changed after the Chaos has been
+//given to a Driver.
+type Chaos struct {
+	//BadConnRate is the probability between 0 and 1 with which a statement
+	//outside of a transaction fails with driver.ErrBadConn before it is sent
+	//to the database. The database/sql package usually retries such
+	//statements on another connection.
+	BadConnRate float64
+	//BeginFailureRate is the probability between 0 and 1 with which starting
+	//a transaction fails with driver.ErrBadConn.
+	BeginFailureRate float64
+	//TransactionKillRate is the probability between 0 and 1 with which a
+	//statement inside a transaction finds that its connection was closed by
+	//the server. The transaction is rolled back, and the statement and all
+	//further operations on the connection (including Commit) fail with
+	//driver.ErrBadConn. Since database/sql does not retry inside
+	//transactions, this error reaches the application.
+	TransactionKillRate float64
+	//DecisionLog (optional) receives one line for each random decision, e.g.
+	//"3: chaos BadConnRate=0.05 roll=0.012345 fail=true".
+	DecisionLog io.Writer
+
+	random     *seededRandom
+	randomOnce sync.Once
+}
+
+//NewChaos returns a Chaos with all rates set to zero, whose random decisions
+//are drawn from a random number generator with the given seed.
+func NewChaos(seed uint64) *Chaos {
+	return &Chaos{random: newSeededRandom(seed)}
+}
+
+//Seed returns the seed that was given to NewChaos(), or the random seed that
+//was chosen for a Chaos that was not created by NewChaos().
+func (c *Chaos) Seed() uint64 {
+	return c.rng().seed
+}
+
+//rng returns the random number generator, and creates it with a random seed
+//if the Chaos was not created by NewChaos().
+func (c *Chaos) rng() *seededRandom {
+	c.randomOnce.Do(func() {
+		if c.random == nil {
+			c.random = newSeededRandom(rand.Uint64())
+		}
+	})
+	return c.random
+}
+
+//roll returns true with the given probability. The name of the rate is used
+//in the decision log.
+func (c *Chaos) roll(rateName string, probability float64) (result bool) {
+	if probability <= 0 {
+		return false
+	}
+	c.rng().decide(c.DecisionLog, func(rng *rand.Rand) string {
+		value := rng.Float64()
+		result = value < probability
+		return fmt.Sprintf("chaos %s=%g roll=%.6f fail=%t", rateName, probability, value, result)
+	})
+	return result
+}
+
+//checkChaosOnBegin returns driver.ErrBadConn if Driver.Chaos decides that the
+//connection shall fail to start a transaction, or if Driver.ChaosSchedule has
+//killed it.
+func (c *connection) checkChaosOnBegin() error {
+	if err := c.checkChaosSchedule(); err != nil {
+		return err
+	}
+	chaos := c.driver.Chaos
+	if c.killed || (chaos != nil && chaos.roll("BeginFailureRate", chaos.BeginFailureRate)) {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+//checkChaos returns driver.ErrBadConn if Driver.Chaos decides that the
+//connection shall appear broken before executing a statement, or if
+//Driver.ChaosSchedule has killed it.
+func (c *connection) checkChaos() error {
+	if err := c.checkChaosSchedule(); err != nil {
+		return err
+	}
+	chaos := c.driver.Chaos
+	switch {
+	case c.killed:
+		return driver.ErrBadConn
+	case chaos == nil:
+		return nil
+	case c.tx == nil:
+		if chaos.roll("BadConnRate", chaos.BadConnRate) {
+			return driver.ErrBadConn
+		}
+		return nil
+	default:
+		if chaos.roll("TransactionKillRate", chaos.TransactionKillRate) {
+			c.killTransaction()
+			return driver.ErrBadConn
+		}
+		return nil
+	}
+}
+
+//killTransaction simulates the server closing the connection during a
+//transaction: All changes made by the transaction are discarded, and the
+//connection is unusable from now on.
+func (c *connection) killTransaction() {
+	c.killed = true
+	c.bad = true
+	//errors are ignored since there is nobody to report them to; the
+	//connection is discarded by database/sql either way
+	c.tx.tx.Rollback()
+	c.tx.tx = killedTx{}
+}
+
+//killedTx replaces the proxied transaction of a connection that was killed by
+//Chaos.
+type killedTx struct{}
+
+func (killedTx) Commit() error   { return driver.ErrBadConn }
+func (killedTx) Rollback() error { return driver.ErrBadConn }
@@ -0,0 +1,128 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ChaosBadConn(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	chaos := NewChaos(1)
+	chaos.BadConnRate = 1
+	chaos.BeginFailureRate = 1
+	connects := 0
+	d := New("sqlite3", WithChaos(chaos), WithAfterConnect(func(_ time.Duration, _ error) { connects++ }))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER)`)
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+	if connects < 2 {
+		t.Errorf("expected database/sql to retry on a new connection, but only %d connections were opened", connects)
+	}
+	_, err = db.Begin()
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("expected ErrBadConn from Begin, got %v", err)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_ChaosZeroValue(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	//a Chaos that was not created by NewChaos gets a random seed
+	var decisions bytes.Buffer
+	chaos := &Chaos{BadConnRate: 1, DecisionLog: &decisions}
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithChaos(chaos)), "file:"+sqliteFile))
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER)`)
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("expected ErrBadConn, got %v", err)
+	}
+	if !strings.HasPrefix(decisions.String(), "1: chaos BadConnRate=1 ") {
+		t.Errorf("unexpected decision log: %q", decisions.String())
+	}
+
+	//the random seed is reported for reproducing the run
+	if seed := chaos.Seed(); seed != chaos.Seed() {
+		t.Errorf("expected Seed() to be stable, got %d and %d", seed, chaos.Seed())
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_ChaosTransactionKill(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	chaos := NewChaos(1)
+	chaos.TransactionKillRate = 1
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithChaos(chaos)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER)`))
+
+	tx, err := db.Begin()
+	tt.Must(err)
+	_, err = tx.Exec(`INSERT INTO users (id) VALUES (1)`)
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("expected ErrBadConn inside transaction, got %v", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("expected Commit to fail after the connection was killed")
+	}
+
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count))
+	if count != 0 {
+		t.Errorf("expected killed transaction to be rolled back, but found %d rows", count)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_ChaosIsReproducible(t *testing.T) {
+	a, b := NewChaos(42), NewChaos(42)
+	var logA, logB bytes.Buffer
+	a.DecisionLog, b.DecisionLog = &logA, &logB
+	for idx := range 100 {
+		if a.roll("test", 0.5) != b.roll("test", 0.5) {
+			t.Fatalf("Chaos instances with the same seed diverged after %d rolls", idx)
+		}
+	}
+	if a.Seed() != 42 {
+		TT{t}.Unexpected("seed", uint64(42), a.Seed())
+	}
+	if logA.String() != logB.String() || !strings.HasPrefix(logA.String(), "1: chaos test=0.5 roll=") {
+		t.Errorf("unexpected decision logs:\n%s\n%s", logA.String(), logB.String())
+	}
+}
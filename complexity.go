@@ -0,0 +1,188 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+//QueryComplexity is the result of AnalyzeComplexity().
+type QueryComplexity struct {
+	//Joins counts explicit JOINs, as well as comma-separated tables in a FROM
+	//clause that are restricted by a WHERE clause.
+	Joins int
+	//Subqueries counts SELECT statements in parentheses (including CTEs).
+	Subqueries int
+	//MissingWhere counts SELECT statements with a FROM clause, as well as
+	//UPDATE and DELETE statements, that do not have a WHERE clause.
+	MissingWhere int
+	//CartesianProducts counts CROSS JOINs, as well as comma-separated tables
+	//in a FROM clause that are not restricted by a WHERE clause.
+	CartesianProducts int
+}
+
+//Score combines the counts in this QueryComplexity into a single number.
+//Each join counts 2 points, each subquery 3 points, each missing WHERE clause
+//5 points and each cartesian product 10 points.
+func (c QueryComplexity) Score() int {
+	return 2*c.Joins + 3*c.Subqueries + 5*c.MissingWhere + 10*c.CartesianProducts
+}
+
+//complexityScope is a statement (or the contents of a pair of parentheses)
+//within AnalyzeComplexity().
+type complexityScope struct {
+	statementType string //"SELECT", "UPDATE", "DELETE" or empty
+	inFrom        bool
+	hasFrom       bool
+	hasWhere      bool
+	fromCommas    int
+}
+
+//keywords that end a FROM clause
+var fromClauseEnd = map[string]bool{
+	"WHERE": true, "GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true,
+	"OFFSET": true, "FETCH": true, "FOR": true, "WINDOW": true, "UNION": true,
+	"INTERSECT": true, "EXCEPT": true, "RETURNING": true, "ON": true, "USING": true,
+	"SET": true,
+}
+
+//keywords before UPDATE or DELETE that do not start a statement, as in
+//"FOR UPDATE", "FOR NO KEY UPDATE", "ON DELETE CASCADE" or "DO UPDATE"
+var nonStatementPrefix = map[string]bool{"FOR": true, "KEY": true, "ON": true, "DO": true}
+
+//AnalyzeComplexity estimates how expensive a statement is likely to be, based
+//on the number of joins, subqueries, missing WHERE clauses and cartesian
+//products. Like Normalize(), this is a heuristic that works on the query
+//string only, without knowledge of the schema or the data.
+func AnalyzeComplexity(query string) QueryComplexity {
+	var (
+		result QueryComplexity
+		tokens = tokenizeSQL(query)
+		scopes = []*complexityScope{{}}
+	)
+	finish := func(s *complexityScope) {
+		switch s.statementType {
+		case "SELECT":
+			if s.hasFrom && !s.hasWhere {
+				result.MissingWhere++
+			}
+		case "UPDATE", "DELETE":
+			if !s.hasWhere {
+				result.MissingWhere++
+			}
+		}
+		if s.hasWhere {
+			result.Joins += s.fromCommas
+		} else {
+			result.CartesianProducts += s.fromCommas
+		}
+		*s = complexityScope{}
+	}
+
+	previousKeyword := ""
+	for idx, token := range tokens {
+		scope := scopes[len(scopes)-1]
+		switch token.kind {
+		case sqlTokenPunctuation:
+			switch token.text {
+			case "(":
+				scopes = append(scopes, &complexityScope{})
+			case ")":
+				if len(scopes) > 1 {
+					finish(scope)
+					scopes = scopes[:len(scopes)-1]
+				}
+			case ",":
+				if scope.inFrom {
+					scope.fromCommas++
+				}
+			}
+			previousKeyword = ""
+			continue
+		case sqlTokenWord:
+		default:
+			previousKeyword = ""
+			continue
+		}
+
+		keyword := strings.ToUpper(token.text)
+		switch {
+		case keyword == "SELECT" || ((keyword == "UPDATE" || keyword == "DELETE") && !nonStatementPrefix[previousKeyword]):
+			if scope.statementType != "" {
+				finish(scope)
+			}
+			scope.statementType = keyword
+			scope.inFrom = keyword == "UPDATE"
+			if keyword == "SELECT" && idx > 0 && tokens[idx-1].text == "(" {
+				result.Subqueries++
+			}
+		case keyword == "FROM":
+			if scope.statementType != "" {
+				scope.inFrom = true
+				scope.hasFrom = true
+			}
+		case keyword == "JOIN":
+			if previousKeyword == "CROSS" {
+				result.CartesianProducts++
+			} else {
+				result.Joins++
+			}
+		default:
+			if fromClauseEnd[keyword] {
+				scope.inFrom = false
+			}
+			if keyword == "WHERE" {
+				scope.hasWhere = true
+			}
+		}
+		previousKeyword = keyword
+	}
+	for idx := len(scopes) - 1; idx >= 0; idx-- {
+		finish(scopes[idx])
+	}
+	return result
+}
+
+//WithMaintenance returns a context that exempts statements from
+//Driver.MaxComplexity, e.g. for reporting jobs or migrations. It does not
+//exempt statements from Driver.RowSecurity; use WithoutRowSecurity() for that.
+func WithMaintenance(ctx context.Context) context.Context {
+	return context.WithValue(ctx, maintenanceKey{}, true)
+}
+
+type maintenanceKey struct{}
+
+//checkComplexity implements Driver.MaxComplexity.
+func (c *connection) checkComplexity(ctx context.Context, query string) error {
+	if c.driver.MaxComplexity <= 0 {
+		return nil
+	}
+	if isMaintenance, _ := ctx.Value(maintenanceKey{}).(bool); isMaintenance {
+		return nil
+	}
+	score := AnalyzeComplexity(query).Score()
+	if score <= c.driver.MaxComplexity {
+		return nil
+	}
+	reason := fmt.Sprintf("complexity score %d exceeds limit %d", score, c.driver.MaxComplexity)
+	return PolicyError{Query: query, Reason: reason}
+}
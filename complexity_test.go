@@ -0,0 +1,83 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func Test_AnalyzeComplexity(t *testing.T) {
+	testCases := map[string]QueryComplexity{
+		`SELECT 1`:                                         {},
+		`SELECT * FROM users WHERE id = $1`:                {},
+		`SELECT * FROM users`:                              {MissingWhere: 1},
+		`SELECT * FROM users WHERE id = $1 FOR UPDATE`:     {},
+		`UPDATE users SET name = $1`:                       {MissingWhere: 1},
+		`DELETE FROM users WHERE id IN (SELECT id FROM t)`: {Subqueries: 1, MissingWhere: 1},
+		`SELECT count(*), extract(year from d) FROM users u JOIN groups g ON g.id = u.group_id LEFT JOIN t ON t.id = g.id WHERE u.id = $1`: {Joins: 2},
+		`SELECT * FROM users, groups WHERE users.group_id = groups.id`:                                                                     {Joins: 1},
+		`SELECT * FROM users, groups, t`:                                             {MissingWhere: 1, CartesianProducts: 2},
+		`SELECT * FROM users CROSS JOIN groups WHERE users.id = 1`:                   {CartesianProducts: 1},
+		`WITH x AS (SELECT * FROM users WHERE id > 5) SELECT * FROM x WHERE id < 10`: {Subqueries: 1},
+		`INSERT INTO t (a, b) VALUES ($1, $2) ON CONFLICT (a) DO UPDATE SET b = $2`:  {},
+	}
+	for query, expected := range testCases {
+		actual := AnalyzeComplexity(query)
+		if actual != expected {
+			TT{t}.Unexpected("complexity of "+query, expected, actual)
+		}
+	}
+
+	c := QueryComplexity{Joins: 1, Subqueries: 1, MissingWhere: 1, CartesianProducts: 1}
+	if c.Score() != 20 {
+		t.Errorf("expected score 20, got %d", c.Score())
+	}
+}
+
+func Test_MaxComplexity(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithMaxComplexity(4)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, 1, "alice"))
+
+	rows := tt.MustRows(db.Query(`SELECT * FROM users WHERE id = ?`, 1))
+	tt.Must(rows.Close())
+
+	query := `SELECT * FROM users a, users b`
+	_, err := db.Query(query)
+	var perr PolicyError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected PolicyError, got %#v", err)
+	}
+	if perr.Reason != "complexity score 15 exceeds limit 4" {
+		t.Errorf("unexpected reason: %q", perr.Reason)
+	}
+
+	rows = tt.MustRows(db.QueryContext(WithMaintenance(context.Background()), query))
+	tt.Must(rows.Close())
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
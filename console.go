@@ -0,0 +1,291 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//QueryConsole is an http.Handler with a small HTML form for running
+//read-only statements against a database and looking at their results and
+//query plans. On development and staging systems, this can replace handing
+//out database credentials to developers:
+//
+//	db := sql.OpenDB(sqlproxy.NewConnector(driver, dataSource))
+//	console := sqlproxy.NewQueryConsole(db)
+//	console.Authorize = func(r *http.Request) bool {
+//		user, password, ok := r.BasicAuth()
+//		return ok && user == "dev" && subtle.ConstantTimeCompare([]byte(password), devPassword) == 1
+//	}
+//	console.ExplainCommand = "EXPLAIN"
+//	http.Handle("/debug/sqlproxy/console", console)
+//
+//Statements are executed through the given sql.DB, so when it is opened
+//through a Driver, all of the Driver's guards (e.g. Driver.ReadOnly,
+//Driver.RowSecurity, Driver.MaxRows and blocking Rules) apply as usual, and
+//the statements show up in its hooks. On top of that, the console only
+//accepts statements for which IsReadOnlyStatement() is true, and runs them in
+//a read-only transaction that is always rolled back. (Some drivers, e.g.
+//mattn/go-sqlite3, ignore the read-only flag, so the first check is the only
+//one there.) Result sets are cut off after MaxRows rows, and the values of
+//sensitive columns are masked by the Redactor, if any. Since masking works by
+//result column name, statements that use masked columns in any other way than
+//selecting them as is (e.g. in expressions, with an alias, or in a WHERE
+//clause) are refused.
+//
+//The console refuses all requests unless Authorize is set. Statements are only
+//executed for same-origin requests, as indicated by the Sec-Fetch-Site or
+//Origin headers that browsers send, so that other websites cannot make the
+//developer's browser run statements through the console (cross-site request
+//forgery). Requests without these headers (e.g. from curl) are accepted. The exported fields
+//must not be changed while the handler is in use.
+type QueryConsole struct {
+	//Authorize decides whether the given request may use the console.
+	//Requests that are not authorized are answered with status 403.
+	Authorize func(r *http.Request) bool
+	//MaxRows is the number of rows that are shown for each statement. The
+	//default is 100.
+	MaxRows int
+	//Timeout limits how long each request may take. The default is 10
+	//seconds.
+	Timeout time.Duration
+	//ExplainCommand (optional) is prepended to the statement to show its
+	//query plan below the result, e.g. "EXPLAIN" (see Driver.ExplainCommand).
+	ExplainCommand string
+	//Redactor (optional) masks the values of sensitive columns in the result
+	//(see Redactor.RedactRow).
+	Redactor *Redactor
+
+	db *sql.DB
+}
+
+//NewQueryConsole returns a QueryConsole that executes statements through the
+//given database handle.
+func NewQueryConsole(db *sql.DB) *QueryConsole {
+	return &QueryConsole{db: db}
+}
+
+type queryConsoleResult struct {
+	Query     string
+	Columns   []string
+	Rows      [][]string
+	Truncated bool
+	Duration  time.Duration
+	Plan      string
+	Error     string
+}
+
+//ServeHTTP implements the http.Handler interface. GET requests show the
+//form, POST requests execute the statement in the form field "query".
+func (c *QueryConsole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.Authorize == nil || !c.Authorize(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var result queryConsoleResult
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		if isCrossOriginRequest(r) {
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
+		result.Query = strings.TrimSpace(r.PostFormValue("query"))
+		if result.Query != "" {
+			c.execute(r.Context(), &result)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	//prevent the result from being shown in frames on other sites
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Cache-Control", "no-store")
+	err := queryConsoleTemplate.Execute(w, result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+//isCrossOriginRequest returns whether the request was sent by a browser on
+//behalf of a different website.
+func isCrossOriginRequest(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "":
+		//older browser or not a browser, check Origin instead
+	case "same-origin", "none":
+		return false
+	default:
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+func (c *QueryConsole) execute(ctx context.Context, result *queryConsoleResult) {
+	if !IsReadOnlyStatement(result.Query) {
+		result.Error = "only read-only statements can be executed here"
+		return
+	}
+	if c.Redactor != nil {
+		if column := c.Redactor.unmaskableColumn(result.Query); column != "" {
+			result.Error = fmt.Sprintf("the values of column %s are masked, so it can only be selected as is", column)
+			return
+		}
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	//errors are ignored since the transaction did not change anything
+	defer tx.Rollback()
+
+	maxRows := c.MaxRows
+	if maxRows <= 0 {
+		maxRows = 100
+	}
+	startedAt := time.Now()
+	err = c.query(ctx, tx, result, maxRows)
+	result.Duration = time.Since(startedAt)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	if c.ExplainCommand != "" {
+		plan := queryConsoleResult{Query: c.ExplainCommand + " " + result.Query}
+		err := c.query(ctx, tx, &plan, 0)
+		if err != nil {
+			result.Plan = "cannot obtain query plan: " + err.Error()
+			return
+		}
+		lines := make([]string, len(plan.Rows))
+		for idx, row := range plan.Rows {
+			lines[idx] = strings.Join(row, " ")
+		}
+		result.Plan = strings.Join(lines, "\n")
+	}
+}
+
+//query executes result.Query and fills in its columns and rows. If maxRows is
+//positive, only that many rows are read.
+func (c *QueryConsole) query(ctx context.Context, tx *sql.Tx, result *queryConsoleResult, maxRows int) error {
+	rows, err := tx.QueryContext(ctx, result.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	result.Columns, err = rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(result.Columns))
+	pointers := make([]interface{}, len(values))
+	for idx := range values {
+		pointers[idx] = &values[idx]
+	}
+	for rows.Next() {
+		if maxRows > 0 && len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		err := rows.Scan(pointers...)
+		if err != nil {
+			return err
+		}
+		row := values
+		if c.Redactor != nil {
+			row = c.Redactor.RedactRow(result.Query, result.Columns, row)
+		}
+		fields := make([]string, len(row))
+		for idx, value := range row {
+			switch value := value.(type) {
+			case nil:
+				fields[idx] = "NULL"
+			case []byte:
+				fields[idx] = string(value)
+			default:
+				fields[idx] = fmt.Sprint(value)
+			}
+		}
+		result.Rows = append(result.Rows, fields)
+	}
+	return rows.Err()
+}
+
+var queryConsoleTemplate = template.Must(template.New("console").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>sqlproxy query console</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+textarea { width: 100%; font-family: monospace; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #999; padding: 0.2em 0.5em; font-family: monospace; white-space: pre; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<form method="post">
+<textarea name="query" rows="8" placeholder="SELECT ...">{{.Query}}</textarea>
+<button type="submit">Run (read-only)</button>
+</form>
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- else if .Columns}}
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+<p>{{len .Rows}} rows{{if .Truncated}} (more rows were cut off){{end}} in {{.Duration}}</p>
+{{- if .Plan}}
+<h2>Query plan</h2>
+<pre>{{.Plan}}</pre>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
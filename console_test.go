@@ -0,0 +1,149 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_QueryConsole(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var queries []string
+	d := New("sqlite3", WithAfterQuery(func(e QueryEvent) {
+		queries = append(queries, e.Query)
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER, name TEXT, password TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users VALUES (1, 'alice', 'secret'), (2, 'bob', NULL), (3, 'carol', 'hunter2')`))
+
+	console := NewQueryConsole(db)
+	console.MaxRows = 2
+	console.ExplainCommand = "EXPLAIN QUERY PLAN"
+	redactor, err := NewRedactor(RedactionRule{Columns: []string{"password"}})
+	tt.Must(err)
+	console.Redactor = redactor
+	var headers map[string]string
+	request := func(method string, query string) *httptest.ResponseRecorder {
+		var r *http.Request
+		if method == http.MethodPost {
+			r = httptest.NewRequest(method, "/console", strings.NewReader(url.Values{"query": {query}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(method, "/console", nil)
+		}
+		r.SetBasicAuth("dev", "swordfish")
+		for key, value := range headers {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		console.ServeHTTP(w, r)
+		return w
+	}
+
+	//without Authorize, everything is refused
+	if w := request(http.MethodGet, ""); w.Code != http.StatusForbidden {
+		tt.Unexpected("status without Authorize", http.StatusForbidden, w.Code)
+	}
+	console.Authorize = func(r *http.Request) bool {
+		_, password, ok := r.BasicAuth()
+		return ok && password == "swordfish"
+	}
+	if w := request(http.MethodGet, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post">`) {
+		t.Errorf("unexpected response to GET: %d %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodDelete, ""); w.Code != http.StatusMethodNotAllowed {
+		tt.Unexpected("status for DELETE", http.StatusMethodNotAllowed, w.Code)
+	}
+
+	//results are cut off and masked, and the plan is shown
+	queries = nil
+	body := request(http.MethodPost, `SELECT id, name, password FROM users ORDER BY id`).Body.String()
+	for _, expected := range []string{
+		`<tr><th>id</th><th>name</th><th>password</th></tr>`,
+		`<tr><td>1</td><td>alice</td><td>[REDACTED]</td></tr>`,
+		`<tr><td>2</td><td>bob</td><td>[REDACTED]</td></tr>`,
+		`2 rows (more rows were cut off)`,
+		`<h2>Query plan</h2>`,
+		`SCAN users`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in response, got %s", expected, body)
+		}
+	}
+	if strings.Contains(body, "carol") || strings.Contains(body, "secret") {
+		t.Errorf("unexpected row or value in response: %s", body)
+	}
+	//the statements went through the proxy
+	if len(queries) != 2 || queries[1] != `EXPLAIN QUERY PLAN SELECT id, name, password FROM users ORDER BY id` {
+		t.Errorf("unexpected queries: %#v", queries)
+	}
+
+	//writes are refused, and query text is escaped
+	body = request(http.MethodPost, `DELETE FROM users WHERE name = '<b>'`).Body.String()
+	if !strings.Contains(body, "only read-only statements can be executed here") || !strings.Contains(body, "&lt;b&gt;") {
+		t.Errorf("expected write to be refused, got %s", body)
+	}
+	//masked columns cannot be used in expressions etc.
+	body = request(http.MethodPost, `SELECT upper(password) AS name FROM users`).Body.String()
+	if !strings.Contains(body, "the values of column password are masked, so it can only be selected as is") || strings.Contains(body, "SECRET") {
+		t.Errorf("expected masking bypass to be refused, got %s", body)
+	}
+	body = request(http.MethodPost, `SELECT * FROM nonexistent`).Body.String()
+	if !strings.Contains(body, `<p class="error">no such table: nonexistent</p>`) {
+		t.Errorf("expected error in response, got %s", body)
+	}
+	//cross-origin requests from browsers are refused
+	for _, h := range []map[string]string{
+		{"Sec-Fetch-Site": "cross-site"},
+		{"Sec-Fetch-Site": "same-site"},
+		{"Origin": "https://evil.example.com"},
+	} {
+		headers = h
+		if w := request(http.MethodPost, `SELECT pg_sleep(3600)`); w.Code != http.StatusForbidden {
+			tt.Unexpected(fmt.Sprintf("status for POST with %v", h), http.StatusForbidden, w.Code)
+		}
+	}
+	for _, h := range []map[string]string{
+		{"Sec-Fetch-Site": "same-origin"},
+		{"Origin": "http://example.com"}, //the host of httptest.NewRequest
+	} {
+		headers = h
+		if w := request(http.MethodPost, `SELECT 1`); w.Code != http.StatusOK {
+			tt.Unexpected(fmt.Sprintf("status for POST with %v", h), http.StatusOK, w.Code)
+		}
+	}
+
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count))
+	if count != 3 {
+		tt.Unexpected("number of users", 3, count)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
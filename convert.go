@@ -0,0 +1,140 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+)
+
+//ConvertValue converts an argument value into a driver.Value in the same way
+//as database/sql does for drivers that do not bring their own conversions.
+//Values implementing driver.Valuer are asked to convert themselves (where nil
+//pointers of types with value-receiver Value methods become NULL), and values
+//of other types are converted with driver.DefaultParameterConverter.
+//
+//This can be used in hooks that need to handle arguments from outside of
+//database/sql in the same way as the proxy does.
+func ConvertValue(v interface{}) (driver.Value, error) {
+	if vr, ok := v.(driver.Valuer); ok {
+		sv, err := callValuerValue(vr)
+		if err != nil {
+			return nil, err
+		}
+		if !driver.IsValue(sv) {
+			return nil, fmt.Errorf("non-subset type %T returned from Value", sv)
+		}
+		return sv, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+//Usually, database/sql converts arguments before they reach the proxy, using
+//the checkers and converters of the proxied driver (the proxy delegates
+//CheckNamedValue and ColumnConverter to the proxied driver). But when the
+//proxy has to prepare a statement on its own (because the proxied driver
+//rejected the fast path for a one-off statement with driver.ErrSkip), the
+//statement's own checks have not been applied yet. convertArgs does that, in
+//the same order as database/sql would when using the proxied driver directly.
+func convertArgs(conn driver.Conn, stmt driver.Stmt, args []driver.NamedValue) ([]driver.NamedValue, error) {
+	nvc, hasNVC := stmt.(driver.NamedValueChecker)
+	if !hasNVC {
+		nvc, hasNVC = conn.(driver.NamedValueChecker)
+	}
+	cc, hasCC := stmt.(driver.ColumnConverter)
+	want := stmt.NumInput()
+
+	result := make([]driver.NamedValue, 0, len(args))
+	for _, arg := range args {
+		nv := arg
+		err := driver.ErrSkip
+		if hasNVC {
+			err = nvc.CheckNamedValue(&nv)
+		}
+		if err == driver.ErrSkip && hasCC {
+			err = checkWithColumnConverter(cc, want, &nv)
+		}
+		if err == driver.ErrSkip {
+			nv.Value, err = ConvertValue(nv.Value)
+		}
+
+		switch err {
+		case nil:
+			result = append(result, nv)
+		case driver.ErrRemoveArgument:
+			continue
+		default:
+			return nil, fmt.Errorf("sql: converting argument %s type: %w", describeNamedValue(nv), err)
+		}
+	}
+
+	if want != -1 && len(result) != want {
+		return nil, fmt.Errorf("sql: expected %d arguments, got %d", want, len(result))
+	}
+	return result, nil
+}
+
+func checkWithColumnConverter(cc driver.ColumnConverter, want int, nv *driver.NamedValue) error {
+	//like in database/sql, the column converter is not consulted for
+	//arguments that the statement does not expect
+	index := nv.Ordinal - 1
+	if want >= 0 && want <= index {
+		return nil
+	}
+
+	if _, ok := nv.Value.(driver.Valuer); ok {
+		sv, err := ConvertValue(nv.Value)
+		if err != nil {
+			return err
+		}
+		nv.Value = sv
+	}
+
+	arg := nv.Value
+	var err error
+	nv.Value, err = cc.ColumnConverter(index).ConvertValue(arg)
+	if err != nil {
+		return err
+	}
+	if !driver.IsValue(nv.Value) {
+		return fmt.Errorf("driver ColumnConverter error converted %T to unsupported type %T", arg, nv.Value)
+	}
+	return nil
+}
+
+//callValuerValue returns vr.Value(), but treats a nil pointer whose Value
+//method has a value receiver as NULL instead of panicking, like database/sql.
+func callValuerValue(vr driver.Valuer) (driver.Value, error) {
+	if rv := reflect.ValueOf(vr); rv.Kind() == reflect.Pointer && rv.IsNil() &&
+		rv.Type().Elem().Implements(valuerReflectType) {
+		return nil, nil
+	}
+	return vr.Value()
+}
+
+var valuerReflectType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+func describeNamedValue(nv driver.NamedValue) string {
+	if nv.Name == "" {
+		return fmt.Sprintf("$%d", nv.Ordinal)
+	}
+	return fmt.Sprintf("with name %q", nv.Name)
+}
@@ -0,0 +1,116 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//point is a custom type that is stored as a string like "1,2".
+type point struct {
+	X, Y int
+}
+
+//Value implements the driver.Valuer interface.
+func (p point) Value() (driver.Value, error) {
+	return fmt.Sprintf("%d,%d", p.X, p.Y), nil
+}
+
+//Scan implements the sql.Scanner interface.
+func (p *point) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return fmt.Errorf("cannot scan %T into point", src)
+	}
+	_, err := fmt.Sscanf(strings.TrimSpace(s), "%d,%d", &p.X, &p.Y)
+	return err
+}
+
+func Test_ConvertValue(t *testing.T) {
+	tt := TT{t}
+	var nilPoint *point
+
+	testCases := []struct {
+		Input    interface{}
+		Expected driver.Value
+	}{
+		{int16(42), int64(42)},
+		{"truth", "truth"},
+		{point{1, 2}, "1,2"},
+		{nilPoint, nil},
+		{sql.NullInt64{}, nil},
+		{sql.NullInt64{Int64: 5, Valid: true}, int64(5)},
+	}
+	for _, tc := range testCases {
+		actual, err := ConvertValue(tc.Input)
+		tt.Must(err)
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			tt.Unexpected(fmt.Sprintf("ConvertValue(%#v)", tc.Input), tc.Expected, actual)
+		}
+	}
+
+	_, err := ConvertValue(struct{}{})
+	if err == nil {
+		t.Error("expected ConvertValue to reject struct{}{}")
+	}
+}
+
+//Test_ValuerScannerRoundTrip tests that custom Valuer and Scanner types,
+//including NULL values, behave identically with and without the proxy.
+func Test_ValuerScannerRoundTrip(t *testing.T) {
+	tt := TT{t}
+	var nilPoint *point
+
+	tt.ForeachDB("+nothing", func(db *sql.DB) {
+		tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ($1, $2)`, 1, point{3, 4}))
+		tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ($1, $2)`, 2, nilPoint))
+		tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ($1, $2)`, sql.NullInt64{}, sql.NullString{String: "void", Valid: true}))
+
+		var p point
+		tt.Must(db.QueryRow(`SELECT thing FROM knowledge WHERE number = $1`, 1).Scan(&p))
+		if p != (point{3, 4}) {
+			tt.Unexpected("p", point{3, 4}, p)
+		}
+
+		var s sql.NullString
+		tt.Must(db.QueryRow(`SELECT thing FROM knowledge WHERE number = $1`, 2).Scan(&s))
+		if s.Valid {
+			tt.Unexpected("s", sql.NullString{}, s)
+		}
+
+		var n sql.NullInt64
+		tt.Must(db.QueryRow(`SELECT number FROM knowledge WHERE thing = $1`, "void").Scan(&n))
+		if n.Valid {
+			tt.Unexpected("n", sql.NullInt64{}, n)
+		}
+	})
+
+	tt.CleanupDB()
+}
@@ -25,29 +25,38 @@ SQL driver. For example, to augment a PostgreSQL driver with statement logging:
 	//this assumes that a "postgresql" driver is already registered
 	sql.Register("postgres-with-logging", &sqlproxy.Driver {
 		ProxiedDriverName: "postgresql",
-		BeforeQueryHook: func(query string, args[]interface{}) {
-			log.Printf("SQL: %s %#v", query, args)
+		Hooks: sqlproxy.Hooks{
+			BeforeQueryHook: func(query string, args[]interface{}) {
+				log.Printf("SQL: %s %#v", query, args)
+			},
 		},
 	})
 
 There's also a BeforePrepareHook that can be used to reject or edit query
-strings.
+strings, and several other hooks (see type Hooks). Hooks can be replaced at
+runtime with Driver.SetHooks() and Driver.UpdateHooks().
 
 Caveats
 
 Do not use this code on production databases. This package is intended for
 development purposes only, and access to it should remain behind a debugging
-switch. It only implements the bare necessities of the database/sql driver
-interface and hides optimizations and advanced features of the proxied SQL
-driver.
+switch. Not all optional interfaces of the database/sql driver API are passed
+through, so some optimizations and advanced features of the proxied SQL driver
+may not be available through the proxy.
 
 */
 package sqlproxy
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"io"
+	"reflect"
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -59,56 +68,954 @@ type Driver struct {
 	//ProxiedDriverName identifies the SQL driver which will be used to actually
 	//perform SQL queries.
 	ProxiedDriverName string
-	//BeforePrepareHook (optional) runs just before a query is prepared (both for
-	//explicit Prepare() calls and one-off queries). The return value will be
-	//substituted for the original query string, allowing the hook to rewrite
-	//queries arbitrarily. If an error is returned, it will be propagated to the
-	//caller of db.Prepare() or tx.Prepare() etc.
+	//ProxiedDriver can be given instead of ProxiedDriverName to proxy a driver
+	//that has not been registered with sql.Register(). If both are given,
+	//ProxiedDriver takes precedence.
+	ProxiedDriver driver.Driver
+	//Hooks contains the hooks that are called when statements are executed
+	//etc. The hooks can be replaced at runtime with SetHooks() or
+	//UpdateHooks(), even while statements are being executed concurrently.
+	Hooks
+	//BeforePrepareHook is the predecessor of Hooks.BeforePrepareHook, and is
+	//kept so that Driver literals from before type Hooks existed still
+	//compile. If both are set, this one runs first and the other one receives
+	//its result.
+	//
+	//Deprecated: Use Hooks.BeforePrepareHook instead.
 	BeforePrepareHook func(query string) (string, error)
-	//BeforeQueryHook (optional) runs just before a query is executed, e.g. by
-	//the Exec(), Query() or QueryRows() methods of sql.DB, sql.Tx and sql.Stmt.
+	//BeforeQueryHook is the predecessor of Hooks.BeforeQueryHook, and is kept
+	//so that Driver literals from before type Hooks existed still compile. If
+	//both are set, this one runs first.
+	//
+	//Deprecated: Use Hooks.BeforeQueryHook instead.
 	BeforeQueryHook func(query string, args []interface{})
+	//SlowQueryThreshold (optional) enables reporting of slow statements. Each
+	//statement whose QueryEvent.Duration exceeds this threshold is given to
+	//the SlowQueryHook, or logged through log/slog if no SlowQueryHook is set.
+	SlowQueryThreshold time.Duration
+	//RedactSlowQueryArgs (optional) causes the default logging of slow
+	//statements to omit the statements' arguments, e.g. because they could
+	//contain personal data. This does not affect the SlowQueryHook.
+	RedactSlowQueryArgs bool
+	//ExplainCommand (optional) is prepended to slow SELECT statements (see
+	//SlowQueryThreshold) to obtain their query plan, e.g. "EXPLAIN" or
+	//"EXPLAIN ANALYZE" for PostgreSQL, or "EXPLAIN QUERY PLAN" for SQLite. The
+	//statement is re-run with the same (unredacted) arguments on the same
+	//connection (which may be a replica), and the plan is given to the
+	//ExplainHook, or logged through log/slog if no ExplainHook is set.
+	//Statements answered by an InterceptHook or DryRun are not explained.
+	ExplainCommand string
+	//ProfilerLabels (optional) enables pprof labels for statement execution.
+	//While the proxied driver executes a statement, the executing goroutine
+	//carries the label "sql_fingerprint" with the statement's fingerprint (see
+	//Normalize), such that CPU and goroutine profiles attribute time spent in
+	//the proxied driver to specific statements. Time spent reading the rows
+	//of a result set is not labelled.
+	ProfilerLabels bool
+	//CaptureCaller (optional) enables caller attribution. For each statement,
+	//the first stack frame outside of database/sql and this package is
+	//recorded in QueryEvent.Caller and included in all log messages produced
+	//by this package. This costs a stack walk per statement.
+	CaptureCaller bool
+	//CountTables (optional) enables per-table statistics. The tables that each
+	//successful statement reads from or writes to are guessed from its query
+	//string (see ExtractTables), and counted in DriverStats.Tables. This answers the question which
+	//tables an application actually uses, e.g. when tightening database
+	//permissions.
+	CountTables bool
+	//ListTables (optional) fills QueryEvent.Tables with the tables that each
+	//statement refers to (see ExtractTables and TableExtractor), e.g. for
+	//cache invalidation or authorization in hooks.
+	ListTables bool
+	//Placeholders (optional) is the placeholder style that the proxied driver
+	//understands. When set, placeholders of all other styles are translated
+	//into this style (after the BeforePrepareHook), and the arguments are
+	//rearranged accordingly. This allows e.g. code written with "?"
+	//placeholders for MySQL to run against a PostgreSQL driver. Placeholders
+	//in string literals, quoted identifiers and comments are left alone, but
+	//operators that look like placeholders (e.g. the "?" operators for JSONB in
+	//PostgreSQL) cannot be told apart.
+	Placeholders PlaceholderStyle
+	//ReplicaDataSources (optional) enables read/write splitting. These are
+	//data source names for the proxied driver that point to read-only replicas
+	//of the database given to Open() or NewConnector(). One-off SELECT
+	//statements outside of transactions are executed on one of the replicas
+	//(chosen round-robin for each connection), everything else on the
+	//primary. The RouteHook can override this decision. Statements that are
+	//prepared explicitly (e.g. by sql.DB.Prepare) always go to the primary.
+	//Session state (e.g. from SET statements or temporary tables) is not
+	//shared between primary and replica. This does not work with
+	//WrapConnector().
+	ReplicaDataSources []string
+	//ReplicaWarmup (optional) are statements that are executed on each
+	//replica in ReplicaDataSources before any statements are routed to it,
+	//e.g. to load the busiest tables and indexes into the replica's cache.
+	//The warm-up runs in the background when a sql.DB opens its first
+	//connection (so each sql.DB warms up the replicas separately). Until a
+	//replica has completed it, statements go to the other replicas, or to
+	//the primary if no replica is ready yet. Warm-up
+	//statements run on a separate connection without any hooks, and their
+	//result sets are discarded. Progress is reported to the
+	//ReplicaWarmupHook. If the replica cannot be connected to, the
+	//connection is retried with increasing delays, and the replica does not
+	//get any statements until it has been warmed up. A warm-up statement
+	//that fails does not keep the replica out of the routing pool though,
+	//since the regular error handling applies there.
+	ReplicaWarmup []string
+	//TenantFromContext (optional) extracts the tenant from the context of a
+	//statement or transaction (as given to e.g. sql.DB.QueryContext) in
+	//multi-tenant applications. The result is stored in QueryEvent.Tenant and
+	//TransactionEvent.Tenant, and the metrics and statistics provided by this
+	//package (and package promhooks) are partitioned by it.
+	TenantFromContext func(ctx context.Context) string
+	//RepeatedQueryThreshold (optional) enables detection of N+1 query
+	//problems. When statements with the same fingerprint (see Normalize) are
+	//executed more often than this within a single transaction or query scope
+	//(see BeginQueryScope), the RepeatedQueryHook is called, or a warning is
+	//logged through log/slog if no RepeatedQueryHook is set.
+	RepeatedQueryThreshold int
+	//DetectDuplicateQueries (optional) enables detection of identical
+	//statements (same query and same arguments) being executed more than once
+	//within a single transaction, which usually indicates missing caching or
+	//redundant loads. When the transaction ends, each such statement is given
+	//to the DuplicateQueryHook, or logged through log/slog if no
+	//DuplicateQueryHook is set.
+	DetectDuplicateQueries bool
+	//DetectInjection (optional) enables heuristic detection of SQL injection.
+	//Before execution, each statement is searched for suspicious patterns
+	//like stacked statements after a semicolon, tautologies like "OR 1=1", or
+	//string literals that are followed by a comment which swallows the rest of
+	//the statement. Statements with such patterns are given to the
+	//SuspiciousQueryHook, or logged through log/slog if no SuspiciousQueryHook
+	//is set. They are still executed. Statements from the Queries registry
+	//are not checked.
+	DetectInjection bool
+	//DetectLiterals (optional) enables detection of statements that embed
+	//string or number literals where a bind parameter would be expected, e.g.
+	//"WHERE id = 12345", to help migrate a codebase towards full
+	//parameterization. Such statements are given to the LiteralQueryHook, or
+	//logged through log/slog if no LiteralQueryHook is set. Statements from
+	//the Queries registry are not checked.
+	DetectLiterals bool
+	//MaxComplexity (optional) rejects statements whose complexity score (see
+	//AnalyzeComplexity) exceeds this value with a PolicyError before they
+	//reach the database, to protect shared databases from runaway analytical
+	//queries. Statements executed with a context from WithMaintenance() are
+	//exempt. For prepared statements, the context given to Prepare counts.
+	MaxComplexity int
+	//ReadOnly (optional) rejects all statements that modify data or the
+	//schema (INSERT, UPDATE, DELETE, DDL etc.) with a ReadOnlyError before
+	//they reach the database, e.g. for replicas, during incident response, or
+	//when running untrusted report code against production. Only statements
+	//that are recognized as read-only (SELECT, SHOW, EXPLAIN, transaction
+	//control etc.) are let through. Read-only mode can be switched on and off
+	//at runtime with SetReadOnly().
+	ReadOnly bool
+	//AutoReadOnlyTransactions (optional) starts tagged transactions (see
+	//WithTransactionTag) as READ ONLY (see sql.TxOptions) when the previous
+	//transactions with the same tag have repeatedly performed only reads,
+	//with the same set of statement fingerprints (see Normalize). Untagged
+	//transactions are left alone. The classification is reported in
+	//TransactionEvent.ReadOnly and TransactionEvent.AutoReadOnly.
+	//
+	//Only tag transactions whose statements do not depend on the data that
+	//they read: If a transaction that was started as READ ONLY attempts a
+	//write, the database rejects the write, and the next transaction with
+	//the same tag is started as read-write again. If the proxied driver
+	//rejects a read-only transaction, but accepts a read-write transaction
+	//on the same connection right afterwards, this option is suspended for
+	//ten minutes.
+	AutoReadOnlyTransactions bool
+	//DryRun (optional) does not send statements that modify data or the
+	//schema (see IsReadOnlyStatement) to the database. Instead, they are
+	//reported to the DryRunHook (or logged through log/slog if there is
+	//none), and a fake result is returned to the caller (see DryRunResult).
+	//Read-only statements are executed as usual. This is useful for
+	//verifying batch jobs and migrations before running them for real.
+	DryRun bool
+	//DryRunCountRows (optional) makes DryRun run a SELECT COUNT(*) with the
+	//same table and WHERE clause for each UPDATE and DELETE statement, to
+	//report how many rows would have been affected in QueryEvent.Rows and in
+	//the fake result. Statements with joins or LIMIT clauses are not counted.
+	DryRunCountRows bool
+	//DryRunResult (optional) returns the fake result for statements that
+	//were not executed because of DryRun. The default result reports
+	//e.Rows as the number of affected rows.
+	DryRunResult func(e QueryEvent) driver.Result
+	//RollbackOnCommit (optional) rolls back each transaction when it is
+	//committed, but reports success to the caller (and to the
+	//AfterCommitHook) if the rollback succeeds. This allows integration tests
+	//to run against a shared database without leaving residue. Statements
+	//that are executed outside of transactions are still committed
+	//implicitly by the database.
+	RollbackOnCommit bool
+	//ServerTimeout (optional) passes the deadline of each statement's context
+	//on to the database server (see type ServerTimeoutStyle), so that the
+	//server cancels the statement when the deadline expires, instead of only
+	//the client giving up on it. For prepared statements with
+	//ServerTimeoutMySQL, the deadline of the context given to Prepare counts.
+	ServerTimeout ServerTimeoutStyle
+	//MaxRows (optional) limits the number of rows that can be read from a
+	//single result set. When a result set has more rows, reading it fails with
+	//a TooManyRowsError after MaxRows rows, and the TooManyRowsHook is called.
+	//This turns unnoticed memory blowups into errors that can be attributed to
+	//a statement.
+	MaxRows int
+	//Parser (optional) parses each statement before it is prepared or
+	//executed. The result is available to hooks in QueryEvent.AST and in the
+	//ParsedStatementHook, which can reject statements based on their
+	//structure.
+	Parser Parser
+	//StripComments (optional) removes comments from each statement and
+	//collapses its whitespace before it is given to the proxied driver and to
+	//all hooks that see the executed statement, so that statements which only
+	//differ in comments and formatting end up with the same fingerprint.
+	//String literals, quoted identifiers and optimizer hints like
+	//"/*+ INDEX(...) */" are kept intact. This runs after the
+	//BeforePrepareHook (so that marker comments are still visible to e.g.
+	//RequireWhereClause) and before the CommentHook.
+	StripComments bool
+	//Redactor (optional) replaces sensitive arguments in QueryEvent.Args (and
+	//in the arguments given to the BeforeQueryHook), so that they do not show
+	//up in logs, traces and reports. The proxied driver still receives the
+	//original arguments.
+	Redactor *Redactor
+	//SchemaPerTenant (optional) selects a database schema for each statement
+	//based on its tenant (see type SchemaPerTenant). This requires
+	//TenantFromContext to be set.
+	SchemaPerTenant *SchemaPerTenant
+	//RowSecurity (optional) rewrites statements on protected tables to only
+	//see the rows that belong to the tenant (or user etc.) in the context of
+	//the statement (see type RowSecurity).
+	RowSecurity *RowSecurity
+	//Tracer (optional) receives a span for each executed statement (see type
+	//Tracer).
+	Tracer Tracer
+	//Inspector (optional) keeps track of currently executing statements and
+	//recent slow statements, and lists them through HTTP (see type
+	//Inspector).
+	Inspector *Inspector
+	//FaultInjector (optional) delays selected statements or makes them fail
+	//with a given error instead of executing them (see type FaultInjector).
+	FaultInjector *FaultInjector
+	//Chaos (optional) randomly simulates broken connections (see type
+	//Chaos).
+	Chaos *Chaos
+	//ChaosSchedule (optional) injects faults at given points in time (see
+	//type ChaosSchedule).
+	ChaosSchedule *ChaosSchedule
+	//Shadow (optional) mirrors statements asynchronously to a secondary
+	//database (see type Shadow).
+	Shadow *Shadow
+	//Recorder (optional) writes each executed statement and its result to a
+	//recording that can be served by a ReplayDriver (see type Recorder).
+	Recorder *Recorder
+	//PlanCollector (optional) collects the query plan of each distinct SELECT
+	//statement for a report (see type PlanCollector).
+	PlanCollector *PlanCollector
+	//Queries (optional) is a registry of named statements. When one of these
+	//statements is executed, its Expectation is verified (see Queries.Expect).
+	Queries *Queries
+	//Fixtures (optional) are statements that are executed once on the first
+	//connection opened through this Driver, e.g. to create the schema and
+	//test data for integration tests (see LoadFixtureFiles). They are
+	//executed in order, directly on the proxied connection, so no hooks run
+	//for them. If one of them fails, opening the connection fails, and all
+	//fixtures are executed again from the start on the next connection.
+	//
+	//The fixtures are executed in a single transaction, so a failure rolls
+	//back the fixtures that were already executed. This does not help on
+	//databases that commit DDL statements implicitly (e.g. MySQL) or with
+	//drivers that do not support transactions: There, the retry starts over
+	//on top of the partially applied fixtures, so fixtures should be written
+	//to be idempotent (e.g. "CREATE TABLE IF NOT EXISTS").
+	Fixtures []string
+
+	//when not nil, replaces the embedded Hooks (see SetHooks)
+	swappedHooks atomic.Pointer[Hooks]
+	//the embedded Hooks merged with the deprecated hook fields (see hooks())
+	legacyHooksOnce sync.Once
+	legacyHooks     *Hooks
+	//when not nil, replaces the ReadOnly field (see SetReadOnly)
+	swappedReadOnly atomic.Pointer[bool]
+	//see AddProfile
+	profilesMutex sync.Mutex
+	profiles      map[string]Hooks
+	//see Stats
+	stats driverCounters
+	//see Fixtures
+	fixturesMutex  sync.Mutex
+	fixturesLoaded bool
+	//see AutoReadOnlyTransactions
+	transactionClasses transactionClassifier
 }
 
 //Open implements the Driver interface.
 func (d *Driver) Open(dataSource string) (driver.Conn, error) {
+	return NewConnector(d, dataSource).Connect(context.Background())
+}
+
+//OpenConnector implements the driver.DriverContext interface.
+func (d *Driver) OpenConnector(dataSource string) (driver.Connector, error) {
+	return NewConnector(d, dataSource), nil
+}
+
+//proxiedConnector returns a driver.Connector for the given data source that
+//connects through the proxied driver.
+func (d *Driver) proxiedConnector(dataSource string) (driver.Connector, error) {
+	proxiedDriver, err := d.proxiedDriver(dataSource)
+	if err != nil {
+		return nil, err
+	}
+	if dc, ok := proxiedDriver.(driver.DriverContext); ok {
+		return dc.OpenConnector(dataSource)
+	}
+	return dsnConnector{proxiedDriver, dataSource}, nil
+}
+
+func (d *Driver) proxiedDriver(dataSource string) (driver.Driver, error) {
+	if d.ProxiedDriver != nil {
+		return d.ProxiedDriver, nil
+	}
+
+	//the public API of database/sql only gives out registered drivers via
+	//sql.DB.Driver() (sql.Open does not connect yet, so this is cheap)
 	db, err := sql.Open(d.ProxiedDriverName, dataSource)
 	if err != nil {
 		return nil, err
 	}
-	return &connection{d, db}, nil
+	return db.Driver(), db.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// connector
+
+//NewConnector returns a driver.Connector that opens connections to the given
+//data source through the given Driver. This can be used with sql.OpenDB() to
+//use a Driver without registering it with sql.Register() first:
+//
+//	db := sql.OpenDB(sqlproxy.NewConnector(&sqlproxy.Driver{
+//		ProxiedDriverName: "postgres",
+//		Hooks: sqlproxy.Hooks{
+//			BeforeQueryHook: sqlproxy.TraceQuery(func(msg string) { log.Println(msg) }),
+//		},
+//	}, "postgres://localhost/mydb"))
+//
+//Since each connector can use its own Driver instance, different databases
+//can be accessed with different sets of hooks.
+func NewConnector(d *Driver, dataSource string) driver.Connector {
+	return &connector{driver: d, dataSource: dataSource}
+}
+
+//WrapConnector returns a driver.Connector that opens connections through the
+//given connector, and applies the hooks from the given Driver to them. This is
+//useful for drivers that are usually configured through their own connector
+//constructors instead of through a data source string. The ProxiedDriverName
+//and ProxiedDriver fields of the given Driver are ignored.
+func WrapConnector(c driver.Connector, d *Driver) driver.Connector {
+	result := &connector{driver: d}
+	result.once.Do(func() {
+		result.proxied = c
+	})
+	return result
+}
+
+//WrapDB opens a *sql.DB for the given driver name and data source (like
+//sql.Open does), with the given hooks applied to all its connections. This is
+//a shorthand for sql.OpenDB() with NewConnector(), except that an unknown
+//driver name is reported right away instead of on first use.
+//
+//	db, err := sqlproxy.WrapDB("postgres", "postgres://localhost/mydb", sqlproxy.Hooks{
+//		BeforeQueryHook: sqlproxy.TraceQuery(func(msg string) { log.Println(msg) }),
+//	})
+func WrapDB(driverName, dataSource string, hooks Hooks) (*sql.DB, error) {
+	c := &connector{
+		driver:     &Driver{ProxiedDriverName: driverName, Hooks: hooks},
+		dataSource: dataSource,
+	}
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(c), nil
+}
+
+type connector struct {
+	driver     *Driver
+	dataSource string
+	//the connector of the proxied driver is initialized on first use
+	once    sync.Once
+	proxied driver.Connector
+	options dsnOptions
+	err     error
+	//see Driver.ReplicaDataSources
+	replicas *replicaSet
+}
+
+//Connect implements the driver.Connector interface.
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	startedAt := time.Now()
+	conn, err := c.connect(ctx)
+	duration := time.Since(startedAt)
+	c.driver.snapshotStats()
+	c.driver.stats.countConnect(duration)
+	if hook := c.options.apply(c.driver.hooks()).AfterConnectHook; hook != nil {
+		hook(duration, err)
+	}
+	return conn, err
+}
+
+func (c *connector) connect(ctx context.Context) (driver.Conn, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	conn, err := c.proxied.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &connection{
+		driver:   c.driver,
+		conn:     conn,
+		id:       connectionIDs.Add(1),
+		options:  c.options,
+		replicas: c.replicas,
+	}
+	if schedule := c.driver.ChaosSchedule; schedule != nil {
+		result.scheduledKills = schedule.kills(schedule.elapsed())
+	}
+	if err := result.loadFixtures(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.driver.stats.openConnections.Add(1)
+	return result, nil
+}
+
+//init initializes the connector of the proxied driver, after extracting the
+//proxy's own parameters from the data source name.
+func (c *connector) init() error {
+	c.once.Do(func() {
+		var dataSource string
+		dataSource, c.options, c.err = parseDSNOptions(c.dataSource)
+		if c.err == nil {
+			c.proxied, c.err = c.driver.proxiedConnector(dataSource)
+		}
+		if c.err == nil {
+			c.replicas, c.err = newReplicaSet(c.driver)
+		}
+	})
+	return c.err
+}
+
+//Driver implements the driver.Connector interface.
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+//Close implements the io.Closer interface. It is called by sql.DB.Close().
+func (c *connector) Close() error {
+	if c.replicas != nil {
+		c.replicas.close()
+	}
+	if closer, ok := c.proxied.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+//dsnConnector is the driver.Connector for proxied drivers that do not
+//implement driver.DriverContext.
+type dsnConnector struct {
+	driver     driver.Driver
+	dataSource string
+}
+
+//Connect implements the driver.Connector interface.
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dataSource)
+}
+
+//Driver implements the driver.Connector interface.
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // connection
 
+//connectionIDs is used to assign a unique ID to each connection.
+var connectionIDs atomic.Uint64
+
 type connection struct {
 	driver *Driver
-	db     *sql.DB
+	conn   driver.Conn
+	id     uint64
+	//set when the proxied driver reports driver.ErrBadConn, see IsValid()
+	bad bool
+	//from the data source name, see parseDSNOptions()
+	options dsnOptions
+	//the currently running transaction, if any
+	tx *transaction
+	//see Driver.ReplicaDataSources; the connection to a replica is established
+	//on first use
+	replicas *replicaSet
+	replica  driver.Conn
+	//the schema that is currently selected on the primary and replica
+	//connection, see SchemaPerTenant
+	schemas map[driver.Conn]string
+	//whether statement_timeout is currently set on the primary and replica
+	//connection, see ServerTimeoutPostgres
+	timeoutSet map[driver.Conn]bool
+	//set when Driver.Chaos has simulated the loss of this connection
+	killed bool
+	//how many "kill connections" steps of Driver.ChaosSchedule this
+	//connection has seen
+	scheduledKills int
+}
+
+func (c *connection) newEvent(ctx context.Context, hooks *Hooks, q *rewrittenQuery, args []driver.NamedValue) QueryEvent {
+	query := q.query
+	e := QueryEvent{Query: query, Args: castNamedValues(args), ConnectionID: c.id, QueryName: q.name}
+	if q.parsed != nil {
+		e.AST, e.ParseError = q.parsed.ast, q.parsed.err
+	}
+	if c.driver.ListTables {
+		e.Tables = c.tablesForStatement(e)
+	}
+	if c.driver.Redactor != nil {
+		e.Args = c.driver.Redactor.RedactArgs(query, e.Args)
+	}
+	if hooks.CorrelationHook != nil {
+		e.Fields = hooks.CorrelationHook(ctx)
+	}
+	if c.driver.CaptureCaller {
+		e.Caller = findCaller()
+	}
+	if c.driver.TenantFromContext != nil {
+		e.Tenant = c.driver.TenantFromContext(ctx)
+	}
+	if c.tx != nil && c.tx.scope != nil {
+		e.scope = c.tx.scope
+	} else if c.driver.RepeatedQueryThreshold > 0 {
+		e.scope = queryScopeFromContext(ctx)
+	}
+	if c.tx == nil {
+		e.trace = requestTraceFromContext(ctx)
+	}
+	if c.driver.Inspector != nil {
+		e.inspectorID = c.driver.Inspector.begin(e)
+	}
+	if c.driver.Recorder != nil {
+		e.recording = &recordedResult{startedAt: time.Now()}
+	}
+	if c.driver.DetectInjection {
+		c.checkInjection(hooks, e)
+	}
+	if c.driver.DetectLiterals {
+		c.checkLiterals(hooks, e)
+	}
+	return e
+}
+
+//startSpan starts a span for the given statement if the Driver has a Tracer,
+//and returns the context that the statement shall be executed with.
+func (c *connection) startSpan(ctx context.Context, e *QueryEvent) context.Context {
+	if c.driver.Tracer == nil {
+		return ctx
+	}
+	e.spanContext = c.driver.Tracer.StartSpan(ctx, *e)
+	return e.spanContext
+}
+
+//hooks returns the hooks that are currently in effect for this connection.
+func (c *connection) hooks() *Hooks {
+	return c.options.apply(c.driver.hooks())
 }
 
 //Prepare implements the driver.Conn interface.
 func (c *connection) Prepare(query string) (driver.Stmt, error) {
-	var err error
-	if c.driver.BeforePrepareHook != nil {
-		query, err = c.driver.BeforePrepareHook(query)
-		if err != nil {
-			return nil, err
-		}
+	return c.PrepareContext(context.Background(), query)
+}
+
+//PrepareContext implements the driver.ConnPrepareContext interface.
+func (c *connection) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	q, err := c.rewriteQuery(ctx, c.hooks(), query)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.useSchema(ctx, c.conn); err != nil {
+		return nil, err
+	}
+	c.driver.snapshotStats()
+	c.driver.stats.prepares.Add(1)
+	stmt, err := proxiedPrepare(ctx, c.conn, q.query)
+	if err != nil {
+		c.driver.stats.countError(err)
+		return nil, c.checkError(err)
+	}
+	return &statement{c.driver, c, stmt, q}, nil
+}
+
+//translatePlaceholders translates the placeholders in the given query into
+//the style given by Driver.Placeholders. If no translation is necessary, nil is
+//returned.
+func (c *connection) translatePlaceholders(query string) *placeholderTranslation {
+	if c.driver.Placeholders == "" {
+		return nil
 	}
-	stmt, err := c.db.Prepare(query)
-	return &statement{c.driver, stmt, query}, err
+	return translatePlaceholders(query, c.driver.Placeholders)
 }
 
 //Close implements the driver.Conn interface.
 func (c *connection) Close() error {
-	return c.db.Close()
+	err := c.conn.Close()
+	if c.replica != nil {
+		c.replica.Close()
+	}
+	c.driver.stats.openConnections.Add(-1)
+	if hook := c.hooks().AfterDisconnectHook; hook != nil {
+		hook(err)
+	}
+	return err
+}
+
+//ExecContext implements the driver.ExecerContext interface. This allows
+//one-off statements to skip the separate Prepare() step if the proxied driver
+//supports that.
+func (c *connection) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !hasExecer(c.conn) {
+		//let database/sql go through Prepare() like it would for the proxied
+		//driver (among other things, this applies the statement's
+		//ColumnConverter to the arguments)
+		return nil, driver.ErrSkip
+	}
+	hooks := c.hooks()
+	q, err := c.rewriteQuery(ctx, hooks, query)
+	if err != nil {
+		return nil, err
+	}
+	args, err = q.args(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	conn := c.route(ctx, hooks, q.query)
+	var result driver.Result
+	x, err := c.execute(ctx, hooks, conn, q, args, func(ctx context.Context, x *execution) error {
+		var err error
+		result, err = proxiedExec(ctx, conn, q.query, args)
+		if err == driver.ErrSkip {
+			//the proxied driver cannot take the fast path for this statement, so
+			//do what database/sql would do (we cannot return ErrSkip ourselves
+			//since the hooks have already run)
+			result, err = execPrepared(ctx, conn, q.query, args)
+		}
+		c.mirror(hooks, q.query, args, err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.finishExec(x, result)
+}
+
+//QueryContext implements the driver.QueryerContext interface. This allows
+//one-off queries to skip the separate Prepare() step if the proxied driver
+//supports that.
+func (c *connection) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !hasQueryer(c.conn) {
+		//see comment in ExecContext
+		return nil, driver.ErrSkip
+	}
+	hooks := c.hooks()
+	q, err := c.rewriteQuery(ctx, hooks, query)
+	if err != nil {
+		return nil, err
+	}
+	args, err = q.args(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	conn := c.route(ctx, hooks, q.query)
+	var (
+		rows driver.Rows
+		stmt driver.Stmt
+	)
+	x, err := c.execute(ctx, hooks, conn, q, args, func(ctx context.Context, x *execution) error {
+		var err error
+		rows, err = proxiedQuery(ctx, conn, q.query, args)
+		if err == driver.ErrSkip {
+			//same as in ExecContext, except that the statement can only be closed
+			//along with the rows
+			stmt, err = proxiedPrepare(ctx, conn, q.query)
+			if err == nil {
+				args, err = convertArgs(conn, stmt, args)
+				if err == nil {
+					rows, err = proxiedStmtQuery(ctx, stmt, args)
+				}
+				if err != nil {
+					stmt.Close()
+				}
+			}
+		}
+		x.event.shadow = c.mirrorQuery(hooks, q.query, args, err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.finishQuery(x, rows, stmt)
+}
+
+//withProfilerLabels runs the given action, with pprof labels for the given
+//query if the Driver's ProfilerLabels flag is set.
+func (c *connection) withProfilerLabels(ctx context.Context, query string, action func(context.Context)) {
+	if !c.driver.ProfilerLabels {
+		action(ctx)
+		return
+	}
+	pprof.Do(ctx, pprof.Labels("sql_fingerprint", Normalize(query)), action)
+}
+
+//afterQuery runs the AfterQueryHook and, if the statement was slow, the
+//SlowQueryHook. It also counts the statement towards its transaction or query
+//scope.
+func (c *connection) afterQuery(hooks *Hooks, e QueryEvent) {
+	c.driver.snapshotStats()
+	c.driver.stats.executions.Add(1)
+	if e.Err != nil {
+		c.driver.stats.countError(e.Err)
+	} else if c.driver.CountTables {
+		refs := e.Tables
+		if !c.driver.ListTables {
+			refs = c.tablesForStatement(e)
+		}
+		c.driver.stats.countTables(refs)
+	}
+	if e.spanContext != nil {
+		c.driver.Tracer.EndSpan(e.spanContext, e)
+	}
+	hooks.execAfterQueryHook(e)
+	threshold := c.driver.SlowQueryThreshold
+	isSlow := threshold > 0 && e.Duration > threshold
+	if c.driver.Inspector != nil {
+		c.driver.Inspector.end(e.inspectorID, e, isSlow)
+	}
+	if c.driver.Recorder != nil {
+		c.driver.Recorder.record(e)
+	}
+	if c.driver.PlanCollector != nil {
+		c.driver.PlanCollector.collect(e)
+	}
+	if isSlow {
+		if hooks.SlowQueryHook != nil {
+			hooks.SlowQueryHook(e)
+		} else {
+			logSlowQuery(e, c.driver.RedactSlowQueryArgs)
+		}
+		c.explainSlowQuery(hooks, e)
+	}
+	if e.scope != nil {
+		e.scope.record(c.driver, hooks, e)
+	}
+	if c.tx != nil {
+		c.tx.event.Statements++
+		c.tx.event.Rows += e.Rows
+		if c.tx.class != nil {
+			c.tx.classify(e.Query)
+		}
+		if c.tx.trace != nil {
+			c.tx.trace.addStatement(c.tx.traceNode, e)
+		}
+	} else if e.trace != nil {
+		e.trace.addStatement(nil, e)
+	}
+}
+
+//CheckNamedValue implements the driver.NamedValueChecker interface by
+//delegating to the proxied connection. If the proxied connection does not
+//check values itself, database/sql's default conversions apply, just like they
+//would when using the proxied driver directly.
+func (c *connection) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
 }
 
 //Begin implements the driver.Conn interface.
 func (c *connection) Begin() (driver.Tx, error) {
-	tx, err := c.db.Begin()
-	return tx, err
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+//BeginTx implements the driver.ConnBeginTx interface.
+func (c *connection) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.useSchema(ctx, c.conn); err != nil {
+		return nil, err
+	}
+	startedAt := time.Now()
+	var class *transactionClass
+	if c.driver.AutoReadOnlyTransactions {
+		class = c.driver.transactionClasses.start(transactionTagFromContext(ctx))
+	}
+	tx, autoReadOnly, err := c.beginTxAutoReadOnly(ctx, opts, class)
+	if err != nil {
+		return nil, err
+	}
+	c.tx = &transaction{
+		tx:        tx,
+		conn:      c,
+		startedAt: startedAt,
+		event:     TransactionEvent{ConnectionID: c.id, Tag: transactionTagFromContext(ctx), AutoReadOnly: autoReadOnly},
+		class:     class,
+	}
+	if hooks := c.hooks(); hooks.CorrelationHook != nil {
+		c.tx.event.Fields = hooks.CorrelationHook(ctx)
+	}
+	if c.driver.TenantFromContext != nil {
+		c.tx.event.Tenant = c.driver.TenantFromContext(ctx)
+	}
+	if trace := requestTraceFromContext(ctx); trace != nil {
+		c.tx.trace = trace
+		c.tx.traceNode = trace.addTransaction(c.tx.event)
+	}
+	if c.driver.RepeatedQueryThreshold > 0 || c.driver.DetectDuplicateQueries {
+		c.tx.scope = &queryScope{transaction: true}
+	}
+	return c.tx, nil
+}
+
+func (c *connection) beginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := c.checkChaosOnBegin(); err != nil {
+		return nil, c.checkError(err)
+	}
+	if cbt, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err := cbt.BeginTx(ctx, opts)
+		return tx, c.checkError(err)
+	}
+
+	//same restrictions as in database/sql for drivers without ConnBeginTx
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tx, err := c.conn.Begin()
+	return tx, c.checkError(err)
+}
+
+//Ping implements the driver.Pinger interface.
+func (c *connection) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return c.checkError(pinger.Ping(ctx))
+	}
+	return nil
+}
+
+//ResetSession implements the driver.SessionResetter interface.
+func (c *connection) ResetSession(ctx context.Context) error {
+	if c.bad {
+		return driver.ErrBadConn
+	}
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return c.checkError(resetter.ResetSession(ctx))
+	}
+	return nil
+}
+
+//IsValid implements the driver.Validator interface. The database/sql package
+//calls this before returning a connection into its pool, so connections that
+//the proxied driver has reported as broken get discarded instead of reused.
+func (c *connection) IsValid() bool {
+	if c.bad {
+		return false
+	}
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+//checkError records whether the given error indicates a broken connection.
+//The error itself is passed on unchanged, so that database/sql can still
+//recognize driver.ErrBadConn and retry the operation on a fresh connection.
+func (c *connection) checkError(err error) error {
+	if errors.Is(err, driver.ErrBadConn) {
+		c.bad = true
+	}
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// transaction
+
+type transaction struct {
+	tx        driver.Tx
+	conn      *connection
+	startedAt time.Time
+	//collects statistics for the AfterCommitHook or AfterRollbackHook
+	event TransactionEvent
+	//counts statements for the RepeatedQueryHook and DuplicateQueryHook
+	scope *queryScope
+	//see BeginRequestTrace
+	trace     *RequestTrace
+	traceNode *traceNode
+	//statements that are mirrored when the transaction is committed, see
+	//Driver.Shadow
+	shadowStatements []shadowStatement
+	//see Driver.AutoReadOnlyTransactions
+	class        *transactionClass
+	fingerprints map[string]bool
+	wrote        bool
+}
+
+//Commit implements the driver.Tx interface.
+func (t *transaction) Commit() error {
+	if t.conn.driver.RollbackOnCommit {
+		err := t.conn.checkError(t.tx.Rollback())
+		t.conn.driver.stats.commits.Add(1)
+		t.end(err, t.conn.hooks().AfterCommitHook)
+		return err
+	}
+	err := t.conn.checkError(t.tx.Commit())
+	t.conn.driver.stats.commits.Add(1)
+	hooks := t.conn.hooks()
+	if err == nil {
+		t.mirrorTransaction(hooks)
+	}
+	t.end(err, hooks.AfterCommitHook)
+	return err
+}
+
+//Rollback implements the driver.Tx interface.
+func (t *transaction) Rollback() error {
+	err := t.conn.checkError(t.tx.Rollback())
+	t.conn.driver.stats.rollbacks.Add(1)
+	t.end(err, t.conn.hooks().AfterRollbackHook)
+	return err
+}
+
+func (t *transaction) end(err error, hook func(TransactionEvent)) {
+	if t.conn.tx == t {
+		t.conn.tx = nil
+	}
+	if t.scope != nil {
+		t.scope.end()
+	}
+	t.event.Duration = time.Since(t.startedAt)
+	t.event.Err = err
+	if t.class != nil {
+		t.event.ReadOnly = !t.wrote
+		t.conn.driver.transactionClasses.finish(t.class, t.fingerprints, t.wrote)
+	}
+	if t.trace != nil {
+		t.trace.finishTransaction(t.traceNode, t.event)
+	}
+	if hook != nil {
+		hook(t.event)
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -116,8 +1023,9 @@ func (c *connection) Begin() (driver.Tx, error) {
 
 type statement struct {
 	driver *Driver
-	stmt   *sql.Stmt
-	query  string
+	conn   *connection
+	stmt   driver.Stmt
+	*rewrittenQuery
 }
 
 //Close implements the driver.Stmt interface.
@@ -127,140 +1035,480 @@ func (s *statement) Close() error {
 
 //NumInput implements the driver.Stmt interface.
 func (s *statement) NumInput() int {
-	//FIXME: the public API of sql.Stmt does not offer that information
-	return -1
+	if s.placeholders != nil || s.rowSecurity != nil {
+		//the proxied statement counts the translated (or added) placeholders,
+		//which can differ from the number of arguments that the caller has to
+		//supply
+		return -1
+	}
+	return s.stmt.NumInput()
+}
+
+//CheckNamedValue implements the driver.NamedValueChecker interface by
+//delegating to the proxied statement, or to the proxied connection if the
+//statement does not check values itself. This is required for special
+//argument types like sql.Out, which the default conversions reject.
+func (s *statement) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+//ColumnConverter implements the driver.ColumnConverter interface by
+//delegating to the proxied statement. Like the proxied driver would, this
+//applies when the NamedValueChecker of the proxied statement and connection
+//returns driver.ErrSkip or does not exist.
+func (s *statement) ColumnConverter(idx int) driver.ValueConverter {
+	if s.placeholders != nil || s.rowSecurity != nil {
+		//idx refers to the arguments before translation
+		return driver.DefaultParameterConverter
+	}
+	if cc, ok := s.stmt.(driver.ColumnConverter); ok {
+		return cc.ColumnConverter(idx)
+	}
+	return driver.DefaultParameterConverter
 }
 
 //Exec implements the driver.Stmt interface.
 func (s *statement) Exec(values []driver.Value) (driver.Result, error) {
-	args := castValues(values)
-	s.driver.execBeforeQueryHook(s.query, args)
-	return s.stmt.Exec(args...)
+	return s.ExecContext(context.Background(), valuesToNamedValues(values))
+}
+
+//ExecContext implements the driver.StmtExecContext interface.
+func (s *statement) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	args, err := s.args(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	hooks := s.conn.hooks()
+	var result driver.Result
+	x, err := s.conn.execute(ctx, hooks, s.conn.conn, s.rewrittenQuery, args, func(ctx context.Context, x *execution) error {
+		var err error
+		result, err = proxiedStmtExec(ctx, s.stmt, args)
+		s.conn.mirror(hooks, s.query, args, err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.conn.finishExec(x, result)
 }
 
 //Query implements the driver.Stmt interface.
 func (s *statement) Query(values []driver.Value) (driver.Rows, error) {
-	args := castValues(values)
-	s.driver.execBeforeQueryHook(s.query, args)
-	rows, err := s.stmt.Query(args...)
-	return &resultRows{rows}, err
+	return s.QueryContext(context.Background(), valuesToNamedValues(values))
 }
 
-func (d *Driver) execBeforeQueryHook(query string, args []interface{}) {
-	if d.BeforeQueryHook != nil {
-		d.BeforeQueryHook(query, args)
+//QueryContext implements the driver.StmtQueryContext interface.
+func (s *statement) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	args, err := s.args(ctx, args)
+	if err != nil {
+		return nil, err
 	}
+	hooks := s.conn.hooks()
+	var rows driver.Rows
+	x, err := s.conn.execute(ctx, hooks, s.conn.conn, s.rewrittenQuery, args, func(ctx context.Context, x *execution) error {
+		var err error
+		rows, err = proxiedStmtQuery(ctx, s.stmt, args)
+		x.event.shadow = s.conn.mirrorQuery(hooks, s.query, args, err)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.conn.finishQuery(x, rows, nil)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // rows
 
 type resultRows struct {
-	rows *sql.Rows
+	conn *connection
+	rows driver.Rows
+	//for one-off queries that had to be prepared, the statement is closed
+	//along with the rows
+	stmt       driver.Stmt
+	transforms []RowTransform
+	//columns[0] are the columns of the proxied result set, columns[i+1] are
+	//the columns produced by transforms[i] (only filled when transforms exist)
+	columns [][]string
+	expect  *expectation
+	//number of rows returned so far
+	rowCount int
+	//reported to the AfterQueryHook when the rows are closed
+	hooks *Hooks
+	event QueryEvent
+}
+
+func newResultRows(conn *connection, rows driver.Rows, stmt driver.Stmt, hooks *Hooks, event QueryEvent, expect *expectation) (driver.Rows, error) {
+	r := &resultRows{
+		conn:       conn,
+		rows:       rows,
+		stmt:       stmt,
+		transforms: hooks.execRowTransformHook(event.Query),
+		expect:     expect,
+		hooks:      hooks,
+		event:      event,
+	}
+	if event.recording != nil {
+		event.recording.isQuery = true
+		event.recording.columns = rows.Columns()
+	}
+	err := expect.checkDuration(event.Duration)
+	if err == nil {
+		err = expect.checkColumns(r.Columns())
+	}
+	if err != nil {
+		r.event.Err = err
+		r.Close()
+		return nil, err
+	}
+	return r, nil
 }
 
 //Columns implements the driver.Rows interface.
 func (r *resultRows) Columns() []string {
-	result, err := r.rows.Columns()
-	if err != nil {
-		panic(err)
+	if len(r.transforms) == 0 {
+		return r.rows.Columns()
 	}
-	return result
+	return r.transformedColumns()[len(r.transforms)]
+}
+
+func (r *resultRows) transformedColumns() [][]string {
+	if r.columns == nil {
+		columns := r.rows.Columns()
+		r.columns = [][]string{columns}
+		for _, t := range r.transforms {
+			columns = t.TransformColumns(columns)
+			r.columns = append(r.columns, columns)
+		}
+	}
+	return r.columns
 }
 
 //Close implements the driver.Rows interface.
 func (r *resultRows) Close() error {
-	return r.rows.Close()
+	err := r.rows.Close()
+	if r.stmt != nil {
+		closeErr := r.stmt.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	r.event.Rows = int64(r.rowCount)
+	if r.event.shadow != nil {
+		r.conn.mirrorComparison(r.hooks, r.event.shadow)
+	}
+	r.conn.afterQuery(r.hooks, r.event)
+	return err
 }
 
 //Next implements the driver.Rows interface.
 func (r *resultRows) Next(dest []driver.Value) error {
-	if !r.rows.Next() {
-		return io.EOF
+	err := r.next(dest)
+	if err == nil {
+		r.conn.driver.stats.rowBytes.Add(estimateRowSize(dest))
+	} else if err != io.EOF && r.event.Err == nil {
+		r.event.Err = err
 	}
+	return err
+}
 
-	buffer := make([]interface{}, len(dest))
-	for idx := range buffer {
-		buffer[idx] = &union{Current: 0}
+func (r *resultRows) next(dest []driver.Value) error {
+	err := r.nextRow(dest)
+	switch err {
+	case nil:
+		r.rowCount++
+		if err := r.checkMaxRows(); err != nil {
+			return err
+		}
+		return r.expect.checkRowCount(r.rowCount, false)
+	case io.EOF:
+		if r.event.shadow != nil {
+			r.event.shadow.complete = true
+		}
+		checkErr := r.expect.checkRowCount(r.rowCount, true)
+		if checkErr != nil {
+			return checkErr
+		}
+		return err
+	default:
+		return r.conn.checkError(err)
 	}
+}
 
-	err := r.rows.Scan(buffer...)
-	if err != nil {
+func (r *resultRows) nextRow(dest []driver.Value) error {
+	if len(r.transforms) == 0 {
+		err := r.rows.Next(dest)
+		if err == nil {
+			r.recordRow(dest)
+			r.compareRow(dest)
+		}
 		return err
 	}
 
-	for idx, val := range buffer {
-		dest[idx], _ = val.(*union).Value()
+	columns := r.transformedColumns()
+	row := make([]driver.Value, len(columns[0]))
+	for {
+		err := r.rows.Next(row)
+		if err != nil {
+			return err
+		}
+		r.recordRow(row)
+		r.compareRow(row)
+		result, err := r.transformRow(row)
+		if err == ErrSkipRow {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		copy(dest, result)
+		return nil
 	}
-	return nil
 }
 
-////////////////////////////////////////////////////////////////////////////////
-// utils
+//HasNextResultSet implements the driver.RowsNextResultSet interface.
+func (r *resultRows) HasNextResultSet() bool {
+	if rs, ok := r.rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
 
-//Union is a type that implements sql.Scanner and driver.Valuer, and can store
-//all scannable values.
-type union struct {
-	Current uint //0 for nil values
-	Option1 int64
-	Option2 float64
-	Option3 bool
-	Option4 []byte
-	Option5 string
-	Option6 time.Time
-}
-
-//Scan implements the sql.Scanner interface. It places a value in the union.
-func (u *union) Scan(src interface{}) error {
-	switch s := src.(type) {
-	case int64:
-		u.Current = 1
-		u.Option1 = s
-	case float64:
-		u.Current = 2
-		u.Option2 = s
-	case bool:
-		u.Current = 3
-		u.Option3 = s
-	case []byte:
-		u.Current = 4
-		u.Option4 = s
-	case string:
-		u.Current = 5
-		u.Option5 = s
-	case time.Time:
-		u.Current = 6
-		u.Option6 = s
-	default:
-		u.Current = 0
+//NextResultSet implements the driver.RowsNextResultSet interface.
+func (r *resultRows) NextResultSet() error {
+	rs, ok := r.rows.(driver.RowsNextResultSet)
+	if !ok {
+		return io.EOF
 	}
-	return nil
+	err := rs.NextResultSet()
+	r.columns = nil
+	return err
 }
 
-//Value implements the driver.Valuer interface.
-func (u *union) Value() (driver.Value, error) {
-	switch u.Current {
-	case 1:
-		return u.Option1, nil
-	case 2:
-		return u.Option2, nil
-	case 3:
-		return u.Option3, nil
-	case 4:
-		return u.Option4, nil
-	case 5:
-		return u.Option5, nil
-	case 6:
-		return u.Option6, nil
-	default:
-		return nil, nil
+//ColumnTypeDatabaseTypeName implements the
+//driver.RowsColumnTypeDatabaseTypeName interface.
+func (r *resultRows) ColumnTypeDatabaseTypeName(index int) string {
+	index, ok := r.proxiedColumnIndex(index)
+	if rs, ok2 := r.rows.(driver.RowsColumnTypeDatabaseTypeName); ok && ok2 {
+		return rs.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+//ColumnTypeScanType implements the driver.RowsColumnTypeScanType interface.
+func (r *resultRows) ColumnTypeScanType(index int) reflect.Type {
+	index, ok := r.proxiedColumnIndex(index)
+	if rs, ok2 := r.rows.(driver.RowsColumnTypeScanType); ok && ok2 {
+		return rs.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+//ColumnTypeNullable implements the driver.RowsColumnTypeNullable interface.
+func (r *resultRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	index, ok = r.proxiedColumnIndex(index)
+	if rs, ok2 := r.rows.(driver.RowsColumnTypeNullable); ok && ok2 {
+		return rs.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+//ColumnTypeLength implements the driver.RowsColumnTypeLength interface.
+func (r *resultRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	index, ok = r.proxiedColumnIndex(index)
+	if rs, ok2 := r.rows.(driver.RowsColumnTypeLength); ok && ok2 {
+		return rs.ColumnTypeLength(index)
 	}
+	return 0, false
 }
 
-func castValues(values []driver.Value) []interface{} {
+//ColumnTypePrecisionScale implements the
+//driver.RowsColumnTypePrecisionScale interface.
+func (r *resultRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	index, ok = r.proxiedColumnIndex(index)
+	if rs, ok2 := r.rows.(driver.RowsColumnTypePrecisionScale); ok && ok2 {
+		return rs.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
+
+//proxiedColumnIndex maps the index of a column in our result set to the index
+//of that column in the proxied result set. If the column cannot be found in
+//the proxied result set, false is returned.
+func (r *resultRows) proxiedColumnIndex(index int) (int, bool) {
+	if len(r.transforms) == 0 {
+		return index, true
+	}
+
+	//transforms may remove or reorder columns, so we need to find the
+	//respective proxied column by name
+	columns := r.transformedColumns()
+	name := columns[len(r.transforms)][index]
+	for idx, proxiedName := range columns[0] {
+		if proxiedName == name {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+func (r *resultRows) transformRow(row []driver.Value) ([]driver.Value, error) {
+	var err error
+	for idx, t := range r.transforms {
+		row, err = t.TransformRow(r.columns[idx], row)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// utils
+
+func castNamedValues(values []driver.NamedValue) []interface{} {
 	result := make([]interface{}, len(values))
 	for idx, arg := range values {
-		result[idx] = arg
+		if arg.Name == "" {
+			result[idx] = arg.Value
+		} else {
+			result[idx] = sql.Named(arg.Name, arg.Value)
+		}
+	}
+	return result
+}
+
+func valuesToNamedValues(values []driver.Value) []driver.NamedValue {
+	result := make([]driver.NamedValue, len(values))
+	for idx, value := range values {
+		result[idx] = driver.NamedValue{Ordinal: idx + 1, Value: value}
 	}
 	return result
 }
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	result := make([]driver.Value, len(args))
+	for idx, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		result[idx] = arg.Value
+	}
+	return result, nil
+}
+
+//The following functions call into the proxied driver through the
+//context-aware interfaces if possible, and fall back to the legacy interfaces
+//otherwise, in the same way as database/sql does.
+
+func proxiedPrepare(ctx context.Context, conn driver.Conn, query string) (driver.Stmt, error) {
+	if cpc, ok := conn.(driver.ConnPrepareContext); ok {
+		return cpc.PrepareContext(ctx, query)
+	}
+	stmt, err := conn.Prepare(query)
+	if err == nil && ctx.Err() != nil {
+		stmt.Close()
+		return nil, ctx.Err()
+	}
+	return stmt, err
+}
+
+//execPrepared executes a one-off statement through a prepared statement, like
+//database/sql does for drivers that do not support the fast path.
+func execPrepared(ctx context.Context, conn driver.Conn, query string, args []driver.NamedValue) (driver.Result, error) {
+	stmt, err := proxiedPrepare(ctx, conn, query)
+	if err != nil {
+		return nil, err
+	}
+	args, err = convertArgs(conn, stmt, args)
+	var result driver.Result
+	if err == nil {
+		result, err = proxiedStmtExec(ctx, stmt, args)
+	}
+	closeErr := stmt.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return result, err
+}
+
+func hasExecer(conn driver.Conn) bool {
+	_, ok1 := conn.(driver.ExecerContext)
+	_, ok2 := conn.(driver.Execer)
+	return ok1 || ok2
+}
+
+func hasQueryer(conn driver.Conn) bool {
+	_, ok1 := conn.(driver.QueryerContext)
+	_, ok2 := conn.(driver.Queryer)
+	return ok1 || ok2
+}
+
+//Returns driver.ErrSkip if the proxied connection cannot execute the statement
+//without preparing it first.
+func proxiedExec(ctx context.Context, conn driver.Conn, query string, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, query, args)
+	}
+	if execer, ok := conn.(driver.Execer); ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return execer.Exec(query, values)
+	}
+	return nil, driver.ErrSkip
+}
+
+//Returns driver.ErrSkip if the proxied connection cannot execute the query
+//without preparing it first.
+func proxiedQuery(ctx context.Context, conn driver.Conn, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, query, args)
+	}
+	if queryer, ok := conn.(driver.Queryer); ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return queryer.Query(query, values)
+	}
+	return nil, driver.ErrSkip
+}
+
+func proxiedStmtExec(ctx context.Context, stmt driver.Stmt, args []driver.NamedValue) (driver.Result, error) {
+	if sec, ok := stmt.(driver.StmtExecContext); ok {
+		return sec.ExecContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return stmt.Exec(values)
+}
+
+func proxiedStmtQuery(ctx context.Context, stmt driver.Stmt, args []driver.NamedValue) (driver.Rows, error) {
+	if sqc, ok := stmt.(driver.StmtQueryContext); ok {
+		return sqc.QueryContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return stmt.Query(values)
+}
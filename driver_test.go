@@ -20,11 +20,16 @@
 package sqlproxy
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"os"
 	"reflect"
+	"runtime/pprof"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
@@ -43,6 +48,23 @@ func init() {
 				queries = append(queries, fmt.Sprintf("(%s) %#v", query, args))
 			},
 		})
+		sql.Register(driverName+"+transform", &Driver{
+			ProxiedDriverName: driverName,
+			Hooks: Hooks{
+				RowTransformHook: func(query string) []RowTransform {
+					return []RowTransform{
+						FilterRows(func(columns []string, row []driver.Value) bool {
+							return row[0] != int64(23)
+						}),
+						MapRows(func(columns []string, row []driver.Value) error {
+							row[0] = row[0].(int64) * 2
+							return nil
+						}),
+						DropColumns("thing"),
+					}
+				},
+			},
+		})
 	}
 }
 
@@ -211,3 +233,702 @@ func Test_BeforeQueryHook(t *testing.T) {
 
 	tt.CleanupDB()
 }
+
+//Test_RowTransformHook tests that row transforms are applied to result sets.
+func Test_RowTransformHook(t *testing.T) {
+	tt := TT{t}
+
+	tt.ForeachDB("+transform", func(db *sql.DB) {
+		rows := tt.MustRows(db.Query(`SELECT * FROM knowledge ORDER BY number`))
+		columns, err := rows.Columns()
+		tt.Must(err)
+		if !reflect.DeepEqual(columns, []string{"number"}) {
+			tt.Unexpected("columns", []string{"number"}, columns)
+		}
+
+		var number int
+		if !rows.Next() {
+			t.Fatalf("unexpected end of result set")
+		}
+		tt.Must(rows.Scan(&number))
+		if number != 84 {
+			tt.Unexpected("number", 84, number)
+		}
+		if rows.Next() {
+			t.Fatalf("unexpected continuation of result set")
+		}
+		tt.Must(rows.Close())
+	})
+
+	tt.CleanupDB()
+}
+
+//Test_Connector tests that a Driver can be used without registering it.
+func Test_Connector(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	queries = nil
+	connectCount := 0
+	db := sql.OpenDB(NewConnector(&Driver{
+		ProxiedDriverName: "sqlite3",
+		Hooks: Hooks{
+			BeforeQueryHook: func(query string, args []interface{}) {
+				queries = append(queries, query)
+			},
+			AfterConnectHook: func(duration time.Duration, err error) {
+				tt.Must(err)
+				connectCount++
+			},
+		},
+	}, "file:"+sqliteFile))
+
+	var x int
+	tt.Must(db.QueryRow(`SELECT 42`).Scan(&x))
+	if x != 42 {
+		tt.Unexpected("x", 42, x)
+	}
+	if !reflect.DeepEqual(queries, []string{`SELECT 42`}) {
+		tt.Unexpected("queries", []string{`SELECT 42`}, queries)
+	}
+	if connectCount != 1 {
+		tt.Unexpected("connectCount", 1, connectCount)
+	}
+	tt.Must(db.Close())
+
+	//same thing, but wrapping an existing connector
+	queries = nil
+	proxiedConnector, err := (&Driver{ProxiedDriverName: "sqlite3"}).proxiedConnector("file:" + sqliteFile)
+	tt.Must(err)
+	db = sql.OpenDB(WrapConnector(proxiedConnector, &Driver{
+		Hooks: Hooks{
+			BeforeQueryHook: func(query string, args []interface{}) {
+				queries = append(queries, query)
+			},
+		},
+	}))
+	tt.Must(db.QueryRow(`SELECT 23`).Scan(&x))
+	if x != 23 {
+		tt.Unexpected("x", 23, x)
+	}
+	if !reflect.DeepEqual(queries, []string{`SELECT 23`}) {
+		tt.Unexpected("queries", []string{`SELECT 23`}, queries)
+	}
+	tt.Must(db.Close())
+
+	//same thing, but with the WrapDB() shorthand
+	queries = nil
+	db, err = WrapDB("sqlite3", "file:"+sqliteFile, Hooks{
+		BeforeQueryHook: func(query string, args []interface{}) {
+			queries = append(queries, query)
+		},
+	})
+	tt.Must(err)
+	tt.Must(db.QueryRow(`SELECT 5`).Scan(&x))
+	if !reflect.DeepEqual(queries, []string{`SELECT 5`}) {
+		tt.Unexpected("queries", []string{`SELECT 5`}, queries)
+	}
+	tt.Must(db.Close())
+
+	//WrapDB() reports unknown drivers immediately
+	_, err = WrapDB("doesnotexist", "", Hooks{})
+	if err == nil {
+		t.Error("expected WrapDB() to fail for unknown driver, but it succeeded")
+	}
+
+	tt.CleanupDB()
+}
+
+//Test_Register tests that Register() generates distinct names for distinct
+//drivers, and reuses the name for the same driver.
+func Test_Register(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	d1 := &Driver{ProxiedDriverName: "sqlite3"}
+	d2 := &Driver{ProxiedDriverName: "sqlite3"}
+	name1 := Register(d1)
+	name2 := Register(d2)
+	if name1 == name2 {
+		t.Errorf("expected distinct driver names, but both are %q", name1)
+	}
+	if name := Register(d1); name != name1 {
+		tt.Unexpected("name", name1, name)
+	}
+
+	db := tt.MustDB(sql.Open(name2, "file:"+sqliteFile))
+	var x int
+	tt.Must(db.QueryRow(`SELECT 42`).Scan(&x))
+	if x != 42 {
+		tt.Unexpected("x", 42, x)
+	}
+	tt.Must(db.Close())
+
+	tt.CleanupDB()
+}
+
+//Test_ColumnTypes tests that column type information is passed through.
+func Test_ColumnTypes(t *testing.T) {
+	tt := TT{t}
+
+	tt.ForeachDB("+nothing", func(db *sql.DB) {
+		rows := tt.MustRows(db.Query(`SELECT number, thing FROM knowledge`))
+		columnTypes, err := rows.ColumnTypes()
+		tt.Must(err)
+		var typeNames []string
+		for _, ct := range columnTypes {
+			typeNames = append(typeNames, ct.DatabaseTypeName())
+		}
+		expected := []string{"INTEGER", "TEXT"}
+		if db.Driver().(*Driver).ProxiedDriverName == "postgres" {
+			expected = []string{"INT4", "TEXT"}
+		}
+		if !reflect.DeepEqual(typeNames, expected) {
+			tt.Unexpected("typeNames", expected, typeNames)
+		}
+		tt.Must(rows.Close())
+	})
+
+	tt.CleanupDB()
+}
+
+//Test_MultipleResultSets tests that multiple result sets are passed through.
+//Only Postgres is tested since the sqlite3 driver does not support multiple
+//result sets.
+func Test_MultipleResultSets(t *testing.T) {
+	if postgresURI == "" {
+		t.Skip("set POSTGRES_URI to run this test")
+	}
+	tt := TT{t}
+	db := tt.MustDB(sql.Open("postgres+nothing", postgresURI))
+
+	rows := tt.MustRows(db.Query(`SELECT 23; SELECT 42`))
+	for _, expected := range []int{23, 42} {
+		if !rows.Next() {
+			t.Fatalf("unexpected end of result set")
+		}
+		var x int
+		tt.Must(rows.Scan(&x))
+		if x != expected {
+			tt.Unexpected("x", expected, x)
+		}
+		if rows.Next() {
+			t.Fatalf("unexpected continuation of result set")
+		}
+		if rows.NextResultSet() != (expected == 23) {
+			t.Fatalf("unexpected result from NextResultSet() after %d", expected)
+		}
+	}
+	tt.Must(rows.Err())
+	tt.Must(rows.Close())
+	tt.Must(db.Close())
+}
+
+//Test_NumInput tests that database/sql can validate the number of arguments.
+func Test_NumInput(t *testing.T) {
+	tt := TT{t}
+
+	tt.ForeachDB("+nothing", func(db *sql.DB) {
+		stmt, err := db.Prepare(`SELECT thing FROM knowledge WHERE number = $1`)
+		tt.Must(err)
+		_, err = stmt.Exec(23, 42)
+		expected := "sql: expected 1 arguments, got 2"
+		if err == nil || err.Error() != expected {
+			tt.Unexpected("error", expected, err)
+		}
+		tt.Must(stmt.Close())
+	})
+
+	tt.CleanupDB()
+}
+
+//Test_Expectations tests that expectations on named statements are verified.
+func Test_Expectations(t *testing.T) {
+	tt := TT{t}
+
+	var q Queries
+	tt.Must(q.Add(NamedQuery{
+		Name:   "all-things",
+		SQL:    `SELECT thing FROM knowledge ORDER BY number`,
+		Expect: Expectation{MaxRows: 1, RequiredColumns: []string{"thing"}},
+	}))
+	tt.Must(q.Add(NamedQuery{
+		Name:   "one-thing",
+		SQL:    `SELECT number FROM knowledge WHERE thing = $1`,
+		Expect: Expectation{ExactlyOneRow: true, RequiredColumns: []string{"thing"}},
+	}))
+
+	tt.ForeachDB("+nothing", func(outerDB *sql.DB) {
+		var violations []string
+		d := &Driver{
+			ProxiedDriverName: outerDB.Driver().(*Driver).ProxiedDriverName,
+			Queries:           &q,
+			Hooks: Hooks{
+				ExpectationHook: func(err ExpectationError) {
+					violations = append(violations, err.Error())
+				},
+			},
+		}
+		dsn := "file:" + sqliteFile
+		if d.ProxiedDriverName == "postgres" {
+			dsn = postgresURI
+		}
+		db := sql.OpenDB(NewConnector(d, dsn))
+
+		var things []string
+		rows := tt.MustRows(db.Query(q.Get("all-things")))
+		for rows.Next() {
+			var thing string
+			tt.Must(rows.Scan(&thing))
+			things = append(things, thing)
+		}
+		tt.Must(rows.Err())
+		tt.Must(rows.Close())
+		if !reflect.DeepEqual(things, []string{"conspiracy", "truth"}) {
+			tt.Unexpected("things", []string{"conspiracy", "truth"}, things)
+		}
+
+		var number int
+		err := db.QueryRow(q.Get("one-thing"), "nothing").Scan(&number)
+		if err != sql.ErrNoRows {
+			tt.Unexpected("err", sql.ErrNoRows, err)
+		}
+
+		expected := []string{
+			`statement "all-things" violated expectation: returned more than 1 rows`,
+			`statement "one-thing" violated expectation: result set is missing required columns: thing`,
+			`statement "one-thing" violated expectation: returned no rows (expected exactly one)`,
+		}
+		if !reflect.DeepEqual(violations, expected) {
+			tt.Unexpected("violations", expected, violations)
+		}
+
+		//without the hook, violations are reported as errors
+		d.ExpectationHook = nil
+		_, err = db.Query(q.Get("one-thing"), "truth")
+		if _, ok := err.(ExpectationError); !ok {
+			tt.Unexpected("err", ExpectationError{}, err)
+		}
+
+		tt.Must(db.Close())
+	})
+
+	tt.CleanupDB()
+}
+
+//Test_NamedArgs tests that named arguments are passed through to the proxied
+//driver and to the hooks. Only sqlite is tested since the postgres driver
+//does not support named arguments.
+func Test_NamedArgs(t *testing.T) {
+	tt := TT{t}
+
+	tt.ForeachDB("+beforequery", func(db *sql.DB) {
+		if db.Driver().(*Driver).ProxiedDriverName != "sqlite3" {
+			return
+		}
+		queries = nil
+
+		var thing string
+		tt.Must(db.QueryRow(`SELECT thing FROM knowledge WHERE number = :number`, sql.Named("number", 42)).Scan(&thing))
+		if thing != "truth" {
+			tt.Unexpected("thing", "truth", thing)
+		}
+
+		expectedQueries := []string{
+			`(SELECT thing FROM knowledge WHERE number = :number) []interface {}{sql.NamedArg{_NamedFieldsRequired:struct {}{}, Name:"number", Value:42}}`,
+		}
+		if !reflect.DeepEqual(queries, expectedQueries) {
+			tt.Unexpected("queries", expectedQueries, queries)
+		}
+	})
+
+	tt.CleanupDB()
+}
+
+//Test_OutArgs tests that sql.Out arguments are passed through to the proxied
+//driver, and that output values reach the caller.
+func Test_OutArgs(t *testing.T) {
+	tt := TT{t}
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		*(args[0].Value.(sql.Out).Dest.(*int)) = 42
+		return nil
+	}
+	db := tt.MustDB(sql.Open("fake+nothing", ""))
+
+	var x int
+	tt.MustResult(db.Exec(`CALL answer(?)`, sql.Named("x", sql.Out{Dest: &x})))
+	if x != 42 {
+		tt.Unexpected("x", 42, x)
+	}
+	tt.Must(db.Close())
+}
+
+//Test_Transaction tests that statements in a transaction are executed within
+//that transaction.
+func Test_Transaction(t *testing.T) {
+	tt := TT{t}
+
+	tt.ForeachDB("+nothing", func(db *sql.DB) {
+		countRows := func(q interface {
+			QueryRow(string, ...interface{}) *sql.Row
+		}) int {
+			var count int
+			tt.Must(q.QueryRow(`SELECT COUNT(*) FROM knowledge`).Scan(&count))
+			return count
+		}
+
+		tt.Must(db.Ping())
+		tx, err := db.Begin()
+		tt.Must(err)
+		tt.MustResult(tx.Exec(`INSERT INTO knowledge VALUES (5, 'chaos')`))
+		if count := countRows(tx); count != 3 {
+			tt.Unexpected("count within transaction", 3, count)
+		}
+		tt.Must(tx.Rollback())
+		if count := countRows(db); count != 2 {
+			tt.Unexpected("count after rollback", 2, count)
+		}
+	})
+
+	tt.CleanupDB()
+}
+
+//Test_TransactionEvents tests the AfterCommitHook and AfterRollbackHook.
+func Test_TransactionEvents(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var events []string
+	record := func(outcome string) func(TransactionEvent) {
+		return func(e TransactionEvent) {
+			events = append(events, fmt.Sprintf("%s: %d statements, %d rows, err = %v, fields = %v, tenant = %q",
+				outcome, e.Statements, e.Rows, e.Err, e.Fields, e.Tenant))
+		}
+	}
+	type userKey struct{}
+	d := New("sqlite3",
+		WithAfterCommit(record("commit")),
+		WithAfterRollback(record("rollback")),
+		WithCorrelation(func(ctx context.Context) map[string]string {
+			user, _ := ctx.Value(userKey{}).(string)
+			return map[string]string{"user": user}
+		}),
+		WithTenant(func(ctx context.Context) string {
+			if ctx.Value(userKey{}) == nil {
+				return ""
+			}
+			return "acme"
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+
+	ctx := context.WithValue(context.Background(), userKey{}, "alice")
+	tx, err := db.BeginTx(ctx, nil)
+	tt.Must(err)
+	tt.MustResult(tx.Exec(`INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`))
+	var count int
+	tt.Must(tx.QueryRow(`SELECT COUNT(*) FROM knowledge`).Scan(&count))
+	tt.Must(tx.Commit())
+
+	tx, err = db.Begin()
+	tt.Must(err)
+	tt.MustResult(tx.Exec(`DELETE FROM knowledge`))
+	tt.Must(tx.Rollback())
+	tt.Must(db.Close())
+
+	expected := []string{
+		"commit: 2 statements, 3 rows, err = <nil>, fields = map[user:alice], tenant = \"acme\"",
+		"rollback: 1 statements, 2 rows, err = <nil>, fields = map[user:], tenant = \"\"",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		tt.Unexpected("events", expected, events)
+	}
+	stats := d.Stats()
+	if stats.Commits != 1 || stats.Rollbacks != 1 {
+		t.Errorf("expected 1 commit and 1 rollback, got %d and %d", stats.Commits, stats.Rollbacks)
+	}
+
+	tt.CleanupDB()
+}
+
+func Test_RollbackOnCommit(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	committed := 0
+	d := New("sqlite3", WithRollbackOnCommit(), WithAfterCommit(func(e TransactionEvent) {
+		if e.Err == nil {
+			committed++
+		}
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+
+	tx, err := db.Begin()
+	tt.Must(err)
+	tt.MustResult(tx.Exec(`INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`))
+	tt.Must(tx.Commit())
+
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM knowledge`).Scan(&count))
+	if count != 0 {
+		tt.Unexpected("count after commit", 0, count)
+	}
+	if committed != 1 {
+		t.Errorf("expected AfterCommitHook to report 1 successful commit, got %d", committed)
+	}
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+//Test_ErrBadConn tests that database/sql retries an operation on a fresh
+//connection when the proxied driver reports driver.ErrBadConn.
+func Test_ErrBadConn(t *testing.T) {
+	tt := TT{t}
+	callCount := 0
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		callCount++
+		if callCount == 1 {
+			return driver.ErrBadConn
+		}
+		return nil
+	}
+	db := tt.MustDB(sql.Open("fake+nothing", ""))
+
+	tt.MustResult(db.Exec(`DELETE FROM knowledge`))
+	if callCount != 2 {
+		tt.Unexpected("callCount", 2, callCount)
+	}
+	tt.Must(db.Close())
+}
+
+//Test_ColumnConverter tests that argument conversion follows the proxied
+//driver's ColumnConverter.
+func Test_ColumnConverter(t *testing.T) {
+	tt := TT{t}
+	var actualArgs []interface{}
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		actualArgs = castNamedValues(args)
+		return nil
+	}
+	db := tt.MustDB(sql.Open("fake+nothing", ""))
+
+	//test both with and without an explicitly prepared statement
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ($1, $2)`, 42, "truth"))
+	expectedArgs := []interface{}{int64(42), "TRUTH"}
+	if !reflect.DeepEqual(actualArgs, expectedArgs) {
+		tt.Unexpected("args", expectedArgs, actualArgs)
+	}
+
+	stmt, err := db.Prepare(`INSERT INTO knowledge VALUES ($1, $2)`)
+	tt.Must(err)
+	tt.MustResult(stmt.Exec(23, sql.NullString{String: "conspiracy", Valid: true}))
+	expectedArgs = []interface{}{int64(23), "CONSPIRACY"}
+	if !reflect.DeepEqual(actualArgs, expectedArgs) {
+		tt.Unexpected("args", expectedArgs, actualArgs)
+	}
+	tt.Must(stmt.Close())
+	tt.Must(db.Close())
+}
+
+//Test_SetHooks tests that hooks can be replaced at runtime, either directly
+//or through profiles.
+func Test_SetHooks(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var log []string
+	d := &Driver{ProxiedDriverName: "sqlite3"}
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	query := func(q string) {
+		var x int
+		tt.Must(db.QueryRow(q).Scan(&x))
+	}
+
+	query(`SELECT 1`)
+	d.SetHooks(Hooks{
+		BeforeQueryHook: func(query string, args []interface{}) {
+			log = append(log, "first: "+query)
+		},
+	})
+	query(`SELECT 2`)
+	d.UpdateHooks(func(h *Hooks) {
+		previous := h.BeforeQueryHook
+		h.BeforeQueryHook = func(query string, args []interface{}) {
+			previous(query, args)
+			log = append(log, "second: "+query)
+		}
+	})
+	query(`SELECT 3`)
+	d.SetHooks(Hooks{})
+	query(`SELECT 4`)
+
+	expected := []string{"first: SELECT 2", "first: SELECT 3", "second: SELECT 3"}
+	if !reflect.DeepEqual(log, expected) {
+		tt.Unexpected("log", expected, log)
+	}
+
+	//same thing, but with named profiles
+	log = nil
+	d.AddProfile("quiet", Hooks{})
+	d.AddProfile("debug", Hooks{
+		BeforeQueryHook: func(query string, args []interface{}) {
+			log = append(log, query)
+		},
+	})
+	tt.Must(d.UseProfile("debug"))
+	query(`SELECT 5`)
+	tt.Must(d.UseProfile("quiet"))
+	query(`SELECT 6`)
+	if err := d.UseProfile("unknown"); err == nil {
+		t.Error("expected UseProfile() to fail for unknown profile, but it succeeded")
+	}
+	query(`SELECT 7`)
+	expected = []string{"SELECT 5"}
+	if !reflect.DeepEqual(log, expected) {
+		tt.Unexpected("log", expected, log)
+	}
+	tt.Must(db.Close())
+
+	tt.CleanupDB()
+}
+
+//Test_DeprecatedHookFields tests that Driver literals from before the
+//introduction of type Hooks still work.
+func Test_DeprecatedHookFields(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var log []string
+	d := &Driver{
+		ProxiedDriverName: "sqlite3",
+		BeforePrepareHook: func(query string) (string, error) {
+			return strings.Replace(query, "SELECT 1", "SELECT 2", 1), nil
+		},
+		BeforeQueryHook: func(query string, args []interface{}) {
+			log = append(log, "legacy: "+query)
+		},
+		Hooks: Hooks{
+			BeforeQueryHook: func(query string, args []interface{}) {
+				log = append(log, "hooks: "+query)
+			},
+		},
+	}
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	var x int
+	tt.Must(db.QueryRow(`SELECT 1`).Scan(&x))
+	if x != 2 {
+		tt.Unexpected("result", 2, x)
+	}
+
+	//UpdateHooks() starts from the merged hooks
+	d.UpdateHooks(func(h *Hooks) {
+		previous := h.BeforeQueryHook
+		h.BeforeQueryHook = func(query string, args []interface{}) {
+			previous(query, args)
+			log = append(log, "updated: "+query)
+		}
+	})
+	tt.Must(db.QueryRow(`SELECT 3`).Scan(&x))
+	tt.Must(db.Close())
+
+	expected := []string{
+		"legacy: SELECT 2", "hooks: SELECT 2",
+		"legacy: SELECT 3", "hooks: SELECT 3", "updated: SELECT 3",
+	}
+	if !reflect.DeepEqual(log, expected) {
+		tt.Unexpected("log", expected, log)
+	}
+
+	tt.CleanupDB()
+}
+
+//Test_ProfilerLabels tests that statements are executed with pprof labels.
+func Test_ProfilerLabels(t *testing.T) {
+	tt := TT{t}
+	var labels []string
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		label, _ := pprof.Label(ctx, "sql_fingerprint")
+		labels = append(labels, label)
+		return nil
+	}
+	db := sql.OpenDB(NewConnector(&Driver{ProxiedDriver: fakeDriver{}, ProfilerLabels: true}, ""))
+
+	tt.MustResult(db.Exec(`DELETE FROM knowledge WHERE number = $1`, 42))
+	stmt, err := db.Prepare(`INSERT INTO knowledge VALUES (23, 'conspiracy')`)
+	tt.Must(err)
+	tt.MustResult(stmt.Exec())
+	tt.Must(stmt.Close())
+	tt.Must(db.Close())
+
+	expected := []string{
+		`DELETE FROM knowledge WHERE number = ?`,
+		`INSERT INTO knowledge VALUES (?, ?)`,
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		tt.Unexpected("labels", expected, labels)
+	}
+}
+
+//Test_CommentHook tests that sqlcommenter-style comments are added to statements.
+func Test_CommentHook(t *testing.T) {
+	tt := TT{t}
+	var executed []string
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		executed = append(executed, query)
+		return nil
+	}
+	type routeKey struct{}
+	db := sql.OpenDB(NewConnector(New("",
+		WithProxiedDriver(fakeDriver{}),
+		WithComments(func(ctx context.Context) map[string]string {
+			route, ok := ctx.Value(routeKey{}).(string)
+			if !ok {
+				return nil
+			}
+			return map[string]string{
+				"application": "my-app",
+				"route":       route,
+				"traceparent": "00-5bd66ef5095369c7b0d1f8f4bd33716a-c532cb4098ac3dd2-01",
+			}
+		}),
+	), ""))
+
+	ctx := context.WithValue(context.Background(), routeKey{}, "/polls 1000")
+	tt.MustResult(db.ExecContext(ctx, `DELETE FROM knowledge;`))
+	tt.MustResult(db.ExecContext(ctx, `DELETE /* already commented */ FROM knowledge`))
+	tt.MustResult(db.Exec(`DELETE FROM knowledge`))
+	tt.Must(db.Close())
+
+	expected := []string{
+		`DELETE FROM knowledge /*application='my-app',route='%2Fpolls%201000',traceparent='00-5bd66ef5095369c7b0d1f8f4bd33716a-c532cb4098ac3dd2-01'*/;`,
+		`DELETE /* already commented */ FROM knowledge`,
+		`DELETE FROM knowledge`,
+	}
+	if !reflect.DeepEqual(executed, expected) {
+		tt.Unexpected("executed", expected, executed)
+	}
+}
+
+//Test_CaptureCaller tests that QueryEvent.Caller points to the application code.
+func Test_CaptureCaller(t *testing.T) {
+	tt := TT{t}
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		return nil
+	}
+	var callers []string
+	db := sql.OpenDB(NewConnector(New("",
+		WithProxiedDriver(fakeDriver{}),
+		WithCaller(),
+		WithAfterQuery(func(e QueryEvent) {
+			callers = append(callers, e.Caller)
+		}),
+	), ""))
+	tt.MustResult(db.Exec(`DELETE FROM knowledge`))
+	tt.Must(db.Close())
+
+	if len(callers) != 1 || !strings.HasPrefix(callers[0], "github.com/majewsky/sqlproxy.Test_CaptureCaller (") || !strings.Contains(callers[0], "driver_test.go:") {
+		t.Errorf("unexpected callers: %#v", callers)
+	}
+}
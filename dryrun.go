@@ -0,0 +1,216 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+//dryRun implements Driver.DryRun. If the given statement shall not be
+//executed, it returns the Interception that replaces its execution.
+func (c *connection) dryRun(ctx context.Context, conn driver.Conn, hooks *Hooks, e QueryEvent, args []driver.NamedValue) *Interception {
+	if !c.driver.DryRun || IsReadOnlyStatement(e.Query) {
+		return nil
+	}
+	if c.driver.DryRunCountRows {
+		count, err := countAffectedRows(ctx, conn, e.Query, args)
+		if err != nil {
+			return &Interception{Err: err}
+		}
+		e.Rows = count
+	}
+
+	if hooks.DryRunHook != nil {
+		hooks.DryRunHook(e)
+	} else {
+		attrs := []slog.Attr{slog.String("query", formatQuery(e.Query, e.Args))}
+		if c.driver.DryRunCountRows {
+			attrs = append(attrs, slog.Int64("rows", e.Rows))
+		}
+		attrs = append(attrs, e.fieldAttrs()...)
+		slog.Default().LogAttrs(ctx, slog.LevelInfo, "SQL statement not executed in dry-run mode", attrs...)
+	}
+
+	if c.driver.DryRunResult != nil {
+		return &Interception{Result: c.driver.DryRunResult(e)}
+	}
+	return &Interception{Result: driver.RowsAffected(e.Rows)}
+}
+
+//countAffectedRows runs a SELECT COUNT(*) on the proxied connection (i.e.
+//without any hooks) that counts the rows that the given UPDATE or DELETE
+//statement would affect. For other statements, or statements that are too
+//complex to be translated into a SELECT (e.g. with joins), 0 is returned.
+func countAffectedRows(ctx context.Context, conn driver.Conn, query string, args []driver.NamedValue) (int64, error) {
+	t := dryRunCountQuery(query)
+	if t == nil {
+		return 0, nil
+	}
+	args, err := t.args(args)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := proxiedQuery(ctx, conn, t.query, args)
+	if err == driver.ErrSkip {
+		var stmt driver.Stmt
+		stmt, err = proxiedPrepare(ctx, conn, t.query)
+		if err != nil {
+			return 0, err
+		}
+		defer stmt.Close()
+		rows, err = proxiedStmtQuery(ctx, stmt, args)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	row := make([]driver.Value, 1)
+	err = rows.Next(row)
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch value := row[0].(type) {
+	case int64:
+		return value, nil
+	case []byte:
+		var count int64
+		_, err := fmt.Sscan(string(value), &count)
+		return count, err
+	default:
+		var count int64
+		_, err := fmt.Sscan(fmt.Sprint(value), &count)
+		return count, err
+	}
+}
+
+//dryRunCountQuery translates an UPDATE or DELETE statement into a SELECT
+//COUNT(*) with the same table and WHERE clause, or returns nil if the
+//statement cannot be translated. The arguments for the SELECT are obtained
+//from the statement's arguments through the returned translation.
+func dryRunCountQuery(query string) *placeholderTranslation {
+	tokens := tokenizeSQL(query)
+	if len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) < 2 {
+		return nil
+	}
+	endOf := func(idx int) int {
+		return tokens[idx].offset + len(tokens[idx].text)
+	}
+
+	var tableStart, tableEnd, whereStart, whereEnd int
+	switch strings.ToUpper(tokens[0].text) {
+	case "DELETE":
+		if !strings.EqualFold(tokens[1].text, "FROM") {
+			return nil
+		}
+		tableStart, tableEnd = endOf(1), -1
+	case "UPDATE":
+		tableStart, tableEnd = endOf(0), -1
+	default:
+		return nil
+	}
+	whereStart, whereEnd = -1, endOf(len(tokens)-1)
+
+	depth := 0
+	for idx := 2; idx < len(tokens); idx++ {
+		token := tokens[idx]
+		switch token.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
+		if token.text == "," && tableEnd < 0 && whereStart < 0 && strings.EqualFold(tokens[0].text, "DELETE") {
+			return nil //multi-table DELETE
+		}
+		if token.kind != sqlTokenWord {
+			continue
+		}
+		switch strings.ToUpper(token.text) {
+		case "SET":
+			if tableEnd < 0 {
+				tableEnd = token.offset
+			}
+		case "WHERE":
+			if whereStart < 0 {
+				if tableEnd < 0 {
+					tableEnd = token.offset
+				}
+				whereStart = endOf(idx)
+			}
+		case "RETURNING":
+			if tableEnd < 0 {
+				tableEnd = token.offset
+			}
+			if whereStart >= 0 {
+				whereEnd = token.offset
+			}
+			idx = len(tokens) //nothing relevant after this point
+		case "FROM", "USING", "JOIN", "ORDER", "LIMIT":
+			//joins and limits cannot be expressed in a simple SELECT COUNT(*)
+			return nil
+		}
+	}
+	if tableEnd < 0 {
+		tableEnd = whereEnd
+	}
+	table := strings.TrimSpace(query[tableStart:tableEnd])
+	if table == "" {
+		return nil
+	}
+
+	countQuery := "SELECT COUNT(*) FROM " + table
+	var matches []placeholderMatch
+	style := PlaceholderQuestion
+	if whereStart >= 0 {
+		prefix := countQuery + " WHERE "
+		countQuery = prefix + strings.TrimSpace(query[whereStart:whereEnd])
+		shift := len(prefix) - whereStart - countLeadingBytes(query[whereStart:whereEnd], isSpace)
+		for _, m := range findPlaceholders(query) {
+			if m.start < whereStart || m.start >= whereEnd {
+				continue
+			}
+			style = PlaceholderStyle(query[m.start : m.start+1])
+			m.start += shift
+			m.end += shift
+			matches = append(matches, m)
+		}
+	}
+	return renderPlaceholders(countQuery, matches, style)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
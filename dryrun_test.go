@@ -0,0 +1,118 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func Test_DryRunCountQuery(t *testing.T) {
+	type result struct {
+		Query string
+		Refs  []placeholderRef
+	}
+	testCases := map[string]*result{
+		`DELETE FROM users WHERE id = $2 AND name = $1`:                            {`SELECT COUNT(*) FROM users WHERE id = $1 AND name = $2`, []placeholderRef{{ordinal: 2}, {ordinal: 1}}},
+		`UPDATE users u SET name = ? WHERE u.id IN (SELECT id FROM x WHERE y = ?)`: {`SELECT COUNT(*) FROM users u WHERE u.id IN (SELECT id FROM x WHERE y = ?)`, []placeholderRef{{ordinal: 2}}},
+		`UPDATE users SET name = :name`:                                            {`SELECT COUNT(*) FROM users`, nil},
+		`DELETE FROM users WHERE id = :id RETURNING name;`:                         {`SELECT COUNT(*) FROM users WHERE id = :id`, []placeholderRef{{name: "id", ordinal: 1}}},
+		`DELETE FROM sessions`:                                                     {`SELECT COUNT(*) FROM sessions`, nil},
+		`UPDATE users SET name = x.name FROM x WHERE x.id = users.id`:              nil,
+		`DELETE FROM users USING x WHERE x.id = users.id`:                          nil,
+		`DELETE FROM users WHERE id = 1 LIMIT 1`:                                   nil,
+		`INSERT INTO users (name) VALUES ('x')`:                                    nil,
+	}
+	for query, expected := range testCases {
+		var actual *result
+		if tr := dryRunCountQuery(query); tr != nil {
+			actual = &result{tr.query, tr.refs}
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			TT{t}.Unexpected("count query for "+query, expected, actual)
+		}
+	}
+}
+
+func Test_DryRun(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	db := sql.OpenDB(NewConnector(New("sqlite3"), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (id, name) VALUES (1, 'alice'), (2, 'bob'), (3, 'carol')`))
+	tt.Must(db.Close())
+
+	var events []QueryEvent
+	d := New("sqlite3", WithDryRun(true), WithDryRunHook(func(e QueryEvent) {
+		events = append(events, e)
+	}))
+	db = sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+
+	result := tt.MustResult(db.Exec(`DELETE FROM users WHERE id > ?`, 1))
+	affected, err := result.RowsAffected()
+	tt.Must(err)
+	if affected != 2 {
+		tt.Unexpected("rows affected", 2, affected)
+	}
+	stmt, err := db.Prepare(`UPDATE users SET name = ? WHERE name = ?`)
+	tt.Must(err)
+	result = tt.MustResult(stmt.Exec("dave", "alice"))
+	tt.Must(stmt.Close())
+	affected, err = result.RowsAffected()
+	tt.Must(err)
+	if affected != 1 {
+		tt.Unexpected("rows affected", 1, affected)
+	}
+	tt.MustResult(db.Exec(`DROP TABLE users`))
+
+	//nothing was actually changed
+	var names []string
+	rows := tt.MustRows(db.Query(`SELECT name FROM users ORDER BY id`))
+	for rows.Next() {
+		var name string
+		tt.Must(rows.Scan(&name))
+		names = append(names, name)
+	}
+	tt.Must(rows.Close())
+	if !reflect.DeepEqual(names, []string{"alice", "bob", "carol"}) {
+		tt.Unexpected("names", []string{"alice", "bob", "carol"}, names)
+	}
+
+	if len(events) != 3 || events[0].Rows != 2 || events[1].Rows != 1 || events[2].Query != `DROP TABLE users` {
+		t.Errorf("unexpected DryRunHook events: %#v", events)
+	}
+	tt.Must(db.Close())
+
+	//custom fake result
+	d = New("sqlite3", WithDryRun(false), WithDryRunHook(func(QueryEvent) {}))
+	d.DryRunResult = func(e QueryEvent) driver.Result { return driver.RowsAffected(42) }
+	db = sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	result = tt.MustResult(db.Exec(`DELETE FROM users`))
+	affected, err = result.RowsAffected()
+	tt.Must(err)
+	if affected != 42 {
+		tt.Unexpected("rows affected", 42, affected)
+	}
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
@@ -0,0 +1,103 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//dsnOptions contains the settings that can be given to the proxy through
+//parameters in the data source name (see parseDSNOptions).
+type dsnOptions struct {
+	//from "sqlproxy_log=1"
+	trace bool
+	//from "sqlproxy_slow_ms=250"
+	slowQueryThreshold time.Duration
+}
+
+//parseDSNOptions extracts all parameters named "sqlproxy_*" from the query
+//string part of the given data source name, and returns the remaining data
+//source name for the proxied driver. Other parameters are left untouched. The
+//following parameters are understood:
+//
+//	sqlproxy_log=1        - log all statements like TraceQuery() does
+//	sqlproxy_slow_ms=250  - log statements taking longer than 250ms like WithSlowQueryLog() does
+//
+//Traced statements are logged through the standard library's log package, slow
+//statements through log/slog.
+func parseDSNOptions(dataSource string) (string, dsnOptions, error) {
+	var opts dsnOptions
+	idx := strings.LastIndexByte(dataSource, '?')
+	if idx < 0 || !strings.Contains(dataSource[idx:], "sqlproxy_") {
+		return dataSource, opts, nil
+	}
+
+	var remaining []string
+	for _, param := range strings.Split(dataSource[idx+1:], "&") {
+		if !strings.HasPrefix(param, "sqlproxy_") {
+			remaining = append(remaining, param)
+			continue
+		}
+		key, value, _ := strings.Cut(param, "=")
+		switch key {
+		case "sqlproxy_log":
+			trace, err := strconv.ParseBool(value)
+			if err != nil {
+				return "", opts, fmt.Errorf("sqlproxy: invalid value for %s in data source name: %q", key, value)
+			}
+			opts.trace = trace
+		case "sqlproxy_slow_ms":
+			ms, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return "", opts, fmt.Errorf("sqlproxy: invalid value for %s in data source name: %q", key, value)
+			}
+			opts.slowQueryThreshold = time.Duration(ms) * time.Millisecond
+		default:
+			return "", opts, fmt.Errorf("sqlproxy: unknown parameter in data source name: %q", key)
+		}
+	}
+
+	if len(remaining) == 0 {
+		return dataSource[:idx], opts, nil
+	}
+	return dataSource[:idx+1] + strings.Join(remaining, "&"), opts, nil
+}
+
+//apply returns the given hooks, extended by the hooks requested through the
+//data source name.
+func (o dsnOptions) apply(hooks *Hooks) *Hooks {
+	if o == (dsnOptions{}) {
+		return hooks
+	}
+	result := *hooks
+	if o.trace {
+		result.BeforeQueryHook = chainBeforeQueryHooks(result.BeforeQueryHook,
+			TraceQuery(func(msg string) { log.Println(msg) }))
+	}
+	if o.slowQueryThreshold > 0 {
+		result.AfterQueryHook = chainAfterQueryHooks(result.AfterQueryHook,
+			slowQueryLogger(o.slowQueryThreshold))
+	}
+	return &result
+}
@@ -0,0 +1,102 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ParseDSNOptions(t *testing.T) {
+	tt := TT{t}
+
+	testCases := []struct {
+		Input        string
+		ExpectedDSN  string
+		ExpectedOpts dsnOptions
+		ExpectedErr  string
+	}{
+		{"file:test.sqlite", "file:test.sqlite", dsnOptions{}, ""},
+		{"file:test.sqlite?_foreign_keys=1", "file:test.sqlite?_foreign_keys=1", dsnOptions{}, ""},
+		{"file:test.sqlite?sqlproxy_log=1", "file:test.sqlite", dsnOptions{trace: true}, ""},
+		{
+			"postgres://localhost/db?sslmode=disable&sqlproxy_log=true&sqlproxy_slow_ms=250&connect_timeout=5",
+			"postgres://localhost/db?sslmode=disable&connect_timeout=5",
+			dsnOptions{trace: true, slowQueryThreshold: 250 * time.Millisecond},
+			"",
+		},
+		{"user:p?ss@tcp(localhost)/db", "user:p?ss@tcp(localhost)/db", dsnOptions{}, ""},
+		{"file:test.sqlite?sqlproxy_log=maybe", "", dsnOptions{}, `sqlproxy: invalid value for sqlproxy_log in data source name: "maybe"`},
+		{"file:test.sqlite?sqlproxy_slow_ms=-1", "", dsnOptions{}, `sqlproxy: invalid value for sqlproxy_slow_ms in data source name: "-1"`},
+		{"file:test.sqlite?sqlproxy_foo=1", "", dsnOptions{}, `sqlproxy: unknown parameter in data source name: "sqlproxy_foo"`},
+	}
+
+	for _, tc := range testCases {
+		dsn, opts, err := parseDSNOptions(tc.Input)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if errStr != tc.ExpectedErr {
+			tt.Unexpected("error for "+tc.Input, tc.ExpectedErr, errStr)
+		}
+		if err == nil && dsn != tc.ExpectedDSN {
+			tt.Unexpected("DSN for "+tc.Input, tc.ExpectedDSN, dsn)
+		}
+		if err == nil && opts != tc.ExpectedOpts {
+			tt.Unexpected("options for "+tc.Input, tc.ExpectedOpts, opts)
+		}
+	}
+}
+
+//Test_DSNOptions tests that options from the data source name take effect.
+func Test_DSNOptions(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var logBuffer bytes.Buffer
+	log.SetOutput(&logBuffer)
+	defer log.SetOutput(os.Stderr)
+
+	db, err := WrapDB("sqlite3", "file:"+sqliteFile+"?sqlproxy_log=1", Hooks{})
+	tt.Must(err)
+	var x int
+	tt.Must(db.QueryRow(`SELECT $1`, 42).Scan(&x))
+	if x != 42 {
+		tt.Unexpected("x", 42, x)
+	}
+	tt.Must(db.Close())
+
+	if !strings.HasSuffix(strings.TrimSpace(logBuffer.String()), "SELECT $1 [42]") {
+		t.Errorf("unexpected log output: %q", logBuffer.String())
+	}
+
+	//errors in the DSN are reported by WrapDB() right away
+	_, err = WrapDB("sqlite3", "file:"+sqliteFile+"?sqlproxy_log=maybe", Hooks{})
+	if err == nil {
+		t.Error("expected WrapDB() to fail for invalid DSN parameter, but it succeeded")
+	}
+
+	tt.CleanupDB()
+}
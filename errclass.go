@@ -0,0 +1,182 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+)
+
+//ErrorCategory is a coarse classification of errors returned by statements,
+//as computed by ClassifyError(). Unlike the raw error messages, these
+//categories are suitable for metrics and alerting.
+type ErrorCategory string
+
+const (
+	//ErrorCategorySyntax is for invalid statements, including references to
+	//tables or columns that do not exist.
+	ErrorCategorySyntax ErrorCategory = "syntax"
+	//ErrorCategoryConstraint is for violations of unique, foreign key, not
+	//null or check constraints.
+	ErrorCategoryConstraint ErrorCategory = "constraint"
+	//ErrorCategorySerialization is for serialization failures and deadlocks,
+	//i.e. errors that usually go away when the transaction is retried.
+	ErrorCategorySerialization ErrorCategory = "serialization"
+	//ErrorCategoryTimeout is for statements that hit a deadline, a statement
+	//timeout or a lock timeout.
+	ErrorCategoryTimeout ErrorCategory = "timeout"
+	//ErrorCategoryCanceled is for statements whose context was canceled.
+	ErrorCategoryCanceled ErrorCategory = "canceled"
+	//ErrorCategoryConnection is for broken or refused connections.
+	ErrorCategoryConnection ErrorCategory = "connection"
+	//ErrorCategoryExpectation is for ExpectationErrors.
+	ErrorCategoryExpectation ErrorCategory = "expectation"
+	//ErrorCategoryOther is for all other errors.
+	ErrorCategoryOther ErrorCategory = "other"
+)
+
+//errorCategories lists all ErrorCategory values (see driverCounters).
+var errorCategories = [...]ErrorCategory{
+	ErrorCategorySyntax, ErrorCategoryConstraint, ErrorCategorySerialization,
+	ErrorCategoryTimeout, ErrorCategoryCanceled, ErrorCategoryConnection,
+	ErrorCategoryExpectation, ErrorCategoryOther,
+}
+
+//ClassifyError returns the category of the given error, or an empty string if
+//the error is nil. Besides generic errors like context.DeadlineExceeded or
+//driver.ErrBadConn, this understands the error codes of the following drivers
+//without depending on them:
+//
+//	- PostgreSQL (github.com/lib/pq, github.com/jackc/pgx): through the SQLState() method
+//	- MySQL (github.com/go-sql-driver/mysql): through the MySQLError.Number field
+//	- SQLite (github.com/mattn/go-sqlite3): through the Error.Code field
+func ClassifyError(err error) ErrorCategory {
+	var expectationErr ExpectationError
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorCategoryTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCategoryCanceled
+	case errors.As(err, &expectationErr):
+		return ErrorCategoryExpectation
+	}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if category := classifyDriverError(e); category != "" {
+			return category
+		}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return ErrorCategoryConnection
+	}
+	return ErrorCategoryOther
+}
+
+//classifyDriverError classifies a single error from the chain of wrapped
+//errors, or returns an empty string if it is not a known driver error.
+func classifyDriverError(err error) ErrorCategory {
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		return classifySQLState(e.SQLState())
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(err))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	switch t := v.Type(); {
+	case t.Name() == "MySQLError":
+		if f := v.FieldByName("Number"); f.IsValid() && f.Kind() == reflect.Uint16 {
+			return classifyMySQLError(f.Uint())
+		}
+	case t.Name() == "Error" && strings.HasSuffix(t.PkgPath(), "go-sqlite3"):
+		if f := v.FieldByName("Code"); f.IsValid() && f.Kind() == reflect.Int {
+			return classifySQLiteError(f.Int())
+		}
+	}
+	return ""
+}
+
+//classifySQLState classifies SQLSTATE codes as used by PostgreSQL.
+func classifySQLState(code string) ErrorCategory {
+	switch code {
+	case "40001", "40P01": //serialization_failure, deadlock_detected
+		return ErrorCategorySerialization
+	case "57014", "55P03": //query_canceled (e.g. by statement_timeout), lock_not_available
+		return ErrorCategoryTimeout
+	case "57P01", "57P02", "57P03": //admin_shutdown, crash_shutdown, cannot_connect_now
+		return ErrorCategoryConnection
+	case "42501": //insufficient_privilege
+		return ErrorCategoryOther
+	}
+	switch {
+	case strings.HasPrefix(code, "42"): //syntax error or access rule violation
+		return ErrorCategorySyntax
+	case strings.HasPrefix(code, "23"): //integrity constraint violation
+		return ErrorCategoryConstraint
+	case strings.HasPrefix(code, "08"): //connection exception
+		return ErrorCategoryConnection
+	case code == "":
+		return ""
+	default:
+		return ErrorCategoryOther
+	}
+}
+
+//classifyMySQLError classifies MySQL server error numbers.
+func classifyMySQLError(number uint64) ErrorCategory {
+	switch number {
+	case 1064, 1054, 1146, 1149: //ER_PARSE_ERROR, ER_BAD_FIELD_ERROR, ER_NO_SUCH_TABLE, ER_SYNTAX_ERROR
+		return ErrorCategorySyntax
+	case 1062, 1048, 1451, 1452, 3819: //ER_DUP_ENTRY, ER_BAD_NULL_ERROR, ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2, ER_CHECK_CONSTRAINT_VIOLATED
+		return ErrorCategoryConstraint
+	case 1213: //ER_LOCK_DEADLOCK
+		return ErrorCategorySerialization
+	case 1205, 3024: //ER_LOCK_WAIT_TIMEOUT, ER_QUERY_TIMEOUT
+		return ErrorCategoryTimeout
+	case 1040, 1053, 2002, 2003, 2006, 2013: //ER_CON_COUNT_ERROR, ER_SERVER_SHUTDOWN, CR_CONNECTION_ERROR, CR_CONN_HOST_ERROR, CR_SERVER_GONE_ERROR, CR_SERVER_LOST
+		return ErrorCategoryConnection
+	default:
+		return ErrorCategoryOther
+	}
+}
+
+//classifySQLiteError classifies SQLite primary result codes.
+func classifySQLiteError(code int64) ErrorCategory {
+	switch code {
+	case 1: //SQLITE_ERROR (mostly syntax errors and missing tables or columns)
+		return ErrorCategorySyntax
+	case 19: //SQLITE_CONSTRAINT
+		return ErrorCategoryConstraint
+	case 5, 6: //SQLITE_BUSY, SQLITE_LOCKED
+		return ErrorCategoryTimeout
+	case 14: //SQLITE_CANTOPEN
+		return ErrorCategoryConnection
+	default:
+		return ErrorCategoryOther
+	}
+}
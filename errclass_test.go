@@ -0,0 +1,73 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+//MySQLError mimics the error type of github.com/go-sql-driver/mysql.
+type MySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *MySQLError) Error() string {
+	return fmt.Sprintf("Error %d: %s", e.Number, e.Message)
+}
+
+func Test_ClassifyError(t *testing.T) {
+	testCases := []struct {
+		Err      error
+		Expected ErrorCategory
+	}{
+		{nil, ""},
+		{errors.New("something went wrong"), ErrorCategoryOther},
+		{context.DeadlineExceeded, ErrorCategoryTimeout},
+		{fmt.Errorf("while querying: %w", context.Canceled), ErrorCategoryCanceled},
+		{driver.ErrBadConn, ErrorCategoryConnection},
+		{ExpectationError{QueryName: "foo", Message: "too slow"}, ErrorCategoryExpectation},
+		{&pq.Error{Code: "42P01"}, ErrorCategorySyntax},
+		{&pq.Error{Code: "23505"}, ErrorCategoryConstraint},
+		{fmt.Errorf("in transaction: %w", &pq.Error{Code: "40001"}), ErrorCategorySerialization},
+		{&pq.Error{Code: "57014"}, ErrorCategoryTimeout},
+		{&pq.Error{Code: "08006"}, ErrorCategoryConnection},
+		{&pq.Error{Code: "22012"}, ErrorCategoryOther},
+		{&MySQLError{Number: 1064}, ErrorCategorySyntax},
+		{&MySQLError{Number: 1062}, ErrorCategoryConstraint},
+		{&MySQLError{Number: 1213}, ErrorCategorySerialization},
+		{&MySQLError{Number: 1205}, ErrorCategoryTimeout},
+		{&MySQLError{Number: 2006}, ErrorCategoryConnection},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint}, ErrorCategoryConstraint},
+		{sqlite3.Error{Code: sqlite3.ErrBusy}, ErrorCategoryTimeout},
+	}
+	for _, tc := range testCases {
+		if actual := ClassifyError(tc.Err); actual != tc.Expected {
+			t.Errorf("expected ClassifyError(%#v) = %q, got %q", tc.Err, tc.Expected, actual)
+		}
+	}
+}
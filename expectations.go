@@ -0,0 +1,152 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+//Expectation describes the expected shape of the results of a named
+//statement. See Queries.Expect for how to use it. The zero value does not
+//expect anything.
+type Expectation struct {
+	//MaxRows (if non-zero) is the maximum number of rows that the statement
+	//may return.
+	MaxRows int
+	//ExactlyOneRow requires that the statement returns exactly one row.
+	ExactlyOneRow bool
+	//RequiredColumns lists columns that must appear in the result set.
+	RequiredColumns []string
+	//MaxDuration (if non-zero) is the maximum time that the statement may
+	//take to execute. For queries, the time spent reading the result rows is
+	//not included.
+	MaxDuration time.Duration
+}
+
+//ExpectationError is reported when a statement violates its Expectation.
+type ExpectationError struct {
+	QueryName string
+	Message   string
+}
+
+//Error implements the builtin/error interface.
+func (e ExpectationError) Error() string {
+	return fmt.Sprintf("statement %q violated expectation: %s", e.QueryName, e.Message)
+}
+
+//Expect registers an Expectation for the statement with the given name. When
+//a Driver with this registry in its Queries field executes this statement,
+//the expectation will be verified, and violations will be reported through the
+//Driver's ExpectationHook.
+func (q *Queries) Expect(name string, e Expectation) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	query, exists := q.byName[name]
+	if !exists {
+		return fmt.Errorf("no such statement: %q", name)
+	}
+	query.Expect = e
+	return nil
+}
+
+//expectation is what the statement and rows types use to verify an
+//Expectation. All methods can be called on a nil instance, and then do
+//nothing.
+type expectation struct {
+	driver *Driver
+	query  NamedQuery
+}
+
+//lookupQuery finds the given query in Driver.Queries, and returns its name and
+//the expectation that shall be verified for it (if any).
+func (d *Driver) lookupQuery(query string) (string, *expectation) {
+	if d.Queries == nil {
+		return "", nil
+	}
+	nq, exists := d.Queries.Lookup(query)
+	if !exists {
+		return "", nil
+	}
+	if isZeroExpectation(nq.Expect) {
+		return nq.Name, nil
+	}
+	return nq.Name, &expectation{d, nq}
+}
+
+func isZeroExpectation(e Expectation) bool {
+	return e.MaxRows == 0 && !e.ExactlyOneRow && len(e.RequiredColumns) == 0 && e.MaxDuration == 0
+}
+
+//Returns nil if the violation was reported to the ExpectationHook.
+func (e *expectation) violated(format string, args ...interface{}) error {
+	err := ExpectationError{QueryName: e.query.Name, Message: fmt.Sprintf(format, args...)}
+	if hook := e.driver.hooks().ExpectationHook; hook != nil {
+		hook(err)
+		return nil
+	}
+	return err
+}
+
+func (e *expectation) checkDuration(duration time.Duration) error {
+	if e == nil || e.query.Expect.MaxDuration == 0 || duration <= e.query.Expect.MaxDuration {
+		return nil
+	}
+	return e.violated("took %s (expected at most %s)", duration, e.query.Expect.MaxDuration)
+}
+
+func (e *expectation) checkColumns(columns []string) error {
+	if e == nil {
+		return nil
+	}
+	isPresent := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		isPresent[column] = true
+	}
+	var missing []string
+	for _, column := range e.query.Expect.RequiredColumns {
+		if !isPresent[column] {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return e.violated("result set is missing required columns: %s", strings.Join(missing, ", "))
+}
+
+//checkRowCount is called whenever a row was returned, and once when the end
+//of the result set has been reached.
+func (e *expectation) checkRowCount(count int, atEnd bool) error {
+	if e == nil {
+		return nil
+	}
+	expect := e.query.Expect
+	switch {
+	case expect.ExactlyOneRow && atEnd && count == 0:
+		return e.violated("returned no rows (expected exactly one)")
+	case expect.ExactlyOneRow && !atEnd && count == 2:
+		return e.violated("returned more than one row (expected exactly one)")
+	case expect.MaxRows > 0 && !atEnd && count == expect.MaxRows+1:
+		return e.violated("returned more than %d rows", expect.MaxRows)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+//explainSlowQuery runs the Driver's ExplainCommand for the given slow
+//statement on the connection that executed it, and reports the result to the
+//ExplainHook (or logs it if there is no ExplainHook). Only SELECT statements
+//are explained, since other statements could have side effects with EXPLAIN
+//ANALYZE. Statements that were answered by an InterceptHook or DryRun are not
+//explained since the database never saw them.
+func (c *connection) explainSlowQuery(hooks *Hooks, e QueryEvent) {
+	command := c.driver.ExplainCommand
+	if command == "" || e.Err != nil || e.intercepted || e.conn == nil || StatementType(e.Query) != "select" {
+		return
+	}
+	plan, err := explain(e.conn, command+" "+e.Query, e.boundArgs)
+	if hooks.ExplainHook != nil {
+		hooks.ExplainHook(e, plan, err)
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("query", formatQuery(e.Query, nil))}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else {
+		attrs = append(attrs, slog.String("plan", plan))
+	}
+	attrs = append(attrs, e.fieldAttrs()...)
+	slog.Default().LogAttrs(context.Background(), slog.LevelWarn, "query plan for slow SQL statement", attrs...)
+}
+
+//explain runs the given EXPLAIN statement directly on the given proxied
+//connection (i.e. without any hooks) and renders its result set into a
+//string, with one line per row and the columns of each row separated by
+//spaces.
+func explain(conn driver.Conn, query string, args []driver.NamedValue) (string, error) {
+	var lines []string
+	err := queryDirect(context.Background(), conn, query, args, func(row []driver.Value) {
+		fields := make([]string, len(row))
+		for idx, value := range row {
+			if buf, ok := value.([]byte); ok {
+				fields[idx] = string(buf)
+			} else {
+				fields[idx] = fmt.Sprint(value)
+			}
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+//queryDirect runs the given statement directly on the given proxied
+//connection (i.e. without any hooks), and calls the given function for each
+//row of its result set.
+func queryDirect(ctx context.Context, conn driver.Conn, query string, args []driver.NamedValue, eachRow func(row []driver.Value)) error {
+	rows, err := proxiedQuery(ctx, conn, query, args)
+	if err == driver.ErrSkip {
+		var stmt driver.Stmt
+		stmt, err = proxiedPrepare(ctx, conn, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		rows, err = proxiedStmtQuery(ctx, stmt, args)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	row := make([]driver.Value, len(rows.Columns()))
+	for {
+		err := rows.Next(row)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		eachRow(row)
+	}
+}
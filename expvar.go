@@ -0,0 +1,101 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+//PublishExpvar publishes statistics about executed statements through the
+//expvar package (e.g. on /debug/vars) under the given name, and returns the
+//hooks that collect these statistics. This is an alternative to the promhooks
+//package for applications that do not use Prometheus:
+//
+//	sql.Register("postgres-with-stats", sqlproxy.New("postgres",
+//		sqlproxy.WithHooks(sqlproxy.PublishExpvar("sql")),
+//	))
+//
+//The published value is a map with the following keys:
+//
+//	statements          - number of executed statements
+//	errors              - number of statements that returned an error
+//	rows                - number of rows returned or affected by statements
+//	duration_seconds    - total execution time of all statements (see QueryEvent.Duration)
+//	open_connections    - number of currently open connections
+//	errors_by_category  - a map from ClassifyError() to the number of statements
+//	                      that returned an error of that category
+//	tenants             - if Driver.TenantFromContext is set, a map from tenant to
+//	                      the first four values for that tenant's statements
+//
+//Like expvar.Publish(), this panics if the name is already in use. The
+//returned hooks may be used with multiple Drivers to aggregate their
+//statistics.
+func PublishExpvar(name string) Hooks {
+	m := expvar.NewMap(name)
+	//initialize all keys, so that they show up before the first statement
+	for _, key := range []string{"statements", "errors", "rows", "open_connections"} {
+		m.Add(key, 0)
+	}
+	m.AddFloat("duration_seconds", 0)
+	errorsByCategory := new(expvar.Map).Init()
+	m.Set("errors_by_category", errorsByCategory)
+	tenants := new(expvar.Map).Init()
+	m.Set("tenants", tenants)
+	var tenantsMutex sync.Mutex
+
+	return Hooks{
+		AfterQueryHook: func(e QueryEvent) {
+			addQueryEventToExpvar(m, e)
+			if e.Err != nil {
+				errorsByCategory.Add(string(ClassifyError(e.Err)), 1)
+			}
+			if e.Tenant == "" {
+				return
+			}
+			tenantsMutex.Lock()
+			tm, _ := tenants.Get(e.Tenant).(*expvar.Map)
+			if tm == nil {
+				tm = new(expvar.Map).Init()
+				tenants.Set(e.Tenant, tm)
+			}
+			tenantsMutex.Unlock()
+			addQueryEventToExpvar(tm, e)
+		},
+		AfterConnectHook: func(duration time.Duration, err error) {
+			if err == nil {
+				m.Add("open_connections", 1)
+			}
+		},
+		AfterDisconnectHook: func(err error) {
+			m.Add("open_connections", -1)
+		},
+	}
+}
+
+func addQueryEventToExpvar(m *expvar.Map, e QueryEvent) {
+	m.Add("statements", 1)
+	if e.Err != nil {
+		m.Add("errors", 1)
+	}
+	m.Add("rows", e.Rows)
+	m.AddFloat("duration_seconds", e.Duration.Seconds())
+}
@@ -0,0 +1,63 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"expvar"
+	"testing"
+)
+
+//Test_PublishExpvar tests that statistics are published through expvar.
+func Test_PublishExpvar(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithHooks(PublishExpvar("test_sqlproxy"))), "file:"+sqliteFile))
+	db.SetMaxOpenConns(1)
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`))
+	_, err := db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Error("expected DELETE on nonexistent table to fail, but it succeeded")
+	}
+
+	m := expvar.Get("test_sqlproxy").(*expvar.Map)
+	expected := map[string]string{
+		"statements":       "3",
+		"errors":           "1",
+		"rows":             "2",
+		"open_connections": "1",
+	}
+	for key, value := range expected {
+		if actual := m.Get(key).String(); actual != value {
+			tt.Unexpected(key, value, actual)
+		}
+	}
+	if actual := m.Get("errors_by_category").String(); actual != `{"syntax": 1}` {
+		tt.Unexpected("errors_by_category", `{"syntax": 1}`, actual)
+	}
+	tt.Must(db.Close())
+	if actual := m.Get("open_connections").String(); actual != "0" {
+		tt.Unexpected("open_connections", "0", actual)
+	}
+
+	tt.CleanupDB()
+}
@@ -0,0 +1,114 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+)
+
+//fakeDriver is a minimal SQL driver for testing how the proxy handles optional
+//driver features that neither sqlite3 nor postgres support. Its statements do
+//not parse SQL; executing any statement just calls fakeExec.
+type fakeDriver struct{}
+
+type fakeConn struct{}
+
+type fakeStmt struct {
+	query string
+}
+
+var fakeExec func(ctx context.Context, query string, args []driver.NamedValue) error
+
+func init() {
+	sql.Register("fake+nothing", &Driver{ProxiedDriver: fakeDriver{}})
+}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{query}, nil
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+//ExecContext rejects the fast path for one-off statements, like some real
+//drivers do when arguments are given.
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+//CheckNamedValue accepts sql.Out in addition to the usual types.
+func (fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := nv.Value.(sql.Out); ok {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (fakeStmt) Close() error {
+	return nil
+}
+
+func (fakeStmt) NumInput() int {
+	return -1
+}
+
+//ColumnConverter converts strings to upper case, to check that the proxy uses
+//this converter.
+func (fakeStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return upperCaseConverter{}
+}
+
+type upperCaseConverter struct{}
+
+func (upperCaseConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if s, ok := v.(string); ok {
+		return strings.ToUpper(s), nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	panic("unreachable")
+}
+
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	panic("unreachable")
+}
+
+func (s fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	err := fakeExec(ctx, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.ResultNoRows, nil
+}
@@ -0,0 +1,307 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+//InjectedError is an error with a SQLSTATE code, for use in FaultRule.Err.
+//It satisfies the same interface as the errors of PostgreSQL drivers like
+//github.com/jackc/pgx (a SQLState() method), so it is recognized by
+//ClassifyError() and by error handling code that checks SQLSTATE codes.
+type InjectedError struct {
+	Code    string
+	Message string
+}
+
+//Error implements the builtin/error interface.
+func (e InjectedError) Error() string {
+	return fmt.Sprintf("%s (SQLSTATE %s, injected by sqlproxy)", e.Message, e.Code)
+}
+
+//SQLState returns the SQLSTATE code of this error.
+func (e InjectedError) SQLState() string {
+	return e.Code
+}
+
+//Errors for common failure modes, for use in FaultRule.Err.
+var (
+	ErrInjectedDeadlock             = InjectedError{Code: "40P01", Message: "deadlock detected"}
+	ErrInjectedSerializationFailure = InjectedError{Code: "40001", Message: "could not serialize access due to concurrent update"}
+	ErrInjectedStatementTimeout     = InjectedError{Code: "57014", Message: "canceling statement due to statement timeout"}
+	ErrInjectedUniqueViolation      = InjectedError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+	ErrInjectedForeignKeyViolation  = InjectedError{Code: "23503", Message: "insert or update violates foreign key constraint"}
+	ErrInjectedConnectionFailure    = InjectedError{Code: "08006", Message: "connection failure"}
+)
+
+//FaultRule declares which statements shall be delayed or fail with which
+//error (see FaultInjector). At most one of Fingerprint and Pattern may be set.
+//If neither is set, the rule applies to all statements (of the given
+//StatementType, if any). At least one of Err, Delay and DelayDistribution must
+//be set.
+type FaultRule struct {
+	//Fingerprint selects statements with the same fingerprint as this
+	//statement (see Normalize).
+	Fingerprint string
+	//Pattern selects statements matching this regular expression.
+	Pattern string
+	//StatementType (optional) restricts the rule to statements of this type
+	//(see StatementType), e.g. "select" or "update".
+	StatementType string
+	//Probability (optional) is the probability between 0 and 1 with which a
+	//selected statement is affected. The default (0) means that every
+	//selected statement is affected.
+	Probability float64
+	//Delay (optional) is waited before the statement is executed (or fails
+	//with Err), to simulate a slow database. If the context of the statement
+	//expires during the delay, the statement fails with the context's error.
+	Delay time.Duration
+	//DelayDistribution (optional) returns a random delay for each affected
+	//statement, e.g. UniformDelay() or ExponentialDelay(). It shall draw from
+	//the given random number generator (which belongs to the FaultInjector),
+	//so that delays are reproducible with the same seed. If set, Delay is
+	//ignored.
+	DelayDistribution func(rng *rand.Rand) time.Duration
+	//Err (optional) is returned instead of executing the statement. It can be
+	//one of the ErrInjected... values, or any other error, e.g. one of the
+	//error types of the proxied driver.
+	Err error
+}
+
+//UniformDelay returns a FaultRule.DelayDistribution that picks delays
+//uniformly between min and max.
+func UniformDelay(min, max time.Duration) func(rng *rand.Rand) time.Duration {
+	return func(rng *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(rng.Int64N(int64(max-min)))
+	}
+}
+
+//ExponentialDelay returns a FaultRule.DelayDistribution that picks delays
+//from an exponential distribution with the given mean. This resembles the
+//long tail of real database latencies: most delays are short, but some are
+//several times the mean.
+func ExponentialDelay(mean time.Duration) func(rng *rand.Rand) time.Duration {
+	return func(rng *rand.Rand) time.Duration {
+		return time.Duration(rng.ExpFloat64() * float64(mean))
+	}
+}
+
+//FaultInjector delays selected statements or makes them fail with a given
+//error instead of executing them, to test the application's error handling,
+//timeouts and circuit breakers against failures and slowness that are hard to
+//provoke on a real database. For example:
+//
+//	faults, err := sqlproxy.NewFaultInjector(
+//		sqlproxy.FaultRule{Pattern: `^UPDATE accounts\b`, Probability: 0.1, Err: sqlproxy.ErrInjectedDeadlock},
+//		sqlproxy.FaultRule{Fingerprint: "INSERT INTO users (name) VALUES ($1)", Err: sqlproxy.ErrInjectedUniqueViolation},
+//		sqlproxy.FaultRule{StatementType: "select", DelayDistribution: sqlproxy.ExponentialDelay(200 * time.Millisecond)},
+//	)
+//	...
+//	sql.Register("postgres-with-faults", sqlproxy.New("postgres", sqlproxy.WithFaultInjector(faults)))
+//
+//Rules are checked in order, and the first rule that selects the statement
+//and passes its Probability decides the delay and error. Faults are injected
+//when a statement is executed, not when it is prepared, so the injected
+//delays and errors are seen by the AfterQueryHook (as part of
+//QueryEvent.Duration and QueryEvent.Err) and counted in Stats like real ones.
+//
+//All random decisions (see FaultRule.Probability and
+//FaultRule.DelayDistribution) are drawn from a single random number generator.
+//To reproduce a failing test run, log the Seed() and use it with
+//NewSeededFaultInjector(). Like for Chaos, the order of decisions is only
+//deterministic if statements are executed one at a time, and both runs can
+//write their decisions to a DecisionLog for comparison.
+type FaultInjector struct {
+	//DecisionLog (optional) receives one line for each statement that is
+	//selected by a rule, e.g. `3: fault rule 1 roll=0.012345 affected=true
+	//delay=0s query="SELECT ..."`. It must not be changed after the
+	//FaultInjector has been given to a Driver.
+	DecisionLog io.Writer
+
+	rules  []faultRule
+	random *seededRandom
+	//for unit tests
+	roll  func() float64
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type faultRule struct {
+	spec     FaultRule
+	fp       string
+	rx       *regexp.Regexp
+	injected atomic.Uint64
+}
+
+//NewFaultInjector compiles the given rules into a FaultInjector with a random
+//seed (see Seed).
+func NewFaultInjector(rules ...FaultRule) (*FaultInjector, error) {
+	return NewSeededFaultInjector(rand.Uint64(), rules...)
+}
+
+//NewSeededFaultInjector is like NewFaultInjector, but uses the given seed for
+//all random decisions.
+func NewSeededFaultInjector(seed uint64, rules ...FaultRule) (*FaultInjector, error) {
+	f := &FaultInjector{rules: make([]faultRule, len(rules)), random: newSeededRandom(seed), sleep: sleepContext}
+	for idx, spec := range rules {
+		rule := &f.rules[idx]
+		rule.spec = spec
+		switch {
+		case spec.Err == nil && spec.Delay <= 0 && spec.DelayDistribution == nil:
+			return nil, fmt.Errorf("sqlproxy: fault rule %d: one of Err, Delay and DelayDistribution must be given", idx+1)
+		case spec.Probability < 0 || spec.Probability > 1:
+			return nil, fmt.Errorf("sqlproxy: fault rule %d: Probability must be between 0 and 1", idx+1)
+		case spec.Fingerprint != "" && spec.Pattern != "":
+			return nil, fmt.Errorf("sqlproxy: fault rule %d: Fingerprint and Pattern cannot be given at the same time", idx+1)
+		case spec.Fingerprint != "":
+			rule.fp = Normalize(spec.Fingerprint)
+		case spec.Pattern != "":
+			var err error
+			rule.rx, err = regexp.Compile(spec.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("sqlproxy: fault rule %d: %w", idx+1, err)
+			}
+		}
+	}
+	return f, nil
+}
+
+//Apply waits for the delay that the given statement shall be delayed by, if
+//any, and then returns the error that it shall fail with, or nil if it shall
+//be executed normally.
+func (f *FaultInjector) Apply(ctx context.Context, query string) error {
+	var fp, statementType string
+	for idx := range f.rules {
+		rule := &f.rules[idx]
+		if rule.spec.StatementType != "" {
+			if statementType == "" {
+				statementType = StatementType(query)
+			}
+			if statementType != rule.spec.StatementType {
+				continue
+			}
+		}
+		switch {
+		case rule.rx != nil:
+			if !rule.rx.MatchString(query) {
+				continue
+			}
+		case rule.fp != "":
+			if fp == "" {
+				fp = Normalize(query)
+			}
+			if fp != rule.fp {
+				continue
+			}
+		}
+		affected, delay := f.decide(idx, query)
+		if !affected {
+			continue
+		}
+		rule.injected.Add(1)
+		if delay > 0 {
+			if err := f.sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+		return rule.spec.Err
+	}
+	return nil
+}
+
+//decide makes the random decisions for a statement that was selected by the
+//given rule: whether it is affected (see FaultRule.Probability), and if so,
+//how long it shall be delayed.
+func (f *FaultInjector) decide(ruleIdx int, query string) (affected bool, delay time.Duration) {
+	spec := f.rules[ruleIdx].spec
+	f.random.decide(f.DecisionLog, func(rng *rand.Rand) string {
+		affected = true
+		roll := ""
+		if spec.Probability > 0 {
+			value := rng.Float64()
+			if f.roll != nil {
+				value = f.roll()
+			}
+			affected = value < spec.Probability
+			roll = fmt.Sprintf(" roll=%.6f", value)
+		}
+		if affected {
+			delay = spec.Delay
+			if spec.DelayDistribution != nil {
+				delay = spec.DelayDistribution(rng)
+			}
+		}
+		return fmt.Sprintf("fault rule %d%s affected=%t delay=%s query=%q", ruleIdx+1, roll, affected, delay, query)
+	})
+	return affected, delay
+}
+
+//Seed returns the seed of the random number generator behind all random
+//decisions of this FaultInjector.
+func (f *FaultInjector) Seed() uint64 {
+	return f.random.seed
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//InjectedCounts returns how many statements were affected by each rule,
+//indexed like the rules given to NewFaultInjector().
+func (f *FaultInjector) InjectedCounts() []uint64 {
+	result := make([]uint64, len(f.rules))
+	for idx := range f.rules {
+		result[idx] = f.rules[idx].injected.Load()
+	}
+	return result
+}
+
+//injectFault applies Driver.Chaos, Driver.ChaosSchedule and
+//Driver.FaultInjector to the given statement, if any.
+func (c *connection) injectFault(ctx context.Context, query string) error {
+	if err := c.checkChaos(); err != nil {
+		return err
+	}
+	if c.driver.ChaosSchedule != nil {
+		if err := c.driver.ChaosSchedule.apply(ctx, query); err != nil {
+			return err
+		}
+	}
+	if c.driver.FaultInjector == nil {
+		return nil
+	}
+	return c.driver.FaultInjector.Apply(ctx, query)
+}
@@ -0,0 +1,197 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_FaultInjector(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	errCustom := errors.New("custom failure")
+	faults, err := NewFaultInjector(
+		FaultRule{Pattern: `^INSERT INTO users\b`, Err: ErrInjectedUniqueViolation},
+		FaultRule{Fingerprint: "SELECT name FROM users WHERE id = 42", Probability: 0.5, Err: ErrInjectedDeadlock},
+		FaultRule{Pattern: `^SELECT name FROM users`, Probability: 0.5, Err: errCustom},
+	)
+	tt.Must(err)
+	randomValues := []float64{0.7, 0.2, 0.3}
+	faults.roll = func() float64 {
+		value := randomValues[0]
+		randomValues = randomValues[1:]
+		return value
+	}
+
+	var events []QueryEvent
+	d := New("sqlite3", WithFaultInjector(faults), WithAfterQuery(func(e QueryEvent) {
+		events = append(events, e)
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`))
+
+	_, err = db.Exec(`INSERT INTO users (id, name) VALUES (1, 'alice')`)
+	if !errors.Is(err, ErrInjectedUniqueViolation) {
+		t.Errorf("expected unique violation, got %v", err)
+	}
+	if ClassifyError(err) != ErrorCategoryConstraint {
+		t.Errorf("expected injected error to be classified as constraint violation, got %q", ClassifyError(err))
+	}
+
+	//first query: rule 2 does not fire (0.7), rule 3 fires (0.2)
+	_, err = db.Query(`SELECT name FROM users WHERE id = 23`)
+	if !errors.Is(err, errCustom) {
+		t.Errorf("expected custom error, got %v", err)
+	}
+	//second query: rule 2 fires (0.3)
+	stmt, err := db.Prepare(`SELECT name FROM users WHERE id = 23`)
+	tt.Must(err)
+	_, err = stmt.Query()
+	if !errors.Is(err, ErrInjectedDeadlock) {
+		t.Errorf("expected deadlock, got %v", err)
+	}
+	tt.Must(stmt.Close())
+
+	if !reflect.DeepEqual(faults.InjectedCounts(), []uint64{1, 1, 1}) {
+		tt.Unexpected("injected counts", []uint64{1, 1, 1}, faults.InjectedCounts())
+	}
+	if len(events) != 4 || events[3].Err == nil {
+		t.Errorf("expected injected errors to be reported to the AfterQueryHook, got %#v", events)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_NewFaultInjectorErrors(t *testing.T) {
+	testCases := map[string]FaultRule{
+		"sqlproxy: fault rule 1: one of Err, Delay and DelayDistribution must be given":    {Pattern: "x"},
+		"sqlproxy: fault rule 1: Probability must be between 0 and 1":                      {Probability: 1.5, Err: ErrInjectedDeadlock},
+		"sqlproxy: fault rule 1: Fingerprint and Pattern cannot be given at the same time": {Fingerprint: "x", Pattern: "x", Err: ErrInjectedDeadlock},
+	}
+	for expected, rule := range testCases {
+		_, err := NewFaultInjector(rule)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q, got %v", expected, err)
+		}
+	}
+}
+
+func Test_FaultInjectorDelays(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	faults, err := NewFaultInjector(
+		FaultRule{StatementType: "insert", Delay: 5 * time.Second},
+		FaultRule{StatementType: "select", DelayDistribution: func(*rand.Rand) time.Duration { return 3 * time.Second }, Err: ErrInjectedStatementTimeout},
+	)
+	tt.Must(err)
+	var delays []time.Duration
+	faults.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithFaultInjector(faults)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (id, name) VALUES (1, 'alice')`))
+	_, err = db.Query(`SELECT name FROM users`)
+	if !errors.Is(err, ErrInjectedStatementTimeout) {
+		t.Errorf("expected statement timeout, got %v", err)
+	}
+	expected := []time.Duration{5 * time.Second, 3 * time.Second}
+	if !reflect.DeepEqual(delays, expected) {
+		tt.Unexpected("delays", expected, delays)
+	}
+
+	//with the real sleep, the delay is cut short by the context deadline
+	faults.sleep = sleepContext
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	startedAt := time.Now()
+	_, err = db.ExecContext(ctx, `INSERT INTO users (id, name) VALUES (2, 'bob')`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline to be exceeded, got %v", err)
+	}
+	if time.Since(startedAt) > time.Second {
+		t.Error("delay was not interrupted by the context deadline")
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_DelayDistributions(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 1))
+	uniform := UniformDelay(time.Second, 2*time.Second)
+	for range 100 {
+		d := uniform(rng)
+		if d < time.Second || d >= 2*time.Second {
+			t.Fatalf("UniformDelay returned %s", d)
+		}
+		if ExponentialDelay(time.Second)(rng) < 0 {
+			t.Fatal("ExponentialDelay returned a negative delay")
+		}
+	}
+}
+
+func Test_FaultInjectorIsReproducible(t *testing.T) {
+	tt := TT{t}
+
+	run := func(seed uint64) string {
+		faults, err := NewSeededFaultInjector(seed,
+			FaultRule{StatementType: "select", Probability: 0.5, DelayDistribution: UniformDelay(time.Millisecond, time.Second)},
+			FaultRule{StatementType: "update", Err: ErrInjectedDeadlock},
+		)
+		tt.Must(err)
+		if faults.Seed() != seed {
+			tt.Unexpected("seed", seed, faults.Seed())
+		}
+		faults.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+		var log bytes.Buffer
+		faults.DecisionLog = &log
+		for idx := range 50 {
+			faults.Apply(context.Background(), fmt.Sprintf("SELECT %d", idx))
+		}
+		faults.Apply(context.Background(), "UPDATE users SET name = 'x'")
+		return log.String()
+	}
+
+	log := run(42)
+	if !strings.HasPrefix(log, "1: fault rule 1 roll=") || !strings.Contains(log, "51: fault rule 2 affected=true delay=0s query=\"UPDATE users SET name = 'x'\"\n") {
+		t.Errorf("unexpected decision log:\n%s", log)
+	}
+	if run(42) != log {
+		t.Error("fault injectors with the same seed made different decisions")
+	}
+	if run(43) == log {
+		t.Error("fault injectors with different seeds made the same decisions")
+	}
+}
@@ -0,0 +1,115 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+//LoadFixtureFiles reads the files matching the given patterns (see
+//fs.Glob) from the given file system, e.g. for use in Driver.Fixtures:
+//
+//	//go:embed testdata/*.sql
+//	var fixtures embed.FS
+//
+//	statements, err := sqlproxy.LoadFixtureFiles(fixtures, "testdata/*.sql")
+//	...
+//	sql.Register("postgres-test", sqlproxy.New("postgres", sqlproxy.WithFixtures(statements...)))
+//
+//Within each pattern, the files are returned in lexical order, so their names
+//can be prefixed with numbers to define the order of execution. Each file is
+//returned as a single statement, so files containing multiple statements only
+//work with drivers that support this (e.g. lib/pq and mattn/go-sqlite3 when
+//the statement has no arguments). A pattern that does not match any files is
+//an error.
+func LoadFixtureFiles(fsys fs.FS, patterns ...string) ([]string, error) {
+	var result []string
+	for _, pattern := range patterns {
+		paths, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("sqlproxy: no fixture files match %q", pattern)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			buf, err := fs.ReadFile(fsys, path)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, string(buf))
+		}
+	}
+	return result, nil
+}
+
+//loadFixtures implements Driver.Fixtures. It is called for each new
+//connection before the connection is handed to database/sql.
+func (c *connection) loadFixtures(ctx context.Context) error {
+	d := c.driver
+	if len(d.Fixtures) == 0 {
+		return nil
+	}
+	//hold the lock while executing, so that concurrent connections wait until
+	//the fixtures are in place
+	d.fixturesMutex.Lock()
+	defer d.fixturesMutex.Unlock()
+	if d.fixturesLoaded {
+		return nil
+	}
+	//execute all fixtures in one transaction, so that a failure does not
+	//leave a partial set of fixtures behind that would break the retry (if
+	//the driver does not support transactions, there is nothing to roll back)
+	tx, err := c.beginFixtures(ctx)
+	if err != nil {
+		tx = nil
+	}
+	for idx, statement := range d.Fixtures {
+		err := c.execCommand(ctx, c.conn, statement)
+		if err != nil {
+			if tx != nil {
+				_ = tx.Rollback() //the fixture error is more useful than this one
+			}
+			return fmt.Errorf("sqlproxy: cannot execute fixture %d: %w", idx, err)
+		}
+	}
+	if tx != nil {
+		err := tx.Commit()
+		if err != nil {
+			return fmt.Errorf("sqlproxy: cannot commit fixtures: %w", c.checkError(err))
+		}
+	}
+	d.fixturesLoaded = true
+	return nil
+}
+
+//beginFixtures starts the transaction for loadFixtures() directly on the
+//proxied connection, bypassing the hooks and chaos checks in BeginTx().
+func (c *connection) beginFixtures(ctx context.Context) (driver.Tx, error) {
+	if cbt, ok := c.conn.(driver.ConnBeginTx); ok {
+		return cbt.BeginTx(ctx, driver.TxOptions{})
+	}
+	return c.conn.Begin()
+}
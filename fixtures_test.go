@@ -0,0 +1,126 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_Fixtures(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	fsys := fstest.MapFS{
+		"fixtures/02-data.sql":   {Data: []byte(`INSERT INTO users (name) VALUES ('alice'), ('bob');`)},
+		"fixtures/01-schema.sql": {Data: []byte(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);`)},
+		"fixtures/README.md":     {Data: []byte(`not a fixture`)},
+	}
+	statements, err := LoadFixtureFiles(fsys, "fixtures/*.sql")
+	tt.Must(err)
+	if len(statements) != 2 || !strings.HasPrefix(statements[0], "CREATE TABLE") {
+		t.Fatalf("unexpected fixture statements: %#v", statements)
+	}
+
+	var queries []string
+	d := New("sqlite3", WithFixtures(statements...), WithAfterQuery(func(e QueryEvent) {
+		queries = append(queries, e.Query)
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	db.SetMaxIdleConns(0)
+
+	//the fixtures are executed only once, even though each statement runs on
+	//a new connection (a second execution would fail on CREATE TABLE)
+	for range 3 {
+		var count int
+		tt.Must(db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count))
+		if count != 2 {
+			tt.Unexpected("count", 2, count)
+		}
+	}
+	tt.Must(db.Close())
+	//no hooks run for fixtures
+	expected := []string{`SELECT COUNT(*) FROM users`, `SELECT COUNT(*) FROM users`, `SELECT COUNT(*) FROM users`}
+	if !reflect.DeepEqual(queries, expected) {
+		tt.Unexpected("queries", expected, queries)
+	}
+	tt.CleanupDB()
+}
+
+func Test_FixturesFailure(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	d := New("sqlite3", WithFixtures(`CREATE TABLE users (id INTEGER)`, `INSERT INTO nonexistent VALUES (1)`))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	err := db.Ping()
+	if err == nil || !strings.Contains(err.Error(), "cannot execute fixture 1") {
+		t.Errorf("expected fixture error, got %v", err)
+	}
+	//the fixtures were rolled back, so the retry on the next connection starts
+	//over and fails in the same place
+	err = db.Ping()
+	if err == nil || !strings.Contains(err.Error(), "cannot execute fixture 1") {
+		t.Errorf("expected fixture error on retry, got %v", err)
+	}
+	tt.Must(db.Close())
+	db = sql.OpenDB(NewConnector(New("sqlite3"), "file:"+sqliteFile))
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'users'`).Scan(&count))
+	if count != 0 {
+		t.Error("expected fixtures to be rolled back")
+	}
+	tt.Must(db.Close())
+
+	//without transaction support, the retry executes all fixtures again on top
+	//of the partially applied ones
+	var executed []string
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		executed = append(executed, query)
+		if query == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	}
+	db = sql.OpenDB(NewConnector(New("", WithProxiedDriver(fakeDriver{}), WithFixtures("create", "fail")), ""))
+	for range 2 {
+		err = db.Ping()
+		if err == nil || !strings.Contains(err.Error(), "cannot execute fixture 1") {
+			t.Errorf("expected fixture error, got %v", err)
+		}
+	}
+	tt.Must(db.Close())
+	expected := []string{"create", "fail", "create", "fail"}
+	if !reflect.DeepEqual(executed, expected) {
+		tt.Unexpected("executed fixtures", expected, executed)
+	}
+
+	_, err = LoadFixtureFiles(fstest.MapFS{}, "*.sql")
+	if err == nil || !strings.Contains(err.Error(), `no fixture files match "*.sql"`) {
+		t.Errorf("expected error for unmatched pattern, got %v", err)
+	}
+	tt.CleanupDB()
+}
@@ -0,0 +1,461 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Hooks contains the hooks that a Driver calls while proxying statements. All
+//hooks are optional.
+type Hooks struct {
+	//BeforePrepareHook runs just before a query is prepared (both for
+	//explicit Prepare() calls and one-off queries). The return value will be
+	//substituted for the original query string, allowing the hook to rewrite
+	//queries arbitrarily. If an error is returned, it will be propagated to the
+	//caller of db.Prepare() or tx.Prepare() etc.
+	BeforePrepareHook func(query string) (string, error)
+	//BeforeQueryHook runs just before a query is executed, e.g. by
+	//the Exec(), Query() or QueryRows() methods of sql.DB, sql.Tx and sql.Stmt.
+	//Named arguments (see sql.Named) appear in args as sql.NamedArg values.
+	BeforeQueryHook func(query string, args []interface{})
+	//RowTransformHook runs whenever a query returns a result set. It
+	//may return a list of transformations that will be applied, in order, to
+	//the rows while they are streamed to the caller. This can be used e.g. to
+	//strip internal columns from results without rewriting the query itself.
+	RowTransformHook func(query string) []RowTransform
+	//AfterConnectHook runs whenever database/sql has requested a new
+	//connection, with the time it took until the connection was ready for use
+	//(or until establishing it failed). Time spent waiting for a free
+	//connection in the pool is not included; see sql.DBStats.WaitDuration for
+	//that.
+	AfterConnectHook func(duration time.Duration, err error)
+	//AfterDisconnectHook runs whenever a connection that was established
+	//successfully has been closed, with the error returned by the proxied
+	//driver (if any). Together with AfterConnectHook, this can be used to
+	//track the number of open connections.
+	AfterDisconnectHook func(err error)
+	//ExpectationHook runs when a statement violates its
+	//Expectation. If not set, violations are reported as errors to the caller
+	//instead. Note that, for statements that were executed successfully but
+	//too slowly, this means that the caller sees an error even though the
+	//statement's effects have taken place.
+	ExpectationHook func(err ExpectationError)
+	//AfterQueryHook runs after a statement has been executed, e.g. by the
+	//Exec(), Query() or QueryRow() methods of sql.DB, sql.Tx and sql.Stmt. For
+	//statements that return rows, it runs when the rows are closed, such that
+	//the number of rows and any error encountered while reading them can be
+	//reported. See type QueryEvent for details.
+	AfterQueryHook func(e QueryEvent)
+	//SlowQueryHook runs after the AfterQueryHook for statements that took
+	//longer than the Driver's SlowQueryThreshold. If not set, slow statements
+	//are logged through log/slog instead.
+	SlowQueryHook func(e QueryEvent)
+	//ExplainHook receives the query plans of slow statements if the Driver's
+	//ExplainCommand is set. The plan contains one line per row returned by
+	//the EXPLAIN statement. If the EXPLAIN statement failed, err is set
+	//instead.
+	ExplainHook func(e QueryEvent, plan string, err error)
+	//RepeatedQueryHook receives reports about statements that were executed
+	//more often than the Driver's RepeatedQueryThreshold within a single
+	//transaction or query scope (see BeginQueryScope), which usually
+	//indicates an N+1 query problem. It runs when the transaction or query
+	//scope ends. If not set, these reports are logged through log/slog
+	//instead.
+	RepeatedQueryHook func(e RepeatedQueryEvent)
+	//DuplicateQueryHook receives reports about identical statements that
+	//were executed more than once within a single transaction, if the
+	//Driver's DetectDuplicateQueries flag is set. It runs when the
+	//transaction is committed or rolled back. If not set, these reports are
+	//logged through log/slog instead.
+	DuplicateQueryHook func(e DuplicateQueryEvent)
+	//SuspiciousQueryHook runs before the execution of statements that look
+	//like the result of SQL injection, if the Driver's DetectInjection flag is
+	//set. If not set, these reports are logged through log/slog instead.
+	SuspiciousQueryHook func(e SuspiciousQueryEvent)
+	//LiteralQueryHook runs before the execution of statements that contain
+	//literals where a bind parameter would be expected, if the Driver's
+	//DetectLiterals flag is set. If not set, these reports are logged through
+	//log/slog instead.
+	LiteralQueryHook func(e LiteralQueryEvent)
+	//ParsedStatementHook runs before a statement is prepared or executed, if
+	//Driver.Parser is set and was able to parse the statement, with the
+	//statement's AST (as returned by the Parser). If an error is returned,
+	//the statement is not executed and the error is propagated to the caller.
+	ParsedStatementHook func(query string, ast interface{}) error
+	//TooManyRowsHook runs when a result set has more rows than
+	//Driver.MaxRows allows. The event's Err is the TooManyRowsError that is
+	//returned to the caller, and its Rows is the number of rows read so far.
+	TooManyRowsHook func(e QueryEvent)
+	//InterceptHook runs just before a statement is executed, with the query
+	//string as it would be given to the proxied driver and the original
+	//(unredacted) arguments. If it returns an Interception, the statement is
+	//not executed on the database, and the Interception is returned to the
+	//caller instead. If it returns nil, the statement is executed normally.
+	//This allows tests or feature flags to answer specific statements
+	//without a database. Note that statements that are prepared explicitly
+	//(e.g. with sql.DB.Prepare) are still prepared on the database.
+	InterceptHook func(ctx context.Context, query string, args []interface{}) *Interception
+	//DryRunHook runs for each statement that is not executed because
+	//Driver.DryRun is set. If Driver.DryRunCountRows is set, the event's Rows
+	//is the number of rows that would have been affected. If not set, these
+	//statements are logged through log/slog instead.
+	DryRunHook func(e QueryEvent)
+	//ShadowQueryHook runs for each statement that was mirrored to the
+	//secondary database of Driver.Shadow, with the duration, row count and
+	//error observed there. It runs on a worker goroutine of the Shadow, not
+	//on the goroutine that executed the original statement. If not set,
+	//mirrored statements that fail are logged through log/slog instead.
+	ShadowQueryHook func(e QueryEvent)
+	//DivergenceHook runs when a statement mirrored by Driver.Shadow in
+	//canary mode returned a different result on the secondary database (see
+	//Shadow.CompareReads). It runs on a worker goroutine of the Shadow. If
+	//not set, divergences are logged through log/slog instead.
+	DivergenceHook func(e DivergenceEvent)
+	//AfterCommitHook runs after a transaction has been committed (even if the
+	//commit failed). See type TransactionEvent for details.
+	AfterCommitHook func(e TransactionEvent)
+	//AfterRollbackHook runs after a transaction has been rolled back (even if
+	//the rollback failed). See type TransactionEvent for details.
+	AfterRollbackHook func(e TransactionEvent)
+	//CorrelationHook extracts fields like request IDs or user IDs from the
+	//context of a statement (as given to e.g. sql.DB.QueryContext). The result
+	//is stored in QueryEvent.Fields, and appears as additional attributes in
+	//all log messages produced by this package through log/slog.
+	CorrelationHook func(ctx context.Context) map[string]string
+	//CommentHook extracts key-value pairs like trace IDs, routes or the
+	//application name from the context of a statement. If it returns a
+	//non-empty map, the pairs are appended to the statement as a comment in
+	//the format defined by sqlcommenter (https://google.github.io/sqlcommenter/spec/),
+	//so that tools on the database side can attribute the statement to the
+	//application request that issued it. The comment is added after the
+	//BeforePrepareHook has run. Statements that already contain a "/*"
+	//comment are not modified. Note that, since the comment usually differs
+	//between requests, this defeats caching of statements on the database
+	//side.
+	CommentHook func(ctx context.Context) map[string]string
+	//RouteHook decides whether a statement is executed on the primary or on a
+	//replica (see Driver.ReplicaDataSources), e.g. to read one's own writes
+	//from the primary. It receives the context and the query string after the
+	//BeforePrepareHook, and can return RouteDefault to leave the decision to
+	//the default routing.
+	RouteHook func(ctx context.Context, query string) Route
+	//ReplicaWarmupHook receives the progress of the warm-up of each replica
+	//(see Driver.ReplicaWarmup). It runs on a background goroutine. If not
+	//set, failed warm-up statements are logged through log/slog instead.
+	ReplicaWarmupHook func(e ReplicaWarmupEvent)
+}
+
+//QueryEvent describes an executed statement. It is given to the
+//AfterQueryHook.
+type QueryEvent struct {
+	//Query is the query string as sent to the proxied driver, i.e. after the
+	//BeforePrepareHook has been applied.
+	Query string
+	//Args are the arguments bound to the statement, in the same form as given
+	//to the BeforeQueryHook. If Driver.Redactor is set, sensitive arguments
+	//have been replaced.
+	Args []interface{}
+	//Duration is the time until the proxied driver returned from Exec() or
+	//Query(). For queries, the time spent reading the rows is not included.
+	Duration time.Duration
+	//Rows is the number of rows affected by an Exec(), or the number of rows
+	//read from a Query() before the rows were closed.
+	Rows int64
+	//Err is the error returned to the caller, if any. For queries, this
+	//includes errors that occurred while reading the rows.
+	Err error
+	//ConnectionID identifies the connection on which the statement was
+	//executed. IDs are unique within the process.
+	ConnectionID uint64
+	//Fields contains the result of the CorrelationHook, if any.
+	Fields map[string]string
+	//Caller is the function, source file and line in the application that
+	//issued the statement, if Driver.CaptureCaller is set.
+	Caller string
+	//Tenant is the result of Driver.TenantFromContext, if any.
+	Tenant string
+	//QueryName is the name of the statement in Driver.Queries, if it was
+	//registered there (see Queries).
+	QueryName string
+	//Replica is true if the statement was executed on a replica (see
+	//Driver.ReplicaDataSources).
+	Replica bool
+	//AST is the result of Driver.Parser for this statement, if any. If the
+	//statement could not be parsed, AST is nil and ParseError is set instead.
+	AST        interface{}
+	ParseError error
+	//Tables lists the tables that the statement refers to, if
+	//Driver.ListTables is set.
+	Tables []TableRef
+
+	//the transaction or query scope that the statement was executed in, if
+	//any (see RepeatedQueryHook)
+	scope *queryScope
+	//the request trace that the statement is recorded in, if any (see
+	//BeginRequestTrace)
+	trace *RequestTrace
+	//the ID under which the statement is registered in the Driver's
+	//Inspector, if any
+	inspectorID uint64
+	//the context returned by Tracer.StartSpan, if any
+	spanContext context.Context
+	//the parts of the result that are written by Driver.Recorder, if any
+	recording *recordedResult
+	//the result that is compared by Driver.Shadow, if any
+	shadow *shadowComparison
+	//the arguments and the connection that the statement was executed with,
+	//for explaining it afterwards (Args may be redacted, and the connection
+	//may be a replica)
+	boundArgs []driver.NamedValue
+	conn      driver.Conn
+	//whether the statement was answered by an InterceptHook or DryRun
+	//instead of the database
+	intercepted bool
+}
+
+//detached returns a copy of this event without references to internal state,
+//for events that are retained after the statement has finished.
+func (e QueryEvent) detached() QueryEvent {
+	e.scope = nil
+	e.trace = nil
+	e.inspectorID = 0
+	e.spanContext = nil
+	e.recording = nil
+	e.shadow = nil
+	e.boundArgs = nil
+	e.conn = nil
+	return e
+}
+
+//fieldAttrs renders e.Tenant, e.QueryName, e.Caller and e.Fields into slog
+//attributes, the latter sorted by key.
+func (e QueryEvent) fieldAttrs() []slog.Attr {
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var attrs []slog.Attr
+	if e.Tenant != "" {
+		attrs = append(attrs, slog.String("tenant", e.Tenant))
+	}
+	if e.QueryName != "" {
+		attrs = append(attrs, slog.String("query_name", e.QueryName))
+	}
+	if e.Caller != "" {
+		attrs = append(attrs, slog.String("caller", e.Caller))
+	}
+	for _, key := range keys {
+		attrs = append(attrs, slog.String(key, e.Fields[key]))
+	}
+	return attrs
+}
+
+//TransactionEvent describes a finished transaction. It is given to the
+//AfterCommitHook or AfterRollbackHook.
+type TransactionEvent struct {
+	//Duration is the time from the start of the transaction until the commit
+	//or rollback has completed.
+	Duration time.Duration
+	//Statements is the number of statements executed within the transaction.
+	Statements int
+	//Rows is the sum of QueryEvent.Rows over all statements executed within
+	//the transaction.
+	Rows int64
+	//Err is the error returned by the commit or rollback, if any.
+	Err error
+	//ConnectionID is the same as in QueryEvent.
+	ConnectionID uint64
+	//Fields contains the result of the CorrelationHook for the context given
+	//to BeginTx(), if any.
+	Fields map[string]string
+	//Tenant is the result of Driver.TenantFromContext for the context given
+	//to BeginTx(), if any.
+	Tenant string
+	//Tag is the tag given to WithTransactionTag() for the context given to
+	//BeginTx(), if any.
+	Tag string
+	//ReadOnly is whether all statements in the transaction were read-only
+	//(see IsReadOnlyStatement). This is only computed for tagged
+	//transactions if Driver.AutoReadOnlyTransactions is set.
+	ReadOnly bool
+	//AutoReadOnly is whether the transaction was started as READ ONLY by
+	//Driver.AutoReadOnlyTransactions.
+	AutoReadOnly bool
+}
+
+//SetHooks replaces the driver's hooks. This is safe to call while statements
+//are being executed concurrently. Each statement execution uses the hooks that
+//were current when it started. After SetHooks has been called, the fields of
+//the embedded Hooks struct (and the deprecated Driver.BeforePrepareHook and
+//Driver.BeforeQueryHook) are no longer used.
+func (d *Driver) SetHooks(hooks Hooks) {
+	d.swappedHooks.Store(&hooks)
+}
+
+//UpdateHooks replaces the driver's hooks with a modified copy. The given
+//function receives a copy of the current hooks and can modify it in-place.
+//This is safe to call concurrently with other calls to SetHooks or
+//UpdateHooks, and while statements are being executed. For example, to turn
+//on query tracing at runtime:
+//
+//	d.UpdateHooks(func(h *sqlproxy.Hooks) {
+//		h.BeforeQueryHook = sqlproxy.TraceQuery(func(msg string) { log.Println(msg) })
+//	})
+//
+//Since the function may be called multiple times if there are concurrent
+//updates, it should not have side effects.
+func (d *Driver) UpdateHooks(update func(*Hooks)) {
+	for {
+		old := d.swappedHooks.Load()
+		var hooks Hooks
+		if old == nil {
+			hooks = *d.hooks()
+		} else {
+			hooks = *old
+		}
+		update(&hooks)
+		if d.swappedHooks.CompareAndSwap(old, &hooks) {
+			return
+		}
+	}
+}
+
+//AddProfile stores a set of hooks under the given name, such that it can be
+//activated later with UseProfile(). This allows switching between
+//predefined behaviors at runtime, for example:
+//
+//	d.AddProfile("quiet", sqlproxy.Hooks{})
+//	d.AddProfile("debug", sqlproxy.Hooks{
+//		BeforeQueryHook: sqlproxy.TraceQuery(func(msg string) { log.Println(msg) }),
+//	})
+//	...
+//	err := d.UseProfile("debug")
+//
+//If a profile with the same name already exists, it is replaced. This does not
+//affect the hooks currently in effect until UseProfile() is called again.
+func (d *Driver) AddProfile(name string, hooks Hooks) {
+	d.profilesMutex.Lock()
+	defer d.profilesMutex.Unlock()
+	if d.profiles == nil {
+		d.profiles = make(map[string]Hooks)
+	}
+	d.profiles[name] = hooks
+}
+
+//UseProfile replaces the driver's hooks with the profile of the given name
+//(see AddProfile), like SetHooks() would. An error is returned if no profile
+//with that name exists.
+func (d *Driver) UseProfile(name string) error {
+	d.profilesMutex.Lock()
+	defer d.profilesMutex.Unlock()
+	hooks, exists := d.profiles[name]
+	if !exists {
+		return fmt.Errorf("sqlproxy: no hook profile named %q", name)
+	}
+	d.SetHooks(hooks)
+	return nil
+}
+
+//hooks returns the hooks that are currently in effect.
+func (d *Driver) hooks() *Hooks {
+	if hooks := d.swappedHooks.Load(); hooks != nil {
+		return hooks
+	}
+	if d.BeforePrepareHook == nil && d.BeforeQueryHook == nil {
+		return &d.Hooks
+	}
+	d.legacyHooksOnce.Do(func() {
+		hooks := d.Hooks
+		if d.BeforePrepareHook != nil {
+			hooks.BeforePrepareHook = chainBeforePrepareHooks(d.BeforePrepareHook, hooks.BeforePrepareHook)
+		}
+		if d.BeforeQueryHook != nil {
+			hooks.BeforeQueryHook = chainBeforeQueryHooks(d.BeforeQueryHook, hooks.BeforeQueryHook)
+		}
+		d.legacyHooks = &hooks
+	})
+	return d.legacyHooks
+}
+
+func (h *Hooks) execBeforePrepareHook(query string) (string, error) {
+	if h.BeforePrepareHook == nil {
+		return query, nil
+	}
+	return h.BeforePrepareHook(query)
+}
+
+func (h *Hooks) execBeforeQueryHook(query string, args []interface{}) {
+	if h.BeforeQueryHook != nil {
+		h.BeforeQueryHook(query, args)
+	}
+}
+
+func (h *Hooks) execRowTransformHook(query string) []RowTransform {
+	if h.RowTransformHook == nil {
+		return nil
+	}
+	return h.RowTransformHook(query)
+}
+
+func (h *Hooks) execAfterQueryHook(e QueryEvent) {
+	if h.AfterQueryHook != nil {
+		h.AfterQueryHook(e)
+	}
+}
+
+func (h *Hooks) execCommentHook(ctx context.Context, query string) string {
+	if h.CommentHook == nil || strings.Contains(query, "/*") {
+		return query
+	}
+	return appendSQLComment(query, h.CommentHook(ctx))
+}
+
+//appendSQLComment appends the given key-value pairs to the query as a comment
+//following the sqlcommenter specification.
+func appendSQLComment(query string, pairs map[string]string) string {
+	if len(pairs) == 0 {
+		return query
+	}
+	escape := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	fields := make([]string, 0, len(pairs))
+	for key, value := range pairs {
+		fields = append(fields, escape(key)+"='"+escape(value)+"'")
+	}
+	sort.Strings(fields)
+	comment := " /*" + strings.Join(fields, ",") + "*/"
+
+	//the comment goes before the trailing semicolon, if any
+	query = strings.TrimRight(query, " \t\n")
+	if strings.HasSuffix(query, ";") {
+		return strings.TrimSuffix(query, ";") + comment + ";"
+	}
+	return query + comment
+}
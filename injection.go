@@ -0,0 +1,135 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+//SuspiciousQueryEvent describes a statement that looks like the result of SQL
+//injection (see Driver.DetectInjection). It is given to the
+//SuspiciousQueryHook.
+type SuspiciousQueryEvent struct {
+	//Findings describes the suspicious patterns that were found in the
+	//statement, e.g. "stacked statements" or "tautology: OR 1=1".
+	Findings []string
+	//Statement is the QueryEvent of the statement as far as it is known
+	//before execution, i.e. without Duration, Rows and Err.
+	Statement QueryEvent
+}
+
+var tautologyRx = regexp.MustCompile(`(?i)\bOR\s+(?:'([^']*)'|(\d+))\s*=\s*(?:'([^']*)'|(\d+))|\bOR\s+TRUE\b`)
+
+//findSuspiciousPatterns implements the heuristics for Driver.DetectInjection.
+func findSuspiciousPatterns(query string) []string {
+	var findings []string
+	addFinding := func(finding string) {
+		for _, f := range findings {
+			if f == finding {
+				return
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	for idx := 0; idx < len(query); idx++ {
+		switch c := query[idx]; c {
+		case '\'', '"', '`':
+			end := strings.IndexByte(query[idx+1:], c)
+			if end == -1 {
+				addFinding("unterminated string literal")
+				idx = len(query)
+				continue
+			}
+			idx += end + 1
+			//in "WHERE name = '<input>' AND ...", an input like "admin'--" comments
+			//out the rest of the statement, including the original closing quote
+			if c == '\'' {
+				rest := strings.TrimLeft(query[idx+1:], " \t\r\n")
+				if strings.HasPrefix(rest, "--") || strings.HasPrefix(rest, "#") {
+					comment, _, _ := strings.Cut(rest, "\n")
+					if strings.Contains(comment, "'") {
+						addFinding("comment-terminated string")
+					}
+				}
+			}
+		case '-':
+			if strings.HasPrefix(query[idx:], "--") {
+				end := strings.IndexByte(query[idx:], '\n')
+				if end == -1 {
+					idx = len(query)
+					continue
+				}
+				idx += end
+			}
+		case '/':
+			if strings.HasPrefix(query[idx:], "/*") {
+				end := strings.Index(query[idx+2:], "*/")
+				if end == -1 {
+					idx = len(query)
+					continue
+				}
+				idx += end + 3
+			}
+		case ';':
+			if strings.TrimSpace(sqlWhitespaceRx.ReplaceAllString(normalizeBlockCommentRx.ReplaceAllString(query[idx+1:], " "), " ")) != "" {
+				addFinding("stacked statements")
+			}
+		}
+	}
+
+	for _, match := range tautologyRx.FindAllStringSubmatch(query, -1) {
+		left, right := match[1]+match[2], match[3]+match[4]
+		if left == right {
+			addFinding("tautology: " + sqlWhitespaceRx.ReplaceAllString(match[0], " "))
+		}
+	}
+	return findings
+}
+
+//checkInjection implements Driver.DetectInjection.
+func (c *connection) checkInjection(hooks *Hooks, e QueryEvent) {
+	if e.QueryName != "" {
+		return
+	}
+	findings := findSuspiciousPatterns(e.Query)
+	if len(findings) == 0 {
+		return
+	}
+	event := SuspiciousQueryEvent{Findings: findings, Statement: e.detached()}
+	if hooks.SuspiciousQueryHook != nil {
+		hooks.SuspiciousQueryHook(event)
+	} else {
+		logSuspiciousQuery(event)
+	}
+}
+
+func logSuspiciousQuery(e SuspiciousQueryEvent) {
+	attrs := []slog.Attr{
+		slog.String("query", formatQuery(e.Statement.Query, nil)),
+		slog.Any("findings", e.Findings),
+		slog.Uint64("connection_id", e.Statement.ConnectionID),
+	}
+	attrs = append(attrs, e.Statement.fieldAttrs()...)
+	slog.LogAttrs(context.Background(), slog.LevelWarn, "suspicious SQL statement (possible SQL injection)", attrs...)
+}
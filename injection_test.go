@@ -0,0 +1,89 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_FindSuspiciousPatterns(t *testing.T) {
+	testCases := map[string][]string{
+		`SELECT * FROM users WHERE name = 'admin'`:                                nil,
+		`SELECT * FROM users WHERE name = $1 -- look up user`:                     nil,
+		`SELECT 'a;b' FROM t; -- trailing semicolon`:                              nil,
+		`SELECT * FROM users WHERE name = 'x' OR 1=1`:                             {"tautology: OR 1=1"},
+		`SELECT * FROM users WHERE name = '' OR 'a' = 'a'`:                        {"tautology: OR 'a' = 'a'"},
+		`SELECT * FROM users WHERE id = 1 OR 1=2`:                                 nil,
+		`SELECT * FROM users WHERE id = 1; DROP TABLE users`:                      {"stacked statements"},
+		`SELECT * FROM users WHERE name = 'admin'--' AND password = 'hunter2'`:    {"comment-terminated string"},
+		`SELECT * FROM users WHERE name = 'admin' -- only admins` + "\nAND x = 1": nil,
+	}
+	for query, expected := range testCases {
+		actual := findSuspiciousPatterns(query)
+		if !reflect.DeepEqual(actual, expected) {
+			TT{t}.Unexpected("findings for "+query, expected, actual)
+		}
+	}
+}
+
+func Test_DetectInjection(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var queries Queries
+	tt.Must(queries.Load(strings.NewReader("-- name: trusted\nSELECT 1 WHERE 1 OR 1=1"), "test.sql"))
+
+	var events []SuspiciousQueryEvent
+	d := New("sqlite3",
+		WithInjectionDetection(),
+		WithSuspiciousQueryHook(func(e SuspiciousQueryEvent) {
+			events = append(events, e)
+		}),
+		//the registry knows the statements as they were before this hook
+		WithBeforePrepare(func(query string) (string, error) {
+			return "/* app */ " + query, nil
+		}),
+	)
+	d.Queries = &queries
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (name TEXT)`))
+
+	name := "x' OR 'a'='a"
+	rows := tt.MustRows(db.Query(`SELECT * FROM users WHERE name = '` + name + `'`))
+	tt.Must(rows.Close())
+	rows = tt.MustRows(db.Query(queries.Get("trusted")))
+	tt.Must(rows.Close())
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 SuspiciousQueryEvent, got %d", len(events))
+	}
+	if !reflect.DeepEqual(events[0].Findings, []string{"tautology: OR 'a'='a'"}) {
+		tt.Unexpected("findings", []string{"tautology: OR 'a'='a'"}, events[0].Findings)
+	}
+	if !strings.Contains(events[0].Statement.Query, name) {
+		t.Errorf("unexpected statement in SuspiciousQueryEvent: %q", events[0].Statement.Query)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
@@ -0,0 +1,227 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+//Inspector keeps track of the statements that are currently executing, and of
+//the most recent slow statements (see Driver.SlowQueryThreshold). It is an
+//http.Handler that lists them, which is invaluable when a service is wedged on
+//the database:
+//
+//	inspector := sqlproxy.NewInspector()
+//	sql.Register("postgres-with-inspector", sqlproxy.New("postgres",
+//		sqlproxy.WithInspector(inspector),
+//		sqlproxy.WithSlowQueryLog(time.Second),
+//	))
+//	http.Handle("/debug/sqlproxy", inspector)
+//
+//The handler renders a plain-text table by default, or JSON if the request has
+//the query parameter "format=json". An Inspector can be shared by multiple
+//Drivers. The exported fields must not be changed after the Inspector has
+//been given to a Driver.
+type Inspector struct {
+	//MaxSlowQueries is the number of slow statements that are retained. The
+	//default is 100.
+	MaxSlowQueries int
+	//RedactArgs causes the handler to omit the statements' arguments, e.g.
+	//because they could contain personal data.
+	RedactArgs bool
+
+	mutex  sync.Mutex
+	nextID uint64
+	active map[uint64]InspectedStatement
+	slow   []InspectedStatement
+}
+
+//InspectedStatement is a statement that is listed by an Inspector.
+type InspectedStatement struct {
+	//StartedAt is when the statement started executing.
+	StartedAt time.Time
+	//Event describes the statement. For statements that are still executing,
+	//only Query, Args, ConnectionID, Fields, Caller and Tenant are filled.
+	Event QueryEvent
+}
+
+//NewInspector creates a new Inspector. Use WithInspector() or set
+//Driver.Inspector to connect it to a Driver.
+func NewInspector() *Inspector {
+	return &Inspector{
+		MaxSlowQueries: 100,
+		active:         make(map[uint64]InspectedStatement),
+	}
+}
+
+//Active returns the statements that are currently executing, the oldest
+//first.
+func (i *Inspector) Active() []InspectedStatement {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	result := make([]InspectedStatement, 0, len(i.active))
+	for _, s := range i.active {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].StartedAt.Before(result[b].StartedAt)
+	})
+	return result
+}
+
+//RecentSlowQueries returns the most recent slow statements, the most recent
+//first.
+func (i *Inspector) RecentSlowQueries() []InspectedStatement {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	result := make([]InspectedStatement, len(i.slow))
+	for idx, s := range i.slow {
+		result[len(i.slow)-1-idx] = s
+	}
+	return result
+}
+
+//begin registers a statement that is about to be executed, and returns the ID
+//that must be given to end().
+func (i *Inspector) begin(e QueryEvent) uint64 {
+	e = e.detached()
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.nextID++
+	i.active[i.nextID] = InspectedStatement{StartedAt: time.Now(), Event: e}
+	return i.nextID
+}
+
+//end unregisters a finished statement, and retains it if it was slow.
+func (i *Inspector) end(id uint64, e QueryEvent, slow bool) {
+	e = e.detached()
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	s, exists := i.active[id]
+	delete(i.active, id)
+	if !slow || !exists {
+		return
+	}
+	s.Event = e
+	i.slow = append(i.slow, s)
+	if excess := len(i.slow) - i.MaxSlowQueries; excess > 0 {
+		i.slow = append(i.slow[:0], i.slow[excess:]...)
+	}
+}
+
+//ServeHTTP implements the http.Handler interface.
+func (i *Inspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	active := i.Active()
+	slow := i.RecentSlowQueries()
+	if i.RedactArgs {
+		for idx := range active {
+			active[idx].Event.Args = nil
+		}
+		for idx := range slow {
+			slow[idx].Event.Args = nil
+		}
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"active": inspectedStatementsToJSON(active, time.Now()),
+			"slow":   inspectedStatementsToJSON(slow, time.Time{}),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	now := time.Now()
+	fmt.Fprintf(tw, "ACTIVE STATEMENTS (%d)\n", len(active))
+	fmt.Fprintln(tw, "STARTED\tRUNNING FOR\tCONNECTION\tLABELS\tQUERY")
+	for _, s := range active {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", s.StartedAt.UTC().Format(time.RFC3339Nano),
+			now.Sub(s.StartedAt), s.Event.ConnectionID, formatInspectorLabels(s.Event), formatQuery(s.Event.Query, s.Event.Args))
+	}
+	fmt.Fprintf(tw, "\nRECENT SLOW STATEMENTS (%d)\n", len(slow))
+	fmt.Fprintln(tw, "STARTED\tDURATION\tCONNECTION\tLABELS\tQUERY")
+	for _, s := range slow {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", s.StartedAt.UTC().Format(time.RFC3339Nano),
+			s.Event.Duration, s.Event.ConnectionID, formatInspectorLabels(s.Event), formatQuery(s.Event.Query, s.Event.Args))
+	}
+	tw.Flush()
+}
+
+//formatInspectorLabels renders the tenant, caller and correlation fields of a
+//statement into a single column.
+func formatInspectorLabels(e QueryEvent) string {
+	var labels []string
+	for _, attr := range e.fieldAttrs() {
+		labels = append(labels, attr.Key+"="+attr.Value.String())
+	}
+	if len(labels) == 0 {
+		return "-"
+	}
+	return strings.Join(labels, " ")
+}
+
+type inspectedStatementJSON struct {
+	StartedAt       time.Time         `json:"started_at"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	ConnectionID    uint64            `json:"connection_id"`
+	Query           string            `json:"query"`
+	Args            []string          `json:"args,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	Tenant          string            `json:"tenant,omitempty"`
+	Caller          string            `json:"caller,omitempty"`
+	Fields          map[string]string `json:"fields,omitempty"`
+}
+
+//inspectedStatementsToJSON prepares statements for JSON encoding. For active
+//statements, the duration is computed relative to the given time.
+func inspectedStatementsToJSON(statements []InspectedStatement, now time.Time) []inspectedStatementJSON {
+	result := make([]inspectedStatementJSON, len(statements))
+	for idx, s := range statements {
+		duration := s.Event.Duration
+		if !now.IsZero() {
+			duration = now.Sub(s.StartedAt)
+		}
+		result[idx] = inspectedStatementJSON{
+			StartedAt:       s.StartedAt,
+			DurationSeconds: duration.Seconds(),
+			ConnectionID:    s.Event.ConnectionID,
+			Query:           s.Event.Query,
+			Tenant:          s.Event.Tenant,
+			Caller:          s.Event.Caller,
+			Fields:          s.Event.Fields,
+		}
+		if len(s.Event.Args) > 0 {
+			result[idx].Args = formatArgs(s.Event.Args)
+		}
+		if s.Event.Err != nil {
+			result[idx].Error = s.Event.Err.Error()
+		}
+	}
+	return result
+}
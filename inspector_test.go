@@ -0,0 +1,104 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Inspector(t *testing.T) {
+	tt := TT{t}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		if strings.HasPrefix(query, "UPDATE") {
+			close(started)
+			<-release
+			return errors.New("lock timeout")
+		}
+		return nil
+	}
+	inspector := NewInspector()
+	db := sql.OpenDB(NewConnector(New("",
+		WithProxiedDriver(fakeDriver{}),
+		WithInspector(inspector),
+		WithSlowQueryHook(func(e QueryEvent) {}),
+		WithSlowQueryLog(time.Nanosecond),
+		WithCorrelation(func(ctx context.Context) map[string]string {
+			return map[string]string{"request_id": "abc"}
+		}),
+	), ""))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := db.Exec(`UPDATE knowledge SET thing = $1`, "truth")
+		if err == nil {
+			t.Error("expected UPDATE to fail, but it succeeded")
+		}
+	}()
+	<-started
+
+	active := inspector.Active()
+	if len(active) != 1 || active[0].Event.Query != `UPDATE knowledge SET thing = $1` || active[0].Event.Fields["request_id"] != "abc" {
+		t.Errorf("unexpected active statements: %#v", active)
+	}
+	rec := httptest.NewRecorder()
+	inspector.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/sqlproxy", nil))
+	body := rec.Body.String()
+	for _, expected := range []string{"ACTIVE STATEMENTS (1)", `request_id=abc  UPDATE knowledge SET thing = $1 ["truth"]`, "RECENT SLOW STATEMENTS (0)"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected %q in response, got:\n%s", expected, body)
+		}
+	}
+
+	close(release)
+	<-done
+	tt.MustResult(db.Exec(`DELETE FROM knowledge`))
+	tt.Must(db.Close())
+
+	if active := inspector.Active(); len(active) != 0 {
+		t.Errorf("expected no active statements, got %#v", active)
+	}
+	inspector.RedactArgs = true
+	rec = httptest.NewRecorder()
+	inspector.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/sqlproxy?format=json", nil))
+	var data struct {
+		Active []inspectedStatementJSON `json:"active"`
+		Slow   []inspectedStatementJSON `json:"slow"`
+	}
+	tt.Must(json.Unmarshal(rec.Body.Bytes(), &data))
+	if len(data.Active) != 0 || len(data.Slow) != 2 {
+		t.Fatalf("unexpected response: %s", rec.Body.String())
+	}
+	if data.Slow[0].Query != `DELETE FROM knowledge` || data.Slow[1].Query != `UPDATE knowledge SET thing = $1` ||
+		data.Slow[1].Error != "lock timeout" || data.Slow[1].Args != nil {
+		t.Errorf("unexpected slow statements: %s", rec.Body.String())
+	}
+}
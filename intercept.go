@@ -0,0 +1,80 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+//Interception is returned by an InterceptHook to answer a statement without
+//executing it on the database.
+type Interception struct {
+	//Result is returned by Exec(). If nil, Exec() reports zero affected rows.
+	Result driver.Result
+	//Rows is returned by Query(), e.g. from StaticRows(). If nil, Query()
+	//returns an empty result set without columns.
+	Rows driver.Rows
+	//Err, if not nil, is returned instead of Result or Rows.
+	Err error
+}
+
+func (i *Interception) result() (driver.Result, error) {
+	if i.Err != nil {
+		return nil, i.Err
+	}
+	if i.Result == nil {
+		return driver.RowsAffected(0), nil
+	}
+	return i.Result, nil
+}
+
+func (i *Interception) rows() (driver.Rows, error) {
+	if i.Err != nil {
+		return nil, i.Err
+	}
+	if i.Rows == nil {
+		return &staticRows{}, nil
+	}
+	return i.Rows, nil
+}
+
+func (h *Hooks) execInterceptHook(ctx context.Context, query string, args []driver.NamedValue) *Interception {
+	if h.InterceptHook == nil {
+		return nil
+	}
+	return h.InterceptHook(ctx, query, castNamedValues(args))
+}
+
+//StaticRows returns a driver.Rows with the given column names and rows, for
+//use in Interception.Rows. Each row must have one value per column.
+//
+//	return &sqlproxy.Interception{
+//		Rows: sqlproxy.StaticRows([]string{"id", "name"},
+//			[]driver.Value{int64(1), "alice"},
+//			[]driver.Value{int64(2), "bob"},
+//		),
+//	}
+//
+//To build rows from values of other types, or with database type names, use
+//a RowsBuilder instead.
+func StaticRows(columns []string, rows ...[]driver.Value) driver.Rows {
+	return newStaticRows(columns, nil, rows)
+}
@@ -0,0 +1,95 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_InterceptHook(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	errIntercepted := errors.New("intercepted")
+	var events []QueryEvent
+	d := New("sqlite3",
+		WithInterceptHook(func(ctx context.Context, query string, args []interface{}) *Interception {
+			switch {
+			case strings.HasPrefix(query, "SELECT name FROM users"):
+				return &Interception{Rows: StaticRows([]string{"name"}, []driver.Value{"alice"}, []driver.Value{args[0]})}
+			case strings.HasPrefix(query, "DELETE"):
+				return &Interception{Result: driver.RowsAffected(23)}
+			case strings.HasPrefix(query, "UPDATE"):
+				return &Interception{Err: errIntercepted}
+			default:
+				return nil
+			}
+		}),
+		WithAfterQuery(func(e QueryEvent) { events = append(events, e) }),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+
+	//the table does not exist, so these would fail on the database
+	var names []string
+	rows := tt.MustRows(db.Query(`SELECT name FROM users WHERE id > ?`, "bob"))
+	for rows.Next() {
+		var name string
+		tt.Must(rows.Scan(&name))
+		names = append(names, name)
+	}
+	tt.Must(rows.Err())
+	tt.Must(rows.Close())
+	if !reflect.DeepEqual(names, []string{"alice", "bob"}) {
+		tt.Unexpected("names", []string{"alice", "bob"}, names)
+	}
+
+	stmt, err := db.Prepare(`DELETE FROM sessions`)
+	if err == nil {
+		t.Error("expected explicit Prepare to reach the database")
+		tt.Must(stmt.Close())
+	}
+	result := tt.MustResult(db.Exec(`DELETE FROM sessions`))
+	affected, err := result.RowsAffected()
+	tt.Must(err)
+	if affected != 23 {
+		tt.Unexpected("rows affected", 23, affected)
+	}
+	_, err = db.Exec(`UPDATE users SET name = 'x'`)
+	if !errors.Is(err, errIntercepted) {
+		t.Errorf("expected intercepted error, got %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO users (name) VALUES ('x')`)
+	if err == nil || !strings.Contains(err.Error(), "no such table") {
+		t.Errorf("expected non-intercepted statement to reach the database, got %v", err)
+	}
+
+	if len(events) != 4 || events[0].Rows != 2 || events[1].Rows != 23 {
+		t.Errorf("unexpected events for intercepted statements: %#v", events)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
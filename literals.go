@@ -0,0 +1,238 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+//LiteralQueryEvent describes a statement that embeds literal values where a
+//bind parameter would be expected (see Driver.DetectLiterals). It is given to
+//the LiteralQueryHook.
+type LiteralQueryEvent struct {
+	//Literals lists the literals that were found in the statement, in order.
+	Literals []Literal
+	//Statement is the QueryEvent of the statement as far as it is known
+	//before execution, i.e. without Duration, Rows and Err.
+	Statement QueryEvent
+}
+
+//Literal is a string or number literal in a statement. It appears in type
+//LiteralQueryEvent.
+type Literal struct {
+	//Offset is the position of the literal in Statement.Query (in bytes).
+	Offset int
+	//Text is the literal as it appears in the statement, e.g. "12345" or
+	//"'alice'" (including quotes).
+	Text string
+}
+
+type sqlTokenKind int
+
+const (
+	sqlTokenWord sqlTokenKind = iota
+	sqlTokenString
+	sqlTokenNumber
+	sqlTokenOperator
+	sqlTokenPunctuation
+	sqlTokenOther
+)
+
+type sqlToken struct {
+	kind   sqlTokenKind
+	offset int
+	text   string
+}
+
+//tokenizeSQL splits a statement into tokens. Comments are skipped. Quoted
+//identifiers, dollar-quoted strings and placeholders are reported as
+//sqlTokenOther.
+func tokenizeSQL(query string) []sqlToken {
+	var tokens []sqlToken
+	for idx := 0; idx < len(query); {
+		rest := query[idx:]
+		c := query[idx]
+		token := sqlToken{kind: sqlTokenOther, offset: idx}
+		length := 1
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			idx++
+			continue
+		case strings.HasPrefix(rest, "--"):
+			length = strings.IndexByte(rest, '\n')
+			if length == -1 {
+				length = len(rest)
+			}
+			idx += length
+			continue
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end == -1 {
+				return tokens
+			}
+			idx += end + 4
+			continue
+		case c == '\'':
+			//'' is an escaped quote within the literal
+			length = 1
+			for length < len(rest) {
+				end := strings.IndexByte(rest[length:], '\'')
+				if end == -1 {
+					length = len(rest)
+					break
+				}
+				length += end + 1
+				if length >= len(rest) || rest[length] != '\'' {
+					break
+				}
+				length++
+			}
+			token.kind = sqlTokenString
+		case c == '"' || c == '`':
+			end := strings.IndexByte(rest[1:], c)
+			if end == -1 {
+				return tokens
+			}
+			length = end + 2
+		case c == '$' && dollarQuoteLength(rest) > 0:
+			length = dollarQuoteLength(rest)
+		case c == '$' || c == '?' || (c == ':' && !strings.HasPrefix(rest, "::")):
+			length = 1 + countLeadingBytes(rest[1:], isIdentifierByte)
+		case isDigit(c) || (c == '.' && len(rest) > 1 && isDigit(rest[1])):
+			length = countLeadingBytes(rest, func(c byte) bool { return isDigit(c) || c == '.' })
+			token.kind = sqlTokenNumber
+		case isIdentifierByte(c):
+			length = countLeadingBytes(rest, isIdentifierByte)
+			token.kind = sqlTokenWord
+		case strings.IndexByte("=<>!", c) != -1:
+			length = countLeadingBytes(rest, func(c byte) bool { return strings.IndexByte("=<>!", c) != -1 })
+			token.kind = sqlTokenOperator
+		case c == '(' || c == ')' || c == ',':
+			token.kind = sqlTokenPunctuation
+		}
+		token.text = rest[:length]
+		tokens = append(tokens, token)
+		idx += length
+	}
+	return tokens
+}
+
+//findLiterals implements the heuristics for Driver.DetectLiterals. A literal
+//is reported if it is compared to something (with an operator like "=" or
+//"<", or with LIKE or BETWEEN), or if it appears in an IN list or a VALUES
+//list. Other literals (e.g. in "LIMIT 10" or "SELECT 1") are not reported.
+func findLiterals(query string) []Literal {
+	var (
+		result  []Literal
+		tokens  = tokenizeSQL(query)
+		openers []string //for each open parenthesis, the keyword before it
+		//the keyword before the most recently closed parenthesis, so that in
+		//"VALUES (...), (...)", the second list is recognized as well
+		lastOpener string
+	)
+	keywordAt := func(idx int) string {
+		if idx < 0 || tokens[idx].kind != sqlTokenWord {
+			return ""
+		}
+		return strings.ToUpper(tokens[idx].text)
+	}
+
+	for idx, token := range tokens {
+		switch token.kind {
+		case sqlTokenPunctuation:
+			switch token.text {
+			case "(":
+				opener := keywordAt(idx - 1)
+				if idx > 0 && tokens[idx-1].text == "," {
+					opener = lastOpener
+				}
+				openers = append(openers, opener)
+			case ")":
+				if len(openers) > 0 {
+					lastOpener = openers[len(openers)-1]
+					openers = openers[:len(openers)-1]
+				}
+			}
+			continue
+		case sqlTokenString, sqlTokenNumber:
+		default:
+			continue
+		}
+		if idx == 0 {
+			continue
+		}
+
+		previous := tokens[idx-1]
+		isParameterLike := false
+		switch {
+		case previous.kind == sqlTokenOperator:
+			isParameterLike = true
+		case previous.kind == sqlTokenPunctuation && previous.text != ")":
+			if len(openers) > 0 {
+				opener := openers[len(openers)-1]
+				isParameterLike = opener == "IN" || opener == "VALUES"
+			}
+		default:
+			switch keywordAt(idx - 1) {
+			case "LIKE", "ILIKE", "BETWEEN":
+				isParameterLike = true
+			case "AND":
+				isParameterLike = keywordAt(idx-3) == "BETWEEN"
+			}
+		}
+		if isParameterLike {
+			result = append(result, Literal{Offset: token.offset, Text: token.text})
+		}
+	}
+	return result
+}
+
+//checkLiterals implements Driver.DetectLiterals.
+func (c *connection) checkLiterals(hooks *Hooks, e QueryEvent) {
+	if e.QueryName != "" {
+		return
+	}
+	literals := findLiterals(e.Query)
+	if len(literals) == 0 {
+		return
+	}
+	event := LiteralQueryEvent{Literals: literals, Statement: e.detached()}
+	if hooks.LiteralQueryHook != nil {
+		hooks.LiteralQueryHook(event)
+	} else {
+		logLiteralQuery(event)
+	}
+}
+
+func logLiteralQuery(e LiteralQueryEvent) {
+	offsets := make([]int, len(e.Literals))
+	for idx, l := range e.Literals {
+		offsets[idx] = l.Offset
+	}
+	attrs := []slog.Attr{
+		slog.String("query", formatQuery(e.Statement.Query, nil)),
+		slog.Any("literal_offsets", offsets),
+		slog.Uint64("connection_id", e.Statement.ConnectionID),
+	}
+	attrs = append(attrs, e.Statement.fieldAttrs()...)
+	slog.LogAttrs(context.Background(), slog.LevelInfo, "SQL statement contains literals instead of bind parameters", attrs...)
+}
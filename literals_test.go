@@ -0,0 +1,96 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_FindLiterals(t *testing.T) {
+	testCases := map[string][]Literal{
+		`SELECT * FROM users WHERE id = $1`:                               nil,
+		`SELECT 1`:                                                        nil,
+		`SELECT * FROM users LIMIT 10`:                                    nil,
+		`SELECT * FROM users WHERE id = 12345`:                            {{31, "12345"}},
+		`SELECT * FROM users WHERE name = 'O''Brien' AND age >= 18`:       {{33, "'O''Brien'"}, {55, "18"}},
+		`SELECT * FROM users WHERE name LIKE 'a%' -- = 5`:                 {{36, "'a%'"}},
+		`SELECT * FROM t WHERE x BETWEEN 1 AND 10`:                        {{32, "1"}, {38, "10"}},
+		`SELECT * FROM t WHERE x IN (1, 2, ?)`:                            {{28, "1"}, {31, "2"}},
+		`SELECT count(1), coalesce(x, 0) FROM t WHERE y = ?`:              nil,
+		`INSERT INTO t (a, b) VALUES ('x', 1), (?, 2)`:                    {{29, "'x'"}, {34, "1"}, {42, "2"}},
+		`SELECT "a = 1" FROM t WHERE x::text = $tag$a$tag$ AND y = :name`: nil,
+		`UPDATE t SET a = 3.5 WHERE id = ?`:                               {{17, "3.5"}},
+	}
+	for query, expected := range testCases {
+		actual := findLiterals(query)
+		if !reflect.DeepEqual(actual, expected) {
+			TT{t}.Unexpected("literals in "+query, expected, actual)
+		}
+		for _, l := range actual {
+			if query[l.Offset:l.Offset+len(l.Text)] != l.Text {
+				t.Errorf("wrong offset %d for literal %s in %s", l.Offset, l.Text, query)
+			}
+		}
+	}
+}
+
+func Test_DetectLiterals(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var queries Queries
+	tt.Must(queries.Load(strings.NewReader("-- name: admins\nSELECT * FROM users WHERE id = 0"), "test.sql"))
+
+	var events []LiteralQueryEvent
+	d := New("sqlite3",
+		WithLiteralDetection(),
+		WithLiteralQueryHook(func(e LiteralQueryEvent) {
+			events = append(events, e)
+		}),
+		//the registry knows the statements as they were before this hook
+		WithBeforePrepare(func(query string) (string, error) {
+			return "/* app */ " + query, nil
+		}),
+		WithQueries(&queries),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, 1, "alice"))
+	rows := tt.MustRows(db.Query(`SELECT * FROM users WHERE id = 1`))
+	tt.Must(rows.Close())
+	rows = tt.MustRows(db.Query(queries.Get("admins")))
+	tt.Must(rows.Close())
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 LiteralQueryEvent, got %d", len(events))
+	}
+	if !reflect.DeepEqual(events[0].Literals, []Literal{{41, "1"}}) {
+		tt.Unexpected("literals", []Literal{{41, "1"}}, events[0].Literals)
+	}
+	if events[0].Statement.Query != `/* app */ SELECT * FROM users WHERE id = 1` {
+		t.Errorf("unexpected statement in LiteralQueryEvent: %q", events[0].Statement.Query)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
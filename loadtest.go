@@ -0,0 +1,200 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+//LoadTest re-executes a workload that was captured by a Recorder against a
+//database, and reports how long the statements took:
+//
+//	file, err := os.Open("workload.jsonl")
+//	...
+//	lt, err := sqlproxy.NewLoadTest(file)
+//	lt.Concurrency = 8
+//	lt.SpeedUp = 2
+//	db, err := sql.Open("postgres", "postgres://staging-db/app")
+//	...
+//	report, err := lt.Run(ctx, db)
+//	fmt.Println(report) //e.g. "1000 statements (0 errors) in 30.5s: p50 = 1.2ms, p90 = 4.5ms, p99 = 12ms, max = 80ms"
+//
+//Statements are started in the order in which they were recorded. Statements
+//that were recorded on the same connection are executed one after another by
+//the same worker, so that their relative order is preserved; but since
+//transaction boundaries are not recorded, they are not executed in a
+//transaction. The recorded results are ignored, so the recording does not
+//need to be made with Recorder.CaptureRows.
+//
+//If the recording was made with Driver.Redactor, the redacted arguments are
+//sent to the database, which usually makes statements behave differently
+//than in the original workload.
+//
+//The exported fields must not be changed while Run() is executing.
+type LoadTest struct {
+	//Concurrency (optional) is the number of workers that execute statements
+	//concurrently. The default is 1.
+	Concurrency int
+	//SpeedUp (optional) paces the replay according to the start times of the
+	//recorded statements, divided by this factor. For example, 1 replays at
+	//the original pace, and 2 replays twice as fast. The default of 0
+	//executes statements as fast as possible. Pacing requires a recording
+	//with start times; older recordings are always replayed as fast as
+	//possible.
+	SpeedUp float64
+
+	statements []*recordedStatement
+}
+
+//NewLoadTest loads a recording written by Recorder.
+func NewLoadTest(r io.Reader) (*LoadTest, error) {
+	recs, err := readRecording(r)
+	if err != nil {
+		return nil, err
+	}
+	return &LoadTest{statements: recs}, nil
+}
+
+//Run executes the workload against the given database. If the context
+//expires, Run stops starting new statements and returns the report for the
+//statements that were executed until then, along with the context's error.
+//Statements failing on the database do not stop the replay; they are counted
+//in LoadTestReport.Errors.
+func (l *LoadTest) Run(ctx context.Context, db *sql.DB) (LoadTestReport, error) {
+	workers := max(l.Concurrency, 1)
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		report    LoadTestReport
+		queues    = make([]chan *recordedStatement, workers)
+		startedAt = time.Now()
+	)
+	for idx := range queues {
+		queues[idx] = make(chan *recordedStatement, 64)
+		wg.Add(1)
+		go func(queue <-chan *recordedStatement) {
+			defer wg.Done()
+			for rec := range queue {
+				duration, err := l.execute(ctx, db, rec)
+				mutex.Lock()
+				report.latencies = append(report.latencies, duration)
+				if err != nil {
+					report.Errors++
+					if report.FirstError == nil {
+						report.FirstError = err
+					}
+				}
+				mutex.Unlock()
+			}
+		}(queues[idx])
+	}
+
+	var (
+		err          error
+		firstStarted *time.Time
+	)
+	for _, rec := range l.statements {
+		if l.SpeedUp > 0 && rec.StartedAt != nil {
+			if firstStarted == nil {
+				firstStarted = rec.StartedAt
+			}
+			offset := time.Duration(float64(rec.StartedAt.Sub(*firstStarted)) / l.SpeedUp)
+			err = sleepContext(ctx, time.Until(startedAt.Add(offset)))
+		} else {
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+		queues[rec.ConnectionID%uint64(workers)] <- rec
+	}
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(startedAt)
+	report.Statements = len(report.latencies)
+	slices.Sort(report.latencies)
+	return report, err
+}
+
+//execute executes a single statement. For statements that return rows, all
+//rows are read.
+func (l *LoadTest) execute(ctx context.Context, db *sql.DB, rec *recordedStatement) (time.Duration, error) {
+	args := castNamedValues(valuesToNamedValues(rec.decodeArgs()))
+	startedAt := time.Now()
+	isQuery := rec.Columns != nil || (rec.RowsAffected == nil && IsReadOnlyStatement(rec.Query))
+	if !isQuery {
+		_, err := db.ExecContext(ctx, rec.Query, args...)
+		return time.Since(startedAt), err
+	}
+	rows, err := db.QueryContext(ctx, rec.Query, args...)
+	if err != nil {
+		return time.Since(startedAt), err
+	}
+	for rows.Next() {
+	}
+	err = rows.Err()
+	if closeErr := rows.Close(); err == nil {
+		err = closeErr
+	}
+	return time.Since(startedAt), err
+}
+
+//LoadTestReport is returned by LoadTest.Run().
+type LoadTestReport struct {
+	//Statements is the number of statements that were executed.
+	Statements int
+	//Errors is the number of statements that failed, and FirstError is the
+	//error returned by the first of them.
+	Errors     int
+	FirstError error
+	//Duration is the wall-clock time of the whole replay.
+	Duration time.Duration
+
+	//the latencies of all executed statements, in ascending order
+	latencies []time.Duration
+}
+
+//Percentile returns the latency below which the given percentage (between 0
+//and 100) of statements completed, e.g. Percentile(99) for the p99 latency.
+//For queries, the latency includes reading all rows. If no statements were
+//executed, 0 is returned.
+func (r LoadTestReport) Percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p/100*float64(len(r.latencies)))) - 1
+	return r.latencies[min(max(idx, 0), len(r.latencies)-1)]
+}
+
+//String returns a human-readable summary of the report.
+func (r LoadTestReport) String() string {
+	return fmt.Sprintf("%d statements (%d errors) in %s: p50 = %s, p90 = %s, p99 = %s, max = %s",
+		r.Statements, r.Errors, r.Duration, r.Percentile(50), r.Percentile(90), r.Percentile(99), r.Percentile(100))
+}
@@ -0,0 +1,124 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_LoadTest(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var buf bytes.Buffer
+	rec, err := NewRecorder(&buf)
+	tt.Must(err)
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithRecorder(rec)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, data BLOB)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (name) VALUES (?), (?)`, "alice", "bob"))
+	for range 5 {
+		readUserNames(tt, db, "a")
+	}
+	_, err = db.Exec(`SELECT * FROM nonexistent`)
+	if err == nil {
+		t.Fatal("expected query on nonexistent table to fail")
+	}
+	tt.Must(db.Close())
+	tt.CleanupDB()
+	tt.Must(rec.Err())
+
+	lt, err := NewLoadTest(bytes.NewReader(buf.Bytes()))
+	tt.Must(err)
+	lt.SpeedUp = 1000
+	targetFile := filepath.Join(t.TempDir(), "target.sqlite")
+	target := sql.OpenDB(NewConnector(New("sqlite3"), "file:"+targetFile))
+	report, err := lt.Run(context.Background(), target)
+	tt.Must(err)
+
+	if report.Statements != 8 {
+		tt.Unexpected("statements", 8, report.Statements)
+	}
+	if report.Errors != 1 || report.FirstError == nil || !strings.Contains(report.FirstError.Error(), "no such table") {
+		t.Errorf("expected 1 error for the nonexistent table, got %d (first: %v)", report.Errors, report.FirstError)
+	}
+	//the workload has actually been executed on the target database
+	names := readUserNames(tt, target, "")
+	if len(names) != 2 {
+		tt.Unexpected("rows in target database", 2, len(names))
+	}
+	tt.Must(target.Close())
+	if p50, max := report.Percentile(50), report.Percentile(100); p50 <= 0 || p50 > max {
+		t.Errorf("implausible latencies: p50 = %s, max = %s", p50, max)
+	}
+}
+
+func Test_LoadTestPacing(t *testing.T) {
+	tt := TT{t}
+
+	//three statements over 200ms on two connections
+	recording := `{"sqlproxy_recording":1}
+{"query":"SELECT 1","args":[],"started_at":"2026-01-01T00:00:00Z","connection_id":1,"duration_ns":0}
+{"query":"SELECT 2","args":[],"started_at":"2026-01-01T00:00:00.1Z","connection_id":2,"duration_ns":0}
+{"query":"SELECT 3","args":[],"started_at":"2026-01-01T00:00:00.2Z","connection_id":1,"duration_ns":0}
+`
+	lt, err := NewLoadTest(strings.NewReader(recording))
+	tt.Must(err)
+	lt.Concurrency = 2
+	lt.SpeedUp = 2
+	db := sql.OpenDB(NewConnector(New("sqlite3"), "file:"+filepath.Join(t.TempDir(), "target.sqlite")))
+	report, err := lt.Run(context.Background(), db)
+	tt.Must(err)
+	tt.Must(db.Close())
+
+	if report.Statements != 3 || report.Errors != 0 {
+		t.Errorf("expected 3 successful statements, got %d with %d errors", report.Statements, report.Errors)
+	}
+	if report.Duration < 100*time.Millisecond {
+		t.Errorf("expected replay at double speed to take at least 100ms, took %s", report.Duration)
+	}
+}
+
+func Test_LoadTestReportPercentile(t *testing.T) {
+	var report LoadTestReport
+	if p := report.Percentile(99); p != 0 {
+		tt := TT{t}
+		tt.Unexpected("percentile of empty report", time.Duration(0), p)
+	}
+	for idx := 1; idx <= 100; idx++ {
+		report.latencies = append(report.latencies, time.Duration(idx)*time.Millisecond)
+	}
+	testCases := map[float64]time.Duration{
+		0:   1 * time.Millisecond,
+		50:  50 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+	}
+	for p, expected := range testCases {
+		if actual := report.Percentile(p); actual != expected {
+			t.Errorf("expected p%g = %s, got %s", p, expected, actual)
+		}
+	}
+}
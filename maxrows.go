@@ -0,0 +1,53 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"fmt"
+)
+
+//TooManyRowsError is returned from reading a result set that contains more
+//rows than Driver.MaxRows allows.
+type TooManyRowsError struct {
+	Query   string
+	MaxRows int
+}
+
+//Error implements the builtin/error interface.
+func (e TooManyRowsError) Error() string {
+	return fmt.Sprintf("sqlproxy: result set has more than %d rows: %s", e.MaxRows, Normalize(e.Query))
+}
+
+//checkMaxRows implements Driver.MaxRows. It is called after each row has been
+//read.
+func (r *resultRows) checkMaxRows() error {
+	maxRows := r.conn.driver.MaxRows
+	if maxRows <= 0 || r.rowCount <= maxRows {
+		return nil
+	}
+	err := TooManyRowsError{Query: r.event.Query, MaxRows: maxRows}
+	if r.hooks.TooManyRowsHook != nil {
+		e := r.event.detached()
+		e.Rows = int64(r.rowCount)
+		e.Err = err
+		r.hooks.TooManyRowsHook(e)
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func Test_MaxRows(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var events []QueryEvent
+	d := New("sqlite3", WithMaxRows(2), WithTooManyRowsHook(func(e QueryEvent) {
+		events = append(events, e)
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE things (id INTEGER)`))
+	tt.MustResult(db.Exec(`INSERT INTO things VALUES (1), (2), (3)`))
+
+	count := func(query string) (int, error) {
+		rows := tt.MustRows(db.Query(query))
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		err := rows.Err()
+		tt.Must(rows.Close())
+		return n, err
+	}
+
+	n, err := count(`SELECT * FROM things WHERE id <= 2`)
+	if n != 2 || err != nil {
+		t.Errorf("expected 2 rows without error, got %d rows and error %#v", n, err)
+	}
+	n, err = count(`SELECT * FROM things`)
+	var terr TooManyRowsError
+	if n != 2 || !errors.As(err, &terr) || terr.MaxRows != 2 {
+		t.Errorf("expected 2 rows with TooManyRowsError, got %d rows and error %#v", n, err)
+	}
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if events[0].Query != `SELECT * FROM things` || events[0].Rows != 3 || !errors.As(events[0].Err, &terr) {
+		t.Errorf("unexpected event: %#v", events[0])
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
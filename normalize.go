@@ -0,0 +1,75 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	normalizeBlockCommentRx = regexp.MustCompile(`/\*(?s:.*?)\*/`)
+	normalizeLiteralRx      = regexp.MustCompile(`'(?:[^']|'')*'|\b\d+(?:\.\d+)?\b|\$\d+`)
+	normalizeInListRx       = regexp.MustCompile(`(?i)\bIN \( ?\?(?: ?, ?\?)* ?\)`)
+	normalizeValuesListRx   = regexp.MustCompile(`(?i)\bVALUES (\([?, ]*\))(?: ?, ?\([?, ]*\))+`)
+)
+
+//Normalize returns the fingerprint of the given query string, such that
+//statements which only differ in their literal values have the same
+//fingerprint. Specifically:
+//
+//  - comments are removed and whitespace is collapsed like in TraceQuery(),
+//  - string and number literals as well as placeholders like "$1" are replaced by "?",
+//  - lists of values like "IN (?, ?, ?)" are collapsed into "IN (?)", and
+//  - multiple rows in "VALUES (?, ?), (?, ?)" are collapsed into "VALUES (?, ?)".
+//
+//The proxy uses this function wherever it needs to group statements, e.g. for
+//fingerprint rules (see Rules) and in FingerprintStats. Applications can use
+//it to produce matching fingerprints.
+func Normalize(query string) string {
+	query = normalizeBlockCommentRx.ReplaceAllString(query, " ")
+	query = strings.TrimSpace(sqlWhitespaceRx.ReplaceAllString(query, " "))
+	query = normalizeLiteralRx.ReplaceAllString(query, "?")
+	query = normalizeInListRx.ReplaceAllString(query, "IN (?)")
+	return normalizeValuesListRx.ReplaceAllString(query, "VALUES $1")
+}
+
+var leadingKeywordRx = regexp.MustCompile(`^(?:\s|--.*\n|/\*(?s:.*?)\*/|\()*([A-Za-z]+)`)
+
+var knownStatementTypes = map[string]bool{
+	"select": true, "insert": true, "update": true, "delete": true,
+	"with": true, "create": true, "alter": true, "drop": true,
+	"begin": true, "commit": true, "rollback": true,
+}
+
+//StatementType returns the leading keyword of the given query in lower case
+//(e.g. "select" or "insert"), or "other" for statements that do not start
+//with a well-known keyword. Leading comments and parentheses are skipped.
+func StatementType(query string) string {
+	match := leadingKeywordRx.FindStringSubmatch(query)
+	if match == nil {
+		return "other"
+	}
+	keyword := strings.ToLower(match[1])
+	if !knownStatementTypes[keyword] {
+		return "other"
+	}
+	return keyword
+}
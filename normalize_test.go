@@ -0,0 +1,58 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import "testing"
+
+func Test_Normalize(t *testing.T) {
+	testCases := map[string]string{
+		"SELECT * FROM users WHERE id = 42":                      "SELECT * FROM users WHERE id = ?",
+		"SELECT *\n  FROM users -- comment\n WHERE id = $1":      "SELECT * FROM users WHERE id = ?",
+		"SELECT /* hint */ * FROM users WHERE id = ?":            "SELECT * FROM users WHERE id = ?",
+		"SELECT * FROM t1 WHERE name = 'it''s' AND x > 1.5":      "SELECT * FROM t1 WHERE name = ? AND x > ?",
+		"DELETE FROM users WHERE id IN (1, 2, 3)":                "DELETE FROM users WHERE id IN (?)",
+		"DELETE FROM users WHERE id in ($1,$2) OR name IN ('x')": "DELETE FROM users WHERE id IN (?) OR name IN (?)",
+		"INSERT INTO t VALUES (1, 'a'), (2, 'b'),(3, 'c')":       "INSERT INTO t VALUES (?, ?)",
+		"INSERT INTO t (a, b) VALUES ($1, $2)":                   "INSERT INTO t (a, b) VALUES (?, ?)",
+	}
+	for input, expected := range testCases {
+		actual := Normalize(input)
+		if actual != expected {
+			TT{t}.Unexpected("Normalize("+input+")", expected, actual)
+		}
+	}
+}
+
+func Test_StatementType(t *testing.T) {
+	testCases := map[string]string{
+		"SELECT 1":                        "select",
+		"  -- comment\n insert INTO foo":  "insert",
+		"/* hint */ UPDATE foo SET x = 1": "update",
+		"(SELECT 1) UNION (SELECT 2)":     "select",
+		"VACUUM":                          "other",
+		"":                                "other",
+	}
+	for query, expected := range testCases {
+		actual := StatementType(query)
+		if actual != expected {
+			TT{t}.Unexpected("StatementType("+query+")", expected, actual)
+		}
+	}
+}
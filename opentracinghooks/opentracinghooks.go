@@ -0,0 +1,119 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package opentracinghooks provides an adapter that reports the statements
+//executed through a sqlproxy.Driver as OpenTracing spans. It lives in a
+//separate package such that sqlproxy itself does not depend on OpenTracing.
+//Usage:
+//
+//	sql.Register("postgres-with-tracing", sqlproxy.New("postgres",
+//		sqlproxy.WithTracer(opentracinghooks.NewTracer(nil)),
+//	))
+//
+//This also works for legacy tracing clients like jaeger-client-go, since those
+//implement the opentracing.Tracer interface. Each statement becomes a span
+//with the following tags, following the OpenTracing semantic conventions:
+//
+//	span.kind               "client"
+//	component               "sqlproxy"
+//	db.type                 "sql"
+//	db.instance             see Tracer.Instance (only if not empty)
+//	db.user                 see Tracer.User (only if not empty)
+//	db.statement            the query string
+//	sqlproxy.connection_id  see sqlproxy.QueryEvent.ConnectionID
+//	sqlproxy.tenant         see sqlproxy.QueryEvent.Tenant (only if not empty)
+//	sqlproxy.rows           see sqlproxy.QueryEvent.Rows
+//	error                   true for failed statements (and the error is logged on the span)
+package opentracinghooks
+
+import (
+	"context"
+	"strings"
+
+	"github.com/majewsky/sqlproxy"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+//Tracer implements the sqlproxy.Tracer interface on top of OpenTracing.
+type Tracer struct {
+	//Instance (optional) is reported as the "db.instance" tag, e.g. the
+	//database name.
+	Instance string
+	//User (optional) is reported as the "db.user" tag.
+	User string
+
+	tracer opentracing.Tracer
+}
+
+//NewTracer creates a new Tracer that creates spans with the given
+//opentracing.Tracer, or with opentracing.GlobalTracer() if nil.
+func NewTracer(tracer opentracing.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+//StartSpan implements the sqlproxy.Tracer interface.
+func (t *Tracer) StartSpan(ctx context.Context, e sqlproxy.QueryEvent) context.Context {
+	tracer := t.tracer
+	if tracer == nil {
+		tracer = opentracing.GlobalTracer()
+	}
+	tags := opentracing.Tags{
+		string(ext.SpanKind):     ext.SpanKindRPCClientEnum,
+		string(ext.Component):    "sqlproxy",
+		string(ext.DBType):       "sql",
+		string(ext.DBStatement):  e.Query,
+		"sqlproxy.connection_id": e.ConnectionID,
+	}
+	if t.Instance != "" {
+		tags[string(ext.DBInstance)] = t.Instance
+	}
+	if t.User != "" {
+		tags[string(ext.DBUser)] = t.User
+	}
+	if e.Tenant != "" {
+		tags["sqlproxy.tenant"] = e.Tenant
+	}
+	_, ctx = opentracing.StartSpanFromContextWithTracer(ctx, tracer, operationName(e.Query), tags)
+	return ctx
+}
+
+//EndSpan implements the sqlproxy.Tracer interface.
+func (t *Tracer) EndSpan(ctx context.Context, e sqlproxy.QueryEvent) {
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	span.SetTag("sqlproxy.rows", e.Rows)
+	if e.Err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(e.Err))
+	}
+	span.Finish()
+}
+
+//operationName returns an operation name like "SQL SELECT".
+func operationName(query string) string {
+	statementType := sqlproxy.StatementType(query)
+	if statementType == "other" {
+		return "SQL"
+	}
+	return "SQL " + strings.ToUpper(statementType)
+}
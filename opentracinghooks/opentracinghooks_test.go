@@ -0,0 +1,87 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package opentracinghooks
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/majewsky/sqlproxy"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestTracer(t *testing.T) {
+	tracer := mocktracer.New()
+	adapter := NewTracer(tracer)
+	adapter.Instance = "test"
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.sqlite")
+	db := sql.OpenDB(sqlproxy.NewConnector(
+		sqlproxy.New("sqlite3", sqlproxy.WithTracer(adapter)),
+		dsn,
+	))
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`)
+	must(err)
+	_, err = db.Exec(`INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`)
+	must(err)
+	_, err = db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Error("expected DELETE on nonexistent table to fail, but it succeeded")
+	}
+	must(db.Close())
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	for idx, expectedName := range []string{"SQL CREATE", "SQL INSERT", "SQL DELETE"} {
+		if name := spans[idx].OperationName; name != expectedName {
+			t.Errorf("expected span %d to be named %q, got %q", idx, expectedName, name)
+		}
+	}
+	expectedTags := map[string]interface{}{
+		"span.kind":     ext.SpanKindRPCClientEnum,
+		"component":     "sqlproxy",
+		"db.type":       "sql",
+		"db.instance":   "test",
+		"db.statement":  `INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`,
+		"sqlproxy.rows": int64(2),
+	}
+	for key, expected := range expectedTags {
+		if actual := spans[1].Tag(key); actual != expected {
+			t.Errorf("expected tag %s = %#v, got %#v", key, expected, actual)
+		}
+	}
+	if user := spans[1].Tag("db.user"); user != nil {
+		t.Errorf("expected no db.user tag, got %#v", user)
+	}
+	if isError := spans[2].Tag("error"); isError != true {
+		t.Errorf("expected error tag on failed statement, got %#v", isError)
+	}
+}
@@ -0,0 +1,794 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+//Option configures a Driver constructed by New().
+type Option func(*Driver)
+
+//New constructs a Driver for the given proxied driver name, configured by the
+//given options. The result can be given to sql.Register() or NewConnector():
+//
+//	sql.Register("postgres-with-logging", sqlproxy.New("postgres",
+//		sqlproxy.WithBeforeQuery(sqlproxy.TraceQuery(func(msg string) { log.Println(msg) })),
+//		sqlproxy.WithSlowQueryLog(200*time.Millisecond),
+//	))
+//
+//Options are applied in order. When multiple options set the same hook, the
+//hooks are chained instead of replacing each other, so e.g. WithAfterQuery()
+//and WithSlowQueryLog() can be combined.
+//
+//New panics if the resulting configuration is inconsistent (see Validate),
+//so that mistakes are caught at startup instead of on the first connect.
+func New(proxiedDriverName string, opts ...Option) *Driver {
+	d := &Driver{ProxiedDriverName: proxiedDriverName}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if err := d.Validate(); err != nil {
+		panic("sqlproxy.New: " + err.Error())
+	}
+	return d
+}
+
+//Validate checks that the configuration of this Driver is consistent, e.g.
+//that a proxied driver is given either by name or as ProxiedDriver, and that
+//options which depend on other options have them set. New() calls this
+//automatically; users that construct a Driver as a struct literal can call it
+//themselves.
+func (d *Driver) Validate() error {
+	if d.ProxiedDriverName == "" && d.ProxiedDriver == nil {
+		return errors.New("no proxied driver given (either ProxiedDriverName or ProxiedDriver must be set)")
+	}
+	if d.SchemaPerTenant != nil && d.TenantFromContext == nil {
+		return errors.New("SchemaPerTenant requires TenantFromContext to be set")
+	}
+	if d.SchemaPerTenant != nil && d.SchemaPerTenant.Schema == nil {
+		return errors.New("SchemaPerTenant requires its Schema function to be set")
+	}
+	if d.DryRunCountRows && !d.DryRun {
+		return errors.New("DryRunCountRows requires DryRun to be set")
+	}
+	return nil
+}
+
+//WithProxiedDriver sets the Driver.ProxiedDriver field.
+func WithProxiedDriver(proxied driver.Driver) Option {
+	return func(d *Driver) {
+		d.ProxiedDriver = proxied
+	}
+}
+
+//WithQueries sets the Driver.Queries field.
+func WithQueries(q *Queries) Option {
+	return func(d *Driver) {
+		d.Queries = q
+	}
+}
+
+//WithFixtures appends to the Driver.Fixtures field.
+func WithFixtures(statements ...string) Option {
+	return func(d *Driver) {
+		d.Fixtures = append(d.Fixtures, statements...)
+	}
+}
+
+//WithBeforePrepare adds a BeforePrepareHook. When chained, each hook receives
+//the query string returned by the previous one.
+func WithBeforePrepare(hook func(query string) (string, error)) Option {
+	return func(d *Driver) {
+		d.Hooks.BeforePrepareHook = chainBeforePrepareHooks(d.Hooks.BeforePrepareHook, hook)
+	}
+}
+
+func chainBeforePrepareHooks(first, second func(string) (string, error)) func(string) (string, error) {
+	if first == nil {
+		return second
+	}
+	if second == nil {
+		return first
+	}
+	return func(query string) (string, error) {
+		query, err := first(query)
+		if err != nil {
+			return "", err
+		}
+		return second(query)
+	}
+}
+
+//WithBeforeQuery adds a BeforeQueryHook.
+func WithBeforeQuery(hook func(query string, args []interface{})) Option {
+	return func(d *Driver) {
+		d.Hooks.BeforeQueryHook = chainBeforeQueryHooks(d.Hooks.BeforeQueryHook, hook)
+	}
+}
+
+func chainBeforeQueryHooks(first, second func(string, []interface{})) func(string, []interface{}) {
+	if first == nil {
+		return second
+	}
+	if second == nil {
+		return first
+	}
+	return func(query string, args []interface{}) {
+		first(query, args)
+		second(query, args)
+	}
+}
+
+//WithRowTransform adds a RowTransformHook. When chained, the transforms
+//returned by the previous hook run first.
+func WithRowTransform(hook func(query string) []RowTransform) Option {
+	return func(d *Driver) {
+		previous := d.RowTransformHook
+		if previous == nil {
+			d.RowTransformHook = hook
+			return
+		}
+		d.RowTransformHook = func(query string) []RowTransform {
+			return append(previous(query), hook(query)...)
+		}
+	}
+}
+
+//WithAfterConnect adds an AfterConnectHook.
+func WithAfterConnect(hook func(duration time.Duration, err error)) Option {
+	return func(d *Driver) {
+		d.AfterConnectHook = chainAfterConnectHooks(d.AfterConnectHook, hook)
+	}
+}
+
+func chainAfterConnectHooks(first, second func(time.Duration, error)) func(time.Duration, error) {
+	if first == nil {
+		return second
+	}
+	return func(duration time.Duration, err error) {
+		first(duration, err)
+		second(duration, err)
+	}
+}
+
+//WithAfterDisconnect adds an AfterDisconnectHook.
+func WithAfterDisconnect(hook func(err error)) Option {
+	return func(d *Driver) {
+		d.AfterDisconnectHook = chainEventHooks(d.AfterDisconnectHook, hook)
+	}
+}
+
+//WithExpectationHook adds an ExpectationHook.
+func WithExpectationHook(hook func(err ExpectationError)) Option {
+	return func(d *Driver) {
+		d.ExpectationHook = chainEventHooks(d.ExpectationHook, hook)
+	}
+}
+
+//WithAfterQuery adds an AfterQueryHook.
+func WithAfterQuery(hook func(e QueryEvent)) Option {
+	return func(d *Driver) {
+		d.AfterQueryHook = chainAfterQueryHooks(d.AfterQueryHook, hook)
+	}
+}
+
+func chainAfterQueryHooks(first, second func(QueryEvent)) func(QueryEvent) {
+	if first == nil {
+		return second
+	}
+	return func(e QueryEvent) {
+		first(e)
+		second(e)
+	}
+}
+
+//WithAfterCommit adds an AfterCommitHook.
+func WithAfterCommit(hook func(e TransactionEvent)) Option {
+	return func(d *Driver) {
+		d.AfterCommitHook = chainTransactionHooks(d.AfterCommitHook, hook)
+	}
+}
+
+//WithAfterRollback adds an AfterRollbackHook.
+func WithAfterRollback(hook func(e TransactionEvent)) Option {
+	return func(d *Driver) {
+		d.AfterRollbackHook = chainTransactionHooks(d.AfterRollbackHook, hook)
+	}
+}
+
+func chainTransactionHooks(first, second func(TransactionEvent)) func(TransactionEvent) {
+	if first == nil {
+		return second
+	}
+	return func(e TransactionEvent) {
+		first(e)
+		second(e)
+	}
+}
+
+//chainEventHooks is like chainAfterQueryHooks, but for the hooks that receive
+//other kinds of events.
+func chainEventHooks[E any](first, second func(E)) func(E) {
+	if first == nil {
+		return second
+	}
+	return func(e E) {
+		first(e)
+		second(e)
+	}
+}
+
+//WithRouteHook adds a RouteHook. When chained, the decision of the latest hook
+//that does not return RouteDefault wins.
+func WithRouteHook(hook func(ctx context.Context, query string) Route) Option {
+	return func(d *Driver) {
+		previous := d.RouteHook
+		if previous == nil {
+			d.RouteHook = hook
+			return
+		}
+		d.RouteHook = func(ctx context.Context, query string) Route {
+			if route := hook(ctx, query); route != RouteDefault {
+				return route
+			}
+			return previous(ctx, query)
+		}
+	}
+}
+
+//WithInjectionDetection sets the Driver.DetectInjection field.
+func WithInjectionDetection() Option {
+	return func(d *Driver) {
+		d.DetectInjection = true
+	}
+}
+
+//WithSuspiciousQueryHook adds a SuspiciousQueryHook.
+func WithSuspiciousQueryHook(hook func(e SuspiciousQueryEvent)) Option {
+	return func(d *Driver) {
+		d.SuspiciousQueryHook = chainEventHooks(d.SuspiciousQueryHook, hook)
+	}
+}
+
+//WithLiteralDetection sets the Driver.DetectLiterals field.
+func WithLiteralDetection() Option {
+	return func(d *Driver) {
+		d.DetectLiterals = true
+	}
+}
+
+//WithLiteralQueryHook adds a LiteralQueryHook.
+func WithLiteralQueryHook(hook func(e LiteralQueryEvent)) Option {
+	return func(d *Driver) {
+		d.LiteralQueryHook = chainEventHooks(d.LiteralQueryHook, hook)
+	}
+}
+
+//WithParser sets the Driver.Parser field.
+func WithParser(p Parser) Option {
+	return func(d *Driver) {
+		d.Parser = p
+	}
+}
+
+//WithParsedStatementHook adds a ParsedStatementHook. If multiple
+//ParsedStatementHooks are added, the statement is rejected with the first error
+//that any of them returns.
+func WithParsedStatementHook(hook func(query string, ast interface{}) error) Option {
+	return func(d *Driver) {
+		if d.ParsedStatementHook == nil {
+			d.ParsedStatementHook = hook
+			return
+		}
+		first := d.ParsedStatementHook
+		d.ParsedStatementHook = func(query string, ast interface{}) error {
+			if err := first(query, ast); err != nil {
+				return err
+			}
+			return hook(query, ast)
+		}
+	}
+}
+
+//WithMaxRows sets the Driver.MaxRows field.
+func WithMaxRows(maxRows int) Option {
+	return func(d *Driver) {
+		d.MaxRows = maxRows
+	}
+}
+
+//WithTooManyRowsHook adds a TooManyRowsHook.
+func WithTooManyRowsHook(hook func(e QueryEvent)) Option {
+	return func(d *Driver) {
+		d.TooManyRowsHook = chainAfterQueryHooks(d.TooManyRowsHook, hook)
+	}
+}
+
+//WithInterceptHook adds an InterceptHook. When chained, the Interception of
+//the latest hook wins, unless it returns nil.
+func WithInterceptHook(hook func(ctx context.Context, query string, args []interface{}) *Interception) Option {
+	return func(d *Driver) {
+		previous := d.InterceptHook
+		if previous == nil {
+			d.InterceptHook = hook
+			return
+		}
+		d.InterceptHook = func(ctx context.Context, query string, args []interface{}) *Interception {
+			if i := hook(ctx, query, args); i != nil {
+				return i
+			}
+			return previous(ctx, query, args)
+		}
+	}
+}
+
+//WithRollbackOnCommit sets the Driver.RollbackOnCommit field.
+func WithRollbackOnCommit() Option {
+	return func(d *Driver) {
+		d.RollbackOnCommit = true
+	}
+}
+
+//WithDryRun sets the Driver.DryRun field. If countRows is true, the
+//Driver.DryRunCountRows field is set as well.
+func WithDryRun(countRows bool) Option {
+	return func(d *Driver) {
+		d.DryRun = true
+		d.DryRunCountRows = countRows
+	}
+}
+
+//WithDryRunHook adds a DryRunHook.
+func WithDryRunHook(hook func(e QueryEvent)) Option {
+	return func(d *Driver) {
+		d.DryRunHook = chainAfterQueryHooks(d.DryRunHook, hook)
+	}
+}
+
+//WithShadowQueryHook adds a ShadowQueryHook.
+func WithShadowQueryHook(hook func(e QueryEvent)) Option {
+	return func(d *Driver) {
+		d.ShadowQueryHook = chainAfterQueryHooks(d.ShadowQueryHook, hook)
+	}
+}
+
+//WithDivergenceHook adds a DivergenceHook.
+func WithDivergenceHook(hook func(e DivergenceEvent)) Option {
+	return func(d *Driver) {
+		d.DivergenceHook = chainEventHooks(d.DivergenceHook, hook)
+	}
+}
+
+//WithReplicaWarmupHook adds a ReplicaWarmupHook.
+func WithReplicaWarmupHook(hook func(e ReplicaWarmupEvent)) Option {
+	return func(d *Driver) {
+		d.ReplicaWarmupHook = chainEventHooks(d.ReplicaWarmupHook, hook)
+	}
+}
+
+//WithHooks adds all hooks that are set in the given Hooks struct, like the
+//respective With...() options would.
+func WithHooks(hooks Hooks) Option {
+	var opts []Option
+	if hooks.BeforePrepareHook != nil {
+		opts = append(opts, WithBeforePrepare(hooks.BeforePrepareHook))
+	}
+	if hooks.BeforeQueryHook != nil {
+		opts = append(opts, WithBeforeQuery(hooks.BeforeQueryHook))
+	}
+	if hooks.RowTransformHook != nil {
+		opts = append(opts, WithRowTransform(hooks.RowTransformHook))
+	}
+	if hooks.AfterConnectHook != nil {
+		opts = append(opts, WithAfterConnect(hooks.AfterConnectHook))
+	}
+	if hooks.AfterDisconnectHook != nil {
+		opts = append(opts, WithAfterDisconnect(hooks.AfterDisconnectHook))
+	}
+	if hooks.ExpectationHook != nil {
+		opts = append(opts, WithExpectationHook(hooks.ExpectationHook))
+	}
+	if hooks.AfterQueryHook != nil {
+		opts = append(opts, WithAfterQuery(hooks.AfterQueryHook))
+	}
+	if hooks.SlowQueryHook != nil {
+		opts = append(opts, WithSlowQueryHook(hooks.SlowQueryHook))
+	}
+	if hooks.CorrelationHook != nil {
+		opts = append(opts, WithCorrelation(hooks.CorrelationHook))
+	}
+	if hooks.CommentHook != nil {
+		opts = append(opts, WithComments(hooks.CommentHook))
+	}
+	if hooks.RepeatedQueryHook != nil {
+		opts = append(opts, WithRepeatedQueryHook(hooks.RepeatedQueryHook))
+	}
+	if hooks.DuplicateQueryHook != nil {
+		opts = append(opts, WithDuplicateQueryHook(hooks.DuplicateQueryHook))
+	}
+	if hooks.SuspiciousQueryHook != nil {
+		opts = append(opts, WithSuspiciousQueryHook(hooks.SuspiciousQueryHook))
+	}
+	if hooks.LiteralQueryHook != nil {
+		opts = append(opts, WithLiteralQueryHook(hooks.LiteralQueryHook))
+	}
+	if hooks.ParsedStatementHook != nil {
+		opts = append(opts, WithParsedStatementHook(hooks.ParsedStatementHook))
+	}
+	if hooks.TooManyRowsHook != nil {
+		opts = append(opts, WithTooManyRowsHook(hooks.TooManyRowsHook))
+	}
+	if hooks.InterceptHook != nil {
+		opts = append(opts, WithInterceptHook(hooks.InterceptHook))
+	}
+	if hooks.DryRunHook != nil {
+		opts = append(opts, WithDryRunHook(hooks.DryRunHook))
+	}
+	if hooks.ShadowQueryHook != nil {
+		opts = append(opts, WithShadowQueryHook(hooks.ShadowQueryHook))
+	}
+	if hooks.DivergenceHook != nil {
+		opts = append(opts, WithDivergenceHook(hooks.DivergenceHook))
+	}
+	if hooks.AfterCommitHook != nil {
+		opts = append(opts, WithAfterCommit(hooks.AfterCommitHook))
+	}
+	if hooks.AfterRollbackHook != nil {
+		opts = append(opts, WithAfterRollback(hooks.AfterRollbackHook))
+	}
+	if hooks.RouteHook != nil {
+		opts = append(opts, WithRouteHook(hooks.RouteHook))
+	}
+	if hooks.ReplicaWarmupHook != nil {
+		opts = append(opts, WithReplicaWarmupHook(hooks.ReplicaWarmupHook))
+	}
+	if hooks.ExplainHook != nil {
+		opts = append(opts, func(d *Driver) {
+			d.ExplainHook = chainExplainHooks(d.ExplainHook, hooks.ExplainHook)
+		})
+	}
+	return func(d *Driver) {
+		for _, opt := range opts {
+			opt(d)
+		}
+	}
+}
+
+//WithRules adds the hooks from the given rules (see Rules.Hooks).
+func WithRules(r *Rules) Option {
+	return WithHooks(r.Hooks())
+}
+
+//WithQueryPolicy adds the hooks from the given QueryPolicy (see
+//QueryPolicy.Hooks).
+func WithQueryPolicy(p *QueryPolicy) Option {
+	return WithHooks(p.Hooks())
+}
+
+//WithRewriter adds the hooks from the given Rewriter (see Rewriter.Hooks).
+func WithRewriter(r *Rewriter) Option {
+	return WithHooks(r.Hooks())
+}
+
+//WithSlowQueryLog sets the Driver.SlowQueryThreshold field. Unless a
+//SlowQueryHook is set, statements taking longer than the threshold will be
+//logged through log/slog.
+func WithSlowQueryLog(threshold time.Duration) Option {
+	return func(d *Driver) {
+		d.SlowQueryThreshold = threshold
+	}
+}
+
+//WithRedactedSlowQueryLog sets the Driver.RedactSlowQueryArgs field.
+func WithRedactedSlowQueryLog() Option {
+	return func(d *Driver) {
+		d.RedactSlowQueryArgs = true
+	}
+}
+
+//WithSlowQueryHook adds a SlowQueryHook.
+func WithSlowQueryHook(hook func(e QueryEvent)) Option {
+	return func(d *Driver) {
+		d.SlowQueryHook = chainAfterQueryHooks(d.SlowQueryHook, hook)
+	}
+}
+
+//WithExplain sets the Driver.ExplainCommand field, and adds the given
+//ExplainHook if it is not nil.
+func WithExplain(command string, hook func(e QueryEvent, plan string, err error)) Option {
+	return func(d *Driver) {
+		d.ExplainCommand = command
+		if hook != nil {
+			d.ExplainHook = chainExplainHooks(d.ExplainHook, hook)
+		}
+	}
+}
+
+func chainExplainHooks(first, second func(QueryEvent, string, error)) func(QueryEvent, string, error) {
+	if first == nil {
+		return second
+	}
+	return func(e QueryEvent, plan string, err error) {
+		first(e, plan, err)
+		second(e, plan, err)
+	}
+}
+
+//WithRepeatedQueryDetection sets the Driver.RepeatedQueryThreshold field.
+func WithRepeatedQueryDetection(threshold int) Option {
+	return func(d *Driver) {
+		d.RepeatedQueryThreshold = threshold
+	}
+}
+
+//WithRepeatedQueryHook adds a RepeatedQueryHook.
+func WithRepeatedQueryHook(hook func(e RepeatedQueryEvent)) Option {
+	return func(d *Driver) {
+		d.RepeatedQueryHook = chainEventHooks(d.RepeatedQueryHook, hook)
+	}
+}
+
+//WithDuplicateQueryDetection sets the Driver.DetectDuplicateQueries field.
+func WithDuplicateQueryDetection() Option {
+	return func(d *Driver) {
+		d.DetectDuplicateQueries = true
+	}
+}
+
+//WithDuplicateQueryHook adds a DuplicateQueryHook.
+func WithDuplicateQueryHook(hook func(e DuplicateQueryEvent)) Option {
+	return func(d *Driver) {
+		d.DuplicateQueryHook = chainEventHooks(d.DuplicateQueryHook, hook)
+	}
+}
+
+//WithTracer sets the Driver.Tracer field.
+func WithTracer(tracer Tracer) Option {
+	return func(d *Driver) {
+		d.Tracer = tracer
+	}
+}
+
+//WithInspector sets the Driver.Inspector field.
+func WithInspector(inspector *Inspector) Option {
+	return func(d *Driver) {
+		d.Inspector = inspector
+	}
+}
+
+//WithFaultInjector sets the Driver.FaultInjector field.
+func WithFaultInjector(f *FaultInjector) Option {
+	return func(d *Driver) {
+		d.FaultInjector = f
+	}
+}
+
+//WithChaos sets the Driver.Chaos field.
+func WithChaos(c *Chaos) Option {
+	return func(d *Driver) {
+		d.Chaos = c
+	}
+}
+
+//WithChaosSchedule sets the Driver.ChaosSchedule field.
+func WithChaosSchedule(s *ChaosSchedule) Option {
+	return func(d *Driver) {
+		d.ChaosSchedule = s
+	}
+}
+
+//WithShadow sets the Driver.Shadow field.
+func WithShadow(s *Shadow) Option {
+	return func(d *Driver) {
+		d.Shadow = s
+	}
+}
+
+//WithRecorder sets the Driver.Recorder field.
+func WithRecorder(r *Recorder) Option {
+	return func(d *Driver) {
+		d.Recorder = r
+	}
+}
+
+//WithPlanCollector sets the Driver.PlanCollector field.
+func WithPlanCollector(p *PlanCollector) Option {
+	return func(d *Driver) {
+		d.PlanCollector = p
+	}
+}
+
+//WithProfilerLabels sets the Driver.ProfilerLabels field.
+func WithProfilerLabels() Option {
+	return func(d *Driver) {
+		d.ProfilerLabels = true
+	}
+}
+
+//WithCaller sets the Driver.CaptureCaller field.
+func WithCaller() Option {
+	return func(d *Driver) {
+		d.CaptureCaller = true
+	}
+}
+
+//WithPlaceholders sets the Driver.Placeholders field.
+func WithPlaceholders(style PlaceholderStyle) Option {
+	return func(d *Driver) {
+		d.Placeholders = style
+	}
+}
+
+//WithServerTimeout sets the Driver.ServerTimeout field.
+func WithServerTimeout(style ServerTimeoutStyle) Option {
+	return func(d *Driver) {
+		d.ServerTimeout = style
+	}
+}
+
+//WithReadOnly sets the Driver.ReadOnly field.
+func WithReadOnly() Option {
+	return func(d *Driver) {
+		d.ReadOnly = true
+	}
+}
+
+//WithAutoReadOnlyTransactions sets the Driver.AutoReadOnlyTransactions field.
+func WithAutoReadOnlyTransactions() Option {
+	return func(d *Driver) {
+		d.AutoReadOnlyTransactions = true
+	}
+}
+
+//WithMaxComplexity sets the Driver.MaxComplexity field.
+func WithMaxComplexity(max int) Option {
+	return func(d *Driver) {
+		d.MaxComplexity = max
+	}
+}
+
+//WithCommentStripping sets the Driver.StripComments field.
+func WithCommentStripping() Option {
+	return func(d *Driver) {
+		d.StripComments = true
+	}
+}
+
+//WithRedactor sets the Driver.Redactor field.
+func WithRedactor(r *Redactor) Option {
+	return func(d *Driver) {
+		d.Redactor = r
+	}
+}
+
+//WithReplicas sets the Driver.ReplicaDataSources field.
+func WithReplicas(dataSources ...string) Option {
+	return func(d *Driver) {
+		d.ReplicaDataSources = dataSources
+	}
+}
+
+//WithReplicaWarmup sets the Driver.ReplicaWarmup field.
+func WithReplicaWarmup(statements ...string) Option {
+	return func(d *Driver) {
+		d.ReplicaWarmup = statements
+	}
+}
+
+//WithSchemaPerTenant sets the Driver.SchemaPerTenant field.
+func WithSchemaPerTenant(s *SchemaPerTenant) Option {
+	return func(d *Driver) {
+		d.SchemaPerTenant = s
+	}
+}
+
+//WithRowSecurity sets the Driver.RowSecurity field.
+func WithRowSecurity(rs *RowSecurity) Option {
+	return func(d *Driver) {
+		d.RowSecurity = rs
+	}
+}
+
+//WithTableStats sets the Driver.CountTables field.
+func WithTableStats() Option {
+	return func(d *Driver) {
+		d.CountTables = true
+	}
+}
+
+//WithTableList sets the Driver.ListTables field.
+func WithTableList() Option {
+	return func(d *Driver) {
+		d.ListTables = true
+	}
+}
+
+//WithTenant sets the Driver.TenantFromContext field.
+func WithTenant(tenantFromContext func(ctx context.Context) string) Option {
+	return func(d *Driver) {
+		d.TenantFromContext = tenantFromContext
+	}
+}
+
+//WithCorrelation adds a CorrelationHook. When chained, the fields returned by
+//later hooks take precedence.
+func WithCorrelation(hook func(ctx context.Context) map[string]string) Option {
+	return func(d *Driver) {
+		d.CorrelationHook = chainContextFieldHooks(d.CorrelationHook, hook)
+	}
+}
+
+func chainContextFieldHooks(first, second func(context.Context) map[string]string) func(context.Context) map[string]string {
+	if first == nil {
+		return second
+	}
+	return func(ctx context.Context) map[string]string {
+		//merge into a new map, since the hooks may return maps that they keep
+		//using themselves (e.g. a static map)
+		firstFields, secondFields := first(ctx), second(ctx)
+		if len(firstFields) == 0 && len(secondFields) == 0 {
+			return nil
+		}
+		fields := make(map[string]string, len(firstFields)+len(secondFields))
+		for key, value := range firstFields {
+			fields[key] = value
+		}
+		for key, value := range secondFields {
+			fields[key] = value
+		}
+		return fields
+	}
+}
+
+//WithComments adds a CommentHook. When chained, the pairs returned by later
+//hooks take precedence.
+func WithComments(hook func(ctx context.Context) map[string]string) Option {
+	return func(d *Driver) {
+		d.CommentHook = chainContextFieldHooks(d.CommentHook, hook)
+	}
+}
+
+//slowQueryLogger returns an AfterQueryHook that logs statements exceeding the
+//given threshold like the default SlowQueryHook does.
+func slowQueryLogger(threshold time.Duration) func(QueryEvent) {
+	return func(e QueryEvent) {
+		if e.Duration > threshold {
+			logSlowQuery(e, false)
+		}
+	}
+}
+
+//logSlowQuery is the default SlowQueryHook.
+func logSlowQuery(e QueryEvent, redactArgs bool) {
+	attrs := []slog.Attr{
+		slog.String("query", formatQuery(e.Query, nil)),
+		slog.Duration("duration", e.Duration),
+	}
+	if !redactArgs {
+		attrs = append(attrs, slog.Any("args", formatArgs(e.Args)))
+	}
+	attrs = append(attrs, e.fieldAttrs()...)
+	slog.Default().LogAttrs(context.Background(), slog.LevelWarn, "slow SQL statement", attrs...)
+}
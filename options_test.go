@@ -0,0 +1,294 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Test_New tests the functional options constructor, and the AfterQueryHook
+//that some of the options are built on.
+func Test_New(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var (
+		trace  []string
+		events []string
+	)
+	var logBuffer bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logBuffer, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			//remove nondeterministic attributes
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+
+	d := New("sqlite3",
+		WithBeforeQuery(func(query string, args []interface{}) {
+			trace = append(trace, "first: "+query)
+		}),
+		WithBeforeQuery(func(query string, args []interface{}) {
+			trace = append(trace, "second: "+query)
+		}),
+		WithAfterQuery(func(e QueryEvent) {
+			events = append(events, fmt.Sprintf("%s -> %d rows, err = %v", e.Query, e.Rows, e.Err))
+		}),
+		WithSlowQueryLog(time.Nanosecond), //log everything
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`))
+	rows := tt.MustRows(db.Query(`SELECT * FROM knowledge WHERE number > $1`, 5))
+	for rows.Next() {
+	}
+	tt.Must(rows.Err())
+	tt.Must(rows.Close())
+	_, err := db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Error("expected DELETE on nonexistent table to fail, but it succeeded")
+	}
+	tt.Must(db.Close())
+
+	expectedTrace := []string{
+		"first: CREATE TABLE knowledge (number INTEGER, thing TEXT)",
+		"second: CREATE TABLE knowledge (number INTEGER, thing TEXT)",
+		"first: INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')",
+		"second: INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')",
+		"first: SELECT * FROM knowledge WHERE number > $1",
+		"second: SELECT * FROM knowledge WHERE number > $1",
+		"first: DELETE FROM nonexistent",
+		"second: DELETE FROM nonexistent",
+	}
+	if !reflect.DeepEqual(trace, expectedTrace) {
+		tt.Unexpected("trace", expectedTrace, trace)
+	}
+
+	expectedEvents := []string{
+		"CREATE TABLE knowledge (number INTEGER, thing TEXT) -> 0 rows, err = <nil>",
+		"INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth') -> 2 rows, err = <nil>",
+		"SELECT * FROM knowledge WHERE number > $1 -> 2 rows, err = <nil>",
+		"DELETE FROM nonexistent -> 0 rows, err = no such table: nonexistent",
+	}
+	if !reflect.DeepEqual(events, expectedEvents) {
+		tt.Unexpected("events", expectedEvents, events)
+	}
+
+	expectedLog := strings.Join([]string{
+		`level=WARN msg="slow SQL statement" query="CREATE TABLE knowledge (number INTEGER, thing TEXT)" args=[]`,
+		`level=WARN msg="slow SQL statement" query="INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')" args=[]`,
+		`level=WARN msg="slow SQL statement" query="SELECT * FROM knowledge WHERE number > $1" args=[5]`,
+		`level=WARN msg="slow SQL statement" query="DELETE FROM nonexistent" args=[]`,
+	}, "\n") + "\n"
+	if logBuffer.String() != expectedLog {
+		tt.Unexpected("log", expectedLog, logBuffer.String())
+	}
+
+	tt.CleanupDB()
+}
+
+//Test_NewValidation tests that New() rejects inconsistent options up front
+//instead of failing on the first connect.
+func Test_NewValidation(t *testing.T) {
+	expectPanic := func(expected string, opts ...Option) {
+		t.Helper()
+		defer func() {
+			t.Helper()
+			r := recover()
+			if r == nil {
+				t.Errorf("expected New() to panic with %q, but it did not", expected)
+			} else if msg := fmt.Sprint(r); msg != expected {
+				t.Errorf("expected New() to panic with %q, but got %q", expected, msg)
+			}
+		}()
+		New("", opts...)
+	}
+
+	expectPanic("sqlproxy.New: no proxied driver given (either ProxiedDriverName or ProxiedDriver must be set)")
+	expectPanic("sqlproxy.New: SchemaPerTenant requires TenantFromContext to be set",
+		WithProxiedDriver(fakeDriver{}),
+		WithSchemaPerTenant(&SchemaPerTenant{Schema: func(tenant string) string { return tenant }}),
+	)
+
+	//these are valid
+	New("", WithProxiedDriver(fakeDriver{}))
+	New("sqlite3", WithDryRun(true))
+
+	//struct literals can be validated explicitly
+	d := &Driver{ProxiedDriverName: "sqlite3", DryRunCountRows: true}
+	err := d.Validate()
+	if err == nil || err.Error() != "DryRunCountRows requires DryRun to be set" {
+		t.Errorf("unexpected error from Validate: %v", err)
+	}
+}
+
+//Test_SlowQueryHook tests that the SlowQueryHook only sees slow statements.
+func Test_SlowQueryHook(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var slow []string
+	hook := WithSlowQueryHook(func(e QueryEvent) {
+		slow = append(slow, e.Query)
+	})
+	for _, threshold := range []time.Duration{time.Hour, time.Nanosecond} {
+		d := New("sqlite3", WithSlowQueryLog(threshold), hook)
+		db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+		tt.MustResult(db.Exec(fmt.Sprintf(`SELECT '%s'`, threshold)))
+		tt.Must(db.Close())
+	}
+
+	expected := []string{`SELECT '1ns'`}
+	if !reflect.DeepEqual(slow, expected) {
+		tt.Unexpected("slow", expected, slow)
+	}
+
+	tt.CleanupDB()
+}
+
+//Test_Explain tests that query plans are obtained for slow SELECT statements.
+func Test_Explain(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var plans []string
+	d := New("sqlite3",
+		WithSlowQueryHook(func(e QueryEvent) {}),
+		WithSlowQueryLog(time.Nanosecond),
+		WithExplain("EXPLAIN QUERY PLAN", func(e QueryEvent, plan string, err error) {
+			tt.Must(err)
+			plans = append(plans, e.Query+" -> "+plan)
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM knowledge WHERE number > $1`, 5).Scan(&count))
+	tt.Must(db.Close())
+
+	if len(plans) != 1 || !strings.HasPrefix(plans[0], "SELECT COUNT(*) FROM knowledge WHERE number > $1 -> ") || !strings.Contains(plans[0], "SCAN knowledge") {
+		t.Errorf("unexpected plans: %#v", plans)
+	}
+
+	tt.CleanupDB()
+}
+
+//Test_ExplainExecution tests that slow statements are explained with their
+//actual (not redacted) arguments on the connection that executed them, and
+//that intercepted statements are not explained.
+func Test_ExplainExecution(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	//the table only exists on the replica, so explaining on the primary fails
+	replicaFile := filepath.Join(t.TempDir(), "replica.sqlite")
+	replica := tt.MustDB(sql.Open("sqlite3", "file:"+replicaFile))
+	tt.MustResult(replica.Exec(`CREATE TABLE secrets (token TEXT, owner TEXT)`))
+	tt.MustResult(replica.Exec(`INSERT INTO secrets VALUES ('hunter2', 'alice')`))
+	tt.Must(replica.Close())
+
+	redactor, err := NewRedactor(RedactionRule{Columns: []string{"token"}})
+	tt.Must(err)
+	var plans []string
+	d := New("sqlite3",
+		WithReplicas("file:"+replicaFile),
+		WithRedactor(redactor),
+		WithSlowQueryHook(func(e QueryEvent) {}),
+		WithSlowQueryLog(time.Nanosecond),
+		//instead of a query plan, this "explain command" produces the result of
+		//the statement itself, which shows which arguments it was run with
+		WithExplain("WITH unused AS (SELECT 1)", func(e QueryEvent, plan string, err error) {
+			tt.Must(err)
+			plans = append(plans, fmt.Sprintf("%v -> %s", e.Args, plan))
+		}),
+		WithInterceptHook(func(ctx context.Context, query string, args []interface{}) *Interception {
+			if strings.Contains(query, "intercepted") {
+				return &Interception{}
+			}
+			return nil
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	var owner string
+	tt.Must(db.QueryRow(`SELECT owner FROM secrets WHERE token = $1`, "hunter2").Scan(&owner))
+	rows, err := db.Query(`SELECT 'intercepted'`)
+	tt.Must(err)
+	tt.Must(rows.Close())
+	tt.Must(db.Close())
+
+	expected := []string{"[[REDACTED]] -> alice"}
+	if !reflect.DeepEqual(plans, expected) {
+		tt.Unexpected("plans", expected, plans)
+	}
+
+	tt.CleanupDB()
+}
+
+func Test_ChainedContextFieldHooks(t *testing.T) {
+	type requestIDKey struct{}
+	//the first hook returns a map that it keeps using
+	static := map[string]string{"service": "api"}
+	for _, opt := range []func(func(context.Context) map[string]string) Option{WithCorrelation, WithComments} {
+		d := New("sqlite3",
+			opt(func(ctx context.Context) map[string]string { return static }),
+			opt(func(ctx context.Context) map[string]string {
+				return map[string]string{"request": ctx.Value(requestIDKey{}).(string)}
+			}),
+		)
+		hook := d.CorrelationHook
+		if hook == nil {
+			hook = d.CommentHook
+		}
+
+		//concurrent calls must not write into the static map
+		var wg sync.WaitGroup
+		for idx := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				requestID := fmt.Sprintf("r%d", idx)
+				fields := hook(context.WithValue(context.Background(), requestIDKey{}, requestID))
+				expected := map[string]string{"service": "api", "request": requestID}
+				if !reflect.DeepEqual(fields, expected) {
+					t.Errorf("expected fields %v, got %v", expected, fields)
+				}
+			}()
+		}
+		wg.Wait()
+		if !reflect.DeepEqual(static, map[string]string{"service": "api"}) {
+			t.Errorf("static map was modified: %v", static)
+		}
+	}
+}
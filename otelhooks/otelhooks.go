@@ -0,0 +1,103 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package otelhooks provides an adapter that reports the statements executed
+//through a sqlproxy.Driver as OpenTelemetry spans. It lives in a separate
+//package such that sqlproxy itself does not depend on OpenTelemetry. Usage:
+//
+//	sql.Register("postgres-with-tracing", sqlproxy.New("postgres",
+//		sqlproxy.WithTracer(otelhooks.NewTracer(nil)),
+//	))
+//
+//Each statement becomes a span of kind "client" with the following
+//attributes:
+//
+//	db.system               "other_sql"
+//	db.operation            the statement type as reported by sqlproxy.StatementType()
+//	db.statement            the query string
+//	sqlproxy.connection_id  see sqlproxy.QueryEvent.ConnectionID
+//	sqlproxy.tenant         see sqlproxy.QueryEvent.Tenant (only if not empty)
+//	sqlproxy.rows           see sqlproxy.QueryEvent.Rows
+//
+//Failed statements have their error recorded on the span, and the span status
+//set to "error".
+package otelhooks
+
+import (
+	"context"
+	"strings"
+
+	"github.com/majewsky/sqlproxy"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//Tracer implements the sqlproxy.Tracer interface on top of OpenTelemetry.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+//NewTracer creates a new Tracer that creates spans with the given
+//TracerProvider, or with otel.GetTracerProvider() if nil.
+func NewTracer(provider trace.TracerProvider) *Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracer{provider.Tracer("github.com/majewsky/sqlproxy")}
+}
+
+//StartSpan implements the sqlproxy.Tracer interface.
+func (t *Tracer) StartSpan(ctx context.Context, e sqlproxy.QueryEvent) context.Context {
+	operation := sqlproxy.StatementType(e.Query)
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "other_sql"),
+		attribute.String("db.operation", operation),
+		attribute.String("db.statement", e.Query),
+		attribute.Int64("sqlproxy.connection_id", int64(e.ConnectionID)),
+	}
+	if e.Tenant != "" {
+		attrs = append(attrs, attribute.String("sqlproxy.tenant", e.Tenant))
+	}
+	ctx, _ = t.tracer.Start(ctx, spanName(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx
+}
+
+//EndSpan implements the sqlproxy.Tracer interface.
+func (t *Tracer) EndSpan(ctx context.Context, e sqlproxy.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("sqlproxy.rows", e.Rows))
+	if e.Err != nil {
+		span.RecordError(e.Err)
+		span.SetStatus(codes.Error, e.Err.Error())
+	}
+	span.End()
+}
+
+//spanName returns a span name like "SQL SELECT".
+func spanName(operation string) string {
+	if operation == "other" {
+		return "SQL"
+	}
+	return "SQL " + strings.ToUpper(operation)
+}
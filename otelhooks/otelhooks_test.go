@@ -0,0 +1,79 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package otelhooks
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/majewsky/sqlproxy"
+	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.sqlite")
+	db := sql.OpenDB(sqlproxy.NewConnector(
+		sqlproxy.New("sqlite3", sqlproxy.WithTracer(NewTracer(provider))),
+		dsn,
+	))
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`)
+	must(err)
+	rows, err := db.Query(`SELECT * FROM knowledge`)
+	must(err)
+	for rows.Next() {
+	}
+	must(rows.Close())
+	_, err = db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Error("expected DELETE on nonexistent table to fail, but it succeeded")
+	}
+	must(db.Close())
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	for idx, expectedName := range []string{"SQL CREATE", "SQL SELECT", "SQL DELETE"} {
+		if name := spans[idx].Name(); name != expectedName {
+			t.Errorf("expected span %d to be named %q, got %q", idx, expectedName, name)
+		}
+	}
+	attrs := attribute.NewSet(spans[1].Attributes()...)
+	if value, _ := attrs.Value("db.statement"); value.AsString() != `SELECT * FROM knowledge` {
+		t.Errorf("unexpected db.statement: %q", value.AsString())
+	}
+	if status := spans[2].Status(); status.Code != codes.Error {
+		t.Errorf("expected error status on failed statement, got %#v", status)
+	}
+}
@@ -0,0 +1,76 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+//Parser parses statements into a structured representation (an abstract
+//syntax tree), so that hooks can inspect statements without parsing the query
+//string themselves (see Driver.Parser). This package does not contain an SQL
+//parser itself; the interface is meant to be implemented by thin adapters
+//around existing parsers. For example, with the MySQL parser from Vitess:
+//
+//	parser, err := sqlparser.New(sqlparser.Options{})
+//	...
+//	d := sqlproxy.New("mysql", sqlproxy.WithParser(sqlproxy.ParserFunc(
+//		func(query string) (interface{}, error) {
+//			return parser.Parse(query)
+//		},
+//	)))
+//
+//Or with pg_query_go, which uses the parser of PostgreSQL itself:
+//
+//	d := sqlproxy.New("postgres", sqlproxy.WithParser(sqlproxy.ParserFunc(
+//		func(query string) (interface{}, error) {
+//			return pg_query.Parse(query)
+//		},
+//	)))
+//
+//Parse may be called concurrently from multiple goroutines.
+type Parser interface {
+	Parse(query string) (interface{}, error)
+}
+
+//ParserFunc is an adapter that allows the use of ordinary functions as Parser.
+type ParserFunc func(query string) (interface{}, error)
+
+//Parse implements the Parser interface.
+func (f ParserFunc) Parse(query string) (interface{}, error) {
+	return f(query)
+}
+
+//parsedStatement is the result of Driver.Parser for one statement.
+type parsedStatement struct {
+	ast interface{}
+	err error
+}
+
+//parse implements Driver.Parser and the ParsedStatementHook. Nil is returned
+//if no Parser is configured.
+func (c *connection) parse(hooks *Hooks, query string) (*parsedStatement, error) {
+	if c.driver.Parser == nil {
+		return nil, nil
+	}
+	ast, err := c.driver.Parser.Parse(query)
+	if err == nil && hooks.ParsedStatementHook != nil {
+		if hookErr := hooks.ParsedStatementHook(query, ast); hookErr != nil {
+			return nil, hookErr
+		}
+	}
+	return &parsedStatement{ast, err}, nil
+}
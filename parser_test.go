@@ -0,0 +1,86 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//toyParser splits statements into upper-case words. It cannot parse
+//statements containing "?".
+var toyParser = ParserFunc(func(query string) (interface{}, error) {
+	if strings.Contains(query, "?") {
+		return nil, errors.New("placeholders are not supported")
+	}
+	return strings.Fields(strings.ToUpper(query)), nil
+})
+
+func Test_Parser(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	errNoDrop := errors.New("DROP is not allowed")
+	var events []QueryEvent
+	d := New("sqlite3",
+		WithParser(toyParser),
+		WithParsedStatementHook(func(query string, ast interface{}) error {
+			if ast.([]string)[0] == "DROP" {
+				return errNoDrop
+			}
+			return nil
+		}),
+		WithAfterQuery(func(e QueryEvent) { events = append(events, e) }),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`create table users (name TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (name) VALUES (?)`, "alice"))
+	stmt, err := db.Prepare(`SELECT name FROM users`)
+	tt.Must(err)
+	rows := tt.MustRows(stmt.Query())
+	tt.Must(rows.Close())
+	tt.Must(stmt.Close())
+
+	_, err = db.Exec(`DROP TABLE users`)
+	if !errors.Is(err, errNoDrop) {
+		t.Errorf("expected DROP to be rejected, got %#v", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	expected := []string{"CREATE", "TABLE", "USERS", "(NAME", "TEXT)"}
+	if !reflect.DeepEqual(events[0].AST, expected) {
+		tt.Unexpected("AST", expected, events[0].AST)
+	}
+	if events[1].AST != nil || events[1].ParseError == nil {
+		t.Errorf("expected ParseError for statement with placeholder, got AST = %#v, ParseError = %#v", events[1].AST, events[1].ParseError)
+	}
+	expected = []string{"SELECT", "NAME", "FROM", "USERS"}
+	if !reflect.DeepEqual(events[2].AST, expected) {
+		tt.Unexpected("AST", expected, events[2].AST)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
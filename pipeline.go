@@ -0,0 +1,199 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+//All statements go through the same pipeline: rewriteQuery() runs the
+//BeforePrepareHook and all rewrites and policy checks that only depend on the
+//query string (once per Prepare() for prepared statements), then the caller
+//chooses the connection to execute on, and execute() runs the statement and
+//all hooks around it. The results are reported by finishExec() or
+//finishQuery().
+
+//rewrittenQuery is a statement that has passed through rewriteQuery().
+type rewrittenQuery struct {
+	query string
+	//the name of the statement in Driver.Queries, if any (it is looked up
+	//with the query as given by the caller, before the BeforePrepareHook and
+	//all rewrites)
+	name   string
+	expect *expectation
+	//see Driver.RowSecurity
+	rowSecurity *rowSecurityRewrite
+	//see Driver.Placeholders
+	placeholders *placeholderTranslation
+	//see Driver.Parser
+	parsed *parsedStatement
+}
+
+//rewriteQuery runs the given query through the BeforePrepareHook, and through
+//all rewrites and policy checks that do not depend on the arguments.
+func (c *connection) rewriteQuery(ctx context.Context, hooks *Hooks, query string) (*rewrittenQuery, error) {
+	q := &rewrittenQuery{}
+	q.name, q.expect = c.driver.lookupQuery(query)
+	query, err := hooks.execBeforePrepareHook(query)
+	if err != nil {
+		return nil, err
+	}
+	if c.driver.StripComments {
+		query = stripComments(query)
+	}
+	if err := c.checkReadOnly(query); err != nil {
+		return nil, err
+	}
+	if err := c.checkComplexity(ctx, query); err != nil {
+		return nil, err
+	}
+	query = c.qualifyTables(ctx, query)
+	q.rowSecurity, err = c.applyRowSecurity(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if q.rowSecurity != nil {
+		query = q.rowSecurity.query
+	}
+	q.placeholders = c.translatePlaceholders(query)
+	if q.placeholders != nil {
+		query = q.placeholders.query
+	}
+	query = c.injectTimeoutHint(ctx, query)
+	query = hooks.execCommentHook(ctx, query)
+	q.parsed, err = c.parse(hooks, query)
+	if err != nil {
+		return nil, err
+	}
+	q.query = query
+	return q, nil
+}
+
+//args rewrites the arguments for one execution of this query to match the
+//rewrites of Driver.RowSecurity and Driver.Placeholders.
+func (q *rewrittenQuery) args(ctx context.Context, args []driver.NamedValue) ([]driver.NamedValue, error) {
+	var err error
+	if q.rowSecurity != nil {
+		args, err = q.rowSecurity.args(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if q.placeholders != nil {
+		args, err = q.placeholders.args(args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+//execution is the state of a single statement execution, see execute().
+type execution struct {
+	hooks  *Hooks
+	expect *expectation
+	event  QueryEvent
+	//set if an InterceptHook or DryRun answered the statement instead of the
+	//database
+	interception *Interception
+	//the error returned by the proxied driver or by fault injection
+	err error
+}
+
+//execute runs a single execution of the given query on the given connection
+//(either the primary or a replica). The given action executes the statement
+//on the proxied driver, unless an InterceptHook, DryRun or fault injection
+//takes over. An error is only returned if the execution could not be started;
+//all other errors are reported through the execution.
+func (c *connection) execute(ctx context.Context, hooks *Hooks, conn driver.Conn, q *rewrittenQuery, args []driver.NamedValue, action func(ctx context.Context, x *execution) error) (*execution, error) {
+	if err := c.useSchema(ctx, conn); err != nil {
+		return nil, err
+	}
+	if err := c.setServerTimeout(ctx, conn); err != nil {
+		return nil, err
+	}
+	x := &execution{hooks: hooks, expect: q.expect}
+	x.event = c.newEvent(ctx, hooks, q, args)
+	x.event.Replica = conn != c.conn
+	x.event.boundArgs = args
+	x.event.conn = conn
+	ctx = c.startSpan(ctx, &x.event)
+	hooks.execBeforeQueryHook(x.event.Query, x.event.Args)
+
+	startedAt := time.Now()
+	c.withProfilerLabels(ctx, q.query, func(ctx context.Context) {
+		if x.interception = hooks.execInterceptHook(ctx, q.query, args); x.interception != nil {
+			return
+		}
+		if x.interception = c.dryRun(ctx, conn, hooks, x.event, args); x.interception != nil {
+			return
+		}
+		if x.err = c.injectFault(ctx, q.query); x.err != nil {
+			return
+		}
+		x.err = action(ctx, x)
+	})
+	x.event.intercepted = x.interception != nil
+	x.event.Duration = time.Since(startedAt)
+	return x, nil
+}
+
+//finishExec does the common postprocessing for all Exec() calls.
+func (c *connection) finishExec(x *execution, result driver.Result) (driver.Result, error) {
+	err := x.err
+	if x.interception != nil {
+		result, err = x.interception.result()
+	}
+	if err == nil {
+		err = x.expect.checkDuration(x.event.Duration)
+	}
+	event := x.event
+	event.Err = c.checkError(err)
+	if event.Err == nil {
+		//not all drivers can report this, so errors are ignored here
+		event.Rows, _ = result.RowsAffected()
+		if event.recording != nil {
+			if id, err := result.LastInsertId(); err == nil {
+				event.recording.lastInsertID = &id
+			}
+		}
+	}
+	c.afterQuery(x.hooks, event)
+	return result, event.Err
+}
+
+//finishQuery does the common postprocessing for all Query() calls. For
+//one-off queries that had to be prepared, the statement is given and will be
+//closed along with the rows.
+func (c *connection) finishQuery(x *execution, rows driver.Rows, stmt driver.Stmt) (driver.Rows, error) {
+	err := x.err
+	if x.interception != nil {
+		rows, err = x.interception.rows()
+	}
+	if err != nil {
+		event := x.event
+		event.Err = c.checkError(err)
+		c.afterQuery(x.hooks, event)
+		return nil, event.Err
+	}
+	return newResultRows(c, rows, stmt, x.hooks, x.event, x.expect)
+}
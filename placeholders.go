@@ -0,0 +1,267 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//PlaceholderStyle is a syntax for argument placeholders in SQL statements.
+//See Driver.Placeholders.
+type PlaceholderStyle string
+
+const (
+	//PlaceholderQuestion is the "?" style used by MySQL and SQLite.
+	PlaceholderQuestion PlaceholderStyle = "?"
+	//PlaceholderDollar is the "$1, $2, ..." style used by PostgreSQL.
+	PlaceholderDollar PlaceholderStyle = "$"
+	//PlaceholderColon is the ":name" style used by Oracle. Positional
+	//arguments are written as ":1, :2, ...".
+	PlaceholderColon PlaceholderStyle = ":"
+)
+
+//placeholderRef identifies the argument that a placeholder refers to.
+type placeholderRef struct {
+	//for named placeholders, the name of the argument
+	name string
+	//for positional placeholders, the 1-based position of the argument; for
+	//named placeholders, the position to fall back to when the arguments are
+	//not named (the n-th distinct name refers to the n-th argument)
+	ordinal int
+}
+
+func (r placeholderRef) String() string {
+	if r.name != "" {
+		return ":" + r.name
+	}
+	return "$" + strconv.Itoa(r.ordinal)
+}
+
+//placeholderTranslation is the result of translatePlaceholders().
+type placeholderTranslation struct {
+	query string
+	style PlaceholderStyle
+	//the arguments that the translated query expects, in order
+	refs []placeholderRef
+}
+
+type placeholderMatch struct {
+	start, end int
+	ref        placeholderRef
+}
+
+//translatePlaceholders rewrites all placeholders in the given query (in any
+//of the supported styles) into the given style. String literals, quoted
+//identifiers and comments are skipped. If the query does not need to be
+//translated, nil is returned.
+func translatePlaceholders(query string, style PlaceholderStyle) *placeholderTranslation {
+	matches := findPlaceholders(query)
+	needsTranslation := false
+	for _, m := range matches {
+		if PlaceholderStyle(query[m.start:m.start+1]) != style {
+			needsTranslation = true
+		}
+	}
+	if !needsTranslation {
+		return nil
+	}
+	return renderPlaceholders(query, matches, style)
+}
+
+//renderPlaceholders rewrites the given placeholders in the given query into
+//the given style.
+func renderPlaceholders(query string, matches []placeholderMatch, style PlaceholderStyle) *placeholderTranslation {
+	t := &placeholderTranslation{style: style}
+	var (
+		b        strings.Builder
+		offset   = 0
+		indexFor = make(map[placeholderRef]int)
+	)
+	for _, m := range matches {
+		b.WriteString(query[offset:m.start])
+		offset = m.end
+
+		if style == PlaceholderQuestion {
+			t.refs = append(t.refs, m.ref)
+			b.WriteString("?")
+			continue
+		}
+		idx, exists := indexFor[m.ref]
+		if !exists {
+			t.refs = append(t.refs, m.ref)
+			idx = len(t.refs)
+			indexFor[m.ref] = idx
+		}
+		switch {
+		case style == PlaceholderDollar:
+			b.WriteString("$" + strconv.Itoa(idx))
+		case m.ref.name != "":
+			b.WriteString(":" + m.ref.name)
+		default:
+			b.WriteString(":" + strconv.Itoa(idx))
+		}
+	}
+	b.WriteString(query[offset:])
+	t.query = b.String()
+	return t
+}
+
+//findPlaceholders returns all placeholders in the given query, in order.
+func findPlaceholders(query string) []placeholderMatch {
+	var (
+		result        []placeholderMatch
+		questionMarks = 0
+		namedOrdinals = make(map[string]int)
+	)
+	for idx := 0; idx < len(query); idx++ {
+		switch c := query[idx]; c {
+		case '\'', '"', '`':
+			end := strings.IndexByte(query[idx+1:], c)
+			if end == -1 {
+				return result
+			}
+			idx += end + 1
+		case '-':
+			if strings.HasPrefix(query[idx:], "--") {
+				end := strings.IndexByte(query[idx:], '\n')
+				if end == -1 {
+					return result
+				}
+				idx += end
+			}
+		case '/':
+			if strings.HasPrefix(query[idx:], "/*") {
+				end := strings.Index(query[idx+2:], "*/")
+				if end == -1 {
+					return result
+				}
+				idx += end + 3
+			}
+		case '?':
+			questionMarks++
+			result = append(result, placeholderMatch{idx, idx + 1, placeholderRef{ordinal: questionMarks}})
+		case '$':
+			end := idx + 1 + countLeadingBytes(query[idx+1:], isDigit)
+			if end > idx+1 {
+				ordinal, _ := strconv.Atoi(query[idx+1 : end])
+				result = append(result, placeholderMatch{idx, end, placeholderRef{ordinal: ordinal}})
+				idx = end - 1
+				continue
+			}
+			if length := dollarQuoteLength(query[idx:]); length > 0 {
+				idx += length - 1
+			}
+		case ':':
+			if strings.HasPrefix(query[idx:], "::") {
+				//type cast (PostgreSQL)
+				idx++
+				continue
+			}
+			if idx+1 >= len(query) || isDigit(query[idx+1]) {
+				continue
+			}
+			end := idx + 1 + countLeadingBytes(query[idx+1:], isIdentifierByte)
+			if end > idx+1 {
+				name := query[idx+1 : end]
+				ordinal, exists := namedOrdinals[name]
+				if !exists {
+					ordinal = len(namedOrdinals) + 1
+					namedOrdinals[name] = ordinal
+				}
+				result = append(result, placeholderMatch{idx, end, placeholderRef{name: name, ordinal: ordinal}})
+				idx = end - 1
+			}
+		}
+	}
+	return result
+}
+
+//dollarQuoteLength returns the length of the dollar-quoted string (like
+//$$...$$ or $tag$...$tag$ in PostgreSQL) at the start of s, or 0 if s does not
+//start with a dollar-quoted string. Unterminated strings extend to the end of
+//s.
+func dollarQuoteLength(s string) int {
+	if len(s) < 2 || s[0] != '$' || isDigit(s[1]) {
+		return 0
+	}
+	tagEnd := 1 + countLeadingBytes(s[1:], isIdentifierByte)
+	if tagEnd >= len(s) || s[tagEnd] != '$' {
+		return 0
+	}
+	tag := s[:tagEnd+1]
+	end := strings.Index(s[len(tag):], tag)
+	if end == -1 {
+		return len(s)
+	}
+	return len(tag) + end + len(tag)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func countLeadingBytes(s string, predicate func(byte) bool) int {
+	for idx := 0; idx < len(s); idx++ {
+		if !predicate(s[idx]) {
+			return idx
+		}
+	}
+	return len(s)
+}
+
+//args arranges the given arguments in the order that the translated query
+//expects them.
+func (t *placeholderTranslation) args(args []driver.NamedValue) ([]driver.NamedValue, error) {
+	result := make([]driver.NamedValue, len(t.refs))
+	for idx, ref := range t.refs {
+		arg, err := findArgument(args, ref)
+		if err != nil {
+			return nil, err
+		}
+		result[idx] = driver.NamedValue{Ordinal: idx + 1, Value: arg.Value}
+		if t.style == PlaceholderColon {
+			result[idx].Name = ref.name
+		}
+	}
+	return result, nil
+}
+
+func findArgument(args []driver.NamedValue, ref placeholderRef) (driver.NamedValue, error) {
+	if ref.name != "" {
+		for _, arg := range args {
+			if arg.Name == ref.name {
+				return arg, nil
+			}
+		}
+	}
+	for _, arg := range args {
+		if arg.Ordinal == ref.ordinal && (ref.name == "" || arg.Name == "") {
+			return arg, nil
+		}
+	}
+	return driver.NamedValue{}, fmt.Errorf("sqlproxy: no argument given for placeholder %s", ref)
+}
@@ -0,0 +1,128 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+)
+
+func Test_TranslatePlaceholders(t *testing.T) {
+	testCases := []struct {
+		Query    string
+		Style    PlaceholderStyle
+		Expected string
+		Refs     []placeholderRef
+	}{
+		{`SELECT * FROM t WHERE a = ? AND b = ?`, PlaceholderDollar,
+			`SELECT * FROM t WHERE a = $1 AND b = $2`, []placeholderRef{{ordinal: 1}, {ordinal: 2}}},
+		{`SELECT * FROM t WHERE a = $2 OR b = $1 OR c = $2`, PlaceholderQuestion,
+			`SELECT * FROM t WHERE a = ? OR b = ? OR c = ?`, []placeholderRef{{ordinal: 2}, {ordinal: 1}, {ordinal: 2}}},
+		{`SELECT * FROM t WHERE a = $2 OR b = $1 OR c = $2`, PlaceholderColon,
+			`SELECT * FROM t WHERE a = :1 OR b = :2 OR c = :1`, []placeholderRef{{ordinal: 2}, {ordinal: 1}}},
+		{`UPDATE t SET a = :value WHERE id = :id AND b <> :value`, PlaceholderDollar,
+			`UPDATE t SET a = $1 WHERE id = $2 AND b <> $1`, []placeholderRef{{"value", 1}, {"id", 2}}},
+		//literals, quoted identifiers, comments and casts are skipped
+		{"SELECT '?', \"$1\", `:x`, $$ ? $$, $f$ ? $f$, a::text FROM t /* ? */ WHERE b = ? -- ?", PlaceholderDollar,
+			"SELECT '?', \"$1\", `:x`, $$ ? $$, $f$ ? $f$, a::text FROM t /* ? */ WHERE b = $1 -- ?", []placeholderRef{{ordinal: 1}}},
+	}
+	for _, tc := range testCases {
+		actual := translatePlaceholders(tc.Query, tc.Style)
+		if actual == nil {
+			t.Errorf("expected %q to be translated, but it was not", tc.Query)
+			continue
+		}
+		if actual.query != tc.Expected {
+			TT{t}.Unexpected("translation of "+tc.Query, tc.Expected, actual.query)
+		}
+		if !reflect.DeepEqual(actual.refs, tc.Refs) {
+			TT{t}.Unexpected("placeholders in "+tc.Query, tc.Refs, actual.refs)
+		}
+	}
+
+	//statements that already use the desired style are not translated
+	for _, query := range []string{`SELECT 1`, `SELECT * FROM t WHERE a = $1 AND b = $1`} {
+		if actual := translatePlaceholders(query, PlaceholderDollar); actual != nil {
+			t.Errorf("expected %q not to be translated, but got %q", query, actual.query)
+		}
+	}
+}
+
+func Test_PlaceholderTranslationArgs(t *testing.T) {
+	tt := TT{t}
+
+	pt := translatePlaceholders(`SELECT :b, :a, :b`, PlaceholderQuestion)
+	actual, err := pt.args([]driver.NamedValue{
+		{Name: "a", Ordinal: 1, Value: int64(1)},
+		{Name: "b", Ordinal: 2, Value: int64(2)},
+	})
+	tt.Must(err)
+	expected := []driver.NamedValue{
+		{Ordinal: 1, Value: int64(2)},
+		{Ordinal: 2, Value: int64(1)},
+		{Ordinal: 3, Value: int64(2)},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("args", expected, actual)
+	}
+
+	//unnamed arguments are used in the order of first appearance of each name
+	actual, err = pt.args([]driver.NamedValue{{Ordinal: 1, Value: "x"}, {Ordinal: 2, Value: "y"}})
+	tt.Must(err)
+	expected = []driver.NamedValue{{Ordinal: 1, Value: "x"}, {Ordinal: 2, Value: "y"}, {Ordinal: 3, Value: "x"}}
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("args", expected, actual)
+	}
+
+	_, err = pt.args([]driver.NamedValue{{Name: "a", Ordinal: 1, Value: int64(1)}})
+	if err == nil || err.Error() != "sqlproxy: no argument given for placeholder :b" {
+		t.Errorf("expected missing argument error, got err = %v", err)
+	}
+}
+
+func Test_DriverPlaceholders(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithPlaceholders(PlaceholderQuestion)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ($2, $1), ($3, $1)`, "truth", 42, 23))
+
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM knowledge WHERE thing = :thing AND number > :min`,
+		sql.Named("min", 30), sql.Named("thing", "truth")).Scan(&count))
+	if count != 1 {
+		tt.Unexpected("count", 1, count)
+	}
+
+	stmt, err := db.Prepare(`SELECT number FROM knowledge WHERE number = $1 OR number = $1 + 1`)
+	tt.Must(err)
+	var number int
+	tt.Must(stmt.QueryRow(22).Scan(&number))
+	if number != 23 {
+		tt.Unexpected("number", 23, number)
+	}
+	tt.Must(stmt.Close())
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
@@ -0,0 +1,150 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//PlanReportVersion is the version of the report format written by
+//PlanCollector.WriteReport().
+const PlanReportVersion = 1
+
+//PlanCollector runs EXPLAIN once for every distinct SELECT statement (as
+//identified by its fingerprint, see Normalize) that is executed through a
+//Driver, and writes the collected query plans into a report. When the report
+//of a test suite is stored as a CI artifact, the reports of two branches can
+//be diffed to catch index regressions before they reach production:
+//
+//	func TestMain(m *testing.M) {
+//		plans := sqlproxy.NewPlanCollector("EXPLAIN (COSTS OFF)")
+//		sql.Register("postgres-test", sqlproxy.New("postgres", sqlproxy.WithPlanCollector(plans)))
+//		code := m.Run()
+//		file, err := os.Create("query-plans.json")
+//		...
+//		err = plans.WriteReport(file)
+//		...
+//		os.Exit(code)
+//	}
+//
+//The command is prepended to the statement like Driver.ExplainCommand, and run
+//with the same arguments (unredacted, even if Driver.Redactor is set) on the
+//same connection (which may be a replica) after the statement has completed.
+//Only statements that completed successfully are explained, and statements
+//answered by an InterceptHook or DryRun are skipped. For stable diffs, the command should leave out details that vary between runs,
+//like cost estimates or actual timings (e.g. "EXPLAIN (COSTS OFF)" for
+//PostgreSQL, or "EXPLAIN QUERY PLAN" for SQLite).
+type PlanCollector struct {
+	command string
+	mutex   sync.Mutex
+	//indexed by fingerprint; a nil entry means that the plan is being
+	//collected right now
+	plans map[string]*collectedPlan
+}
+
+type collectedPlan struct {
+	Fingerprint string   `json:"fingerprint"`
+	Plan        []string `json:"plan,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+type planReport struct {
+	Version int              `json:"sqlproxy_plans"`
+	Plans   []*collectedPlan `json:"plans"`
+}
+
+//NewPlanCollector returns a PlanCollector that obtains query plans by
+//prepending the given command to each statement.
+func NewPlanCollector(command string) *PlanCollector {
+	return &PlanCollector{command: command, plans: make(map[string]*collectedPlan)}
+}
+
+//collect implements Driver.PlanCollector for a statement that has completed.
+func (p *PlanCollector) collect(e QueryEvent) {
+	if e.Err != nil || e.intercepted || e.conn == nil || StatementType(e.Query) != "select" {
+		return
+	}
+	fingerprint := Normalize(e.Query)
+	p.mutex.Lock()
+	_, exists := p.plans[fingerprint]
+	if !exists {
+		p.plans[fingerprint] = nil
+	}
+	p.mutex.Unlock()
+	if exists {
+		return
+	}
+
+	result := &collectedPlan{Fingerprint: fingerprint}
+	plan, err := explain(e.conn, p.command+" "+e.Query, e.boundArgs)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Plan = strings.Split(plan, "\n")
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.plans[fingerprint] = result
+}
+
+//WriteReport writes the plans collected so far as JSON, for example:
+//
+//	{
+//	  "sqlproxy_plans": 1,
+//	  "plans": [
+//	    {
+//	      "fingerprint": "SELECT name FROM users WHERE id = ?",
+//	      "plan": [
+//	        "Index Scan using users_pkey on users",
+//	        "  Index Cond: (id = $1)"
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+//The plan contains one line per row returned by the EXPLAIN command, with the
+//columns of each row separated by spaces. If the EXPLAIN command failed, the
+//key "error" contains the error message instead. The plans are sorted by
+//fingerprint, so that the reports of different runs can be compared with a
+//line-based diff.
+func (p *PlanCollector) WriteReport(w io.Writer) error {
+	report := planReport{Version: PlanReportVersion, Plans: []*collectedPlan{}}
+	p.mutex.Lock()
+	for _, plan := range p.plans {
+		if plan != nil {
+			report.Plans = append(report.Plans, plan)
+		}
+	}
+	p.mutex.Unlock()
+	sort.Slice(report.Plans, func(i, j int) bool {
+		return report.Plans[i].Fingerprint < report.Plans[j].Fingerprint
+	})
+
+	buf, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
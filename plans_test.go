@@ -0,0 +1,144 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_PlanCollector(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	plans := NewPlanCollector("EXPLAIN QUERY PLAN")
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithPlanCollector(plans)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (id, name) VALUES (1, 'alice'), (2, 'bob')`))
+
+	for _, id := range []int{1, 2, 1} {
+		var name string
+		tt.Must(db.QueryRow(`SELECT name FROM users WHERE id = ?`, id).Scan(&name))
+	}
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM users WHERE name = 'alice'`).Scan(&count))
+	_, err := db.Query(`SELECT * FROM nonexistent`)
+	if err == nil {
+		t.Fatal("expected query on nonexistent table to fail")
+	}
+	tt.Must(db.Close())
+	tt.CleanupDB()
+
+	var buf bytes.Buffer
+	tt.Must(plans.WriteReport(&buf))
+	var report struct {
+		Version int `json:"sqlproxy_plans"`
+		Plans   []struct {
+			Fingerprint string   `json:"fingerprint"`
+			Plan        []string `json:"plan"`
+		} `json:"plans"`
+	}
+	tt.Must(json.Unmarshal(buf.Bytes(), &report))
+	if report.Version != PlanReportVersion {
+		tt.Unexpected("report version", PlanReportVersion, report.Version)
+	}
+
+	//each fingerprint is explained once; failed statements and writes are
+	//not explained
+	var fingerprints []string
+	for _, plan := range report.Plans {
+		fingerprints = append(fingerprints, plan.Fingerprint)
+	}
+	expected := []string{
+		`SELECT COUNT(*) FROM users WHERE name = ?`,
+		`SELECT name FROM users WHERE id = ?`,
+	}
+	if !reflect.DeepEqual(fingerprints, expected) {
+		tt.Unexpected("explained statements", expected, fingerprints)
+	}
+	if len(report.Plans) == 2 {
+		if plan := strings.Join(report.Plans[0].Plan, "\n"); !strings.Contains(plan, "SCAN") {
+			t.Errorf("expected a table scan for the COUNT(*) query, got %q", plan)
+		}
+		if plan := strings.Join(report.Plans[1].Plan, "\n"); !strings.Contains(plan, "SEARCH") {
+			t.Errorf("expected an index search for the lookup by ID, got %q", plan)
+		}
+	}
+}
+
+//Test_PlanCollectorExecution tests that statements are explained with their
+//actual (not redacted) arguments on the connection that executed them, and
+//that intercepted statements are not explained.
+func Test_PlanCollectorExecution(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	//the table only exists on the replica, so explaining on the primary fails
+	replicaFile := filepath.Join(t.TempDir(), "replica.sqlite")
+	replica := tt.MustDB(sql.Open("sqlite3", "file:"+replicaFile))
+	tt.MustResult(replica.Exec(`CREATE TABLE secrets (token TEXT, owner TEXT)`))
+	tt.MustResult(replica.Exec(`INSERT INTO secrets VALUES ('hunter2', 'alice')`))
+	tt.Must(replica.Close())
+
+	redactor, err := NewRedactor(RedactionRule{Columns: []string{"token"}})
+	tt.Must(err)
+	//instead of a query plan, this "explain command" produces the result of
+	//the statement itself, which shows which arguments it was run with
+	plans := NewPlanCollector("WITH unused AS (SELECT 1)")
+	d := New("sqlite3",
+		WithReplicas("file:"+replicaFile),
+		WithRedactor(redactor),
+		WithPlanCollector(plans),
+		WithInterceptHook(func(ctx context.Context, query string, args []interface{}) *Interception {
+			if strings.Contains(query, "intercepted") {
+				return &Interception{}
+			}
+			return nil
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	var owner string
+	tt.Must(db.QueryRow(`SELECT owner FROM secrets WHERE token = $1`, "hunter2").Scan(&owner))
+	rows, err := db.Query(`SELECT 'intercepted'`)
+	tt.Must(err)
+	tt.Must(rows.Close())
+	tt.Must(db.Close())
+	tt.CleanupDB()
+
+	var buf bytes.Buffer
+	tt.Must(plans.WriteReport(&buf))
+	var report struct {
+		Plans []collectedPlan `json:"plans"`
+	}
+	tt.Must(json.Unmarshal(buf.Bytes(), &report))
+	expected := []collectedPlan{{
+		Fingerprint: `SELECT owner FROM secrets WHERE token = ?`,
+		Plan:        []string{"alice"},
+	}}
+	if !reflect.DeepEqual(report.Plans, expected) {
+		tt.Unexpected("plans", expected, report.Plans)
+	}
+}
@@ -0,0 +1,151 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//QueryPolicy restricts which statements may be executed. Statements that
+//violate the policy are rejected with a PolicyError before they reach the
+//database. For example, to make sure that a service never truncates tables:
+//
+//	policy, err := sqlproxy.NewQueryPolicy(nil, []string{`(?i)^\s*TRUNCATE\b`})
+//	...
+//	sql.Register("postgres-with-policy", sqlproxy.New("postgres", sqlproxy.WithQueryPolicy(policy)))
+type QueryPolicy struct {
+	allow map[string]bool
+	deny  []*regexp.Regexp
+}
+
+//NewQueryPolicy compiles a QueryPolicy.
+//
+//If the allowlist is not empty, only statements whose fingerprint (see
+//Normalize) matches the fingerprint of one of the given statements are
+//allowed. The denylist contains regular expressions; statements matching any
+//of them are rejected even if they are on the allowlist. An error is returned
+//if one of the regular expressions is invalid.
+func NewQueryPolicy(allow, deny []string) (*QueryPolicy, error) {
+	p := &QueryPolicy{}
+	if len(allow) > 0 {
+		p.allow = make(map[string]bool, len(allow))
+		for _, query := range allow {
+			p.allow[Normalize(query)] = true
+		}
+	}
+	for _, pattern := range deny {
+		rx, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("sqlproxy: invalid denylist pattern: %w", err)
+		}
+		p.deny = append(p.deny, rx)
+	}
+	return p, nil
+}
+
+//PolicyError is returned for statements that are rejected by a QueryPolicy,
+//by RequireWhereClause() or because of Driver.MaxComplexity.
+type PolicyError struct {
+	Query string
+	//Pattern is the denylist pattern that matched the statement, or empty if
+	//the statement was rejected because it is not on the allowlist.
+	Pattern string
+	//Reason is set instead of Pattern if the statement was rejected for
+	//another reason, e.g. "UPDATE without WHERE clause".
+	Reason string
+}
+
+//Error implements the builtin/error interface.
+func (e PolicyError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("sqlproxy: statement rejected (%s): %s", e.Reason, Normalize(e.Query))
+	}
+	if e.Pattern == "" {
+		return fmt.Sprintf("sqlproxy: statement is not on the allowlist: %s", Normalize(e.Query))
+	}
+	return fmt.Sprintf("sqlproxy: statement matches denylist pattern %q: %s", e.Pattern, Normalize(e.Query))
+}
+
+//Check returns a PolicyError if the given statement violates this policy, or
+//nil otherwise.
+func (p *QueryPolicy) Check(query string) error {
+	for _, rx := range p.deny {
+		if rx.MatchString(query) {
+			return PolicyError{Query: query, Pattern: rx.String()}
+		}
+	}
+	if p.allow != nil && !p.allow[Normalize(query)] {
+		return PolicyError{Query: query}
+	}
+	return nil
+}
+
+//Hooks returns a BeforePrepareHook that enforces this policy. To combine it
+//with other hooks, use the WithQueryPolicy() option. Since hooks are chained
+//in order, the policy sees the statements as rewritten by the
+//BeforePrepareHooks of earlier options.
+func (p *QueryPolicy) Hooks() Hooks {
+	return Hooks{
+		BeforePrepareHook: func(query string) (string, error) {
+			return query, p.Check(query)
+		},
+	}
+}
+
+//RequireWhereClause returns a BeforePrepareHook that rejects UPDATE and DELETE
+//statements without a WHERE clause with a PolicyError, since these affect all
+//rows of the table and are usually a mistake. Statements that really shall
+//affect all rows can be let through by including the given marker, e.g. a
+//comment like "/* all rows */". If the marker is empty, such statements are
+//always rejected. Only WHERE clauses outside of parentheses count, so a WHERE
+//in a subquery does not make the statement pass.
+//
+//	sql.Register("postgres-safe", sqlproxy.New("postgres",
+//		sqlproxy.WithBeforePrepare(sqlproxy.RequireWhereClause("/* all rows */")),
+//	))
+func RequireWhereClause(marker string) func(query string) (string, error) {
+	return func(query string) (string, error) {
+		statementType := StatementType(query)
+		if statementType != "update" && statementType != "delete" {
+			return query, nil
+		}
+		if (marker != "" && strings.Contains(query, marker)) || hasTopLevelKeyword(Normalize(query), whereKeywordRx) {
+			return query, nil
+		}
+		reason := strings.ToUpper(statementType) + " without WHERE clause"
+		return "", PolicyError{Query: query, Reason: reason}
+	}
+}
+
+var whereKeywordRx = regexp.MustCompile(`(?i)\bWHERE\b`)
+
+//hasTopLevelKeyword returns whether the given normalized query contains a
+//match of the given keyword regex outside of parentheses.
+func hasTopLevelKeyword(query string, keywordRx *regexp.Regexp) bool {
+	for _, loc := range keywordRx.FindAllStringIndex(query, -1) {
+		prefix := query[:loc[0]]
+		if strings.Count(prefix, "(") == strings.Count(prefix, ")") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func Test_QueryPolicy(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	policy, err := NewQueryPolicy(
+		[]string{
+			`CREATE TABLE knowledge (number INTEGER, thing TEXT)`,
+			`INSERT INTO knowledge VALUES (1, 'x')`,
+			`SELECT thing FROM knowledge WHERE number = $1`,
+			`TRUNCATE knowledge`,
+		},
+		[]string{`(?i)^\s*TRUNCATE\b`},
+	)
+	tt.Must(err)
+
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithQueryPolicy(policy)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES (42, 'truth')`))
+	var thing string
+	tt.Must(db.QueryRow(`SELECT thing FROM knowledge WHERE number = $1`, 42).Scan(&thing))
+
+	//not on the allowlist
+	_, err = db.Query(`SELECT * FROM knowledge`)
+	var perr PolicyError
+	if !errors.As(err, &perr) || perr.Pattern != "" {
+		t.Errorf("expected PolicyError for statement not on allowlist, got err = %v", err)
+	} else if err.Error() != "sqlproxy: statement is not on the allowlist: SELECT * FROM knowledge" {
+		tt.Unexpected("error message", "sqlproxy: statement is not on the allowlist: SELECT * FROM knowledge", err.Error())
+	}
+
+	//on the allowlist, but denied
+	_, err = db.Exec(`truncate knowledge`)
+	if !errors.As(err, &perr) || perr.Pattern != `(?i)^\s*TRUNCATE\b` {
+		t.Errorf("expected PolicyError for denied statement, got err = %v", err)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+
+	if _, err := NewQueryPolicy(nil, []string{"("}); err == nil {
+		t.Error("expected NewQueryPolicy() to fail for invalid pattern, but it succeeded")
+	}
+}
+
+func Test_RequireWhereClause(t *testing.T) {
+	hook := RequireWhereClause("/* all rows */")
+	testCases := map[string]string{
+		`SELECT * FROM users`:                                   "",
+		`DELETE FROM sessions WHERE expires_at < $1`:            "",
+		`update users set name = 'where' where id = 1`:          "",
+		`DELETE FROM sessions /* all rows */`:                   "",
+		`DELETE FROM sessions`:                                  "DELETE without WHERE clause",
+		`UPDATE users SET x = (SELECT y FROM t WHERE t.id = 1)`: "UPDATE without WHERE clause",
+		`UPDATE users SET name = 'where'`:                       "UPDATE without WHERE clause",
+		"DELETE FROM users -- WHERE id = 1":                     "DELETE without WHERE clause",
+	}
+	for query, expectedReason := range testCases {
+		_, err := hook(query)
+		var perr PolicyError
+		switch {
+		case expectedReason == "" && err != nil:
+			t.Errorf("expected %q to pass, but got err = %v", query, err)
+		case expectedReason != "" && (!errors.As(err, &perr) || perr.Reason != expectedReason):
+			t.Errorf("expected %q to be rejected with %q, but got err = %v", query, expectedReason, err)
+		}
+	}
+
+	_, err := hook(`DELETE FROM sessions`)
+	expected := "sqlproxy: statement rejected (DELETE without WHERE clause): DELETE FROM sessions"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected err = %q, got %v", expected, err)
+	}
+}
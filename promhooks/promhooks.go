@@ -0,0 +1,265 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package promhooks provides a set of sqlproxy hooks that collect Prometheus
+//metrics about the statements executed through a sqlproxy.Driver. It lives in
+//a separate package such that sqlproxy itself does not depend on the
+//Prometheus client library. Usage:
+//
+//	collector := promhooks.NewCollector("myapp")
+//	prometheus.MustRegister(collector)
+//	sql.Register("postgres-with-metrics", sqlproxy.New("postgres",
+//		sqlproxy.WithHooks(collector.Hooks()),
+//	))
+//
+//The following metrics are reported (with the given namespace as prefix):
+//
+//	sql_statements_total{type,error}             counter
+//	sql_errors_total{type,category}              counter
+//	sql_statement_duration_seconds{type}         histogram
+//	sql_statement_rows{type}                     histogram
+//	sql_named_statements_total{query,error}      counter
+//	sql_named_statement_duration_seconds{query}  histogram
+//	sql_open_connections                         gauge
+//	sql_transactions_total{outcome,error}        counter
+//	sql_transaction_duration_seconds{outcome}    histogram
+//	sql_transaction_statements{outcome}          histogram
+//
+//The "type" label is the statement type as reported by sqlproxy.StatementType().
+//The "error" label classifies the error returned to the caller as one of
+//"none", "canceled", "deadline_exceeded", "bad_conn", "expectation" or
+//"other". The "category" label is the result of sqlproxy.ClassifyError(),
+//which distinguishes database errors by their error codes. The "query" label
+//is the name of the statement in sqlproxy.Driver.Queries (see
+//sqlproxy.QueryEvent.QueryName); statements that are not registered there are
+//not counted in the sql_named_* metrics. The "outcome" label is either
+//"commit" or "rollback".
+//
+//For multi-tenant applications, NewTenantCollector() adds a "tenant" label
+//(see sqlproxy.Driver.TenantFromContext) to all metrics except
+//sql_open_connections.
+package promhooks
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/majewsky/sqlproxy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+//Collector is a prometheus.Collector for the metrics described in the package
+//documentation. Its hooks can be used with any number of sqlproxy.Driver
+//instances, in which case the metrics are aggregated across all of them.
+type Collector struct {
+	statements  *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	durations   *prometheus.HistogramVec
+	rows        *prometheus.HistogramVec
+	connections prometheus.Gauge
+
+	namedStatements *prometheus.CounterVec
+	namedDurations  *prometheus.HistogramVec
+
+	transactions *prometheus.CounterVec
+	txDurations  *prometheus.HistogramVec
+	txStatements *prometheus.HistogramVec
+
+	withTenant bool
+}
+
+//NewCollector creates a new Collector. The namespace is used as a prefix for
+//all metric names, and may be empty.
+func NewCollector(namespace string) *Collector {
+	return newCollector(namespace, false)
+}
+
+//NewTenantCollector is like NewCollector, but the metrics have an additional
+//"tenant" label. Beware that this multiplies the number of time series by the
+//number of tenants.
+func NewTenantCollector(namespace string) *Collector {
+	return newCollector(namespace, true)
+}
+
+func newCollector(namespace string, withTenant bool) *Collector {
+	labels := func(names ...string) []string {
+		if withTenant {
+			names = append(names, "tenant")
+		}
+		return names
+	}
+	return &Collector{
+		withTenant: withTenant,
+		statements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_statements_total",
+			Help:      "Number of SQL statements executed, by statement type and error class.",
+		}, labels("type", "error")),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_errors_total",
+			Help:      "Number of failed SQL statements, by statement type and error category.",
+		}, labels("type", "category")),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sql_statement_duration_seconds",
+			Help:      "Execution time of SQL statements, by statement type.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels("type")),
+		rows: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sql_statement_rows",
+			Help:      "Rows returned or affected by SQL statements, by statement type.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+		}, labels("type")),
+		namedStatements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_named_statements_total",
+			Help:      "Number of SQL statements from the named-query registry executed, by statement name and error class.",
+		}, labels("query", "error")),
+		namedDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sql_named_statement_duration_seconds",
+			Help:      "Execution time of SQL statements from the named-query registry, by statement name.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels("query")),
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sql_open_connections",
+			Help:      "Number of open connections to the proxied database driver.",
+		}),
+		transactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sql_transactions_total",
+			Help:      "Number of finished SQL transactions, by outcome and error class.",
+		}, labels("outcome", "error")),
+		txDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sql_transaction_duration_seconds",
+			Help:      "Time from start to commit or rollback of SQL transactions, by outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels("outcome")),
+		txStatements: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sql_transaction_statements",
+			Help:      "Number of statements executed within SQL transactions, by outcome.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}, labels("outcome")),
+	}
+}
+
+//Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.statements.Describe(ch)
+	c.errors.Describe(ch)
+	c.durations.Describe(ch)
+	c.rows.Describe(ch)
+	c.namedStatements.Describe(ch)
+	c.namedDurations.Describe(ch)
+	c.connections.Describe(ch)
+	c.transactions.Describe(ch)
+	c.txDurations.Describe(ch)
+	c.txStatements.Describe(ch)
+}
+
+//Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.statements.Collect(ch)
+	c.errors.Collect(ch)
+	c.durations.Collect(ch)
+	c.rows.Collect(ch)
+	c.namedStatements.Collect(ch)
+	c.namedDurations.Collect(ch)
+	c.connections.Collect(ch)
+	c.transactions.Collect(ch)
+	c.txDurations.Collect(ch)
+	c.txStatements.Collect(ch)
+}
+
+//Hooks returns the hooks that feed this collector. Use
+//sqlproxy.WithHooks() to combine them with other hooks.
+func (c *Collector) Hooks() sqlproxy.Hooks {
+	return sqlproxy.Hooks{
+		AfterQueryHook: c.afterQuery,
+		AfterConnectHook: func(duration time.Duration, err error) {
+			if err == nil {
+				c.connections.Inc()
+			}
+		},
+		AfterDisconnectHook: func(err error) {
+			c.connections.Dec()
+		},
+		AfterCommitHook: func(e sqlproxy.TransactionEvent) {
+			c.afterTransaction("commit", e)
+		},
+		AfterRollbackHook: func(e sqlproxy.TransactionEvent) {
+			c.afterTransaction("rollback", e)
+		},
+	}
+}
+
+func (c *Collector) afterQuery(e sqlproxy.QueryEvent) {
+	statementType := sqlproxy.StatementType(e.Query)
+	c.statements.WithLabelValues(c.labelValues(e.Tenant, statementType, ErrorClass(e.Err))...).Inc()
+	if e.Err != nil {
+		category := string(sqlproxy.ClassifyError(e.Err))
+		c.errors.WithLabelValues(c.labelValues(e.Tenant, statementType, category)...).Inc()
+	}
+	c.durations.WithLabelValues(c.labelValues(e.Tenant, statementType)...).Observe(e.Duration.Seconds())
+	c.rows.WithLabelValues(c.labelValues(e.Tenant, statementType)...).Observe(float64(e.Rows))
+	if e.QueryName != "" {
+		c.namedStatements.WithLabelValues(c.labelValues(e.Tenant, e.QueryName, ErrorClass(e.Err))...).Inc()
+		c.namedDurations.WithLabelValues(c.labelValues(e.Tenant, e.QueryName)...).Observe(e.Duration.Seconds())
+	}
+}
+
+func (c *Collector) afterTransaction(outcome string, e sqlproxy.TransactionEvent) {
+	c.transactions.WithLabelValues(c.labelValues(e.Tenant, outcome, ErrorClass(e.Err))...).Inc()
+	c.txDurations.WithLabelValues(c.labelValues(e.Tenant, outcome)...).Observe(e.Duration.Seconds())
+	c.txStatements.WithLabelValues(c.labelValues(e.Tenant, outcome)...).Observe(float64(e.Statements))
+}
+
+//labelValues appends the tenant to the given label values if required.
+func (c *Collector) labelValues(tenant string, values ...string) []string {
+	if c.withTenant {
+		return append(values, tenant)
+	}
+	return values
+}
+
+//ErrorClass returns the value of the "error" label for the given error.
+func ErrorClass(err error) string {
+	var expectationErr sqlproxy.ExpectationError
+	switch {
+	case err == nil:
+		return "none"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	case errors.Is(err, driver.ErrBadConn):
+		return "bad_conn"
+	case errors.As(err, &expectationErr):
+		return "expectation"
+	default:
+		return "other"
+	}
+}
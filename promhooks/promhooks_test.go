@@ -0,0 +1,158 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package promhooks
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/majewsky/sqlproxy"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector("test")
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.sqlite")
+	db := sql.OpenDB(sqlproxy.NewConnector(
+		sqlproxy.New("sqlite3", sqlproxy.WithHooks(collector.Hooks())),
+		dsn,
+	))
+	db.SetMaxOpenConns(1)
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`)
+	must(err)
+	_, err = db.Exec(`INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`)
+	must(err)
+	rows, err := db.Query(`SELECT * FROM knowledge`)
+	must(err)
+	for rows.Next() {
+	}
+	must(rows.Close())
+	_, err = db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Error("expected DELETE on nonexistent table to fail, but it succeeded")
+	}
+	tx, err := db.Begin()
+	must(err)
+	_, err = tx.Exec(`DELETE FROM knowledge`)
+	must(err)
+	must(tx.Rollback())
+
+	expected := `
+# HELP test_sql_errors_total Number of failed SQL statements, by statement type and error category.
+# TYPE test_sql_errors_total counter
+test_sql_errors_total{category="syntax",type="delete"} 1
+# HELP test_sql_open_connections Number of open connections to the proxied database driver.
+# TYPE test_sql_open_connections gauge
+test_sql_open_connections 1
+# HELP test_sql_statements_total Number of SQL statements executed, by statement type and error class.
+# TYPE test_sql_statements_total counter
+test_sql_statements_total{error="none",type="create"} 1
+test_sql_statements_total{error="none",type="insert"} 1
+test_sql_statements_total{error="none",type="select"} 1
+test_sql_statements_total{error="none",type="delete"} 1
+test_sql_statements_total{error="other",type="delete"} 1
+# HELP test_sql_transactions_total Number of finished SQL transactions, by outcome and error class.
+# TYPE test_sql_transactions_total counter
+test_sql_transactions_total{error="none",outcome="rollback"} 1
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"test_sql_errors_total", "test_sql_open_connections", "test_sql_statements_total", "test_sql_transactions_total")
+	must(err)
+	if count := testutil.CollectAndCount(collector, "test_sql_statement_rows"); count != 4 {
+		t.Errorf("expected 4 row histograms, got %d", count)
+	}
+
+	must(db.Close())
+	if value := testutil.ToFloat64(collector.connections); value != 0 {
+		t.Errorf("expected 0 open connections after db.Close(), got %g", value)
+	}
+}
+
+func TestTenantCollector(t *testing.T) {
+	collector := NewTenantCollector("test")
+	hooks := collector.Hooks()
+	hooks.AfterQueryHook(sqlproxy.QueryEvent{Query: `SELECT 1`, Tenant: "acme"})
+	hooks.AfterQueryHook(sqlproxy.QueryEvent{Query: `SELECT 1`, Tenant: "acme"})
+	hooks.AfterQueryHook(sqlproxy.QueryEvent{Query: `SELECT 1`, Tenant: "globex"})
+	hooks.AfterCommitHook(sqlproxy.TransactionEvent{Statements: 2, Tenant: "acme"})
+
+	expected := `
+# HELP test_sql_statements_total Number of SQL statements executed, by statement type and error class.
+# TYPE test_sql_statements_total counter
+test_sql_statements_total{error="none",tenant="acme",type="select"} 2
+test_sql_statements_total{error="none",tenant="globex",type="select"} 1
+# HELP test_sql_transactions_total Number of finished SQL transactions, by outcome and error class.
+# TYPE test_sql_transactions_total counter
+test_sql_transactions_total{error="none",outcome="commit",tenant="acme"} 1
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"test_sql_statements_total", "test_sql_transactions_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNamedStatements(t *testing.T) {
+	var queries sqlproxy.Queries
+	err := queries.Add(sqlproxy.NamedQuery{Name: "count-things", SQL: `SELECT COUNT(*) FROM knowledge`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := NewCollector("test")
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.sqlite")
+	db := sql.OpenDB(sqlproxy.NewConnector(
+		sqlproxy.New("sqlite3", sqlproxy.WithHooks(collector.Hooks()), sqlproxy.WithQueries(&queries)),
+		dsn,
+	))
+	defer db.Close()
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`)
+	must(err)
+	var count int
+	for range 2 {
+		must(db.QueryRow(queries.Get("count-things")).Scan(&count))
+	}
+
+	expected := `
+# HELP test_sql_named_statements_total Number of SQL statements from the named-query registry executed, by statement name and error class.
+# TYPE test_sql_named_statements_total counter
+test_sql_named_statements_total{error="none",query="count-things"} 2
+`
+	must(testutil.CollectAndCompare(collector, strings.NewReader(expected), "test_sql_named_statements_total"))
+	if count := testutil.CollectAndCount(collector, "test_sql_named_statement_duration_seconds"); count != 1 {
+		t.Errorf("expected 1 duration histogram for named statements, got %d", count)
+	}
+}
@@ -0,0 +1,293 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//NamedQuery is a SQL statement that was loaded into a Queries registry.
+type NamedQuery struct {
+	Name string
+	//Tags and Params are taken from the "-- tags:" and "-- params:" annotations
+	//of the query, if any.
+	Tags   []string
+	Params []string
+	SQL    string
+	//Expect is checked when this statement is executed. See Queries.Expect.
+	Expect Expectation
+}
+
+//Queries is a registry of named SQL statements. Statements are usually loaded
+//from .sql files at startup, e.g. from an embed.FS:
+//
+//	//go:embed sql/*.sql
+//	var sqlFiles embed.FS
+//
+//	var queries sqlproxy.Queries
+//	err := queries.LoadFS(sqlFiles, "sql/*.sql")
+//	...
+//	rows, err := db.Query(queries.Get("find-user"), userID)
+//
+//Each statement in such a file is introduced by a "-- name:" comment, and may
+//be annotated with further comments like this:
+//
+//	-- name: find-user
+//	-- tags: users, hot
+//	-- params: id
+//	SELECT * FROM users WHERE id = $1;
+//
+//If "-- params:" is given, the statement must have one placeholder per
+//declared parameter, or for named placeholders like ":id", exactly the
+//declared names.
+//
+//Since the registry can map query strings back to their names (see Lookup),
+//hooks can use it to refer to statements by their declared names. When the
+//registry is set as Driver.Queries, the name appears in QueryEvent.QueryName,
+//and thus in the logs and metrics of this package and package promhooks.
+type Queries struct {
+	mutex  sync.RWMutex
+	byName map[string]*NamedQuery
+	bySQL  map[string]*NamedQuery
+}
+
+var queryAnnotationRx = regexp.MustCompile(`^\s*--\s*(name|tags|params)\s*:\s*(.*?)\s*$`)
+
+//LoadFS loads all files matching any of the given glob patterns from the given
+//filesystem into this registry. If any file cannot be loaded, an error is
+//returned and the registry is not changed.
+func (q *Queries) LoadFS(fsys fs.FS, patterns ...string) error {
+	var loaded []loadedQuery
+	for _, pattern := range patterns {
+		fileNames, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, fileName := range fileNames {
+			file, err := fsys.Open(fileName)
+			if err != nil {
+				return err
+			}
+			queries, err := parseQueries(file, fileName)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			loaded = append(loaded, queries...)
+		}
+	}
+	return q.addAll(loaded)
+}
+
+//Load reads statements from the given reader into this registry. The fileName
+//is only used for error messages. If the statements cannot be loaded, an error
+//is returned and the registry is not changed.
+func (q *Queries) Load(reader io.Reader, fileName string) error {
+	loaded, err := parseQueries(reader, fileName)
+	if err != nil {
+		return err
+	}
+	return q.addAll(loaded)
+}
+
+//loadedQuery is a statement from a .sql file, see parseQueries.
+type loadedQuery struct {
+	query    NamedQuery
+	fileName string
+}
+
+//parseQueries implements Load without adding the statements to a registry.
+func parseQueries(reader io.Reader, fileName string) ([]loadedQuery, error) {
+	var (
+		current *NamedQuery
+		lines   []string
+		parsed  []*NamedQuery
+	)
+	finish := func() {
+		if current != nil {
+			current.SQL = strings.TrimSpace(strings.Join(lines, "\n"))
+			parsed = append(parsed, current)
+		}
+		lines = nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		match := queryAnnotationRx.FindStringSubmatch(line)
+		switch {
+		case match == nil:
+			if current == nil {
+				if strings.TrimSpace(line) != "" && !strings.HasPrefix(strings.TrimSpace(line), "--") {
+					return nil, fmt.Errorf("%s:%d: expected \"-- name:\" before first statement", fileName, lineNo)
+				}
+				continue
+			}
+			lines = append(lines, line)
+		case match[1] == "name":
+			finish()
+			current = &NamedQuery{Name: match[2]}
+		case current == nil:
+			return nil, fmt.Errorf("%s:%d: expected \"-- name:\" before \"-- %s:\"", fileName, lineNo, match[1])
+		case match[1] == "tags":
+			current.Tags = append(current.Tags, splitAnnotation(match[2])...)
+		case match[1] == "params":
+			current.Params = append(current.Params, splitAnnotation(match[2])...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	finish()
+
+	result := make([]loadedQuery, len(parsed))
+	for idx, query := range parsed {
+		err := validateQuery(*query)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		result[idx] = loadedQuery{*query, fileName}
+	}
+	return result, nil
+}
+
+func splitAnnotation(value string) []string {
+	var result []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+//Add adds a single statement to this registry. An error is returned if a
+//statement with the same name already exists, if the statement is empty, or
+//if its Params do not match its placeholders.
+func (q *Queries) Add(query NamedQuery) error {
+	err := validateQuery(query)
+	if err != nil {
+		return err
+	}
+	return q.addAll([]loadedQuery{{query: query}})
+}
+
+func validateQuery(query NamedQuery) error {
+	if query.Name == "" {
+		return fmt.Errorf("cannot add statement without name: %q", query.SQL)
+	}
+	if strings.TrimSpace(query.SQL) == "" {
+		return fmt.Errorf("statement %q is empty", query.Name)
+	}
+	if len(query.Params) == 0 {
+		return nil
+	}
+
+	names := make(map[string]bool)
+	ordinals := make(map[int]bool)
+	for _, match := range findPlaceholders(query.SQL) {
+		if match.ref.name != "" {
+			names[match.ref.name] = true
+		} else {
+			ordinals[match.ref.ordinal] = true
+		}
+	}
+	if len(names) == 0 {
+		if len(ordinals) != len(query.Params) {
+			return fmt.Errorf("statement %q declares %d params, but has %d placeholders", query.Name, len(query.Params), len(ordinals))
+		}
+		return nil
+	}
+	declared := make(map[string]bool, len(query.Params))
+	for _, param := range query.Params {
+		declared[param] = true
+		if !names[param] {
+			return fmt.Errorf("statement %q declares param %q, but has no placeholder for it", query.Name, param)
+		}
+	}
+	for _, match := range findPlaceholders(query.SQL) {
+		if match.ref.name != "" && !declared[match.ref.name] {
+			return fmt.Errorf("statement %q has placeholder %q, but does not declare it in its params", query.Name, match.ref.String())
+		}
+	}
+	return nil
+}
+
+//addAll adds the given statements to this registry, or none of them if there
+//are duplicate names.
+func (q *Queries) addAll(loaded []loadedQuery) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	byName := make(map[string]*NamedQuery, len(q.byName)+len(loaded))
+	bySQL := make(map[string]*NamedQuery, len(q.bySQL)+len(loaded))
+	for name, query := range q.byName {
+		byName[name] = query
+	}
+	for sql, query := range q.bySQL {
+		bySQL[sql] = query
+	}
+	for _, l := range loaded {
+		query := l.query
+		if _, exists := byName[query.Name]; exists {
+			err := fmt.Errorf("duplicate statement name: %q", query.Name)
+			if l.fileName != "" {
+				err = fmt.Errorf("%s: %w", l.fileName, err)
+			}
+			return err
+		}
+		byName[query.Name] = &query
+		bySQL[query.SQL] = &query
+	}
+	q.byName, q.bySQL = byName, bySQL
+	return nil
+}
+
+//Get returns the SQL for the statement with the given name. It panics if no
+//such statement exists, since that indicates a programming error.
+func (q *Queries) Get(name string) string {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	query, exists := q.byName[name]
+	if !exists {
+		panic(fmt.Sprintf("no such statement: %q", name))
+	}
+	return query.SQL
+}
+
+//Lookup returns the registered statement with exactly the given SQL, if any.
+//This can be used within hooks to find the declared name of a statement.
+func (q *Queries) Lookup(sql string) (NamedQuery, bool) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	query, exists := q.bySQL[sql]
+	if !exists {
+		return NamedQuery{}, false
+	}
+	return *query, true
+}
@@ -0,0 +1,162 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_QueriesLoadFS(t *testing.T) {
+	tt := TT{t}
+	fsys := fstest.MapFS{
+		"sql/knowledge.sql": &fstest.MapFile{Data: []byte(`
+-- statements concerning the knowledge table
+
+-- name: get-thing
+-- tags: knowledge, hot
+-- params: number
+SELECT thing FROM knowledge
+ WHERE number = $1;
+
+-- name: count-things
+SELECT COUNT(*) FROM knowledge;
+`)},
+		"sql/README.md": &fstest.MapFile{Data: []byte(`not a SQL file`)},
+	}
+
+	var q Queries
+	tt.Must(q.LoadFS(fsys, "sql/*.sql"))
+
+	expected := "SELECT thing FROM knowledge\n WHERE number = $1;"
+	if actual := q.Get("get-thing"); actual != expected {
+		tt.Unexpected("SQL", expected, actual)
+	}
+	query, ok := q.Lookup("SELECT COUNT(*) FROM knowledge;")
+	if !ok || query.Name != "count-things" {
+		tt.Unexpected("query", "count-things", query)
+	}
+	query, _ = q.Lookup(expected)
+	if !reflect.DeepEqual(query.Tags, []string{"knowledge", "hot"}) {
+		tt.Unexpected("tags", []string{"knowledge", "hot"}, query.Tags)
+	}
+	if !reflect.DeepEqual(query.Params, []string{"number"}) {
+		tt.Unexpected("params", []string{"number"}, query.Params)
+	}
+
+	//loading the same statements again must fail because of duplicate names
+	if q.LoadFS(fsys, "sql/*.sql") == nil {
+		t.Error("expected error when loading duplicate statement names")
+	}
+}
+
+func Test_QueriesLoadErrors(t *testing.T) {
+	testCases := map[string]string{
+		"-- name: a\n-- params: id\nSELECT * FROM users":                                 `test.sql: statement "a" declares 1 params, but has 0 placeholders`,
+		"-- name: a\n-- params: id\nSELECT * FROM users WHERE id = $1 AND name = $2":     `test.sql: statement "a" declares 1 params, but has 2 placeholders`,
+		"-- name: a\n-- params: id, name\nSELECT * FROM users WHERE id = :id":            `test.sql: statement "a" declares param "name", but has no placeholder for it`,
+		"-- name: a\n-- params: id\nSELECT * FROM users WHERE id = :id AND name = :name": `test.sql: statement "a" has placeholder ":name", but does not declare it in its params`,
+		"-- name: a\nSELECT 1\n-- name: b\n\n-- name: c\nSELECT 3":                       `test.sql: statement "b" is empty`,
+		"-- name: a\nSELECT 1\n-- name: a\nSELECT 2":                                     `test.sql: duplicate statement name: "a"`,
+	}
+	for input, expectedErr := range testCases {
+		var q Queries
+		err := q.Load(strings.NewReader(input), "test.sql")
+		if err == nil || err.Error() != expectedErr {
+			t.Errorf("expected error %q for %q, got %v", expectedErr, input, err)
+		}
+		//a failed Load() does not leave a partially loaded registry behind
+		if _, exists := q.Lookup("SELECT 1"); exists {
+			t.Errorf("expected no statements to be loaded from %q", input)
+		}
+	}
+
+	//matching params are accepted
+	var q Queries
+	err := q.Load(strings.NewReader(`
+-- name: by-id
+-- params: id, name
+SELECT * FROM users WHERE id = $1 AND name = $2 AND $1 > 0
+-- name: by-name
+-- params: name
+SELECT * FROM users WHERE name = :name OR alias = :name
+`), "test.sql")
+	if err != nil {
+		t.Error(err)
+	}
+
+	//same for LoadFS() across multiple files
+	fsys := fstest.MapFS{
+		"sql/a.sql": &fstest.MapFile{Data: []byte("-- name: c\nSELECT 3")},
+		"sql/b.sql": &fstest.MapFile{Data: []byte("-- name: by-id\nSELECT 4")},
+	}
+	err = q.LoadFS(fsys, "sql/*.sql")
+	if err == nil || err.Error() != `sql/b.sql: duplicate statement name: "by-id"` {
+		t.Errorf("unexpected error from LoadFS(): %v", err)
+	}
+	if _, exists := q.Lookup("SELECT 3"); exists {
+		t.Error("expected no statements to be loaded by a failed LoadFS()")
+	}
+}
+
+func Test_QueryName(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var q Queries
+	tt.Must(q.Load(strings.NewReader("-- name: count-things\nSELECT COUNT(*) FROM knowledge"), "test.sql"))
+	var names []string
+	d := New("sqlite3",
+		WithQueries(&q),
+		//the statement is looked up before this hook rewrites it
+		WithBeforePrepare(func(query string) (string, error) {
+			return "/* app */ " + query, nil
+		}),
+		WithAfterQuery(func(e QueryEvent) {
+			names = append(names, e.QueryName)
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	var count int
+	tt.Must(db.QueryRow(q.Get("count-things")).Scan(&count))
+	stmt, err := db.Prepare(q.Get("count-things"))
+	tt.Must(err)
+	tt.Must(stmt.QueryRow().Scan(&count))
+	tt.Must(stmt.Close())
+	tt.Must(db.Close())
+
+	expected := []string{"", "count-things", "count-things"}
+	if !reflect.DeepEqual(names, expected) {
+		tt.Unexpected("query names", expected, names)
+	}
+
+	//the name is also logged
+	line := formatQueryLogLine(time.Unix(0, 0), QueryEvent{Query: "SELECT 1", QueryName: "one"})
+	if !strings.Contains(line, " query_name=one: SELECT 1") {
+		t.Errorf("unexpected log line: %q", line)
+	}
+
+	tt.CleanupDB()
+}
@@ -0,0 +1,57 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sync"
+)
+
+//seededRandom is the random number generator behind FaultInjector and Chaos.
+//Each random decision is made under a mutex, and can be written to a decision
+//log, so that a failing test run can be reproduced by using the same seed and
+//compared with the original run line by line.
+type seededRandom struct {
+	seed      uint64
+	mutex     sync.Mutex
+	rng       *rand.Rand
+	decisions uint64
+}
+
+func newSeededRandom(seed uint64) *seededRandom {
+	return &seededRandom{seed: seed, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+//decide calls the given function with exclusive access to the random number
+//generator. The function returns a description of the decision that it made,
+//which is written to the given decision log (if any) as one line, prefixed
+//with a sequence number.
+func (s *seededRandom) decide(log io.Writer, fn func(rng *rand.Rand) string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	description := fn(s.rng)
+	s.decisions++
+	if log != nil {
+		//errors are ignored since the decision has been made either way
+		fmt.Fprintf(log, "%d: %s\n", s.decisions, description)
+	}
+}
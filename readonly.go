@@ -0,0 +1,102 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+//ErrReadOnly is matched by errors.Is() for all errors of type ReadOnlyError.
+var ErrReadOnly = errors.New("sqlproxy: statement rejected in read-only mode")
+
+//ReadOnlyError is returned for statements that are rejected because the
+//Driver is in read-only mode (see Driver.ReadOnly).
+type ReadOnlyError struct {
+	Query string
+}
+
+//Error implements the builtin/error interface.
+func (e ReadOnlyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrReadOnly.Error(), Normalize(e.Query))
+}
+
+//Is allows errors.Is(err, ErrReadOnly) to match this error.
+func (e ReadOnlyError) Is(target error) bool {
+	return target == ErrReadOnly
+}
+
+//SetReadOnly switches read-only mode on or off (see Driver.ReadOnly). This is
+//safe to call while statements are being executed concurrently. After
+//SetReadOnly has been called, the ReadOnly field is no longer used.
+func (d *Driver) SetReadOnly(readOnly bool) {
+	d.swappedReadOnly.Store(&readOnly)
+}
+
+//IsReadOnly returns whether read-only mode is currently active.
+func (d *Driver) IsReadOnly() bool {
+	if readOnly := d.swappedReadOnly.Load(); readOnly != nil {
+		return *readOnly
+	}
+	return d.ReadOnly
+}
+
+//statement types that are allowed in read-only mode, as long as they do not
+//contain writes (e.g. in a CTE, or in EXPLAIN ANALYZE)
+var readOnlyStatementTypes = map[string]bool{
+	"select": true, "with": true, "values": true, "show": true, "explain": true,
+	"describe": true, "desc": true, "set": true, "reset": true,
+	"begin": true, "start": true, "commit": true, "rollback": true,
+	"savepoint": true, "release": true,
+}
+
+//checkReadOnly implements Driver.ReadOnly.
+func (c *connection) checkReadOnly(query string) error {
+	if !c.driver.IsReadOnly() {
+		return nil
+	}
+	if !IsReadOnlyStatement(query) {
+		return ReadOnlyError{Query: query}
+	}
+	return nil
+}
+
+//IsReadOnlyStatement returns whether the given statement can be executed in
+//read-only mode (see Driver.ReadOnly), i.e. whether it neither modifies data
+//nor the schema. Locking reads like SELECT ... FOR UPDATE do not count as
+//read-only either, since they can block writers.
+func IsReadOnlyStatement(query string) bool {
+	match := leadingKeywordRx.FindStringSubmatch(query)
+	if match == nil || !readOnlyStatementTypes[strings.ToLower(match[1])] {
+		return false
+	}
+	//look at the normalized query to ignore keywords in string literals
+	normalized := Normalize(query)
+	if lockingReadRx.MatchString(normalized) {
+		return false
+	}
+	for _, ref := range ExtractTables(normalized) {
+		if ref.Write {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,230 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_IsReadOnlyStatement(t *testing.T) {
+	testCases := map[string]bool{
+		`SELECT * FROM users WHERE name = 'insert into'`:           true,
+		`/* report */ SELECT COUNT(*) FROM users`:                  true,
+		`WITH x AS (SELECT 1) SELECT * FROM x`:                     true,
+		`EXPLAIN SELECT * FROM users`:                              true,
+		`SHOW TABLES`:                                              true,
+		`BEGIN`:                                                    true,
+		`SELECT * FROM users FOR UPDATE`:                           false,
+		`INSERT INTO users VALUES (1)`:                             false,
+		`UPDATE users SET name = 'x'`:                              false,
+		`DELETE FROM users`:                                        false,
+		`TRUNCATE users`:                                           false,
+		`CREATE TABLE x (id INTEGER)`:                              false,
+		`DROP TABLE users`:                                         false,
+		`GRANT SELECT ON users TO public`:                          false,
+		`WITH deleted AS (DELETE FROM users RETURNING *) SELECT 1`: false,
+		`EXPLAIN ANALYZE DELETE FROM users`:                        false,
+		`SELECT * INTO backup FROM users`:                          false,
+	}
+	for query, expected := range testCases {
+		if actual := IsReadOnlyStatement(query); actual != expected {
+			t.Errorf("expected IsReadOnlyStatement(%q) = %t, got %t", query, expected, actual)
+		}
+	}
+}
+
+func Test_ReadOnly(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	d := New("sqlite3")
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (name TEXT)`))
+	if d.IsReadOnly() {
+		t.Error("expected read-only mode to be off")
+	}
+
+	d.SetReadOnly(true)
+	_, err := db.Exec(`INSERT INTO users VALUES (?)`, "alice")
+	var roerr ReadOnlyError
+	if !errors.Is(err, ErrReadOnly) || !errors.As(err, &roerr) {
+		t.Errorf("expected ReadOnlyError, got %#v", err)
+	}
+	_, err = db.Prepare(`DROP TABLE users`)
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ReadOnlyError, got %#v", err)
+	}
+	rows := tt.MustRows(db.Query(`SELECT * FROM users`))
+	tt.Must(rows.Close())
+
+	d.SetReadOnly(false)
+	tt.MustResult(db.Exec(`INSERT INTO users VALUES (?)`, "alice"))
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_AutoReadOnlyTransactions(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var events []TransactionEvent
+	d := New("sqlite3",
+		WithAutoReadOnlyTransactions(),
+		WithAfterCommit(func(e TransactionEvent) {
+			events = append(events, e)
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE things (name TEXT)`))
+
+	//transactions with the same tag are similar as long as they execute the
+	//same statements
+	ctx := WithTransactionTag(context.Background(), "list-things")
+	runTransaction := func(queries ...string) {
+		tx, err := db.BeginTx(ctx, nil)
+		tt.Must(err)
+		for _, query := range queries {
+			tt.MustResult(tx.Exec(query))
+		}
+		tt.Must(tx.Commit())
+	}
+	type classification struct{ ReadOnly, AutoReadOnly bool }
+	var expected []classification
+
+	//after enough read-only transactions, similar ones are started as READ
+	//ONLY (SQLite accepts but ignores this, so we can observe what happens
+	//when a write follows)
+	for range autoReadOnlyThreshold {
+		runTransaction(`SELECT * FROM things`)
+		expected = append(expected, classification{ReadOnly: true})
+	}
+	runTransaction(`SELECT * FROM things`)
+	expected = append(expected, classification{ReadOnly: true, AutoReadOnly: true})
+	//a write resets the classification
+	runTransaction(`SELECT * FROM things`, `INSERT INTO things VALUES ('foo')`)
+	expected = append(expected, classification{AutoReadOnly: true})
+	runTransaction(`SELECT * FROM things`)
+	expected = append(expected, classification{ReadOnly: true})
+	//so does a different set of fingerprints
+	runTransaction(`SELECT * FROM things`)
+	runTransaction(`SELECT name FROM things`)
+	runTransaction(`SELECT name FROM things`)
+	expected = append(expected, classification{ReadOnly: true}, classification{ReadOnly: true}, classification{ReadOnly: true})
+	//untagged transactions are not classified at all
+	ctx = context.Background()
+	for range autoReadOnlyThreshold + 1 {
+		runTransaction(`SELECT * FROM things`)
+		expected = append(expected, classification{})
+	}
+
+	var actual []classification
+	for idx, e := range events {
+		actual = append(actual, classification{e.ReadOnly, e.AutoReadOnly})
+		expectedTag := "list-things"
+		if idx >= len(events)-autoReadOnlyThreshold-1 {
+			expectedTag = ""
+		}
+		if e.Tag != expectedTag {
+			tt.Unexpected(fmt.Sprintf("tag of transaction %d", idx), expectedTag, e.Tag)
+		}
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d transactions, got %d", len(expected), len(actual))
+	}
+	for idx := range expected {
+		if actual[idx] != expected[idx] {
+			tt.Unexpected(fmt.Sprintf("classification of transaction %d", idx), expected[idx], actual[idx])
+		}
+	}
+	tt.Must(db.Close())
+}
+
+//readOnlyRejectingConn is a driver.Conn whose BeginTx fails for read-only
+//transactions with readOnlyErr, and for all others with readWriteErr.
+type readOnlyRejectingConn struct {
+	fakeConn
+	readOnlyErr  error
+	readWriteErr error
+	begins       []bool //ReadOnly flag of each BeginTx call
+}
+
+func (c *readOnlyRejectingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.begins = append(c.begins, opts.ReadOnly)
+	if opts.ReadOnly && c.readOnlyErr != nil {
+		return nil, c.readOnlyErr
+	}
+	if c.readWriteErr != nil {
+		return nil, c.readWriteErr
+	}
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func Test_AutoReadOnlyTransactionsUnsupported(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	d := New("", WithProxiedDriver(fakeDriver{}), WithAutoReadOnlyTransactions())
+	d.transactionClasses.now = func() time.Time { return now }
+	class := d.transactionClasses.start("list-things")
+	for range autoReadOnlyThreshold {
+		d.transactionClasses.finish(class, nil, false)
+	}
+
+	//an error that is not specific to read-only transactions (the read-write
+	//retry fails as well) does not switch anything off
+	conn := &readOnlyRejectingConn{readOnlyErr: errors.New("lock timeout"), readWriteErr: errors.New("lock timeout")}
+	c := &connection{driver: d, conn: conn}
+	_, _, err := c.beginTxAutoReadOnly(context.Background(), driver.TxOptions{}, class)
+	if err == nil || err.Error() != "lock timeout" {
+		t.Errorf("expected lock timeout, got %#v", err)
+	}
+	if !d.transactionClasses.isReadOnly(class) {
+		t.Error("expected auto read-only transactions to stay enabled after unrelated error")
+	}
+
+	//if only the read-only transaction is rejected, the feature is suspended
+	conn = &readOnlyRejectingConn{readOnlyErr: errors.New("syntax error at READ ONLY")}
+	c = &connection{driver: d, conn: conn}
+	_, autoReadOnly, err := c.beginTxAutoReadOnly(context.Background(), driver.TxOptions{}, class)
+	TT{t}.Must(err)
+	if autoReadOnly || !reflect.DeepEqual(conn.begins, []bool{true, false}) {
+		t.Errorf("expected fallback to read-write transaction, got autoReadOnly = %t and begins = %v", autoReadOnly, conn.begins)
+	}
+	if d.transactionClasses.isReadOnly(class) {
+		t.Error("expected auto read-only transactions to be suspended")
+	}
+
+	//...but only for a while
+	now = now.Add(autoReadOnlyBackoff)
+	if !d.transactionClasses.isReadOnly(class) {
+		t.Error("expected auto read-only transactions to be enabled again after the backoff")
+	}
+}
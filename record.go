@@ -0,0 +1,504 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+//RecordingVersion is the version of the file format written by Recorder.
+//ReplayDriver refuses to load recordings with a different version.
+const RecordingVersion = 1
+
+//Recorder captures every statement executed through a Driver, with its
+//arguments, timing and outcome, to an io.Writer:
+//
+//	file, err := os.Create("workload.jsonl")
+//	...
+//	rec, err := sqlproxy.NewRecorder(file)
+//	rec.CaptureRows = true
+//	sql.Register("postgres-recorded", sqlproxy.New("postgres", sqlproxy.WithRecorder(rec)))
+//
+//The recording can be served by a ReplayDriver in place of the real database
+//(e.g. for hermetic tests), re-executed against a database by a LoadTest, or
+//analyzed offline. The first line of the file is
+//the header {"sqlproxy_recording":1} (see RecordingVersion). It is followed by
+//one line of JSON per statement with the following keys:
+//
+//	query           - the query string as given to the proxied driver
+//	args            - the bound arguments (see below)
+//	started_at      - when the statement was started
+//	connection_id   - see QueryEvent.ConnectionID
+//	duration_ns     - see QueryEvent.Duration
+//	rows_affected   - only for Exec(), see QueryEvent.Rows
+//	last_insert_id  - only for Exec(), if the proxied driver reports it
+//	columns         - only for Query(), the column names of the result set
+//	rows            - only for Query() if CaptureRows is set, the result rows
+//	error           - only if the statement failed
+//
+//Arguments and column values are recorded as objects with a single key naming
+//their type, e.g. {"int64":42} or {"bytes":"aGVsbG8="}, or as null. Values of
+//types other than those permitted by driver.Value are recorded as
+//{"other":"..."} with their fmt.Sprint() representation. If Driver.Redactor is
+//set, the recorded arguments are redacted. Rows are recorded as returned by
+//the proxied driver, i.e. before any RowTransformHook, and only the first
+//result set of each query is recorded.
+//
+//Errors while writing the recording are reported by Err(), since the
+//statements themselves cannot fail because of them. The exported fields must
+//not be changed after the Recorder has been given to a Driver.
+type Recorder struct {
+	//CaptureRows (optional) records the result rows of queries in addition to
+	//their column names. This is required to replay queries, but can make the
+	//recording very large.
+	CaptureRows bool
+
+	mutex sync.Mutex
+	w     io.Writer
+	err   error
+}
+
+//NewRecorder writes the header of a new recording to the given writer, and
+//returns a Recorder that appends to it.
+func NewRecorder(w io.Writer) (*Recorder, error) {
+	err := writeRecordingLine(w, recordingHeader{Version: RecordingVersion})
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{w: w}, nil
+}
+
+//Err returns the first error that occurred while writing the recording, if
+//any. Once an error occurred, no further statements are recorded.
+func (r *Recorder) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(e QueryEvent) {
+	rec := recordedStatement{
+		Query:        e.Query,
+		Args:         encodeRecordedValues(e.Args),
+		ConnectionID: e.ConnectionID,
+		DurationNS:   e.Duration.Nanoseconds(),
+	}
+	if result := e.recording; result != nil {
+		rec.StartedAt = &result.startedAt
+	}
+	if e.Err != nil {
+		rec.Error = e.Err.Error()
+	}
+	if result := e.recording; result != nil && result.isQuery {
+		rec.Columns = result.columns
+		if r.CaptureRows {
+			rows := make([][]*recordedValue, len(result.rows))
+			for idx, row := range result.rows {
+				rows[idx] = encodeRecordedValues(row)
+			}
+			rec.Rows = &rows
+		}
+	} else if e.Err == nil {
+		rec.RowsAffected = &e.Rows
+		if result != nil {
+			rec.LastInsertID = result.lastInsertID
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err == nil {
+		r.err = writeRecordingLine(r.w, rec)
+	}
+}
+
+func writeRecordingLine(w io.Writer, value interface{}) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
+
+type recordingHeader struct {
+	Version int `json:"sqlproxy_recording"`
+}
+
+type recordedStatement struct {
+	Query        string              `json:"query"`
+	Args         []*recordedValue    `json:"args"`
+	StartedAt    *time.Time          `json:"started_at,omitempty"`
+	ConnectionID uint64              `json:"connection_id,omitempty"`
+	DurationNS   int64               `json:"duration_ns"`
+	RowsAffected *int64              `json:"rows_affected,omitempty"`
+	LastInsertID *int64              `json:"last_insert_id,omitempty"`
+	Columns      []string            `json:"columns,omitempty"`
+	Rows         *[][]*recordedValue `json:"rows,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+//recordedValue is the serialization of a driver.Value. Exactly one field is
+//set. A nil driver.Value is represented by a nil *recordedValue.
+type recordedValue struct {
+	Int64   *int64     `json:"int64,omitempty"`
+	Float64 *float64   `json:"float64,omitempty"`
+	Bool    *bool      `json:"bool,omitempty"`
+	Bytes   *[]byte    `json:"bytes,omitempty"`
+	String  *string    `json:"string,omitempty"`
+	Time    *time.Time `json:"time,omitempty"`
+	Other   *string    `json:"other,omitempty"`
+}
+
+func encodeRecordedValues[T any](values []T) []*recordedValue {
+	result := make([]*recordedValue, len(values))
+	for idx, value := range values {
+		result[idx] = encodeRecordedValue(value)
+	}
+	return result
+}
+
+func encodeRecordedValue(value interface{}) *recordedValue {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case sql.NamedArg:
+		return encodeRecordedValue(value.Value)
+	case int64:
+		return &recordedValue{Int64: &value}
+	case float64:
+		return &recordedValue{Float64: &value}
+	case bool:
+		return &recordedValue{Bool: &value}
+	case []byte:
+		//copy since drivers may reuse the buffer for the next row
+		buf := append([]byte{}, value...)
+		return &recordedValue{Bytes: &buf}
+	case string:
+		return &recordedValue{String: &value}
+	case time.Time:
+		return &recordedValue{Time: &value}
+	default:
+		str := fmt.Sprint(value)
+		return &recordedValue{Other: &str}
+	}
+}
+
+func (v *recordedValue) decode() driver.Value {
+	switch {
+	case v == nil:
+		return nil
+	case v.Int64 != nil:
+		return *v.Int64
+	case v.Float64 != nil:
+		return *v.Float64
+	case v.Bool != nil:
+		return *v.Bool
+	case v.Bytes != nil:
+		return *v.Bytes
+	case v.String != nil:
+		return *v.String
+	case v.Time != nil:
+		return *v.Time
+	case v.Other != nil:
+		return *v.Other
+	default:
+		return nil
+	}
+}
+
+//recordedResult is attached to a QueryEvent while a Recorder is active, to
+//carry the parts of the result that are not part of the QueryEvent itself.
+type recordedResult struct {
+	startedAt    time.Time
+	isQuery      bool
+	columns      []string
+	rows         [][]driver.Value
+	lastInsertID *int64
+}
+
+//recordRow is called by resultRows for each row returned by the proxied
+//driver.
+func (r *resultRows) recordRow(row []driver.Value) {
+	result := r.event.recording
+	if result == nil || !r.conn.driver.Recorder.CaptureRows {
+		return
+	}
+	copied := make([]driver.Value, len(row))
+	for idx, value := range row {
+		if buf, ok := value.([]byte); ok {
+			value = append([]byte{}, buf...)
+		}
+		copied[idx] = value
+	}
+	result.rows = append(result.rows, copied)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// replay
+
+//ReplayDriver is a driver.Driver that serves the results from a recording
+//written by Recorder, without a real database. This makes it possible to run
+//tests hermetically against a workload that was recorded once:
+//
+//	file, err := os.Open("testdata/workload.jsonl")
+//	...
+//	replay, err := sqlproxy.NewReplayDriver(file)
+//	db := sql.OpenDB(sqlproxy.NewConnector(sqlproxy.New("", sqlproxy.WithProxiedDriver(replay)), ""))
+//
+//Statements are matched by their query string and arguments. Since the
+//recording contains the query strings as given to the proxied driver, replay
+//through a Driver with the same hooks as the recording Driver if those hooks
+//rewrite statements (as shown above), or use the ReplayDriver directly
+//otherwise. When a statement was recorded multiple times, the recorded
+//results are served in order, and the last one is repeated once all have
+//been served. Statements that are not in the recording fail with an error.
+//
+//Errors are replayed with their recorded message, but not their original
+//type. Queries can only be replayed if the Recorder had CaptureRows set.
+//Transactions are accepted, but have no effect.
+type ReplayDriver struct {
+	//IgnoreArgs (optional) matches statements by their query string only.
+	//This is required if the recording was made with Driver.Redactor.
+	IgnoreArgs bool
+
+	mutex   sync.Mutex
+	results map[string][]*recordedStatement
+	//for each key of results, how many of them have been served
+	served map[string]int
+}
+
+//NewReplayDriver loads a recording written by Recorder.
+func NewReplayDriver(r io.Reader) (*ReplayDriver, error) {
+	recs, err := readRecording(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &ReplayDriver{
+		results: make(map[string][]*recordedStatement),
+		served:  make(map[string]int),
+	}
+	for _, rec := range recs {
+		key := replayKey(rec.Query, rec.decodeArgs())
+		d.results[key] = append(d.results[key], rec)
+		if key != rec.Query {
+			d.results[rec.Query] = append(d.results[rec.Query], rec)
+		}
+	}
+	return d, nil
+}
+
+//readRecording parses a recording written by Recorder.
+func readRecording(r io.Reader) ([]*recordedStatement, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("sqlproxy: recording is empty")
+	}
+	var header recordingHeader
+	err := json.Unmarshal(scanner.Bytes(), &header)
+	if err != nil {
+		return nil, fmt.Errorf("sqlproxy: cannot parse recording header: %w", err)
+	}
+	if header.Version != RecordingVersion {
+		return nil, fmt.Errorf("sqlproxy: unsupported recording version %d (expected %d)", header.Version, RecordingVersion)
+	}
+
+	var result []*recordedStatement
+	for lineNo := 2; scanner.Scan(); lineNo++ {
+		var rec recordedStatement
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return nil, fmt.Errorf("sqlproxy: cannot parse line %d of recording: %w", lineNo, err)
+		}
+		result = append(result, &rec)
+	}
+	return result, scanner.Err()
+}
+
+func (rec *recordedStatement) decodeArgs() []driver.Value {
+	args := make([]driver.Value, len(rec.Args))
+	for idx, arg := range rec.Args {
+		args[idx] = arg.decode()
+	}
+	return args
+}
+
+func replayKey(query string, args []driver.Value) string {
+	if len(args) == 0 {
+		return query
+	}
+	buf, _ := json.Marshal(encodeRecordedValues(args))
+	return query + "\x00" + string(buf)
+}
+
+//next returns the recorded result for the given statement.
+func (d *ReplayDriver) next(query string, args []driver.Value) (*recordedStatement, error) {
+	key := query
+	if !d.IgnoreArgs {
+		key = replayKey(query, args)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	results := d.results[key]
+	if len(results) == 0 {
+		return nil, fmt.Errorf("sqlproxy: no recorded result for statement: %s", query)
+	}
+	idx := d.served[key]
+	if idx < len(results)-1 {
+		d.served[key] = idx + 1
+	}
+	return results[idx], nil
+}
+
+//Open implements the driver.Driver interface. The data source is ignored.
+func (d *ReplayDriver) Open(dataSource string) (driver.Conn, error) {
+	return replayConn{d}, nil
+}
+
+type replayConn struct {
+	driver *ReplayDriver
+}
+
+func (c replayConn) Prepare(query string) (driver.Stmt, error) {
+	return replayStmt{c.driver, query}, nil
+}
+
+func (c replayConn) Close() error {
+	return nil
+}
+
+func (c replayConn) Begin() (driver.Tx, error) {
+	return replayTx{}, nil
+}
+
+func (c replayConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return replayStmt{c.driver, query}.ExecContext(ctx, args)
+}
+
+func (c replayConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return replayStmt{c.driver, query}.QueryContext(ctx, args)
+}
+
+type replayTx struct{}
+
+func (replayTx) Commit() error   { return nil }
+func (replayTx) Rollback() error { return nil }
+
+type replayStmt struct {
+	driver *ReplayDriver
+	query  string
+}
+
+func (s replayStmt) Close() error {
+	return nil
+}
+
+func (s replayStmt) NumInput() int {
+	return -1
+}
+
+func (s replayStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rec, err := s.driver.next(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Error != "" {
+		return nil, errors.New(rec.Error)
+	}
+	result := replayResult{lastInsertID: rec.LastInsertID}
+	if rec.RowsAffected != nil {
+		result.rowsAffected = *rec.RowsAffected
+	}
+	return result, nil
+}
+
+func (s replayStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Exec(values)
+}
+
+func (s replayStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rec, err := s.driver.next(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Columns == nil {
+		if rec.Error != "" {
+			return nil, errors.New(rec.Error)
+		}
+		return nil, fmt.Errorf("sqlproxy: statement was not recorded as a query: %s", s.query)
+	}
+	if rec.Rows == nil {
+		return nil, fmt.Errorf("sqlproxy: result rows were not recorded for statement: %s", s.query)
+	}
+	values := make([][]driver.Value, len(*rec.Rows))
+	for idx, row := range *rec.Rows {
+		values[idx] = make([]driver.Value, len(row))
+		for colIdx, value := range row {
+			values[idx][colIdx] = value.decode()
+		}
+	}
+	rows := newStaticRows(rec.Columns, nil, values)
+	if rec.Error != "" {
+		rows.err = errors.New(rec.Error)
+	}
+	return rows, nil
+}
+
+func (s replayStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Query(values)
+}
+
+type replayResult struct {
+	lastInsertID *int64
+	rowsAffected int64
+}
+
+func (r replayResult) LastInsertId() (int64, error) {
+	if r.lastInsertID == nil {
+		return 0, errors.New("sqlproxy: no LastInsertId was recorded for this statement")
+	}
+	return *r.lastInsertID, nil
+}
+
+func (r replayResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
@@ -0,0 +1,108 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_RecordAndReplay(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var buf bytes.Buffer
+	rec, err := NewRecorder(&buf)
+	tt.Must(err)
+	rec.CaptureRows = true
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithRecorder(rec)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, data BLOB)`))
+	result := tt.MustResult(db.Exec(`INSERT INTO users (name, data) VALUES (?, ?), (?, NULL)`, "alice", []byte("abc"), "bob"))
+	expectedNames := readUserNames(tt, db, "a")
+	_, err = db.Exec(`SELECT * FROM nonexistent`)
+	if err == nil {
+		t.Fatal("expected query on nonexistent table to fail")
+	}
+	tt.Must(db.Close())
+	tt.CleanupDB()
+	tt.Must(rec.Err())
+
+	if !strings.HasPrefix(buf.String(), `{"sqlproxy_recording":1}`+"\n") {
+		t.Errorf("unexpected recording header in %q", buf.String())
+	}
+
+	replay, err := NewReplayDriver(bytes.NewReader(buf.Bytes()))
+	tt.Must(err)
+	db = sql.OpenDB(NewConnector(New("", WithProxiedDriver(replay)), ""))
+
+	//replaying needs no actual database, so CREATE TABLE is not required
+	replayed := tt.MustResult(db.Exec(`INSERT INTO users (name, data) VALUES (?, ?), (?, NULL)`, "alice", []byte("abc"), "bob"))
+	for _, pair := range [][2]func() (int64, error){
+		{result.RowsAffected, replayed.RowsAffected},
+		{result.LastInsertId, replayed.LastInsertId},
+	} {
+		expected, _ := pair[0]()
+		actual, err := pair[1]()
+		tt.Must(err)
+		if actual != expected {
+			tt.Unexpected("replayed result", expected, actual)
+		}
+	}
+	actualNames := readUserNames(tt, db, "a")
+	if !reflect.DeepEqual(actualNames, expectedNames) {
+		tt.Unexpected("replayed rows", expectedNames, actualNames)
+	}
+
+	_, err = db.Exec(`SELECT * FROM nonexistent`)
+	if err == nil || !strings.Contains(err.Error(), "no such table") {
+		t.Errorf("expected recorded error to be replayed, got %v", err)
+	}
+	_, err = db.Query(`SELECT name FROM users WHERE name LIKE ?`, "b%")
+	if err == nil || !strings.Contains(err.Error(), "no recorded result") {
+		t.Errorf("expected statement with different args to fail, got %v", err)
+	}
+	tt.Must(db.Close())
+}
+
+func readUserNames(tt TT, db *sql.DB, prefix string) []string {
+	rows := tt.MustRows(db.Query(`SELECT name, data FROM users WHERE name LIKE ? ORDER BY id`, prefix+"%"))
+	var result []string
+	for rows.Next() {
+		var (
+			name string
+			data []byte
+		)
+		tt.Must(rows.Scan(&name, &data))
+		result = append(result, name+":"+string(data))
+	}
+	tt.Must(rows.Err())
+	tt.Must(rows.Close())
+	return result
+}
+
+func Test_ReplayDriverRejectsUnknownVersion(t *testing.T) {
+	_, err := NewReplayDriver(strings.NewReader(`{"sqlproxy_recording":2}` + "\n"))
+	if err == nil || !strings.Contains(err.Error(), "unsupported recording version 2") {
+		t.Errorf("expected version error, got %v", err)
+	}
+}
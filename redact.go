@@ -0,0 +1,334 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//RedactionRule declares which arguments of a statement are sensitive (see
+//Redactor). At most one of Fingerprint and Pattern may be set. If neither is
+//set, the rule applies to all statements.
+type RedactionRule struct {
+	//Fingerprint selects statements with the same fingerprint as this
+	//statement (see Normalize).
+	Fingerprint string
+	//Pattern selects statements matching this regular expression.
+	Pattern string
+	//Positions are the 1-based positions of sensitive arguments.
+	Positions []int
+	//Columns are the names of columns whose values are sensitive, e.g.
+	//"password" or "email". Arguments are associated with columns when they
+	//appear in comparisons like "password = $1" or "SET email = ?", or in
+	//"INSERT INTO table (columns...) VALUES (...)". Column names are matched
+	//case-insensitively and without table prefix.
+	Columns []string
+}
+
+//Redactor replaces sensitive arguments with a placeholder before statements
+//are logged or reported. When set as Driver.Redactor, it applies to the
+//QueryEvent.Args seen by all hooks and all logging in this package, whereas
+//the proxied driver still receives the original arguments. For example:
+//
+//	redactor, err := sqlproxy.NewRedactor(
+//		sqlproxy.RedactionRule{Columns: []string{"password", "email"}},
+//		sqlproxy.RedactionRule{Pattern: `^SELECT .* FROM api_tokens`, Positions: []int{1}},
+//	)
+type Redactor struct {
+	//Placeholder replaces the sensitive arguments. Defaults to "[REDACTED]".
+	Placeholder string
+	rules       []redactionRule
+}
+
+type redactionRule struct {
+	spec    RedactionRule
+	fp      string
+	rx      *regexp.Regexp
+	columns map[string]bool
+}
+
+//NewRedactor compiles the given rules into a Redactor.
+func NewRedactor(rules ...RedactionRule) (*Redactor, error) {
+	r := &Redactor{Placeholder: "[REDACTED]"}
+	for idx, spec := range rules {
+		rule := redactionRule{spec: spec, columns: make(map[string]bool)}
+		switch {
+		case spec.Fingerprint != "" && spec.Pattern != "":
+			return nil, fmt.Errorf("sqlproxy: redaction rule %d: Fingerprint and Pattern cannot be given at the same time", idx+1)
+		case spec.Fingerprint != "":
+			rule.fp = Normalize(spec.Fingerprint)
+		case spec.Pattern != "":
+			var err error
+			rule.rx, err = regexp.Compile(spec.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("sqlproxy: redaction rule %d: %w", idx+1, err)
+			}
+		}
+		for _, column := range spec.Columns {
+			rule.columns[strings.ToLower(column)] = true
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+func (r redactionRule) matches(query string, fingerprint func() string) bool {
+	switch {
+	case r.rx != nil:
+		return r.rx.MatchString(query)
+	case r.fp != "":
+		return fingerprint() == r.fp
+	default:
+		return true
+	}
+}
+
+//RedactArgs returns a copy of the given arguments of the given statement in
+//which all sensitive arguments are replaced by the Placeholder. Named
+//arguments (sql.NamedArg) keep their name.
+func (r *Redactor) RedactArgs(query string, args []interface{}) []interface{} {
+	result := make([]interface{}, len(args))
+	copy(result, args)
+
+	var (
+		fp      string
+		columns map[placeholderRef]string
+	)
+	fingerprint := func() string {
+		if fp == "" {
+			fp = Normalize(query)
+		}
+		return fp
+	}
+
+	for _, rule := range r.rules {
+		if !rule.matches(query, fingerprint) {
+			continue
+		}
+		for _, position := range rule.spec.Positions {
+			if position >= 1 && position <= len(result) {
+				result[position-1] = r.redact(result[position-1])
+			}
+		}
+		if len(rule.columns) == 0 {
+			continue
+		}
+		if columns == nil {
+			columns = columnsForPlaceholders(query)
+		}
+		for ref, column := range columns {
+			if rule.columns[column] {
+				r.redactRef(result, ref)
+			}
+		}
+	}
+	return result
+}
+
+//RedactRow returns a copy of the given row of the result set of the given
+//statement in which the values of sensitive columns are replaced by the
+//Placeholder. Only the Columns of the rules matching the statement are
+//considered, since result columns are not associated with argument
+//positions.
+func (r *Redactor) RedactRow(query string, columns []string, row []interface{}) []interface{} {
+	result := make([]interface{}, len(row))
+	copy(result, row)
+
+	var fp string
+	fingerprint := func() string {
+		if fp == "" {
+			fp = Normalize(query)
+		}
+		return fp
+	}
+	for _, rule := range r.rules {
+		if len(rule.columns) == 0 || !rule.matches(query, fingerprint) {
+			continue
+		}
+		for idx, column := range columns {
+			if idx < len(result) && rule.columns[normalizeColumnName(column)] {
+				result[idx] = r.Placeholder
+			}
+		}
+	}
+	return result
+}
+
+//unmaskableColumn returns the first column that is masked by RedactRow for the
+//given statement, but that the statement refers to in a way that RedactRow
+//cannot mask, e.g. "SELECT password AS p", "SELECT upper(password)" or "WHERE
+//password LIKE 'a%'". Masked columns may only appear as plain items in the
+//outermost select list (e.g. "SELECT id, u.password FROM users u"). If there
+//is no such column, "" is returned.
+func (r *Redactor) unmaskableColumn(query string) string {
+	var fp string
+	fingerprint := func() string {
+		if fp == "" {
+			fp = Normalize(query)
+		}
+		return fp
+	}
+	masked := make(map[string]bool)
+	for _, rule := range r.rules {
+		if len(rule.columns) > 0 && rule.matches(query, fingerprint) {
+			for column := range rule.columns {
+				masked[column] = true
+			}
+		}
+	}
+	if len(masked) == 0 {
+		return ""
+	}
+
+	tokens := tokenizeSQL(query)
+	textAt := func(idx int) string {
+		if idx < 0 || idx >= len(tokens) {
+			return ""
+		}
+		return strings.ToUpper(tokens[idx].text)
+	}
+	depth := 0
+	inSelectList := false
+	seenSelect := false
+	for idx, token := range tokens {
+		switch {
+		case token.text == "(":
+			depth++
+		case token.text == ")":
+			depth--
+		case depth == 0 && token.kind == sqlTokenWord && strings.EqualFold(token.text, "SELECT") && !seenSelect:
+			inSelectList, seenSelect = true, true
+		case depth == 0 && token.kind == sqlTokenWord && strings.EqualFold(token.text, "FROM"):
+			inSelectList = false
+		}
+
+		isIdentifier := token.kind == sqlTokenWord || strings.HasPrefix(token.text, `"`) || strings.HasPrefix(token.text, "`")
+		if !isIdentifier || !masked[normalizeColumnName(token.text)] {
+			continue
+		}
+		next := textAt(idx + 1)
+		if next == "." || next == "(" || textAt(idx-1) == "AS" {
+			continue //a qualifier, a function name or an alias
+		}
+		start := idx
+		for start >= 2 && tokens[start-1].text == "." {
+			start -= 2
+		}
+		prev := textAt(start - 1)
+		isPlainItem := prev == "SELECT" || prev == "DISTINCT" || prev == "ALL" || prev == ","
+		isItemEnd := next == "," || next == "FROM" || next == ";" || next == ""
+		if !(depth == 0 && inSelectList && isPlainItem && isItemEnd) {
+			return normalizeColumnName(token.text)
+		}
+	}
+	return ""
+}
+
+func (r *Redactor) redact(arg interface{}) interface{} {
+	if named, ok := arg.(sql.NamedArg); ok {
+		return sql.Named(named.Name, r.Placeholder)
+	}
+	return r.Placeholder
+}
+
+func (r *Redactor) redactRef(args []interface{}, ref placeholderRef) {
+	if ref.name != "" {
+		for idx, arg := range args {
+			if named, ok := arg.(sql.NamedArg); ok && named.Name == ref.name {
+				args[idx] = r.redact(arg)
+				return
+			}
+		}
+	}
+	if ref.ordinal >= 1 && ref.ordinal <= len(args) {
+		args[ref.ordinal-1] = r.redact(args[ref.ordinal-1])
+	}
+}
+
+var (
+	//matches the end of "column = " etc. right before a placeholder
+	comparedColumnRx = regexp.MustCompile("(?i)(\"[^\"]+\"|`[^`]+`|[A-Za-z_][\\w.]*)\\s*(?:=|<>|!=|<=|>=|<|>|\\sLIKE|\\sILIKE)\\s*$")
+	//matches "INSERT INTO table (columns...) VALUES"
+	insertColumnsRx = regexp.MustCompile(`(?is)^\s*(?:INSERT|REPLACE)\s+INTO\s+[^\s(]+\s*\(([^)]*)\)\s*VALUES\b`)
+)
+
+//columnsForPlaceholders guesses which column each placeholder in the given
+//query refers to. Column names are returned in lower case without table
+//prefix.
+func columnsForPlaceholders(query string) map[placeholderRef]string {
+	result := make(map[placeholderRef]string)
+	matches := findPlaceholders(query)
+
+	//INSERT INTO table (a, b, c) VALUES (?, ?, ?), (?, ?, ?)
+	if loc := insertColumnsRx.FindStringSubmatchIndex(query); loc != nil {
+		insertColumns := strings.Split(query[loc[2]:loc[3]], ",")
+		depth, field, matchIdx := 0, 0, 0
+		for idx := loc[1]; idx < len(query) && matchIdx < len(matches); idx++ {
+			for matchIdx < len(matches) && matches[matchIdx].start < idx {
+				matchIdx++
+			}
+			if matchIdx < len(matches) && matches[matchIdx].start == idx {
+				if depth == 1 && field < len(insertColumns) {
+					result[matches[matchIdx].ref] = normalizeColumnName(insertColumns[field])
+				}
+				continue
+			}
+			switch query[idx] {
+			case '\'':
+				end := strings.IndexByte(query[idx+1:], '\'')
+				if end == -1 {
+					return result
+				}
+				idx += end + 1
+			case '(':
+				depth++
+				if depth == 1 {
+					field = 0
+				}
+			case ')':
+				depth--
+			case ',':
+				if depth == 1 {
+					field++
+				}
+			}
+		}
+	}
+
+	for _, m := range matches {
+		//only look at the text right before the placeholder, to avoid quadratic
+		//runtime for statements with lots of placeholders
+		if match := comparedColumnRx.FindStringSubmatch(query[max(0, m.start-100):m.start]); match != nil {
+			result[m.ref] = normalizeColumnName(match[1])
+		}
+	}
+	return result
+}
+
+func normalizeColumnName(name string) string {
+	name = strings.TrimSpace(name)
+	if idx := strings.LastIndexByte(name, '.'); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return strings.ToLower(strings.Trim(name, "\"`"))
+}
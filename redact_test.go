@@ -0,0 +1,130 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_Redactor(t *testing.T) {
+	tt := TT{t}
+	r, err := NewRedactor(
+		RedactionRule{Columns: []string{"password", "Email"}},
+		RedactionRule{Pattern: `^SELECT .* FROM api_tokens`, Positions: []int{2}},
+		RedactionRule{Fingerprint: `CALL rotate_key('x', 'y')`, Positions: []int{1}},
+	)
+	tt.Must(err)
+
+	testCases := []struct {
+		Query    string
+		Args     []interface{}
+		Expected []interface{}
+	}{
+		{`SELECT * FROM users WHERE name = $1 AND u.password = $2`,
+			[]interface{}{"alice", "hunter2"},
+			[]interface{}{"alice", "[REDACTED]"}},
+		{`UPDATE users SET "email" = ?, name = ? WHERE id = ?`,
+			[]interface{}{"a@example.com", "alice", 1},
+			[]interface{}{"[REDACTED]", "alice", 1}},
+		{`INSERT INTO users (name, email, password) VALUES ($1, $2, 'x,y'), ($3, $4, $5)`,
+			[]interface{}{"alice", "a@example.com", "bob", "b@example.com", "secret"},
+			[]interface{}{"alice", "[REDACTED]", "bob", "[REDACTED]", "[REDACTED]"}},
+		{`SELECT * FROM users WHERE email LIKE :pattern`,
+			[]interface{}{sql.Named("pattern", "%@example.com")},
+			[]interface{}{sql.Named("pattern", "[REDACTED]")}},
+		{`SELECT * FROM api_tokens WHERE owner = $1 AND token = $2`,
+			[]interface{}{"alice", "abc123"},
+			[]interface{}{"alice", "[REDACTED]"}},
+		{`CALL rotate_key($1, $2)`,
+			[]interface{}{"key", "value"},
+			[]interface{}{"[REDACTED]", "value"}},
+	}
+	for _, tc := range testCases {
+		actual := r.RedactArgs(tc.Query, tc.Args)
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			tt.Unexpected("redacted args for "+tc.Query, tc.Expected, actual)
+		}
+	}
+
+	if _, err := NewRedactor(RedactionRule{Pattern: "("}); err == nil {
+		t.Error("expected NewRedactor() to fail for invalid pattern, but it succeeded")
+	}
+}
+
+func Test_DriverRedactor(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	r, err := NewRedactor(RedactionRule{Columns: []string{"password"}})
+	tt.Must(err)
+	var buf bytes.Buffer
+	logger, err := NewQueryLogger(&buf, LogFormatText)
+	tt.Must(err)
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithRedactor(r), WithAfterQuery(logger)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (name TEXT, password TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (name, password) VALUES ($1, $2)`, "alice", "hunter2"))
+
+	//the database receives the original argument
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM users WHERE password = $1`, "hunter2").Scan(&count))
+	if count != 1 {
+		tt.Unexpected("count", 1, count)
+	}
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("password leaked into log: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `VALUES ($1, $2) ["alice", "[REDACTED]"]`) {
+		t.Errorf("expected redacted INSERT in log: %s", buf.String())
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_RedactorUnmaskableColumn(t *testing.T) {
+	r, err := NewRedactor(RedactionRule{Columns: []string{"password"}})
+	TT{t}.Must(err)
+	testCases := map[string]string{
+		`SELECT id, password FROM users`:                                 "",
+		`SELECT u.password, u.name FROM users u WHERE u.id = 1`:          "",
+		`SELECT "password" FROM users`:                                   "",
+		`SELECT * FROM users WHERE name LIKE 'password%'`:                "",
+		`SELECT 'x' AS password`:                                         "",
+		`SELECT password AS p FROM users`:                                "password",
+		`SELECT password p FROM users`:                                   "password",
+		`SELECT upper(password) FROM users`:                              "password",
+		`SELECT password || '' FROM users`:                               "password",
+		`SELECT id FROM users WHERE password LIKE 'a%'`:                  "password",
+		`SELECT id FROM users ORDER BY password`:                         "password",
+		`SELECT * FROM (SELECT password AS name FROM users) x`:           "password",
+		`SELECT name FROM users UNION SELECT password FROM users`:        "password",
+		`WITH x AS (SELECT password FROM users) SELECT * FROM x`:         "password",
+		`SELECT (SELECT password FROM users LIMIT 1) AS name FROM users`: "password",
+	}
+	for query, expected := range testCases {
+		if actual := r.unmaskableColumn(query); actual != expected {
+			TT{t}.Unexpected("unmaskable column in "+query, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+var registry = struct {
+	sync.Mutex
+	names map[*Driver]string
+}{names: make(map[*Driver]string)}
+
+//Register registers the given Driver with sql.Register() under a generated
+//name, and returns that name for use with sql.Open(). This is useful when
+//multiple Driver instances are constructed at runtime (e.g. in tests), since
+//sql.Register() panics when a driver name is used twice. When the same Driver
+//instance is given to Register() again, it is not registered a second time;
+//the existing name is returned instead.
+//
+//	db, err := sql.Open(sqlproxy.Register(&sqlproxy.Driver{...}), dsn)
+func Register(d *Driver) string {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if name, exists := registry.names[d]; exists {
+		return name
+	}
+	proxiedName := d.ProxiedDriverName
+	if proxiedName == "" {
+		proxiedName = "custom"
+	}
+	name := fmt.Sprintf("%s+sqlproxy-%d", proxiedName, len(registry.names)+1)
+	sql.Register(name, d)
+	registry.names[d] = name
+	return name
+}
@@ -0,0 +1,230 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//RepeatedQueryEvent describes a statement that was executed more often than
+//the Driver's RepeatedQueryThreshold within a single transaction or query
+//scope. It is given to the RepeatedQueryHook.
+type RepeatedQueryEvent struct {
+	//Fingerprint is the Normalize()d statement.
+	Fingerprint string
+	//Count is how often statements with this fingerprint were executed
+	//within the transaction or query scope.
+	Count int
+	//Duration is the sum of QueryEvent.Duration over all these executions.
+	Duration time.Duration
+	//Transaction is true if the statements were counted within a
+	//transaction, or false if they were counted within a query scope.
+	Transaction bool
+	//First is the QueryEvent of the first of these executions. Its Caller and
+	//Fields usually point to where the repeated statements are issued from.
+	First QueryEvent
+}
+
+//DuplicateQueryEvent describes an identical statement (same query and same
+//arguments) that was executed more than once within a single transaction. It
+//is given to the DuplicateQueryHook.
+type DuplicateQueryEvent struct {
+	//Query and Args are the same as in QueryEvent.
+	Query string
+	Args  []interface{}
+	//Count is how often the statement was executed within the transaction.
+	Count int
+	//Duration is the sum of QueryEvent.Duration over all these executions.
+	Duration time.Duration
+	//First is the QueryEvent of the first of these executions.
+	First QueryEvent
+}
+
+//BeginQueryScope starts a query scope for detecting N+1 query problems (see
+//Driver.RepeatedQueryThreshold). All statements executed with the returned
+//context (or a context derived from it) outside of transactions are counted
+//towards this scope. Statements within a transaction are counted towards the
+//transaction instead. The returned function ends the scope and reports any
+//repeated statements. A typical query scope is a single request in a web
+//application:
+//
+//	func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+//		ctx, endScope := sqlproxy.BeginQueryScope(r.Context())
+//		defer endScope()
+//		h.serve(w, r.WithContext(ctx))
+//	}
+func BeginQueryScope(ctx context.Context) (context.Context, func()) {
+	scope := &queryScope{}
+	return context.WithValue(ctx, queryScopeKey{}, scope), scope.end
+}
+
+type queryScopeKey struct{}
+
+func queryScopeFromContext(ctx context.Context) *queryScope {
+	scope, _ := ctx.Value(queryScopeKey{}).(*queryScope)
+	return scope
+}
+
+//queryScope counts statements by fingerprint within a transaction or a
+//context created by BeginQueryScope. Within transactions, it also counts
+//identical statements (see Driver.DetectDuplicateQueries).
+type queryScope struct {
+	transaction bool
+	mutex       sync.Mutex
+	counts      map[string]*repeatedQueryCount
+	duplicates  map[string]*duplicateQueryCount
+}
+
+type repeatedQueryCount struct {
+	event RepeatedQueryEvent
+	//as of the last execution of this statement
+	hooks     *Hooks
+	threshold int
+}
+
+type duplicateQueryCount struct {
+	event DuplicateQueryEvent
+	//as of the last execution of this statement
+	hooks *Hooks
+}
+
+func (s *queryScope) record(d *Driver, hooks *Hooks, e QueryEvent) {
+	first := e.detached()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if d.RepeatedQueryThreshold > 0 {
+		fingerprint := Normalize(e.Query)
+		if s.counts == nil {
+			s.counts = make(map[string]*repeatedQueryCount)
+		}
+		c := s.counts[fingerprint]
+		if c == nil {
+			c = &repeatedQueryCount{event: RepeatedQueryEvent{
+				Fingerprint: fingerprint,
+				Transaction: s.transaction,
+				First:       first,
+			}}
+			s.counts[fingerprint] = c
+		}
+		c.event.Count++
+		c.event.Duration += e.Duration
+		c.hooks = hooks
+		c.threshold = d.RepeatedQueryThreshold
+	}
+
+	if s.transaction && d.DetectDuplicateQueries {
+		key := duplicateQueryKey(e)
+		if s.duplicates == nil {
+			s.duplicates = make(map[string]*duplicateQueryCount)
+		}
+		c := s.duplicates[key]
+		if c == nil {
+			c = &duplicateQueryCount{event: DuplicateQueryEvent{
+				Query: e.Query,
+				Args:  e.Args,
+				First: first,
+			}}
+			s.duplicates[key] = c
+		}
+		c.event.Count++
+		c.event.Duration += e.Duration
+		c.hooks = hooks
+	}
+}
+
+//duplicateQueryKey identifies statements with the same query and arguments.
+//The arguments are taken before redaction, since statements whose sensitive
+//arguments differ are not duplicates of each other.
+func duplicateQueryKey(e QueryEvent) string {
+	return e.Query + "\x00" + strings.Join(formatArgs(castNamedValues(e.boundArgs)), "\x00")
+}
+
+//end reports all statements whose count exceeds the threshold in order of
+//their fingerprints, followed by all duplicate statements in order of their
+//query and arguments. Statements executed after end() start a new count.
+func (s *queryScope) end() {
+	s.mutex.Lock()
+	counts := s.counts
+	duplicates := s.duplicates
+	s.counts = nil
+	s.duplicates = nil
+	s.mutex.Unlock()
+
+	fingerprints := make([]string, 0, len(counts))
+	for fingerprint, c := range counts {
+		if c.event.Count > c.threshold {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+	sort.Strings(fingerprints)
+	for _, fingerprint := range fingerprints {
+		c := counts[fingerprint]
+		if c.hooks.RepeatedQueryHook != nil {
+			c.hooks.RepeatedQueryHook(c.event)
+		} else {
+			logRepeatedQuery(c.event)
+		}
+	}
+
+	keys := make([]string, 0, len(duplicates))
+	for key, c := range duplicates {
+		if c.event.Count > 1 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		c := duplicates[key]
+		if c.hooks.DuplicateQueryHook != nil {
+			c.hooks.DuplicateQueryHook(c.event)
+		} else {
+			logDuplicateQuery(c.event)
+		}
+	}
+}
+
+func logRepeatedQuery(e RepeatedQueryEvent) {
+	attrs := []slog.Attr{
+		slog.String("fingerprint", e.Fingerprint),
+		slog.Int("count", e.Count),
+		slog.Duration("duration", e.Duration),
+		slog.Bool("transaction", e.Transaction),
+	}
+	attrs = append(attrs, e.First.fieldAttrs()...)
+	slog.LogAttrs(context.Background(), slog.LevelWarn, "repeated SQL statement (possible N+1 query)", attrs...)
+}
+
+func logDuplicateQuery(e DuplicateQueryEvent) {
+	attrs := []slog.Attr{
+		slog.String("query", formatQuery(e.Query, nil)),
+		slog.Any("args", formatArgs(e.Args)),
+		slog.Int("count", e.Count),
+		slog.Duration("duration", e.Duration),
+	}
+	attrs = append(attrs, e.First.fieldAttrs()...)
+	slog.LogAttrs(context.Background(), slog.LevelWarn, "duplicate SQL statement in transaction", attrs...)
+}
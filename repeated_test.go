@@ -0,0 +1,135 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_RepeatedQueryDetection(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var reports []string
+	d := New("sqlite3",
+		WithRepeatedQueryDetection(2),
+		WithRepeatedQueryHook(func(e RepeatedQueryEvent) {
+			reports = append(reports, fmt.Sprintf("%s: %d times, transaction = %t, first args = %v",
+				e.Fingerprint, e.Count, e.Transaction, e.First.Args))
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+
+	//within a query scope
+	ctx, endScope := BeginQueryScope(context.Background())
+	for idx := 1; idx <= 3; idx++ {
+		tt.MustResult(db.ExecContext(ctx, `INSERT INTO knowledge VALUES ($1, 'thing')`, idx))
+	}
+	for idx := 1; idx <= 2; idx++ {
+		tt.MustResult(db.ExecContext(ctx, `UPDATE knowledge SET thing = 'other' WHERE number = $1`, idx))
+	}
+	if len(reports) != 0 {
+		t.Errorf("expected no reports before the scope ends, got %#v", reports)
+	}
+	endScope()
+
+	//within a transaction (the query scope has ended, so the context must not
+	//make a difference)
+	tx, err := db.BeginTx(ctx, nil)
+	tt.Must(err)
+	for idx := 1; idx <= 3; idx++ {
+		var thing string
+		tt.Must(tx.QueryRowContext(ctx, `SELECT thing FROM knowledge WHERE number = $1`, idx).Scan(&thing))
+	}
+	tt.Must(tx.Rollback())
+
+	//outside of any scope
+	for idx := 1; idx <= 3; idx++ {
+		tt.MustResult(db.Exec(`DELETE FROM knowledge WHERE number = $1`, idx))
+	}
+	tt.Must(db.Close())
+
+	expected := []string{
+		"INSERT INTO knowledge VALUES (?, ?): 3 times, transaction = false, first args = [1]",
+		"SELECT thing FROM knowledge WHERE number = ?: 3 times, transaction = true, first args = [1]",
+	}
+	if !reflect.DeepEqual(reports, expected) {
+		tt.Unexpected("reports", expected, reports)
+	}
+
+	tt.CleanupDB()
+}
+
+func Test_DuplicateQueryDetection(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var reports []string
+	d := New("sqlite3",
+		WithDuplicateQueryDetection(),
+		WithDuplicateQueryHook(func(e DuplicateQueryEvent) {
+			reports = append(reports, fmt.Sprintf("%s %v: %d times", e.Query, e.Args, e.Count))
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES (1, 'one'), (2, 'two')`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES (1, 'one'), (2, 'two')`)) //not in a transaction
+
+	tx, err := db.Begin()
+	tt.Must(err)
+	for _, number := range []int{1, 2, 1, 1} {
+		var thing string
+		tt.Must(tx.QueryRow(`SELECT thing FROM knowledge WHERE number = $1 LIMIT 1`, number).Scan(&thing))
+	}
+	if len(reports) != 0 {
+		t.Errorf("expected no reports before the transaction ends, got %#v", reports)
+	}
+	tt.Must(tx.Commit())
+
+	//statements whose arguments only look the same after redaction are not
+	//duplicates
+	redactor, err := NewRedactor(RedactionRule{Columns: []string{"thing"}})
+	tt.Must(err)
+	d.Redactor = redactor
+	tx, err = db.Begin()
+	tt.Must(err)
+	for _, thing := range []string{"one", "two", "two"} {
+		var number int
+		tt.Must(tx.QueryRow(`SELECT number FROM knowledge WHERE thing = $1 LIMIT 1`, thing).Scan(&number))
+	}
+	tt.Must(tx.Commit())
+	tt.Must(db.Close())
+
+	expected := []string{
+		"SELECT thing FROM knowledge WHERE number = $1 LIMIT 1 [1]: 3 times",
+		"SELECT number FROM knowledge WHERE thing = $1 LIMIT 1 [[REDACTED]]: 2 times",
+	}
+	if !reflect.DeepEqual(reports, expected) {
+		tt.Unexpected("reports", expected, reports)
+	}
+
+	tt.CleanupDB()
+}
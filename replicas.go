@@ -0,0 +1,161 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//Route is the result of Hooks.RouteHook. It decides whether a statement is
+//executed on the primary database or on a replica (see
+//Driver.ReplicaDataSources).
+type Route int
+
+const (
+	//RouteDefault leaves the decision to the default routing: Read-only
+	//queries (see IsReadOnlyStatement, e.g. SELECT, WITH ... SELECT, VALUES,
+	//SHOW or EXPLAIN) outside of transactions go to a replica, everything else
+	//(including SET and transaction control) goes to the primary.
+	RouteDefault Route = iota
+	//RoutePrimary sends the statement to the primary.
+	RoutePrimary
+	//RouteReplica sends the statement to a replica. This is ignored within
+	//transactions.
+	RouteReplica
+)
+
+//lockingReadRx matches SELECT statements that take row locks, which are only
+//possible on the primary.
+var lockingReadRx = regexp.MustCompile(`(?i)\bFOR\s+(?:NO\s+KEY\s+)?(?:UPDATE|SHARE)\b|\bLOCK\s+IN\s+SHARE\s+MODE\b`)
+
+//statement types that IsReadOnlyStatement accepts, but that affect the state
+//of the session, so they must run on the primary connection
+var sessionStatementTypes = map[string]bool{
+	"set": true, "reset": true, "begin": true, "start": true, "commit": true,
+	"rollback": true, "savepoint": true, "release": true,
+}
+
+func defaultRoute(query string) Route {
+	if !IsReadOnlyStatement(query) || lockingReadRx.MatchString(query) {
+		return RoutePrimary
+	}
+	//IsReadOnlyStatement has ensured that there is a leading keyword
+	keyword := strings.ToLower(leadingKeywordRx.FindStringSubmatch(query)[1])
+	if sessionStatementTypes[keyword] {
+		return RoutePrimary
+	}
+	return RouteReplica
+}
+
+//replicaSet contains the connectors for Driver.ReplicaDataSources, which
+//are used in round-robin fashion.
+type replicaSet struct {
+	connectors []driver.Connector
+	next       atomic.Uint64
+	//ready[idx] is set once connectors[idx] has completed its warm-up (see
+	//Driver.ReplicaWarmup)
+	ready []atomic.Bool
+	//stops the warm-up when the connector is closed
+	cancel  context.CancelFunc
+	warmups sync.WaitGroup
+}
+
+func newReplicaSet(d *Driver) (*replicaSet, error) {
+	if len(d.ReplicaDataSources) == 0 {
+		return nil, nil
+	}
+	r := &replicaSet{ready: make([]atomic.Bool, len(d.ReplicaDataSources))}
+	for _, dataSource := range d.ReplicaDataSources {
+		c, err := d.proxiedConnector(dataSource)
+		if err != nil {
+			return nil, err
+		}
+		r.connectors = append(r.connectors, c)
+	}
+
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+	for idx := range r.connectors {
+		if len(d.ReplicaWarmup) == 0 {
+			r.ready[idx].Store(true)
+			continue
+		}
+		r.warmups.Add(1)
+		go r.warmup(ctx, d, idx)
+	}
+	return r, nil
+}
+
+//connect connects to the next replica that has completed its warm-up. If no
+//replica is ready yet, nil is returned.
+func (r *replicaSet) connect(ctx context.Context) (driver.Conn, error) {
+	for range r.connectors {
+		idx := (r.next.Add(1) - 1) % uint64(len(r.connectors))
+		if r.ready[idx].Load() {
+			return r.connectors[idx].Connect(ctx)
+		}
+	}
+	return nil, nil
+}
+
+//close stops the warm-up of all replicas and waits for it to finish.
+func (r *replicaSet) close() {
+	r.cancel()
+	r.warmups.Wait()
+}
+
+//route returns the proxied connection that a one-off statement shall be
+//executed on: either the primary connection, or the connection to a replica
+//(which is established on first use).
+func (c *connection) route(ctx context.Context, hooks *Hooks, query string) driver.Conn {
+	if c.replicas == nil || c.tx != nil {
+		return c.conn
+	}
+	route := RouteDefault
+	if hooks.RouteHook != nil {
+		route = hooks.RouteHook(ctx, query)
+	}
+	if route == RouteDefault {
+		route = defaultRoute(query)
+	}
+	if route != RouteReplica {
+		return c.conn
+	}
+
+	if c.replica == nil {
+		replica, err := c.replicas.connect(ctx)
+		if err != nil {
+			slog.Warn("sqlproxy: cannot connect to replica, using primary instead",
+				slog.Uint64("connection_id", c.id), slog.String("error", err.Error()))
+			return c.conn
+		}
+		if replica == nil {
+			return c.conn //all replicas are still warming up
+		}
+		c.replica = replica
+	}
+	return c.replica
+}
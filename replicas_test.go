@@ -0,0 +1,243 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ReadWriteSplitting(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	replicaFile := filepath.Join(t.TempDir(), "replica.sqlite")
+	replica := tt.MustDB(sql.Open("sqlite3", "file:"+replicaFile))
+	tt.MustResult(replica.Exec(`CREATE TABLE knowledge (thing TEXT)`))
+	tt.MustResult(replica.Exec(`INSERT INTO knowledge VALUES ('from replica')`))
+	tt.Must(replica.Close())
+
+	type forcePrimary struct{}
+	var replicaStatements []string
+	d := New("sqlite3",
+		WithReplicas("file:"+replicaFile),
+		WithRouteHook(func(ctx context.Context, query string) Route {
+			if ctx.Value(forcePrimary{}) != nil {
+				return RoutePrimary
+			}
+			return RouteDefault
+		}),
+		WithAfterQuery(func(e QueryEvent) {
+			if e.Replica {
+				replicaStatements = append(replicaStatements, e.Query)
+			}
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	db.SetMaxOpenConns(1)
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ('from primary')`))
+
+	queryThing := func(ctx context.Context, q interface {
+		QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+	}) string {
+		var thing string
+		tt.Must(q.QueryRowContext(ctx, `SELECT thing FROM knowledge`).Scan(&thing))
+		return thing
+	}
+
+	//SELECT outside a transaction goes to the replica
+	if actual := queryThing(context.Background(), db); actual != "from replica" {
+		tt.Unexpected("SELECT result", "from replica", actual)
+	}
+	//...unless the RouteHook says otherwise
+	ctx := context.WithValue(context.Background(), forcePrimary{}, true)
+	if actual := queryThing(ctx, db); actual != "from primary" {
+		tt.Unexpected("SELECT result with RouteHook", "from primary", actual)
+	}
+	//SELECT within a transaction goes to the primary
+	tx, err := db.Begin()
+	tt.Must(err)
+	if actual := queryThing(context.Background(), tx); actual != "from primary" {
+		tt.Unexpected("SELECT result within transaction", "from primary", actual)
+	}
+	tt.Must(tx.Rollback())
+
+	if len(replicaStatements) != 1 || replicaStatements[0] != `SELECT thing FROM knowledge` {
+		t.Errorf("unexpected statements on replica: %#v", replicaStatements)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_DefaultRoute(t *testing.T) {
+	testCases := map[string]Route{
+		`SELECT * FROM users`:                     RouteReplica,
+		`/* comment */ select 1`:                  RouteReplica,
+		`SELECT * FROM jobs FOR UPDATE`:           RoutePrimary,
+		`SELECT * FROM t LOCK IN SHARE MODE`:      RoutePrimary,
+		`INSERT INTO users (name) VALUES ('foo')`: RoutePrimary,
+		`WITH x AS (DELETE FROM t) SELECT 1`:      RoutePrimary,
+		`WITH x AS (SELECT 1) SELECT * FROM x`:    RouteReplica,
+		`VALUES (1), (2)`:                         RouteReplica,
+		`SELECT 1; DELETE FROM users`:             RoutePrimary,
+		`SELECT * INTO backup FROM users`:         RoutePrimary,
+		`SET search_path = foo`:                   RoutePrimary,
+		`BEGIN`:                                   RoutePrimary,
+	}
+	for query, expected := range testCases {
+		if actual := defaultRoute(query); actual != expected {
+			TT{t}.Unexpected("route for "+query, expected, actual)
+		}
+	}
+}
+
+func Test_ReplicaWarmup(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	replicaFile := filepath.Join(t.TempDir(), "replica.sqlite")
+	replica := tt.MustDB(sql.Open("sqlite3", "file:"+replicaFile))
+	tt.MustResult(replica.Exec(`CREATE TABLE knowledge (thing TEXT)`))
+	tt.MustResult(replica.Exec(`INSERT INTO knowledge VALUES ('from replica')`))
+	tt.Must(replica.Close())
+
+	warmupStatements := []string{
+		`SELECT COUNT(*) FROM knowledge`,
+		`SELECT * FROM nonexistent`,
+	}
+	release := make(chan struct{})
+	eventsChan := make(chan ReplicaWarmupEvent, len(warmupStatements))
+	d := New("sqlite3",
+		WithReplicas("file:"+replicaFile),
+		WithReplicaWarmup(warmupStatements...),
+		WithReplicaWarmupHook(func(e ReplicaWarmupEvent) {
+			if e.Completed == 1 {
+				<-release
+			}
+			eventsChan <- e
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ('from primary')`))
+
+	queryThing := func() string {
+		var thing string
+		tt.Must(db.QueryRow(`SELECT thing FROM knowledge`).Scan(&thing))
+		return thing
+	}
+
+	//while the replica is warming up, SELECT goes to the primary
+	if actual := queryThing(); actual != "from primary" {
+		tt.Unexpected("SELECT result during warm-up", "from primary", actual)
+	}
+
+	close(release)
+	var events []ReplicaWarmupEvent
+	for e := range eventsChan {
+		events = append(events, e)
+		if e.Done {
+			break
+		}
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 warm-up events, got %#v", events)
+	}
+	for idx, e := range events {
+		if e.Replica != 0 || e.Query != warmupStatements[idx] || e.Completed != idx+1 || e.Total != 2 {
+			t.Errorf("unexpected warm-up event %d: %#v", idx, e)
+		}
+	}
+	if events[0].Err != nil || events[0].Done {
+		t.Errorf("expected first warm-up statement to succeed, got %#v", events[0])
+	}
+	if events[1].Err == nil {
+		t.Error("expected second warm-up statement to fail")
+	}
+
+	//after the warm-up (even a failed one), SELECT goes to the replica
+	if actual := queryThing(); actual != "from replica" {
+		tt.Unexpected("SELECT result after warm-up", "from replica", actual)
+	}
+	tt.Must(db.Close())
+}
+
+func Test_ReplicaWarmupRetriesConnect(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	//the replica cannot be opened until its directory exists
+	replicaDir := filepath.Join(t.TempDir(), "replica")
+	replicaFile := filepath.Join(replicaDir, "replica.sqlite")
+
+	eventsChan := make(chan ReplicaWarmupEvent, 16)
+	d := New("sqlite3",
+		WithReplicas("file:"+replicaFile),
+		WithReplicaWarmup(`SELECT COUNT(*) FROM knowledge`),
+		WithReplicaWarmupHook(func(e ReplicaWarmupEvent) {
+			select {
+			case eventsChan <- e:
+			default:
+			}
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ('from primary')`))
+
+	queryThing := func() string {
+		var thing string
+		tt.Must(db.QueryRow(`SELECT thing FROM knowledge`).Scan(&thing))
+		return thing
+	}
+
+	e := <-eventsChan
+	if e.Err == nil || e.Done || e.Query != "" {
+		t.Fatalf("expected a failed connection attempt, got %#v", e)
+	}
+	//an unreachable replica does not get any statements
+	if actual := queryThing(); actual != "from primary" {
+		tt.Unexpected("SELECT result while replica is unreachable", "from primary", actual)
+	}
+
+	tt.Must(os.Mkdir(replicaDir, 0777))
+	replica := tt.MustDB(sql.Open("sqlite3", "file:"+replicaFile))
+	tt.MustResult(replica.Exec(`CREATE TABLE knowledge (thing TEXT)`))
+	tt.MustResult(replica.Exec(`INSERT INTO knowledge VALUES ('from replica')`))
+	tt.Must(replica.Close())
+
+	for e := range eventsChan {
+		if e.Done {
+			if e.Err != nil || e.Completed != 1 {
+				t.Errorf("unexpected final warm-up event: %#v", e)
+			}
+			break
+		}
+	}
+	if actual := queryThing(); actual != "from replica" {
+		tt.Unexpected("SELECT result after warm-up", "from replica", actual)
+	}
+	tt.Must(db.Close())
+}
@@ -0,0 +1,176 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"sort"
+	"time"
+)
+
+//ActivityReport is a summary of the statements collected by a
+//FingerprintStats within a time window, as produced by
+//FingerprintStats.Report() or FingerprintStats.RecentReport(). It can be
+//rendered as JSON, e.g. for a daily digest:
+//
+//	report := stats.Report(10)
+//	stats.Reset() //start the next window
+//	buf, err := json.MarshalIndent(report, "", "  ")
+//
+//All durations are given in seconds.
+type ActivityReport struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Statements uint64    `json:"statements"`
+	Errors     uint64    `json:"errors"`
+	//ErrorRate is Errors divided by Statements.
+	ErrorRate    float64            `json:"error_rate"`
+	TotalSeconds float64            `json:"total_seconds"`
+	Latency      LatencyPercentiles `json:"latency"`
+	//BusiestFingerprints lists the fingerprints with the highest total
+	//duration, the busiest first.
+	BusiestFingerprints []FingerprintReport `json:"busiest_fingerprints"`
+	//BusiestTables lists the tables with the highest total duration of
+	//statements referring to them, the busiest first.
+	BusiestTables []TableReport `json:"busiest_tables"`
+}
+
+//LatencyPercentiles appears in type ActivityReport. The percentiles are
+//estimated from histograms (see LatencyHistogram.Quantile).
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+//FingerprintReport appears in type ActivityReport.
+type FingerprintReport struct {
+	Fingerprint  string             `json:"fingerprint"`
+	Tenant       string             `json:"tenant,omitempty"`
+	Calls        uint64             `json:"calls"`
+	Errors       uint64             `json:"errors"`
+	ErrorRate    float64            `json:"error_rate"`
+	Rows         int64              `json:"rows"`
+	TotalSeconds float64            `json:"total_seconds"`
+	MeanSeconds  float64            `json:"mean_seconds"`
+	Latency      LatencyPercentiles `json:"latency"`
+}
+
+//TableReport appears in type ActivityReport.
+type TableReport struct {
+	Table        string  `json:"table"`
+	Calls        uint64  `json:"calls"`
+	Errors       uint64  `json:"errors"`
+	TotalSeconds float64 `json:"total_seconds"`
+}
+
+//Report summarizes the statistics collected since this FingerprintStats was
+//created or last Reset(). At most n fingerprints and n tables are listed.
+//Tables are recognized by the FROM, JOIN, INTO, UPDATE and TABLE keywords in
+//the fingerprints.
+func (s *FingerprintStats) Report(n int) ActivityReport {
+	stats, since := s.snapshot()
+	return buildActivityReport(stats, since, time.Now(), n)
+}
+
+func buildActivityReport(stats []LatencyHistogram, start, end time.Time, n int) ActivityReport {
+	report := ActivityReport{Start: start, End: end}
+
+	var total LatencyHistogram
+	tables := make(map[string]*TableReport)
+	for _, h := range stats {
+		report.Statements += h.Count
+		report.Errors += h.Errors
+		report.TotalSeconds += h.Sum.Seconds()
+		total = mergeLatencyHistograms(total, h)
+
+		for _, table := range tablesInQuery(h.Fingerprint) {
+			t := tables[table]
+			if t == nil {
+				t = &TableReport{Table: table}
+				tables[table] = t
+			}
+			t.Calls += h.Count
+			t.Errors += h.Errors
+			t.TotalSeconds += h.Sum.Seconds()
+		}
+	}
+	report.ErrorRate = errorRate(report.Errors, report.Statements)
+	report.Latency = latencyPercentiles(total)
+
+	report.BusiestFingerprints = []FingerprintReport{}
+	for _, h := range topLatencyHistograms(stats, n, ByTotalTime) {
+		report.BusiestFingerprints = append(report.BusiestFingerprints, FingerprintReport{
+			Fingerprint:  h.Fingerprint,
+			Tenant:       h.Tenant,
+			Calls:        h.Count,
+			Errors:       h.Errors,
+			ErrorRate:    errorRate(h.Errors, h.Count),
+			Rows:         h.Rows,
+			TotalSeconds: h.Sum.Seconds(),
+			MeanSeconds:  h.Mean().Seconds(),
+			Latency:      latencyPercentiles(h),
+		})
+	}
+
+	report.BusiestTables = make([]TableReport, 0, len(tables))
+	for _, t := range tables {
+		report.BusiestTables = append(report.BusiestTables, *t)
+	}
+	sort.Slice(report.BusiestTables, func(i, j int) bool {
+		ti, tj := report.BusiestTables[i], report.BusiestTables[j]
+		if ti.TotalSeconds != tj.TotalSeconds {
+			return ti.TotalSeconds > tj.TotalSeconds
+		}
+		return ti.Table < tj.Table
+	})
+	if n < len(report.BusiestTables) {
+		report.BusiestTables = report.BusiestTables[:n]
+	}
+	return report
+}
+
+//mergeLatencyHistograms adds the counts of h to total. All histograms of one
+//FingerprintStats have the same buckets.
+func mergeLatencyHistograms(total, h LatencyHistogram) LatencyHistogram {
+	if total.Counts == nil {
+		total.Buckets = h.Buckets
+		total.Counts = make([]uint64, len(h.Counts))
+	}
+	total.Count += h.Count
+	for idx, c := range h.Counts {
+		total.Counts[idx] += c
+	}
+	return total
+}
+
+func latencyPercentiles(h LatencyHistogram) LatencyPercentiles {
+	return LatencyPercentiles{
+		P50: h.Quantile(0.5).Seconds(),
+		P90: h.Quantile(0.9).Seconds(),
+		P99: h.Quantile(0.99).Seconds(),
+	}
+}
+
+func errorRate(errors, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(errors) / float64(total)
+}
@@ -0,0 +1,81 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_ActivityReport(t *testing.T) {
+	tt := TT{t}
+
+	s := NewFingerprintStats(10*time.Millisecond, 100*time.Millisecond)
+	hook := s.Hooks().AfterQueryHook
+	for idx := 0; idx < 8; idx++ {
+		hook(QueryEvent{Query: `SELECT * FROM users u JOIN "groups" g ON g.id = u.group_id WHERE u.id = 1`, Duration: 5 * time.Millisecond, Rows: 1})
+	}
+	hook(QueryEvent{Query: `UPDATE users SET name = 'foo' WHERE id = 1`, Duration: 50 * time.Millisecond, Rows: 1})
+	hook(QueryEvent{Query: `INSERT INTO audit VALUES (1, 'bar')`, Duration: 20 * time.Millisecond, Err: errors.New("locked")})
+
+	report := s.Report(2) //"audit" is not listed since it is not among the top 2
+	if report.Start.After(report.End) {
+		t.Errorf("expected Start <= End, got %s > %s", report.Start, report.End)
+	}
+	report.Start, report.End = time.Time{}, time.Time{}
+
+	expected := ActivityReport{
+		Statements:   10,
+		Errors:       1,
+		ErrorRate:    0.1,
+		TotalSeconds: 0.11,
+		Latency:      LatencyPercentiles{P50: 0.00625, P90: 0.055, P99: 0.0955},
+		BusiestFingerprints: []FingerprintReport{
+			{
+				Fingerprint:  `UPDATE users SET name = ? WHERE id = ?`,
+				Calls:        1,
+				Rows:         1,
+				TotalSeconds: 0.05,
+				MeanSeconds:  0.05,
+				Latency:      LatencyPercentiles{P50: 0.055, P90: 0.091, P99: 0.0991},
+			},
+			{
+				Fingerprint:  `SELECT * FROM users u JOIN "groups" g ON g.id = u.group_id WHERE u.id = ?`,
+				Calls:        8,
+				Rows:         8,
+				TotalSeconds: 0.04,
+				MeanSeconds:  0.005,
+				Latency:      LatencyPercentiles{P50: 0.005, P90: 0.009, P99: 0.0099},
+			},
+		},
+		BusiestTables: []TableReport{
+			{Table: "users", Calls: 9, TotalSeconds: 0.09},
+			{Table: "groups", Calls: 8, TotalSeconds: 0.04},
+		},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		actualJSON, _ := json.MarshalIndent(report, "", "  ")
+		expectedJSON, _ := json.MarshalIndent(expected, "", "  ")
+		tt.Unexpected("report", string(expectedJSON), string(actualJSON))
+	}
+}
@@ -0,0 +1,142 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"sync"
+)
+
+//RequestTrace collects all statements and transactions that are executed
+//under a given context (see BeginRequestTrace), e.g. to render a debug panel
+//that lists all statements executed while serving a web request.
+type RequestTrace struct {
+	mutex sync.Mutex
+	nodes []*traceNode
+}
+
+//TraceNode is a transaction or statement in a RequestTrace. Exactly one of
+//Statement and Transaction is set.
+type TraceNode struct {
+	//Statement is set for statements. Statements within a transaction appear
+	//as children of the transaction, all others appear on the top level.
+	Statement *QueryEvent
+	//Transaction is set for transactions. While the transaction is still
+	//running, only ConnectionID, Fields and Tenant are filled. The remaining
+	//fields are filled once the transaction has been committed or rolled
+	//back, and Finished is set to true.
+	Transaction *TransactionEvent
+	Finished    bool
+	//Children contains the statements executed within a transaction.
+	Children []TraceNode
+}
+
+type traceNode struct {
+	statement   *QueryEvent
+	transaction *TransactionEvent
+	finished    bool
+	children    []*traceNode
+}
+
+//BeginRequestTrace starts collecting a RequestTrace. All statements executed
+//with the returned context (or a context derived from it), and all
+//transactions started with it, are recorded in the returned trace:
+//
+//	func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+//		ctx, trace := sqlproxy.BeginRequestTrace(r.Context())
+//		h.serve(w, r.WithContext(ctx))
+//		h.renderDebugPanel(w, trace.Nodes())
+//	}
+//
+//Statements within a transaction are recorded if the transaction was started
+//with the returned context, even if the statements themselves are executed
+//with a different context. Statements are recorded when they have finished,
+//i.e. for queries, when their rows are closed. Transactions are recorded when
+//they are started.
+func BeginRequestTrace(ctx context.Context) (context.Context, *RequestTrace) {
+	trace := &RequestTrace{}
+	return context.WithValue(ctx, requestTraceKey{}, trace), trace
+}
+
+type requestTraceKey struct{}
+
+func requestTraceFromContext(ctx context.Context) *RequestTrace {
+	trace, _ := ctx.Value(requestTraceKey{}).(*RequestTrace)
+	return trace
+}
+
+//Nodes returns a snapshot of the transactions and statements recorded so far,
+//in the order in which they were recorded.
+func (t *RequestTrace) Nodes() []TraceNode {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return snapshotTraceNodes(t.nodes)
+}
+
+func snapshotTraceNodes(nodes []*traceNode) []TraceNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	result := make([]TraceNode, len(nodes))
+	for idx, n := range nodes {
+		result[idx] = TraceNode{Finished: n.finished, Children: snapshotTraceNodes(n.children)}
+		if n.statement != nil {
+			e := *n.statement
+			result[idx].Statement = &e
+		}
+		if n.transaction != nil {
+			e := *n.transaction
+			result[idx].Transaction = &e
+		}
+	}
+	return result
+}
+
+//addStatement records a statement, either within the given transaction node
+//(if not nil) or on the top level.
+func (t *RequestTrace) addStatement(parent *traceNode, e QueryEvent) {
+	e = e.detached()
+	n := &traceNode{statement: &e, finished: true}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if parent == nil {
+		t.nodes = append(t.nodes, n)
+	} else {
+		parent.children = append(parent.children, n)
+	}
+}
+
+//addTransaction records the start of a transaction.
+func (t *RequestTrace) addTransaction(e TransactionEvent) *traceNode {
+	n := &traceNode{transaction: &e}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.nodes = append(t.nodes, n)
+	return n
+}
+
+//finishTransaction records the end of a transaction.
+func (t *RequestTrace) finishTransaction(n *traceNode, e TransactionEvent) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	*n.transaction = e
+	n.finished = true
+}
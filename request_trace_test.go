@@ -0,0 +1,84 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func Test_RequestTrace(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	db := sql.OpenDB(NewConnector(New("sqlite3"), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`)) //not traced
+
+	ctx, trace := BeginRequestTrace(context.Background())
+	tt.MustResult(db.ExecContext(ctx, `INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`))
+	tx, err := db.BeginTx(ctx, nil)
+	tt.Must(err)
+	tt.MustResult(tx.Exec(`UPDATE knowledge SET thing = 'lie' WHERE number = $1`, 23))
+	rows := tt.MustRows(tx.Query(`SELECT * FROM knowledge`))
+	for rows.Next() {
+	}
+	tt.Must(rows.Close())
+
+	//snapshot while the transaction is still running
+	nodes := trace.Nodes()
+	if len(nodes) != 2 || nodes[1].Transaction == nil || nodes[1].Finished || len(nodes[1].Children) != 2 {
+		t.Errorf("unexpected snapshot during transaction: %#v", nodes)
+	}
+
+	tt.Must(tx.Commit())
+	var count int
+	tt.Must(db.QueryRowContext(ctx, `SELECT COUNT(*) FROM knowledge`).Scan(&count))
+	tt.Must(db.Close())
+
+	var actual []string
+	var render func(indent string, nodes []TraceNode)
+	render = func(indent string, nodes []TraceNode) {
+		for _, n := range nodes {
+			if n.Statement != nil {
+				actual = append(actual, fmt.Sprintf("%s%s -> %d rows", indent, n.Statement.Query, n.Statement.Rows))
+			} else {
+				actual = append(actual, fmt.Sprintf("%stransaction (finished = %t, %d statements)", indent, n.Finished, n.Transaction.Statements))
+				render(indent+"  ", n.Children)
+			}
+		}
+	}
+	render("", trace.Nodes())
+
+	expected := []string{
+		"INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth') -> 2 rows",
+		"transaction (finished = true, 2 statements)",
+		"  UPDATE knowledge SET thing = 'lie' WHERE number = $1 -> 1 rows",
+		"  SELECT * FROM knowledge -> 2 rows",
+		"SELECT COUNT(*) FROM knowledge -> 1 rows",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("trace", expected, actual)
+	}
+
+	tt.CleanupDB()
+}
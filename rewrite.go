@@ -0,0 +1,156 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+//RewriteRule is a rule for a Rewriter. Exactly one of Pattern and Prefix must
+//be set.
+type RewriteRule struct {
+	//Pattern is a regular expression. Each match of it is replaced by the
+	//Replacement, in which $1, ${name} etc. refer to capture groups (see
+	//regexp.Regexp.Expand).
+	Pattern string
+	//Prefix matches statements that start with this string. The prefix is
+	//replaced by the Replacement verbatim.
+	Prefix string
+	//Replacement is the template for the rewritten part of the statement.
+	Replacement string
+}
+
+//Rewriter applies a list of RewriteRules to each statement before it is
+//prepared. The rules are applied in order, so later rules see the statement
+//as rewritten by earlier rules. For example:
+//
+//	rw, err := sqlproxy.NewRewriter(
+//		sqlproxy.RewriteRule{Pattern: `\bFROM users_v1\b`, Replacement: "FROM users_v2"},
+//		sqlproxy.RewriteRule{Prefix: "SELECT ", Replacement: "SELECT /*+ MAX_EXECUTION_TIME(1000) */ "},
+//	)
+//	...
+//	sql.Register("postgres-with-rewrites", sqlproxy.New("postgres", sqlproxy.WithRewriter(rw)))
+//
+//Unlike the "rewrite" action of Rules, which is loaded from a file, a Rewriter
+//is configured in code and counts how often each rule matched.
+type Rewriter struct {
+	rules []rewriteRule
+}
+
+type rewriteRule struct {
+	spec    RewriteRule
+	rx      *regexp.Regexp
+	matches atomic.Uint64
+}
+
+//NewRewriter compiles the given rules into a Rewriter. An error is returned
+//if a rule does not have exactly one of Pattern and Prefix, or if a Pattern is
+//not a valid regular expression.
+func NewRewriter(rules ...RewriteRule) (*Rewriter, error) {
+	r := &Rewriter{rules: make([]rewriteRule, len(rules))}
+	for idx, spec := range rules {
+		r.rules[idx].spec = spec
+		switch {
+		case spec.Pattern != "" && spec.Prefix != "":
+			return nil, fmt.Errorf("sqlproxy: rewrite rule %d: Pattern and Prefix cannot be given at the same time", idx+1)
+		case spec.Pattern != "":
+			rx, err := regexp.Compile(spec.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("sqlproxy: rewrite rule %d: %w", idx+1, err)
+			}
+			r.rules[idx].rx = rx
+		case spec.Prefix == "":
+			return nil, fmt.Errorf("sqlproxy: rewrite rule %d: either Pattern or Prefix must be given", idx+1)
+		}
+	}
+	return r, nil
+}
+
+//Rewrite applies all rules to the given query and returns the result.
+func (r *Rewriter) Rewrite(query string) string {
+	for idx := range r.rules {
+		rule := &r.rules[idx]
+		if rule.rx != nil {
+			if !rule.rx.MatchString(query) {
+				continue
+			}
+			query = rule.rx.ReplaceAllString(query, rule.spec.Replacement)
+		} else {
+			if !strings.HasPrefix(query, rule.spec.Prefix) {
+				continue
+			}
+			query = rule.spec.Replacement + strings.TrimPrefix(query, rule.spec.Prefix)
+		}
+		rule.matches.Add(1)
+	}
+	return query
+}
+
+//MatchCounts returns how many statements were rewritten by each rule, indexed
+//like the rules given to NewRewriter().
+func (r *Rewriter) MatchCounts() []uint64 {
+	result := make([]uint64, len(r.rules))
+	for idx := range r.rules {
+		result[idx] = r.rules[idx].matches.Load()
+	}
+	return result
+}
+
+//Hooks returns a BeforePrepareHook that applies this Rewriter. To combine it
+//with other hooks, use the WithRewriter() option.
+func (r *Rewriter) Hooks() Hooks {
+	return Hooks{
+		BeforePrepareHook: func(query string) (string, error) {
+			return r.Rewrite(query), nil
+		},
+	}
+}
+
+//InjectLimit returns a BeforePrepareHook that appends "LIMIT max" to SELECT
+//statements that do not have a LIMIT (or FETCH FIRST) clause, to keep
+//interactive services from accidentally streaming huge result sets.
+//Statements that shall return all rows can be exempted by including the
+//given marker, e.g. a comment like "/* full scan */". Statements with locking
+//clauses like FOR UPDATE are not modified, since the position of LIMIT
+//relative to these clauses differs between databases.
+//
+//	sql.Register("postgres-limited", sqlproxy.New("postgres",
+//		sqlproxy.WithBeforePrepare(sqlproxy.InjectLimit(1000, "/* full scan */")),
+//	))
+func InjectLimit(max int, marker string) func(query string) (string, error) {
+	limitClause := "\nLIMIT " + strconv.Itoa(max)
+	return func(query string) (string, error) {
+		if StatementType(query) != "select" || (marker != "" && strings.Contains(query, marker)) {
+			return query, nil
+		}
+		normalized := Normalize(query)
+		if lockingReadRx.MatchString(normalized) || hasTopLevelKeyword(normalized, limitKeywordRx) {
+			return query, nil
+		}
+		//the LIMIT goes on a separate line in case the query ends in a "--" comment
+		return strings.TrimRight(query, "; \t\r\n") + limitClause, nil
+	}
+}
+
+var limitKeywordRx = regexp.MustCompile(`(?i)\b(?:LIMIT|FETCH\s+(?:FIRST|NEXT))\b`)
@@ -0,0 +1,99 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func Test_Rewriter(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	rw, err := NewRewriter(
+		RewriteRule{Pattern: `\bFROM v(\d+)\b`, Replacement: "FROM knowledge /* v$1 */"},
+		RewriteRule{Prefix: "SELECT thing ", Replacement: "SELECT UPPER(thing) "},
+		RewriteRule{Prefix: "DELETE ", Replacement: "-- "},
+	)
+	tt.Must(err)
+
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithRewriter(rw)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES (42, 'truth')`))
+
+	var number int
+	tt.Must(db.QueryRow(`SELECT number FROM v1 WHERE thing = $1`, "truth").Scan(&number))
+	if number != 42 {
+		tt.Unexpected("number", 42, number)
+	}
+	var thing string
+	tt.Must(db.QueryRow(`SELECT thing FROM v2 WHERE number = $1`, 42).Scan(&thing))
+	if thing != "TRUTH" {
+		tt.Unexpected("thing", "TRUTH", thing)
+	}
+
+	expected := []uint64{2, 1, 0}
+	if actual := rw.MatchCounts(); !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("match counts", expected, actual)
+	}
+	if actual := rw.Rewrite(`SELECT thing FROM v3`); actual != `SELECT UPPER(thing) FROM knowledge /* v3 */` {
+		tt.Unexpected("rewritten query", `SELECT UPPER(thing) FROM knowledge /* v3 */`, actual)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_RewriterInvalidRules(t *testing.T) {
+	invalidRules := []RewriteRule{
+		{Replacement: "SELECT 1"},
+		{Pattern: "^SELECT", Prefix: "SELECT", Replacement: "SELECT 1"},
+		{Pattern: "(", Replacement: "SELECT 1"},
+	}
+	for _, rule := range invalidRules {
+		if _, err := NewRewriter(rule); err == nil {
+			t.Errorf("expected NewRewriter(%#v) to fail, but it succeeded", rule)
+		}
+	}
+}
+
+func Test_InjectLimit(t *testing.T) {
+	hook := InjectLimit(100, "/* full scan */")
+	testCases := map[string]string{
+		`SELECT * FROM users`:                                             "SELECT * FROM users\nLIMIT 100",
+		"SELECT * FROM users;\n":                                          "SELECT * FROM users\nLIMIT 100",
+		`SELECT * FROM users -- all of them`:                              "SELECT * FROM users -- all of them\nLIMIT 100",
+		`SELECT * FROM users WHERE id IN (SELECT user_id FROM t LIMIT 5)`: "SELECT * FROM users WHERE id IN (SELECT user_id FROM t LIMIT 5)\nLIMIT 100",
+		`SELECT * FROM users LIMIT 10`:                                    `SELECT * FROM users LIMIT 10`,
+		`SELECT * FROM users FETCH FIRST 10 ROWS ONLY`:                    `SELECT * FROM users FETCH FIRST 10 ROWS ONLY`,
+		`SELECT * FROM jobs FOR UPDATE`:                                   `SELECT * FROM jobs FOR UPDATE`,
+		`SELECT * FROM users /* full scan */`:                             `SELECT * FROM users /* full scan */`,
+		`DELETE FROM users`:                                               `DELETE FROM users`,
+	}
+	for query, expected := range testCases {
+		actual, err := hook(query)
+		TT{t}.Must(err)
+		if actual != expected {
+			TT{t}.Unexpected("result for "+query, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+//RowsBuilder constructs a driver.Rows from column names and values, e.g. for
+//Interception.Rows or for fake drivers in tests:
+//
+//	rows, err := sqlproxy.NewRowsBuilder("id", "name", "created_at").
+//		DatabaseTypes("INTEGER", "TEXT", "TIMESTAMP").
+//		Row(1, "alice", createdAt).
+//		Row(2, nil, createdAt).
+//		Build()
+//
+//Values are converted like the arguments of sql.DB.Exec() (see
+//driver.DefaultParameterConverter), so e.g. an int becomes an int64. The
+//resulting driver.Rows reports type metadata through the optional
+//driver.RowsColumnType... interfaces, and thus through sql.Rows.ColumnTypes():
+//The scan type of each column is the type of its first non-NULL value, and a
+//column is nullable if it contains a NULL value.
+//
+//Errors (e.g. a row with the wrong number of values) are collected and
+//returned by Build().
+type RowsBuilder struct {
+	columns   []string
+	typeNames []string
+	rows      [][]driver.Value
+	err       error
+}
+
+//NewRowsBuilder returns a RowsBuilder for a result set with the given column
+//names.
+func NewRowsBuilder(columns ...string) *RowsBuilder {
+	return &RowsBuilder{columns: columns}
+}
+
+//DatabaseTypes sets the database type names of all columns, as reported by
+//sql.ColumnType.DatabaseTypeName(). Without it, empty type names are reported.
+func (b *RowsBuilder) DatabaseTypes(typeNames ...string) *RowsBuilder {
+	if b.err == nil && len(typeNames) != len(b.columns) {
+		b.err = fmt.Errorf("sqlproxy: got %d database types, but there are %d columns", len(typeNames), len(b.columns))
+	}
+	b.typeNames = typeNames
+	return b
+}
+
+//Row appends a row with one value per column.
+func (b *RowsBuilder) Row(values ...interface{}) *RowsBuilder {
+	if b.err != nil {
+		return b
+	}
+	rowIdx := len(b.rows)
+	if len(values) != len(b.columns) {
+		b.err = fmt.Errorf("sqlproxy: row %d has %d values, but there are %d columns", rowIdx, len(values), len(b.columns))
+		return b
+	}
+	row := make([]driver.Value, len(values))
+	for idx, value := range values {
+		converted, err := driver.DefaultParameterConverter.ConvertValue(value)
+		if err != nil {
+			b.err = fmt.Errorf("sqlproxy: cannot convert value for column %q in row %d: %w", b.columns[idx], rowIdx, err)
+			return b
+		}
+		row[idx] = converted
+	}
+	b.rows = append(b.rows, row)
+	return b
+}
+
+//Rows appends multiple rows, each with one value per column.
+func (b *RowsBuilder) Rows(rows [][]interface{}) *RowsBuilder {
+	for _, row := range rows {
+		b.Row(row...)
+	}
+	return b
+}
+
+//Build returns the driver.Rows, or the first error that occurred while
+//building it. The driver.Rows can only be read once, but Build() can be called
+//multiple times to obtain fresh copies.
+func (b *RowsBuilder) Build() (driver.Rows, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return newStaticRows(b.columns, b.typeNames, b.rows), nil
+}
+
+//staticRows is the driver.Rows implementation returned by RowsBuilder and
+//StaticRows(), and used by ReplayDriver.
+type staticRows struct {
+	columns []string
+	rows    [][]driver.Value
+	//returned instead of io.EOF after the last row, if set
+	err error
+	//type metadata for each column (typeNames may be nil)
+	typeNames []string
+	scanTypes []reflect.Type
+	nullable  []bool
+}
+
+func newStaticRows(columns, typeNames []string, rows [][]driver.Value) *staticRows {
+	r := &staticRows{
+		columns:   columns,
+		rows:      rows,
+		typeNames: typeNames,
+		scanTypes: make([]reflect.Type, len(columns)),
+		nullable:  make([]bool, len(columns)),
+	}
+	for _, row := range rows {
+		for idx, value := range row {
+			if idx >= len(columns) {
+				break
+			}
+			if value == nil {
+				r.nullable[idx] = true
+			} else if r.scanTypes[idx] == nil {
+				r.scanTypes[idx] = reflect.TypeOf(value)
+			}
+		}
+	}
+	return r
+}
+
+func (r *staticRows) Columns() []string {
+	return r.columns
+}
+
+func (r *staticRows) Close() error {
+	return nil
+}
+
+func (r *staticRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+//ColumnTypeDatabaseTypeName implements the
+//driver.RowsColumnTypeDatabaseTypeName interface.
+func (r *staticRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index >= len(r.typeNames) {
+		return ""
+	}
+	return r.typeNames[index]
+}
+
+//ColumnTypeScanType implements the driver.RowsColumnTypeScanType interface.
+func (r *staticRows) ColumnTypeScanType(index int) reflect.Type {
+	if index >= len(r.scanTypes) || r.scanTypes[index] == nil {
+		return reflect.TypeFor[interface{}]()
+	}
+	return r.scanTypes[index]
+}
+
+//ColumnTypeNullable implements the driver.RowsColumnTypeNullable interface.
+func (r *staticRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if index >= len(r.nullable) {
+		return false, false
+	}
+	return r.nullable[index], true
+}
@@ -0,0 +1,103 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_RowsBuilder(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	createdAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	builder := NewRowsBuilder("id", "name", "created_at").
+		DatabaseTypes("INTEGER", "TEXT", "TIMESTAMP").
+		Row(1, "alice", createdAt).
+		Rows([][]interface{}{{2, nil, createdAt}})
+	d := New("sqlite3", WithInterceptHook(func(ctx context.Context, query string, args []interface{}) *Interception {
+		rows, err := builder.Build()
+		return &Interception{Rows: rows, Err: err}
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+
+	//the same builder can serve multiple result sets
+	for range 2 {
+		rows := tt.MustRows(db.Query(`SELECT id, name, created_at FROM users`))
+		columnTypes, err := rows.ColumnTypes()
+		tt.Must(err)
+		var actualTypes []string
+		for _, ct := range columnTypes {
+			nullable, ok := ct.Nullable()
+			actualTypes = append(actualTypes, ct.Name()+" "+ct.DatabaseTypeName()+" "+ct.ScanType().String()+
+				map[bool]string{true: " NULL", false: " NOT NULL"}[nullable && ok])
+		}
+		expectedTypes := []string{
+			"id INTEGER int64 NOT NULL",
+			"name TEXT string NULL",
+			"created_at TIMESTAMP time.Time NOT NULL",
+		}
+		if !reflect.DeepEqual(actualTypes, expectedTypes) {
+			tt.Unexpected("column types", expectedTypes, actualTypes)
+		}
+
+		var actualRows []string
+		for rows.Next() {
+			var (
+				id        int64
+				name      sql.NullString
+				createdAt time.Time
+			)
+			tt.Must(rows.Scan(&id, &name, &createdAt))
+			actualRows = append(actualRows, fmt.Sprintf("%d %q %s", id, name.String, createdAt.Format(time.RFC3339)))
+		}
+		tt.Must(rows.Err())
+		tt.Must(rows.Close())
+		expectedRows := []string{
+			`1 "alice" 2026-01-01T12:00:00Z`,
+			`2 "" 2026-01-01T12:00:00Z`,
+		}
+		if !reflect.DeepEqual(actualRows, expectedRows) {
+			tt.Unexpected("rows", expectedRows, actualRows)
+		}
+	}
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_RowsBuilderErrors(t *testing.T) {
+	testCases := map[string]*RowsBuilder{
+		"row 1 has 1 values, but there are 2 columns":     NewRowsBuilder("id", "name").Row(1, "alice").Row(2),
+		"got 1 database types, but there are 2 columns":   NewRowsBuilder("id", "name").DatabaseTypes("INTEGER"),
+		`cannot convert value for column "name" in row 0`: NewRowsBuilder("id", "name").Row(1, struct{}{}),
+	}
+	for expected, builder := range testCases {
+		_, err := builder.Build()
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q, got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//RowSecurity implements row-level security in the proxy (see
+//Driver.RowSecurity), as a defense in depth for multi-tenant applications on
+//databases without native row-level security. SELECT, UPDATE and DELETE
+//statements on the tables in Predicates are rewritten to include the table's
+//predicate, with the value for the predicate taken from the context of each
+//statement:
+//
+//	d.RowSecurity = &sqlproxy.RowSecurity{
+//		Predicates: map[string]string{
+//			"projects": "org_id = ?",
+//			"invoices": "org_id = ?",
+//		},
+//		Value: func(ctx context.Context) interface{} {
+//			return orgIDFromContext(ctx) //e.g. int64(42)
+//		},
+//	}
+//
+//With this, "SELECT * FROM projects p WHERE p.name = $1" is executed as
+//"SELECT * FROM projects p WHERE (p.org_id = $1) AND (p.name = $2)", with the
+//organization ID from the context as an additional argument. As in this
+//example, placeholders may be renumbered. The new placeholders are written in
+//the style given by Driver.Placeholders or, if not set, in the style of the
+//existing placeholders in the statement ("?" if there are none). The rewrite
+//follows the same rules as SoftDeleteFilter(). INSERT statements are not
+//rewritten.
+//
+//The rewrite only covers tables in the outermost FROM, JOIN and UPDATE
+//clauses. Statements that refer to protected tables anywhere else, e.g. in a
+//subquery, a derived table, a common table expression (WITH) or in INSERT
+//... SELECT, fail with a PolicyError instead of being executed without the
+//predicate. So do all other types of statements that refer to protected
+//tables (e.g. TRUNCATE, MERGE, COPY, but also DDL, so migrations need to use
+//WithoutRowSecurity()), and all statements that contain more than one
+//statement separated by semicolons.
+//
+//Statements on protected tables fail with a PolicyError if Value returns nil,
+//except for statements executed with a context from WithoutRowSecurity(),
+//which are not rewritten at all. For prepared statements, the value is taken from
+//the context of each execution, but whether the statement is rewritten is
+//decided when it is prepared.
+type RowSecurity struct {
+	//Predicates maps table names to predicate templates. In the template, "?"
+	//stands for the value from the context (regardless of the placeholder
+	//style of the database), and "{table}" for the name or alias of the table
+	//in the statement. If the template does not contain "{table}", the table
+	//name or alias is prepended, so "org_id = ?" is equivalent to
+	//"{table}.org_id = ?".
+	Predicates map[string]string
+	//Value returns the value that is bound to the "?" in the predicates, e.g.
+	//the organization ID of the current request.
+	Value func(ctx context.Context) interface{}
+}
+
+//WithoutRowSecurity returns a context that exempts statements from
+//Driver.RowSecurity, e.g. for background jobs that process the data of all
+//tenants.
+func WithoutRowSecurity(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rowSecurityBypassKey{}, true)
+}
+
+type rowSecurityBypassKey struct{}
+
+//the name of the placeholder for RowSecurity.Value before placeholder
+//translation
+const rowSecurityArgName = "sqlproxy_row_security"
+
+//rowSecurityRewrite is the result of connection.applyRowSecurity.
+type rowSecurityRewrite struct {
+	query string
+	//the translation from the ":sqlproxy_row_security" placeholder into the
+	//placeholder style of the statement, or nil if no translation is needed
+	translation *placeholderTranslation
+	value       func(ctx context.Context) interface{}
+}
+
+//applyRowSecurity implements Driver.RowSecurity. If the statement does not
+//need to be rewritten, nil is returned. If the statement refers to protected
+//tables in positions that cannot be rewritten, a PolicyError is returned.
+func (c *connection) applyRowSecurity(ctx context.Context, query string) (*rowSecurityRewrite, error) {
+	rs := c.driver.RowSecurity
+	if rs == nil {
+		return nil, nil
+	}
+	if bypass, _ := ctx.Value(rowSecurityBypassKey{}).(bool); bypass {
+		return nil, nil
+	}
+	if isStackedStatement(query) {
+		return nil, PolicyError{Query: query, Reason: "row security cannot be applied to multiple statements"}
+	}
+
+	predicates := make(map[string]string, len(rs.Predicates))
+	for table, template := range rs.Predicates {
+		predicates[strings.ToLower(table)] = template
+	}
+	placeholder := ":" + rowSecurityArgName
+	rewrittenRefs := make(map[string]int)
+	predicateFor := func(table, qualifier string) (string, bool) {
+		template, exists := predicates[table]
+		if !exists {
+			return "", false
+		}
+		rewrittenRefs[table]++
+		if !strings.Contains(template, "{table}") {
+			template = "{table}." + template
+		}
+		template = strings.ReplaceAll(template, "{table}", qualifier)
+		return "(" + strings.ReplaceAll(template, "?", placeholder) + ")", true
+	}
+	protectedName := func(name string) (string, bool) {
+		if _, exists := predicates[name]; !exists {
+			if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+				name = name[dot+1:]
+			}
+		}
+		_, exists := predicates[name]
+		return name, exists
+	}
+
+	rewritten := query
+	switch StatementType(query) {
+	case "select", "update", "delete":
+		rewritten = injectPredicates(query, predicateFor)
+	case "insert", "with":
+		//not rewritten, but reads from protected tables are rejected below
+	default:
+		for _, ref := range ExtractTables(query) {
+			if name, exists := protectedName(strings.ToLower(ref.Table)); exists {
+				return nil, PolicyError{Query: query, Reason: "row security cannot be applied to table " + name + " in this type of statement"}
+			}
+		}
+	}
+
+	//fail closed if a protected table appears anywhere that the rewrite did
+	//not cover
+	refs := make(map[string]int)
+	for name, count := range tableReadCounts(query) {
+		if name, exists := protectedName(name); exists {
+			refs[name] += count
+		}
+	}
+	tables := make([]string, 0, len(refs))
+	for table := range refs {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		if refs[table] > rewrittenRefs[table] {
+			return nil, PolicyError{Query: query, Reason: "row security cannot be applied to table " + table + " in this position"}
+		}
+	}
+
+	if rewritten == query {
+		return nil, nil
+	}
+
+	//write the new placeholders in the style of the existing ones
+	style := c.driver.Placeholders
+	if style == "" {
+		style = PlaceholderQuestion
+		if matches := findPlaceholders(query); len(matches) > 0 {
+			style = PlaceholderStyle(query[matches[0].start : matches[0].start+1])
+		}
+	}
+	r := &rowSecurityRewrite{query: rewritten, value: rs.Value}
+	if t := translatePlaceholders(rewritten, style); t != nil {
+		r.query, r.translation = t.query, t
+	}
+	return r, nil
+}
+
+//isStackedStatement returns whether the given query contains more than one
+//statement.
+func isStackedStatement(query string) bool {
+	tokens := tokenizeSQL(query)
+	for idx, token := range tokens {
+		if token.text == ";" && idx < len(tokens)-1 {
+			return true
+		}
+	}
+	return false
+}
+
+//tableReadCounts counts how often each table appears after FROM, JOIN or
+//UPDATE (or after a comma in a FROM list or UPDATE table list) in the given
+//statement, at any nesting depth. Table names are lowercased and unquoted like in
+//injectPredicates.
+func tableReadCounts(query string) map[string]int {
+	tokens := tokenizeSQL(query)
+	result := make(map[string]int)
+	//indexed by nesting depth
+	inFromList := []bool{false}
+	expectTable := false
+	prevKeyword := ""
+	for idx := 0; idx < len(tokens); idx++ {
+		token := tokens[idx]
+		switch token.text {
+		case "(":
+			inFromList = append(inFromList, false)
+			expectTable = false
+			continue
+		case ")":
+			if len(inFromList) > 1 {
+				inFromList = inFromList[:len(inFromList)-1]
+			}
+			continue
+		}
+		depth := len(inFromList) - 1
+		keyword := ""
+		if token.kind == sqlTokenWord {
+			keyword = strings.ToUpper(token.text)
+		}
+		lastKeyword := prevKeyword
+		prevKeyword = keyword
+
+		switch {
+		case keyword == "FROM":
+			inFromList[depth], expectTable = true, true
+		case keyword == "UPDATE":
+			//"UPDATE a, b SET ..." (but not "FOR UPDATE", "DO UPDATE" etc.)
+			isTableList := lastKeyword != "FOR" && lastKeyword != "DO" && lastKeyword != "KEY"
+			inFromList[depth], expectTable = isTableList, true
+		case keyword == "JOIN" || keyword == "STRAIGHT_JOIN":
+			inFromList[depth], expectTable = false, true
+		case token.text == "," && inFromList[depth]:
+			expectTable = true
+		case keyword == "WHERE" || keyword == "SET" || whereClauseEnd[keyword] || setOperationKeywords[keyword]:
+			inFromList[depth], expectTable = false, false
+		case expectTable && keyword == "ONLY":
+			//"FROM ONLY table" (PostgreSQL): the table name follows
+		case expectTable && (keyword != "" || strings.HasPrefix(token.text, `"`) || strings.HasPrefix(token.text, "`")):
+			expectTable = false
+			if joinKeywords[keyword] {
+				continue
+			}
+			unquote := strings.NewReplacer(`"`, "", "`", "")
+			name := unquote.Replace(strings.ToLower(token.text))
+			for idx+2 < len(tokens) && tokens[idx+1].text == "." {
+				idx += 2
+				name += "." + unquote.Replace(strings.ToLower(tokens[idx].text))
+			}
+			result[name]++
+		}
+	}
+	return result
+}
+
+//args adds the value from the context to the given arguments, and arranges
+//them in the order that the rewritten query expects them.
+func (r *rowSecurityRewrite) args(ctx context.Context, args []driver.NamedValue) ([]driver.NamedValue, error) {
+	var value interface{}
+	if r.value != nil {
+		value = r.value(ctx)
+	}
+	if value == nil {
+		return nil, PolicyError{Query: r.query, Reason: "no row security value in context"}
+	}
+	value, err := driver.DefaultParameterConverter.ConvertValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("sqlproxy: cannot convert row security value: %w", err)
+	}
+	args = append(args[:len(args):len(args)], driver.NamedValue{
+		Name:    rowSecurityArgName,
+		Ordinal: len(args) + 1,
+		Value:   value,
+	})
+	if r.translation == nil {
+		return args, nil
+	}
+	return r.translation.args(args)
+}
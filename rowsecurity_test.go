@@ -0,0 +1,207 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type orgIDKey struct{}
+
+func Test_RowSecurity(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var queries []string
+	d := New("sqlite3",
+		WithRowSecurity(&RowSecurity{
+			Predicates: map[string]string{
+				"projects": "org_id = ?",
+				"Members":  "{table}.org_id = ? OR {table}.org_id IS NULL",
+			},
+			Value: func(ctx context.Context) interface{} {
+				return ctx.Value(orgIDKey{})
+			},
+		}),
+		WithAfterQuery(func(e QueryEvent) { queries = append(queries, e.Query) }),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	//DDL on protected tables requires an explicit bypass
+	_, err := db.Exec(`CREATE TABLE projects (org_id INTEGER, name TEXT)`)
+	var perr PolicyError
+	if !errors.As(err, &perr) {
+		t.Errorf("expected PolicyError for CREATE TABLE, got %#v", err)
+	}
+	migrationCtx := WithoutRowSecurity(context.Background())
+	tt.MustResult(db.ExecContext(migrationCtx, `CREATE TABLE projects (org_id INTEGER, name TEXT)`))
+	tt.MustResult(db.ExecContext(migrationCtx, `CREATE TABLE members (org_id INTEGER, name TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO projects VALUES (1, 'a'), (1, 'b'), (2, 'c')`))
+	tt.MustResult(db.Exec(`INSERT INTO members VALUES (1, 'alice'), (2, 'bob'), (NULL, 'root')`))
+
+	ctx := context.WithValue(context.Background(), orgIDKey{}, 1)
+	queryNames := func(ctx context.Context, query string, args ...interface{}) []string {
+		t.Helper()
+		rows := tt.MustRows(db.QueryContext(ctx, query, args...))
+		var names []string
+		for rows.Next() {
+			var name string
+			tt.Must(rows.Scan(&name))
+			names = append(names, name)
+		}
+		tt.Must(rows.Err())
+		tt.Must(rows.Close())
+		return names
+	}
+
+	names := queryNames(ctx, `SELECT name FROM projects WHERE name <> ? ORDER BY name`, "b")
+	if !reflect.DeepEqual(names, []string{"a"}) {
+		tt.Unexpected("projects", []string{"a"}, names)
+	}
+	names = queryNames(ctx, `SELECT m.name FROM members m ORDER BY m.name`)
+	if !reflect.DeepEqual(names, []string{"alice", "root"}) {
+		tt.Unexpected("members", []string{"alice", "root"}, names)
+	}
+	names = queryNames(WithoutRowSecurity(context.Background()), `SELECT name FROM projects ORDER BY name`)
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		tt.Unexpected("projects without row security", []string{"a", "b", "c"}, names)
+	}
+
+	//prepared statements take the value from the context of each execution
+	stmt, err := db.PrepareContext(ctx, `UPDATE projects SET name = ? WHERE name = ?`)
+	tt.Must(err)
+	tt.MustResult(stmt.ExecContext(context.WithValue(ctx, orgIDKey{}, 2), "x", "a"))
+	tt.MustResult(stmt.ExecContext(context.WithValue(ctx, orgIDKey{}, 2), "y", "c"))
+	tt.Must(stmt.Close())
+	names = queryNames(WithoutRowSecurity(context.Background()), `SELECT name FROM projects ORDER BY name`)
+	if !reflect.DeepEqual(names, []string{"a", "b", "y"}) {
+		tt.Unexpected("projects after UPDATE", []string{"a", "b", "y"}, names)
+	}
+
+	//without a value in the context, statements on protected tables fail
+	_, err = db.Exec(`DELETE FROM projects`)
+	if !errors.As(err, &perr) || perr.Reason != "no row security value in context" {
+		t.Errorf("expected PolicyError for missing row security value, got %#v", err)
+	}
+
+	//protected tables in positions that the rewrite does not cover are
+	//rejected instead of being read without the predicate
+	for _, query := range []string{
+		`SELECT * FROM users WHERE id IN (SELECT owner_id FROM projects)`,
+		`SELECT * FROM (SELECT * FROM projects) p`,
+		`WITH x AS (SELECT * FROM projects) SELECT * FROM x`,
+		`INSERT INTO members SELECT * FROM projects`,
+	} {
+		_, err := db.QueryContext(ctx, query)
+		if !errors.As(err, &perr) || perr.Reason != "row security cannot be applied to table projects in this position" {
+			t.Errorf("expected PolicyError for %q, got %#v", query, err)
+		}
+	}
+	//...but not when row security is bypassed
+	names = queryNames(WithoutRowSecurity(ctx), `SELECT name FROM (SELECT * FROM projects) p ORDER BY name`)
+	if !reflect.DeepEqual(names, []string{"a", "b", "y"}) {
+		tt.Unexpected("projects without row security", []string{"a", "b", "y"}, names)
+	}
+
+	expectedQueries := []string{
+		`SELECT name FROM projects WHERE (projects.org_id = ?) AND (name <> ?) ORDER BY name`,
+		`SELECT m.name FROM members m WHERE (m.org_id = ? OR m.org_id IS NULL) ORDER BY m.name`,
+	}
+	if !reflect.DeepEqual(queries[4:6], expectedQueries) {
+		tt.Unexpected("queries", expectedQueries, queries[4:6])
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_RowSecurityDollarPlaceholders(t *testing.T) {
+	c := &connection{driver: New("postgres", WithRowSecurity(&RowSecurity{
+		Predicates: map[string]string{"projects": "org_id = ?"},
+		Value:      func(ctx context.Context) interface{} { return 42 },
+	}))}
+	r, err := c.applyRowSecurity(context.Background(), `SELECT * FROM projects p WHERE p.name = $1`)
+	tt := TT{t}
+	tt.Must(err)
+	expectedQuery := `SELECT * FROM projects p WHERE (p.org_id = $1) AND (p.name = $2)`
+	if r == nil || r.query != expectedQuery {
+		t.Fatalf("expected query %q, got %#v", expectedQuery, r)
+	}
+	args, err := r.args(context.Background(), []driver.NamedValue{{Ordinal: 1, Value: "foo"}})
+	tt.Must(err)
+	expectedArgs := []driver.NamedValue{{Ordinal: 1, Value: int64(42)}, {Ordinal: 2, Value: "foo"}}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		tt.Unexpected("args", expectedArgs, args)
+	}
+}
+
+func Test_RowSecurityFailsClosed(t *testing.T) {
+	c := &connection{driver: New("postgres", WithRowSecurity(&RowSecurity{
+		Predicates: map[string]string{"projects": "org_id = ?"},
+		Value:      func(ctx context.Context) interface{} { return 42 },
+	}))}
+
+	//statements that are rewritten
+	rewriteCases := map[string]string{
+		`UPDATE other, projects SET name = 'x'`:       `UPDATE other, projects SET name = 'x' WHERE (projects.org_id = ?)`,
+		`UPDATE other o, projects p SET p.name = o.x`: `UPDATE other o, projects p SET p.name = o.x WHERE (p.org_id = ?)`,
+		`SELECT * FROM ONLY projects`:                 `SELECT * FROM ONLY projects WHERE (projects.org_id = ?)`,
+		`SELECT * FROM projects;`:                     `SELECT * FROM projects WHERE (projects.org_id = ?);`,
+	}
+	for query, expected := range rewriteCases {
+		for _, ctx := range []context.Context{context.Background(), WithMaintenance(context.Background())} {
+			r, err := c.applyRowSecurity(ctx, query)
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", query, err.Error())
+				continue
+			}
+			if r == nil || r.query != expected {
+				t.Errorf("expected %q to be rewritten into %q, got %#v", query, expected, r)
+			}
+		}
+	}
+
+	//statements that are rejected
+	rejectCases := map[string]string{
+		`SELECT * FROM projects; DELETE FROM projects`:  "row security cannot be applied to multiple statements",
+		`SELECT 1; SELECT 2`:                            "row security cannot be applied to multiple statements",
+		`TABLE projects`:                                "row security cannot be applied to table projects in this type of statement",
+		`MERGE INTO projects p USING x ON p.id = x.id`:  "row security cannot be applied to table projects in this type of statement",
+		`TRUNCATE projects`:                             "row security cannot be applied to table projects in this type of statement",
+		`COPY projects TO STDOUT`:                       "row security cannot be applied to table projects in this type of statement",
+		`EXPLAIN ANALYZE SELECT * FROM public.projects`: "row security cannot be applied to table projects in this type of statement",
+	}
+	for query, reason := range rejectCases {
+		_, err := c.applyRowSecurity(context.Background(), query)
+		var perr PolicyError
+		if !errors.As(err, &perr) || perr.Reason != reason {
+			t.Errorf("expected PolicyError %q for %q, got %#v", reason, query, err)
+		}
+		//...unless row security is bypassed explicitly
+		r, err := c.applyRowSecurity(WithoutRowSecurity(context.Background()), query)
+		if r != nil || err != nil {
+			t.Errorf("expected %q to be left alone without row security, got %#v, %#v", query, r, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+//Rules is a set of rules that are loaded from a JSON file and compiled into
+//hooks. This allows operators to adjust the proxy's behavior without changing
+//code. The file looks like this:
+//
+//	{
+//	  "rules": [
+//	    { "match": "^DELETE FROM audit_log", "action": "block", "message": "audit log is append-only" },
+//	    { "match": "\\bFROM users_v1\\b", "action": "rewrite", "replacement": "FROM users_v2" },
+//	    { "fingerprint": "SELECT * FROM users WHERE id = ?", "action": "log" },
+//	    { "match": ".", "action": "slow", "threshold_ms": 250 }
+//	  ]
+//	}
+//
+//Each rule matches statements either by a regular expression ("match") or by
+//their fingerprint ("fingerprint"), as computed by Normalize(). The following
+//actions are supported:
+//
+//	"block"    - refuse to prepare the statement, with the given "message" as error
+//	"rewrite"  - replace the matched part of the statement with "replacement" (for
+//	             "match" rules, $1 etc. refer to capture groups; for "fingerprint"
+//	             rules, the entire statement is replaced)
+//	"log"      - log the statement like TraceQuery() does
+//	"slow"     - log the statement if it takes longer than "threshold_ms"
+//
+//Rules are applied in order, so later rules see the statement as rewritten by
+//earlier rules. Statements matching "log" rules are logged through the
+//standard library's log package, slow statements through log/slog. The hooks
+//returned by Hooks() always use the most recently loaded rules, so Reload()
+//takes effect immediately.
+type Rules struct {
+	path  string
+	rules atomic.Pointer[[]rule]
+}
+
+type ruleSpec struct {
+	Match       string `json:"match"`
+	Fingerprint string `json:"fingerprint"`
+	Action      string `json:"action"`
+	Message     string `json:"message"`
+	Replacement string `json:"replacement"`
+	ThresholdMS uint   `json:"threshold_ms"`
+}
+
+type rule struct {
+	spec  ruleSpec
+	rx    *regexp.Regexp
+	fp    string
+	delay time.Duration
+}
+
+//LoadRules loads rules from the given JSON file. If the file cannot be read
+//or contains invalid rules, nil and an error are returned.
+func LoadRules(path string) (*Rules, error) {
+	r := &Rules{path: path}
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//Reload loads the rules file again. If the file cannot be read or contains
+//invalid rules, an error is returned and the previous rules remain in effect.
+func (r *Rules) Reload() error {
+	buf, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var data struct {
+		Rules []ruleSpec `json:"rules"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.path, err)
+	}
+
+	rules := make([]rule, len(data.Rules))
+	for idx, spec := range data.Rules {
+		rules[idx], err = compileRule(spec)
+		if err != nil {
+			return fmt.Errorf("%s: rule %d: %w", r.path, idx+1, err)
+		}
+	}
+	r.rules.Store(&rules)
+	return nil
+}
+
+func compileRule(spec ruleSpec) (rule, error) {
+	result := rule{spec: spec}
+	switch {
+	case spec.Match != "" && spec.Fingerprint != "":
+		return result, fmt.Errorf(`"match" and "fingerprint" cannot be given at the same time`)
+	case spec.Match != "":
+		var err error
+		result.rx, err = regexp.Compile(spec.Match)
+		if err != nil {
+			return result, err
+		}
+	case spec.Fingerprint != "":
+		result.fp = Normalize(spec.Fingerprint)
+	default:
+		return result, fmt.Errorf(`either "match" or "fingerprint" must be given`)
+	}
+
+	switch spec.Action {
+	case "block", "log":
+	case "rewrite":
+		if spec.Replacement == "" {
+			return result, fmt.Errorf(`action "rewrite" requires "replacement"`)
+		}
+	case "slow":
+		if spec.ThresholdMS == 0 {
+			return result, fmt.Errorf(`action "slow" requires "threshold_ms"`)
+		}
+		result.delay = time.Duration(spec.ThresholdMS) * time.Millisecond
+	default:
+		return result, fmt.Errorf("unknown action: %q", spec.Action)
+	}
+	return result, nil
+}
+
+func (r rule) matches(query string) bool {
+	if r.rx != nil {
+		return r.rx.MatchString(query)
+	}
+	return Normalize(query) == r.fp
+}
+
+//Hooks returns hooks that apply these rules: a BeforePrepareHook for "block"
+//and "rewrite" rules, a BeforeQueryHook for "log" rules, and an AfterQueryHook
+//for "slow" rules. To combine them with other hooks, use the WithRules()
+//option.
+func (r *Rules) Hooks() Hooks {
+	return Hooks{
+		BeforePrepareHook: r.beforePrepare,
+		BeforeQueryHook:   r.beforeQuery,
+		AfterQueryHook:    r.afterQuery,
+	}
+}
+
+func (r *Rules) beforePrepare(query string) (string, error) {
+	for _, rule := range *r.rules.Load() {
+		if (rule.spec.Action != "block" && rule.spec.Action != "rewrite") || !rule.matches(query) {
+			continue
+		}
+		switch {
+		case rule.spec.Action == "block":
+			message := rule.spec.Message
+			if message == "" {
+				message = "statement is not allowed"
+			}
+			return "", fmt.Errorf("sqlproxy: blocked by rule: %s", message)
+		case rule.rx != nil:
+			query = rule.rx.ReplaceAllString(query, rule.spec.Replacement)
+		default:
+			query = rule.spec.Replacement
+		}
+	}
+	return query, nil
+}
+
+func (r *Rules) beforeQuery(query string, args []interface{}) {
+	for _, rule := range *r.rules.Load() {
+		if rule.spec.Action == "log" && rule.matches(query) {
+			log.Println(formatQuery(query, args))
+			return
+		}
+	}
+}
+
+func (r *Rules) afterQuery(e QueryEvent) {
+	for _, rule := range *r.rules.Load() {
+		if rule.spec.Action == "slow" && e.Duration > rule.delay && rule.matches(e.Query) {
+			slowQueryLogger(rule.delay)(e)
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_Rules(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	rulesPath := filepath.Join(t.TempDir(), "rules.json")
+	writeRules := func(content string) {
+		tt.Must(os.WriteFile(rulesPath, []byte(content), 0666))
+	}
+	writeRules(`{"rules": [
+		{ "match": "^DELETE", "action": "block", "message": "no deletions" },
+		{ "match": "\\bFROM v1\\b", "action": "rewrite", "replacement": "FROM knowledge" },
+		{ "fingerprint": "SELECT number FROM knowledge WHERE thing = 'x'", "action": "log" }
+	]}`)
+	rules, err := LoadRules(rulesPath)
+	tt.Must(err)
+
+	var logBuffer bytes.Buffer
+	log.SetOutput(&logBuffer)
+	defer log.SetOutput(os.Stderr)
+
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithRules(rules)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES (42, 'truth')`))
+
+	//"block" rule
+	_, err = db.Exec(`DELETE FROM knowledge`)
+	if err == nil || err.Error() != "sqlproxy: blocked by rule: no deletions" {
+		t.Errorf("expected DELETE to be blocked, got err = %v", err)
+	}
+
+	//"rewrite" and "log" rules
+	var number int
+	tt.Must(db.QueryRow(`SELECT number FROM v1 WHERE thing = $1`, "truth").Scan(&number))
+	if number != 42 {
+		tt.Unexpected("number", 42, number)
+	}
+	logLines := strings.TrimSpace(logBuffer.String())
+	if !strings.HasSuffix(logLines, `SELECT number FROM knowledge WHERE thing = $1 ["truth"]`) || strings.Contains(logLines, "\n") {
+		t.Errorf("unexpected log output: %q", logLines)
+	}
+
+	//invalid rules are rejected by Reload() and the old rules remain in effect
+	writeRules(`{"rules": [{ "match": "(", "action": "block" }]}`)
+	if err := rules.Reload(); err == nil {
+		t.Error("expected Reload() to fail for invalid regex, but it succeeded")
+	}
+	writeRules(`{"rules": [{ "match": ".", "action": "explode" }]}`)
+	if err := rules.Reload(); err == nil {
+		t.Error("expected Reload() to fail for unknown action, but it succeeded")
+	}
+	_, err = db.Exec(`DELETE FROM knowledge`)
+	if err == nil {
+		t.Error("expected DELETE to still be blocked, but it succeeded")
+	}
+
+	//valid rules take effect immediately on Reload()
+	writeRules(`{"rules": []}`)
+	tt.Must(rules.Reload())
+	tt.MustResult(db.Exec(`DELETE FROM knowledge`))
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_LoadRulesErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	//missing file
+	rules, err := LoadRules(filepath.Join(dir, "missing.json"))
+	if err == nil || !os.IsNotExist(err) {
+		t.Errorf("expected not-exist error for missing file, got %v", err)
+	}
+	if rules != nil {
+		t.Errorf("expected no Rules for missing file, got %#v", rules)
+	}
+
+	//malformed file
+	path := filepath.Join(dir, "rules.json")
+	err = os.WriteFile(path, []byte(`{"rules": [`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err = LoadRules(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("expected decode error for malformed file, got %v", err)
+	}
+	if rules != nil {
+		t.Errorf("expected no Rules for malformed file, got %#v", rules)
+	}
+}
@@ -0,0 +1,295 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bufio"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ChaosSchedule is a scenario of faults that are injected at given points in
+//time during a test run, e.g. to check how the application behaves during
+//and after an outage. Unlike Chaos and FaultInjector, which inject faults at
+//random, a schedule reproduces the same sequence of events in each run.
+//Schedules are written in a line-based format:
+//
+//	# kill all open connections 30 seconds into the test run
+//	at 30s kill connections
+//	# make writes slow for a while
+//	from 60s to 90s delay writes 200ms
+//	# simulate a failover
+//	from 2m to 2m10s fail all connection-failure
+//	# from here on, all updates run into deadlocks
+//	from 3m fail update deadlock
+//
+//Times are given as durations (see time.ParseDuration) since the start of the
+//schedule, optionally prefixed with "t+". The following steps are supported:
+//
+//	"at T kill connections"              - all connections that were opened before T fail with
+//	                                       driver.ErrBadConn when they are used after T (like
+//	                                       for Chaos.TransactionKillRate, a running transaction is
+//	                                       rolled back)
+//	"from T1 [to T2] delay TARGET D"     - matching statements are delayed by D
+//	"from T1 [to T2] fail TARGET ERROR"  - matching statements fail instead of being executed
+//
+//TARGET is one of "all", "reads" (statements that IsReadOnlyStatement
+//accepts), "writes" (all other statements) or a statement type like "update" (see StatementType). ERROR is
+//one of "deadlock", "serialization-failure", "statement-timeout",
+//"unique-violation", "foreign-key-violation", "connection-failure" (see the
+//ErrInjected... values) or "bad-connection" (driver.ErrBadConn). If "to T2"
+//is not given, the step lasts until the end of the test run. When multiple
+//steps match a statement, all of their delays are waited for, and the first
+//"fail" step decides the error.
+//
+//The schedule starts when Start() is called, or otherwise when the first
+//connection is opened or the first statement is executed through a Driver
+//using it. Like with FaultInjector, the injected delays and errors are seen
+//by the AfterQueryHook and counted in Stats.
+type ChaosSchedule struct {
+	steps     []chaosStep
+	mutex     sync.Mutex
+	startedAt time.Time
+	//for unit tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type chaosStep struct {
+	action   string //"kill", "delay" or "fail"
+	from, to time.Duration
+	until    bool //whether "to" was given
+	target   string
+	delay    time.Duration
+	err      error
+}
+
+var chaosScheduleErrors = map[string]error{
+	"deadlock":              ErrInjectedDeadlock,
+	"serialization-failure": ErrInjectedSerializationFailure,
+	"statement-timeout":     ErrInjectedStatementTimeout,
+	"unique-violation":      ErrInjectedUniqueViolation,
+	"foreign-key-violation": ErrInjectedForeignKeyViolation,
+	"connection-failure":    ErrInjectedConnectionFailure,
+	"bad-connection":        driver.ErrBadConn,
+}
+
+//LoadChaosSchedule reads a ChaosSchedule from the given file.
+func LoadChaosSchedule(path string) (*ChaosSchedule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseChaosSchedule(file, path)
+}
+
+//ParseChaosSchedule reads a ChaosSchedule from the given reader. The fileName
+//is only used in error messages.
+func ParseChaosSchedule(reader io.Reader, fileName string) (*ChaosSchedule, error) {
+	s := &ChaosSchedule{now: time.Now, sleep: sleepContext}
+	scanner := bufio.NewScanner(reader)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		step, err := parseChaosStep(words)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", fileName, lineNo, err)
+		}
+		s.steps = append(s.steps, step)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return s, nil
+}
+
+func parseChaosStep(words []string) (chaosStep, error) {
+	var step chaosStep
+	var err error
+	switch words[0] {
+	case "at":
+		if len(words) != 4 || words[2] != "kill" || words[3] != "connections" {
+			return step, fmt.Errorf(`expected "at T kill connections", got %q`, strings.Join(words, " "))
+		}
+		step.action = "kill"
+		step.from, err = parseChaosTime(words[1])
+		return step, err
+	case "from":
+		if len(words) < 2 {
+			return step, fmt.Errorf(`expected time after "from"`)
+		}
+		step.from, err = parseChaosTime(words[1])
+		if err != nil {
+			return step, err
+		}
+		words = words[2:]
+		if len(words) >= 2 && words[0] == "to" {
+			step.to, err = parseChaosTime(words[1])
+			if err != nil {
+				return step, err
+			}
+			if step.to <= step.from {
+				return step, fmt.Errorf("end time %s is not after start time %s", step.to, step.from)
+			}
+			step.until = true
+			words = words[2:]
+		}
+	default:
+		return step, fmt.Errorf(`expected "at" or "from", got %q`, words[0])
+	}
+
+	if len(words) != 3 || (words[0] != "delay" && words[0] != "fail") {
+		return step, fmt.Errorf(`expected "delay TARGET DURATION" or "fail TARGET ERROR", got %q`, strings.Join(words, " "))
+	}
+	step.action, step.target = words[0], words[1]
+	if step.target != "all" && step.target != "reads" && step.target != "writes" && !knownStatementTypes[step.target] {
+		return step, fmt.Errorf("unknown target: %q", step.target)
+	}
+	if step.action == "delay" {
+		step.delay, err = time.ParseDuration(words[2])
+		if err == nil && step.delay <= 0 {
+			err = fmt.Errorf("delay must be positive, got %s", step.delay)
+		}
+		return step, err
+	}
+	step.err = chaosScheduleErrors[words[2]]
+	if step.err == nil {
+		return step, fmt.Errorf("unknown error: %q", words[2])
+	}
+	return step, nil
+}
+
+func parseChaosTime(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimPrefix(value, "t+"))
+	if err == nil && d < 0 {
+		err = fmt.Errorf("time must not be negative, got %s", value)
+	}
+	return d, err
+}
+
+//Start starts (or restarts) the schedule. Calling it is optional: If it is
+//not called, the schedule starts when it is first used by a Driver.
+func (s *ChaosSchedule) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.startedAt = s.now()
+}
+
+//elapsed returns the time since the start of the schedule, starting it if
+//necessary.
+func (s *ChaosSchedule) elapsed() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	if s.startedAt.IsZero() {
+		s.startedAt = now
+	}
+	return now.Sub(s.startedAt)
+}
+
+//kills returns how many "kill connections" steps have happened until the
+//given time.
+func (s *ChaosSchedule) kills(elapsed time.Duration) int {
+	result := 0
+	for _, step := range s.steps {
+		if step.action == "kill" && step.from <= elapsed {
+			result++
+		}
+	}
+	return result
+}
+
+//apply waits for the delays of all active steps that match the given
+//statement, and then returns the error of the first active "fail" step that
+//matches it, if any.
+func (s *ChaosSchedule) apply(ctx context.Context, query string) error {
+	elapsed := s.elapsed()
+	var (
+		statementType string
+		readOnly      bool
+		readOnlyKnown bool
+		failure       error
+	)
+	for _, step := range s.steps {
+		if step.action == "kill" || elapsed < step.from || (step.until && elapsed >= step.to) {
+			continue
+		}
+		switch step.target {
+		case "all":
+		case "reads", "writes":
+			if !readOnlyKnown {
+				readOnly, readOnlyKnown = IsReadOnlyStatement(query), true
+			}
+			if readOnly != (step.target == "reads") {
+				continue
+			}
+		default:
+			if statementType == "" {
+				statementType = StatementType(query)
+			}
+			if statementType != step.target {
+				continue
+			}
+		}
+		if step.action == "fail" {
+			if failure == nil {
+				failure = step.err
+			}
+			continue
+		}
+		if err := s.sleep(ctx, step.delay); err != nil {
+			return err
+		}
+	}
+	return failure
+}
+
+//checkChaosSchedule returns driver.ErrBadConn if Driver.ChaosSchedule has
+//killed all connections since this connection was opened or last checked.
+func (c *connection) checkChaosSchedule() error {
+	schedule := c.driver.ChaosSchedule
+	if schedule == nil {
+		return nil
+	}
+	kills := schedule.kills(schedule.elapsed())
+	if kills <= c.scheduledKills {
+		return nil
+	}
+	c.scheduledKills = kills
+	if c.tx != nil {
+		c.killTransaction()
+	} else {
+		c.killed = true
+		c.bad = true
+	}
+	return driver.ErrBadConn
+}
@@ -0,0 +1,157 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ChaosSchedule(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	schedule, err := ParseChaosSchedule(strings.NewReader(`
+		# comments are ignored
+		at t+10s kill connections
+		from 20s to 30s delay writes 200ms
+		from 40s fail reads deadlock # until the end
+	`), "test.schedule")
+	tt.Must(err)
+	startedAt := time.Unix(0, 0)
+	now := startedAt
+	schedule.now = func() time.Time { return now }
+	var delays []time.Duration
+	schedule.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	schedule.Start()
+
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithChaosSchedule(schedule)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER)`))
+
+	//a transaction that is running when the connections are killed fails and is rolled back
+	now = startedAt.Add(5 * time.Second)
+	tx, err := db.Begin()
+	tt.Must(err)
+	tt.MustResult(tx.Exec(`INSERT INTO users (id) VALUES (1)`))
+	now = startedAt.Add(10 * time.Second)
+	_, err = tx.Exec(`INSERT INTO users (id) VALUES (2)`)
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("expected ErrBadConn after kill, got %v", err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("expected Commit to fail after the connection was killed")
+	}
+	//new connections are not affected
+	countUsers := func() (count int, err error) {
+		err = db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count)
+		return count, err
+	}
+	count, err := countUsers()
+	tt.Must(err)
+	if count != 0 {
+		t.Errorf("expected killed transaction to be rolled back, but found %d rows", count)
+	}
+
+	//writes are delayed while the delay step is active
+	now = startedAt.Add(25 * time.Second)
+	tt.MustResult(db.Exec(`INSERT INTO users (id) VALUES (3)`))
+	_, err = countUsers()
+	tt.Must(err)
+	now = startedAt.Add(30 * time.Second)
+	tt.MustResult(db.Exec(`INSERT INTO users (id) VALUES (4)`))
+	expected := []time.Duration{200 * time.Millisecond}
+	if len(delays) != 1 || delays[0] != expected[0] {
+		tt.Unexpected("delays", expected, delays)
+	}
+
+	//reads fail from 40s on
+	now = startedAt.Add(time.Hour)
+	_, err = countUsers()
+	if !errors.Is(err, ErrInjectedDeadlock) {
+		t.Errorf("expected injected deadlock, got %v", err)
+	}
+	tt.MustResult(db.Exec(`INSERT INTO users (id) VALUES (5)`))
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_ChaosScheduleMatching(t *testing.T) {
+	tt := TT{t}
+	schedule, err := ParseChaosSchedule(strings.NewReader(`
+		from 0s fail all deadlock
+		from 0s delay reads 100ms
+		from 0s delay writes 300ms
+	`), "test.schedule")
+	tt.Must(err)
+	var delays []time.Duration
+	schedule.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	schedule.Start()
+
+	testCases := map[string]time.Duration{
+		`WITH t AS (SELECT 1) SELECT * FROM t`: 100 * time.Millisecond,
+		`EXPLAIN SELECT * FROM users`:          100 * time.Millisecond,
+		`SELECT 1; DELETE FROM users`:          300 * time.Millisecond,
+		`UPDATE users SET id = 1`:              300 * time.Millisecond,
+	}
+	for query, expected := range testCases {
+		delays = nil
+		//the delays of later steps are waited for even though an earlier step fails the statement
+		err := schedule.apply(context.Background(), query)
+		if !errors.Is(err, ErrInjectedDeadlock) {
+			t.Errorf("expected injected deadlock for %q, got %v", query, err)
+		}
+		if len(delays) != 1 || delays[0] != expected {
+			tt.Unexpected(fmt.Sprintf("delays for %q", query), []time.Duration{expected}, delays)
+		}
+	}
+}
+
+func Test_ChaosScheduleErrors(t *testing.T) {
+	testCases := map[string]string{
+		"at 10s kill everything":             `test.schedule:1: expected "at T kill connections", got "at 10s kill everything"`,
+		"after 10s kill connections":         `test.schedule:1: expected "at" or "from", got "after"`,
+		"\nfrom 10s to 5s fail all deadlock": `test.schedule:2: end time 5s is not after start time 10s`,
+		"from 10s delay all":                 `test.schedule:1: expected "delay TARGET DURATION" or "fail TARGET ERROR", got "delay all"`,
+		"from 10s delay everything 1s":       `test.schedule:1: unknown target: "everything"`,
+		"from 10s delay all -1s":             `test.schedule:1: delay must be positive, got -1s`,
+		"from 10s fail writes explosion":     `test.schedule:1: unknown error: "explosion"`,
+		"from soon fail writes deadlock":     `test.schedule:1: time: invalid duration "soon"`,
+		"at -5s kill connections":            `test.schedule:1: time must not be negative, got -5s`,
+	}
+	for input, expected := range testCases {
+		_, err := ParseChaosSchedule(strings.NewReader(input), "test.schedule")
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q for %q, got %v", expected, input, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+)
+
+//SchemaPerTenant implements schema-per-tenant multi-tenancy behind a single
+//sql.DB (see Driver.SchemaPerTenant). The tenant of each statement is taken
+//from Driver.TenantFromContext, and mapped to a database schema by the Schema
+//function. Depending on QualifyTables, the schema is either selected on the
+//connection before the statement is executed (e.g. with "SET search_path" on
+//PostgreSQL), or written into the statement as a qualifier for all table
+//names.
+type SchemaPerTenant struct {
+	//Schema maps a tenant to the name of its schema, e.g. "tenant_42". If it
+	//returns the empty string, the connection's default schema is used.
+	Schema func(tenant string) string
+	//SetCommand (optional) returns the statement that selects the given
+	//schema on a connection. The default is "SET search_path TO <schema>" (for
+	//PostgreSQL) with the schema name quoted as an identifier. For MySQL, use
+	//something like "USE `<schema>`". Since the schema is selected per
+	//connection, it persists until another schema is selected. Within a
+	//transaction, the schema selected at its start is used for all
+	//statements. Not used if QualifyTables is set.
+	SetCommand func(schema string) string
+	//QualifyTables rewrites unqualified table names in each statement into
+	//"schema.table" instead of selecting the schema on the connection. This is
+	//a best-effort rewrite based on the keywords preceding table names (FROM,
+	//JOIN, INTO, UPDATE etc.), not a full SQL parser.
+	QualifyTables bool
+}
+
+func (s *SchemaPerTenant) schemaFor(ctx context.Context, d *Driver) string {
+	if d.TenantFromContext == nil {
+		return ""
+	}
+	tenant := d.TenantFromContext(ctx)
+	if tenant == "" {
+		return ""
+	}
+	return s.Schema(tenant)
+}
+
+func (s *SchemaPerTenant) setCommand(schema string) string {
+	if s.SetCommand != nil {
+		return s.SetCommand(schema)
+	}
+	return "SET search_path TO " + quoteIdentifier(schema)
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+//qualifyTables implements SchemaPerTenant.QualifyTables.
+func (c *connection) qualifyTables(ctx context.Context, query string) string {
+	s := c.driver.SchemaPerTenant
+	if s == nil || !s.QualifyTables {
+		return query
+	}
+	schema := s.schemaFor(ctx, c.driver)
+	if schema == "" {
+		return query
+	}
+	return qualifyTableNames(query, schema)
+}
+
+//useSchema selects the tenant's schema on the given proxied connection, unless
+//it is already selected.
+func (c *connection) useSchema(ctx context.Context, conn driver.Conn) error {
+	s := c.driver.SchemaPerTenant
+	if s == nil || s.QualifyTables || c.tx != nil {
+		return nil
+	}
+	schema := s.schemaFor(ctx, c.driver)
+	if schema == "" || c.schemas[conn] == schema {
+		return nil
+	}
+	if err := c.execCommand(ctx, conn, s.setCommand(schema)); err != nil {
+		return err
+	}
+	if c.schemas == nil {
+		c.schemas = make(map[driver.Conn]string)
+	}
+	c.schemas[conn] = schema
+	return nil
+}
+
+//matches the names of common table expressions, which must not be qualified
+var cteNameRx = regexp.MustCompile(`(?i)(?:\bWITH(?:\s+RECURSIVE)?|,)\s*([A-Za-z_]\w*)\s+AS\s*\(`)
+
+//qualifyTableNames prefixes all unqualified table names in the given query
+//with the given schema.
+func qualifyTableNames(query, schema string) string {
+	isCTE := make(map[string]bool)
+	for _, match := range cteNameRx.FindAllStringSubmatch(query, -1) {
+		isCTE[strings.ToLower(match[1])] = true
+	}
+	skipped := nonTableUpdateRx.FindAllStringIndex(query, -1)
+
+	var (
+		b      strings.Builder
+		offset = 0
+		prefix = quoteIdentifier(schema) + "."
+	)
+matches:
+	for _, loc := range tableRefRx.FindAllStringSubmatchIndex(query, -1) {
+		for _, skip := range skipped {
+			if loc[2] >= skip[0] && loc[2] < skip[1] {
+				continue matches
+			}
+		}
+		name := query[loc[4]:loc[5]]
+		if strings.Contains(name, ".") || isCTE[strings.ToLower(name)] {
+			continue
+		}
+		b.WriteString(query[offset:loc[4]])
+		b.WriteString(prefix)
+		b.WriteString(name)
+		offset = loc[5]
+	}
+	b.WriteString(query[offset:])
+	return b.String()
+}
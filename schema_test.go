@@ -0,0 +1,133 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type tenantKey struct{}
+
+func tenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+func Test_QualifyTableNames(t *testing.T) {
+	testCases := map[string]string{
+		`SELECT * FROM users u JOIN public.groups g ON u.gid = g.id`:                      `SELECT * FROM "t1".users u JOIN public.groups g ON u.gid = g.id`,
+		`INSERT INTO logs SELECT * FROM "events"`:                                         `INSERT INTO "t1".logs SELECT * FROM "t1"."events"`,
+		`WITH recent AS (SELECT * FROM jobs) SELECT * FROM recent FOR UPDATE SKIP LOCKED`: `WITH recent AS (SELECT * FROM "t1".jobs) SELECT * FROM recent FOR UPDATE SKIP LOCKED`,
+		`UPDATE counters SET n = n + 1`:                                                   `UPDATE "t1".counters SET n = n + 1`,
+	}
+	for query, expected := range testCases {
+		if actual := qualifyTableNames(query, "t1"); actual != expected {
+			TT{t}.Unexpected("qualified "+query, expected, actual)
+		}
+	}
+}
+
+func Test_SchemaPerTenantQualifyTables(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	d := New("sqlite3",
+		WithTenant(tenantFromContext),
+		WithSchemaPerTenant(&SchemaPerTenant{
+			Schema:        func(tenant string) string { return "tenant_" + tenant },
+			QualifyTables: true,
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	db.SetMaxOpenConns(1)
+	dir := t.TempDir()
+	for _, tenant := range []string{"a", "b"} {
+		tt.MustResult(db.Exec(`ATTACH DATABASE $1 AS $2`, filepath.Join(dir, tenant+".sqlite"), "tenant_"+tenant))
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		tt.MustResult(db.ExecContext(ctx, `CREATE TABLE users (name TEXT)`))
+		tt.MustResult(db.ExecContext(ctx, `INSERT INTO users VALUES ($1)`, "user of "+tenant))
+	}
+
+	for _, tenant := range []string{"a", "b"} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		var name string
+		tt.Must(db.QueryRowContext(ctx, `SELECT name FROM users`).Scan(&name))
+		if name != "user of "+tenant {
+			tt.Unexpected("name", "user of "+tenant, name)
+		}
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_SchemaPerTenantSetCommand(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	//instead of switching schemas, the SetCommand records which schemas were
+	//selected
+	d := New("sqlite3",
+		WithTenant(tenantFromContext),
+		WithSchemaPerTenant(&SchemaPerTenant{
+			Schema: func(tenant string) string { return "tenant_" + tenant },
+			SetCommand: func(schema string) string {
+				return "INSERT INTO schema_log VALUES ('" + schema + "')"
+			},
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	db.SetMaxOpenConns(1)
+	tt.MustResult(db.Exec(`CREATE TABLE schema_log (schema TEXT)`))
+
+	ctxA := context.WithValue(context.Background(), tenantKey{}, "a")
+	ctxB := context.WithValue(context.Background(), tenantKey{}, "b")
+	tt.MustResult(db.ExecContext(ctxA, `SELECT 1`))
+	tt.MustResult(db.ExecContext(ctxA, `SELECT 2`))
+	tx, err := db.BeginTx(ctxB, nil)
+	tt.Must(err)
+	tt.MustResult(tx.ExecContext(ctxA, `SELECT 3`)) //within the transaction, the schema is not switched
+	tt.Must(tx.Commit())
+	stmt, err := db.PrepareContext(ctxB, `SELECT 4`)
+	tt.Must(err)
+	tt.MustResult(stmt.ExecContext(ctxA))
+	tt.Must(stmt.Close())
+
+	var schemas []string
+	rows := tt.MustRows(db.Query(`SELECT schema FROM schema_log`))
+	for rows.Next() {
+		var schema string
+		tt.Must(rows.Scan(&schema))
+		schemas = append(schemas, schema)
+	}
+	tt.Must(rows.Err())
+	tt.Must(rows.Close())
+	expected := []string{"tenant_a", "tenant_b", "tenant_a"}
+	if !reflect.DeepEqual(schemas, expected) {
+		tt.Unexpected("schemas", expected, schemas)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
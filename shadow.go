@@ -0,0 +1,438 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Shadow mirrors statements asynchronously to a secondary database, and
+//discards the results. This can be used to soak-test a new database version
+//or configuration with the traffic shapes of the production workload:
+//
+//	shadow := sqlproxy.NewShadow("postgres://new-db.example.com/mydb")
+//	shadow.Writes = true
+//	sql.Register("postgres-with-shadow", sqlproxy.New("postgres", sqlproxy.WithShadow(shadow)))
+//
+//The secondary database is accessed through the proxied driver, without any
+//hooks. Only statements that succeeded on the primary database are mirrored.
+//Statements in transactions are collected until the transaction is committed,
+//and then mirrored in a transaction of their own (or dropped if the
+//transaction is rolled back). Mirrored statements that fail are reported to
+//the ShadowQueryHook, or logged through log/slog if there is none.
+//
+//In canary mode (see CompareReads), the results of mirrored SELECT statements
+//are compared against those from the primary database, to validate a
+//migration or a new index or collation before switching over.
+//
+//Mirroring never blocks the application: When the queue is full (because the
+//secondary database is slower than the primary), further statements are
+//dropped and counted (see Dropped). The exported fields must not be changed
+//after the Shadow has been given to a Driver.
+type Shadow struct {
+	//DataSource is the data source name of the secondary database.
+	DataSource string
+	//Reads mirrors statements that do not modify data or the schema (see
+	//IsReadOnlyStatement). This is set by NewShadow.
+	Reads bool
+	//Writes (optional) mirrors statements that modify data or the schema.
+	Writes bool
+	//CompareReads (optional) enables canary mode: For mirrored read
+	//statements outside of transactions, the number of rows and a checksum
+	//over all rows are compared between the primary and the secondary
+	//database, and divergences are reported to the DivergenceHook (or logged
+	//through log/slog if there is none). The checksum does not depend on the
+	//order of rows. Only statements whose result set was read completely by
+	//the application can be compared; other statements are mirrored without
+	//comparison. Since the mirrored statement runs later than the original
+	//one, concurrent writes can cause spurious divergences.
+	CompareReads bool
+	//Workers (optional) is the number of statements (or transactions) that
+	//are executed concurrently on the secondary database. Defaults to 4.
+	Workers int
+	//QueueSize (optional) is the number of statements (or transactions)
+	//that can wait for a worker before further ones are dropped. Defaults to
+	//1000.
+	QueueSize int
+
+	once    sync.Once
+	db      *sql.DB
+	queue   chan shadowJob
+	mutex   sync.RWMutex //protects queue against concurrent Close()
+	closed  bool
+	workers sync.WaitGroup
+	dropped atomic.Uint64
+}
+
+//NewShadow returns a Shadow that mirrors read statements to the given data
+//source.
+func NewShadow(dataSource string) *Shadow {
+	return &Shadow{DataSource: dataSource, Reads: true}
+}
+
+type shadowStatement struct {
+	query string
+	args  []driver.NamedValue
+}
+
+type shadowJob struct {
+	driver     *Driver
+	hooks      *Hooks
+	statements []shadowStatement
+	//whether the statements were executed in a transaction on the primary
+	transaction bool
+	//the result from the primary, if it shall be compared (see CompareReads)
+	compare *shadowComparison
+}
+
+//shadowComparison collects the result of a statement on the primary
+//database, for comparison with the secondary database (see CompareReads).
+type shadowComparison struct {
+	stmt     shadowStatement
+	rows     int64
+	checksum rowChecksum
+	//whether the result set was read completely
+	complete bool
+}
+
+//rowChecksum is a checksum over a set of rows that does not depend on the
+//order of the rows.
+type rowChecksum uint64
+
+func (c *rowChecksum) add(row []driver.Value) {
+	h := fnv.New64a()
+	for _, value := range row {
+		fmt.Fprintf(h, "%T:%v\x00", value, value)
+	}
+	*c += rowChecksum(h.Sum64())
+}
+
+//DivergenceEvent is given to the DivergenceHook when a statement mirrored by a
+//Shadow in canary mode (see Shadow.CompareReads) returned a different result
+//on the secondary database than on the primary database.
+type DivergenceEvent struct {
+	//Query and Args are the mirrored statement. If Driver.Redactor is set,
+	//sensitive arguments have been replaced.
+	Query string
+	Args  []interface{}
+	//PrimaryRows and ShadowRows are the numbers of rows returned by the
+	//primary and secondary database, respectively.
+	PrimaryRows int64
+	ShadowRows  int64
+	//PrimaryChecksum and ShadowChecksum are checksums over all rows returned
+	//by the primary and secondary database, respectively.
+	PrimaryChecksum uint64
+	ShadowChecksum  uint64
+}
+
+//Dropped returns how many statements (or transactions) were not mirrored
+//because the queue was full.
+func (s *Shadow) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+//Close waits until all queued statements have been mirrored, and closes the
+//connections to the secondary database. Afterwards, no further statements are
+//mirrored.
+func (s *Shadow) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	if s.queue != nil {
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+
+	s.workers.Wait()
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+//start opens the secondary database and starts the workers on first use.
+func (s *Shadow) start(d *Driver) bool {
+	s.once.Do(func() {
+		connector, err := d.proxiedConnector(s.DataSource)
+		if err != nil {
+			slog.Error("sqlproxy: cannot open shadow database, statements will not be mirrored", slog.String("error", err.Error()))
+			return
+		}
+		s.db = sql.OpenDB(connector)
+
+		workers := s.Workers
+		if workers <= 0 {
+			workers = 4
+		}
+		queueSize := s.QueueSize
+		if queueSize <= 0 {
+			queueSize = 1000
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.closed {
+			s.db.Close()
+			return
+		}
+		s.queue = make(chan shadowJob, queueSize)
+		for range workers {
+			s.workers.Add(1)
+			go s.work()
+		}
+	})
+	return s.queue != nil
+}
+
+func (s *Shadow) enqueue(job shadowJob) {
+	if !s.start(job.driver) {
+		return
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- job:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *Shadow) work() {
+	defer s.workers.Done()
+	for job := range s.queue {
+		s.run(job)
+	}
+}
+
+//run executes a job on the secondary database.
+func (s *Shadow) run(job shadowJob) {
+	ctx := context.Background()
+	if !job.transaction {
+		s.runStatement(ctx, s.db, job, job.statements[0])
+		return
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.report(job, QueryEvent{Query: "BEGIN", Err: err})
+		return
+	}
+	for _, stmt := range job.statements {
+		s.runStatement(ctx, tx, job, stmt)
+	}
+	err = tx.Commit()
+	if err != nil {
+		s.report(job, QueryEvent{Query: "COMMIT", Err: err})
+	}
+}
+
+type shadowExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (s *Shadow) runStatement(ctx context.Context, db shadowExecutor, job shadowJob, stmt shadowStatement) {
+	e := QueryEvent{Query: stmt.query, Args: castNamedValues(stmt.args)}
+	startedAt := time.Now()
+	var checksum rowChecksum
+	if IsReadOnlyStatement(stmt.query) {
+		var rows *sql.Rows
+		rows, e.Err = db.QueryContext(ctx, stmt.query, e.Args...)
+		if e.Err == nil {
+			e.Rows, checksum, e.Err = readShadowRows(rows, job.compare != nil)
+		}
+	} else {
+		var result sql.Result
+		result, e.Err = db.ExecContext(ctx, stmt.query, e.Args...)
+		if e.Err == nil {
+			e.Rows, _ = result.RowsAffected()
+		}
+	}
+	e.Duration = time.Since(startedAt)
+	if job.driver.Redactor != nil {
+		e.Args = job.driver.Redactor.RedactArgs(e.Query, e.Args)
+	}
+	s.report(job, e)
+
+	if c := job.compare; c != nil && e.Err == nil && (c.rows != e.Rows || c.checksum != checksum) {
+		reportDivergence(job.hooks, DivergenceEvent{
+			Query:           e.Query,
+			Args:            e.Args,
+			PrimaryRows:     c.rows,
+			ShadowRows:      e.Rows,
+			PrimaryChecksum: uint64(c.checksum),
+			ShadowChecksum:  uint64(checksum),
+		})
+	}
+}
+
+//readShadowRows reads the given rows from the secondary database, and
+//computes their checksum if requested.
+func readShadowRows(rows *sql.Rows, withChecksum bool) (count int64, checksum rowChecksum, err error) {
+	defer rows.Close()
+	var (
+		row  []driver.Value
+		dest []interface{}
+	)
+	if withChecksum {
+		columns, err := rows.Columns()
+		if err != nil {
+			return 0, 0, err
+		}
+		row = make([]driver.Value, len(columns))
+		dest = make([]interface{}, len(columns))
+		for idx := range row {
+			dest[idx] = &row[idx]
+		}
+	}
+	for rows.Next() {
+		count++
+		if withChecksum {
+			err := rows.Scan(dest...)
+			if err != nil {
+				return 0, 0, err
+			}
+			checksum.add(row)
+		}
+	}
+	return count, checksum, rows.Err()
+}
+
+func reportDivergence(hooks *Hooks, e DivergenceEvent) {
+	if hooks.DivergenceHook != nil {
+		hooks.DivergenceHook(e)
+		return
+	}
+	slog.Warn("SQL statement returned different results on shadow database",
+		slog.String("query", formatQuery(e.Query, nil)),
+		slog.Int64("primary_rows", e.PrimaryRows), slog.Int64("shadow_rows", e.ShadowRows),
+		slog.Bool("checksum_matches", e.PrimaryChecksum == e.ShadowChecksum))
+}
+
+func (s *Shadow) report(job shadowJob, e QueryEvent) {
+	if job.hooks.ShadowQueryHook != nil {
+		job.hooks.ShadowQueryHook(e)
+		return
+	}
+	if e.Err != nil {
+		slog.Warn("mirrored SQL statement failed on shadow database",
+			slog.String("query", formatQuery(e.Query, nil)), slog.String("error", e.Err.Error()))
+	}
+}
+
+//mirror implements Driver.Shadow for a statement that was executed
+//successfully on the primary database.
+func (c *connection) mirror(hooks *Hooks, query string, args []driver.NamedValue, err error) {
+	stmt, ok := c.shadowStatement(query, args, err)
+	if !ok {
+		return
+	}
+	if c.tx != nil {
+		c.tx.shadowStatements = append(c.tx.shadowStatements, stmt)
+		return
+	}
+	c.driver.Shadow.enqueue(shadowJob{driver: c.driver, hooks: hooks, statements: []shadowStatement{stmt}})
+}
+
+//mirrorQuery is like mirror, but for statements that return rows. In canary
+//mode (see Shadow.CompareReads), the statement is not mirrored right away.
+//Instead, a shadowComparison is returned that collects the result from the
+//primary database, and the statement is mirrored once that result is
+//complete (see mirrorComparison).
+func (c *connection) mirrorQuery(hooks *Hooks, query string, args []driver.NamedValue, err error) *shadowComparison {
+	s := c.driver.Shadow
+	if s == nil || !s.CompareReads || c.tx != nil || !IsReadOnlyStatement(query) {
+		c.mirror(hooks, query, args, err)
+		return nil
+	}
+	stmt, ok := c.shadowStatement(query, args, err)
+	if !ok {
+		return nil
+	}
+	return &shadowComparison{stmt: stmt}
+}
+
+//mirrorComparison is called when the rows of a statement returned by
+//mirrorQuery are closed.
+func (c *connection) mirrorComparison(hooks *Hooks, comparison *shadowComparison) {
+	job := shadowJob{driver: c.driver, hooks: hooks, statements: []shadowStatement{comparison.stmt}}
+	if comparison.complete {
+		job.compare = comparison
+	}
+	c.driver.Shadow.enqueue(job)
+}
+
+//shadowStatement decides whether the given statement shall be mirrored, and
+//if so, prepares it for mirroring.
+func (c *connection) shadowStatement(query string, args []driver.NamedValue, err error) (shadowStatement, bool) {
+	s := c.driver.Shadow
+	if s == nil || err != nil {
+		return shadowStatement{}, false
+	}
+	if IsReadOnlyStatement(query) {
+		if !s.Reads {
+			return shadowStatement{}, false
+		}
+	} else if !s.Writes {
+		return shadowStatement{}, false
+	}
+
+	//the caller may reuse its buffers after the statement has been executed
+	stmt := shadowStatement{query: query, args: make([]driver.NamedValue, len(args))}
+	copy(stmt.args, args)
+	for idx, arg := range stmt.args {
+		if buf, ok := arg.Value.([]byte); ok {
+			stmt.args[idx].Value = append([]byte(nil), buf...)
+		}
+	}
+	return stmt, true
+}
+
+//mirrorTransaction implements Driver.Shadow for a transaction that was
+//committed successfully on the primary database.
+func (t *transaction) mirrorTransaction(hooks *Hooks) {
+	s := t.conn.driver.Shadow
+	if s == nil || len(t.shadowStatements) == 0 {
+		return
+	}
+	s.enqueue(shadowJob{driver: t.conn.driver, hooks: hooks, statements: t.shadowStatements, transaction: true})
+}
+
+//compareRow is called by resultRows for each row returned by the proxied
+//driver.
+func (r *resultRows) compareRow(row []driver.Value) {
+	if c := r.event.shadow; c != nil {
+		c.rows++
+		c.checksum.add(row)
+	}
+}
@@ -0,0 +1,194 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func Test_Shadow(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	shadowFile := filepath.Join(t.TempDir(), "shadow.sqlite")
+	for _, dsn := range []string{sqliteFile, shadowFile} {
+		db := sql.OpenDB(NewConnector(New("sqlite3"), "file:"+dsn))
+		tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`))
+		tt.Must(db.Close())
+	}
+
+	shadow := NewShadow("file:" + shadowFile)
+	shadow.Writes = true
+	shadow.Workers = 1
+	var (
+		mutex  sync.Mutex
+		events []QueryEvent
+	)
+	d := New("sqlite3", WithShadow(shadow), WithShadowQueryHook(func(e QueryEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, e)
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+
+	tt.MustResult(db.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, 1, "alice"))
+	tx, err := db.Begin()
+	tt.Must(err)
+	tt.MustResult(tx.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, 2, "bob"))
+	tt.Must(tx.Commit())
+	tx, err = db.Begin()
+	tt.Must(err)
+	tt.MustResult(tx.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, 3, "carol"))
+	tt.Must(tx.Rollback())
+	_, err = db.Exec(`INSERT INTO nonexistent (id) VALUES (4)`)
+	if err == nil {
+		t.Fatal("expected INSERT into nonexistent table to fail")
+	}
+	rows := tt.MustRows(db.Query(`SELECT name FROM users WHERE id > ?`, 0))
+	tt.Must(rows.Close())
+	tt.Must(db.Close())
+	tt.Must(shadow.Close())
+
+	//the shadow database has seen the same writes as the primary
+	db = sql.OpenDB(NewConnector(New("sqlite3"), "file:"+shadowFile))
+	var names []string
+	rows = tt.MustRows(db.Query(`SELECT name FROM users ORDER BY id`))
+	for rows.Next() {
+		var name string
+		tt.Must(rows.Scan(&name))
+		names = append(names, name)
+	}
+	tt.Must(rows.Close())
+	tt.Must(db.Close())
+	if !reflect.DeepEqual(names, []string{"alice", "bob"}) {
+		tt.Unexpected("names in shadow database", []string{"alice", "bob"}, names)
+	}
+
+	var queries []string
+	for _, e := range events {
+		if e.Err != nil {
+			t.Errorf("unexpected error for mirrored statement %q: %s", e.Query, e.Err.Error())
+		}
+		queries = append(queries, e.Query)
+	}
+	expected := []string{
+		`INSERT INTO users (id, name) VALUES (?, ?)`,
+		`INSERT INTO users (id, name) VALUES (?, ?)`,
+		`SELECT name FROM users WHERE id > ?`,
+	}
+	if !reflect.DeepEqual(queries, expected) {
+		tt.Unexpected("mirrored statements", expected, queries)
+	}
+	if len(events) == 3 && events[2].Rows != 2 {
+		t.Errorf("expected mirrored SELECT to read 2 rows, got %d", events[2].Rows)
+	}
+	if shadow.Dropped() != 0 {
+		t.Errorf("expected no dropped statements, got %d", shadow.Dropped())
+	}
+	tt.CleanupDB()
+}
+
+func Test_ShadowCompareReads(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	//the shadow database has the same rows in a different order, plus one
+	//row that differs
+	shadowFile := filepath.Join(t.TempDir(), "shadow.sqlite")
+	setup := map[string][]string{
+		sqliteFile: {`(1, 'alice')`, `(2, 'bob')`, `(3, 'carol')`},
+		shadowFile: {`(2, 'bob')`, `(1, 'alice')`, `(3, 'Carol')`},
+	}
+	for dsn, values := range setup {
+		db := sql.OpenDB(NewConnector(New("sqlite3"), "file:"+dsn))
+		tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`))
+		for _, value := range values {
+			tt.MustResult(db.Exec(`INSERT INTO users (id, name) VALUES ` + value))
+		}
+		tt.Must(db.Close())
+	}
+
+	shadow := NewShadow("file:" + shadowFile)
+	shadow.CompareReads = true
+	shadow.Workers = 1
+	var (
+		mutex       sync.Mutex
+		mirrored    []string
+		divergences []DivergenceEvent
+	)
+	d := New("sqlite3", WithShadow(shadow),
+		WithShadowQueryHook(func(e QueryEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			mirrored = append(mirrored, e.Query)
+		}),
+		WithDivergenceHook(func(e DivergenceEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			divergences = append(divergences, e)
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+
+	readAll := func(query string, args ...interface{}) {
+		t.Helper()
+		rows := tt.MustRows(db.Query(query, args...))
+		for rows.Next() {
+		}
+		tt.Must(rows.Err())
+		tt.Must(rows.Close())
+	}
+	//same rows in different order -> no divergence
+	readAll(`SELECT id, name FROM users WHERE id < ?`, 3)
+	//different rows -> divergence
+	readAll(`SELECT id, name FROM users WHERE id >= ?`, 2)
+	//result set not read completely -> mirrored without comparison
+	rows := tt.MustRows(db.Query(`SELECT name FROM users ORDER BY id`))
+	tt.Must(rows.Close())
+	tt.Must(db.Close())
+	tt.Must(shadow.Close())
+
+	expectedMirrored := []string{
+		`SELECT id, name FROM users WHERE id < ?`,
+		`SELECT id, name FROM users WHERE id >= ?`,
+		`SELECT name FROM users ORDER BY id`,
+	}
+	if !reflect.DeepEqual(mirrored, expectedMirrored) {
+		tt.Unexpected("mirrored statements", expectedMirrored, mirrored)
+	}
+	if len(divergences) != 1 {
+		t.Fatalf("expected 1 divergence, got %#v", divergences)
+	}
+	e := divergences[0]
+	if e.Query != `SELECT id, name FROM users WHERE id >= ?` || !reflect.DeepEqual(e.Args, []interface{}{int64(2)}) {
+		t.Errorf("divergence reported for wrong statement: %q with %#v", e.Query, e.Args)
+	}
+	if e.PrimaryRows != 2 || e.ShadowRows != 2 {
+		t.Errorf("expected 2 rows on both sides, got %d and %d", e.PrimaryRows, e.ShadowRows)
+	}
+	if e.PrimaryChecksum == e.ShadowChecksum {
+		t.Error("expected checksums to differ")
+	}
+	tt.CleanupDB()
+}
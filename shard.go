@@ -0,0 +1,192 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//ShardRouter sends statements to one of several databases (shards) with the
+//same schema. Each shard has its own connection pool, which is opened through
+//the given Driver on first use, so all shards share the same hooks. For
+//example:
+//
+//	router := sqlproxy.NewShardRouter(sqlproxy.New("postgres"), map[string]string{
+//		"eu": "postgres://db-eu/app",
+//		"us": "postgres://db-us/app",
+//	}, nil)
+//	defer router.Close()
+//	ctx = sqlproxy.WithShard(ctx, "eu")
+//	rows, err := router.QueryContext(ctx, `SELECT * FROM users WHERE region = $1`, "eu")
+//
+//The shard for each statement is chosen by the ShardFunc given to
+//NewShardRouter(). Within the statement's context, ShardFromContext() returns
+//the chosen shard, so it can be picked up by hooks like the CorrelationHook
+//or by Driver.TenantFromContext.
+type ShardRouter struct {
+	driver      *Driver
+	dataSources map[string]string
+	shardFunc   func(ctx context.Context, query string, args []interface{}) (string, error)
+
+	mutex sync.Mutex
+	dbs   map[string]*sql.DB
+}
+
+//NewShardRouter creates a ShardRouter for the given shards, which are given as
+//a map of shard name to data source name for the proxied driver of d.
+//
+//The shardFunc chooses the shard for a statement, e.g. by looking at the
+//customer ID in the context or in the arguments. For BeginTx(), the query is
+//empty and args is nil, so the shard must be derivable from the context.
+//If shardFunc is nil, the shard is taken from the context (see WithShard).
+func NewShardRouter(d *Driver, dataSources map[string]string, shardFunc func(ctx context.Context, query string, args []interface{}) (string, error)) *ShardRouter {
+	if shardFunc == nil {
+		shardFunc = shardFromContextOrError
+	}
+	return &ShardRouter{
+		driver:      d,
+		dataSources: dataSources,
+		shardFunc:   shardFunc,
+		dbs:         make(map[string]*sql.DB),
+	}
+}
+
+type shardKey struct{}
+
+//WithShard returns a context that selects the given shard for the default
+//shardFunc of NewShardRouter().
+func WithShard(ctx context.Context, shard string) context.Context {
+	return context.WithValue(ctx, shardKey{}, shard)
+}
+
+//ShardFromContext returns the shard that was given to WithShard(), or the
+//empty string if none was given.
+func ShardFromContext(ctx context.Context) string {
+	shard, _ := ctx.Value(shardKey{}).(string)
+	return shard
+}
+
+func shardFromContextOrError(ctx context.Context, query string, args []interface{}) (string, error) {
+	shard := ShardFromContext(ctx)
+	if shard == "" {
+		return "", errors.New("sqlproxy: no shard selected in context")
+	}
+	return shard, nil
+}
+
+//Shards returns the names of all shards, in alphabetical order.
+func (r *ShardRouter) Shards() []string {
+	result := make([]string, 0, len(r.dataSources))
+	for shard := range r.dataSources {
+		result = append(result, shard)
+	}
+	sort.Strings(result)
+	return result
+}
+
+//DB returns the connection pool for the given shard, e.g. for configuring
+//its limits with SetMaxOpenConns() etc. or for statements that shall be
+//executed on each shard.
+func (r *ShardRouter) DB(shard string) (*sql.DB, error) {
+	dataSource, exists := r.dataSources[shard]
+	if !exists {
+		return nil, fmt.Errorf("sqlproxy: unknown shard: %q", shard)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	db := r.dbs[shard]
+	if db == nil {
+		db = sql.OpenDB(NewConnector(r.driver, dataSource))
+		r.dbs[shard] = db
+	}
+	return db, nil
+}
+
+//For returns the connection pool that the given statement shall be executed
+//on, and a context in which ShardFromContext() returns the chosen shard.
+//This can be used for the methods of sql.DB that ShardRouter does not
+//provide itself:
+//
+//	db, ctx, err := router.For(ctx, query, args...)
+//	if err != nil { ... }
+//	err = db.QueryRowContext(ctx, query, args...).Scan(&result)
+func (r *ShardRouter) For(ctx context.Context, query string, args ...interface{}) (*sql.DB, context.Context, error) {
+	shard, err := r.shardFunc(ctx, query, args)
+	if err != nil {
+		return nil, ctx, err
+	}
+	db, err := r.DB(shard)
+	if err != nil {
+		return nil, ctx, err
+	}
+	if ShardFromContext(ctx) != shard {
+		ctx = WithShard(ctx, shard)
+	}
+	return db, ctx, nil
+}
+
+//ExecContext executes the given statement on the shard chosen by the
+//shardFunc.
+func (r *ShardRouter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db, ctx, err := r.For(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecContext(ctx, query, args...)
+}
+
+//QueryContext executes the given query on the shard chosen by the shardFunc.
+func (r *ShardRouter) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	db, ctx, err := r.For(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryContext(ctx, query, args...)
+}
+
+//BeginTx starts a transaction on the shard chosen by the shardFunc (which
+//receives an empty query). All statements executed within the transaction
+//go to the same shard.
+func (r *ShardRouter) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	db, ctx, err := r.For(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	return db.BeginTx(ctx, opts)
+}
+
+//Close closes the connection pools of all shards.
+func (r *ShardRouter) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var errs []error
+	for shard, db := range r.dbs {
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("shard %q: %w", shard, err))
+		}
+		delete(r.dbs, shard)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,115 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_ShardRouter(t *testing.T) {
+	tt := TT{t}
+	dir := t.TempDir()
+	dataSources := map[string]string{
+		"even": "file:" + filepath.Join(dir, "even.sqlite"),
+		"odd":  "file:" + filepath.Join(dir, "odd.sqlite"),
+	}
+
+	var shardsSeen []string
+	d := New("sqlite3", WithCorrelation(func(ctx context.Context) map[string]string {
+		shardsSeen = append(shardsSeen, ShardFromContext(ctx))
+		return nil
+	}))
+	//choose the shard by the first argument if there is one, or else by the context
+	router := NewShardRouter(d, dataSources, func(ctx context.Context, query string, args []interface{}) (string, error) {
+		if len(args) == 0 {
+			return ShardFromContext(ctx), nil
+		}
+		if args[0].(int)%2 == 0 {
+			return "even", nil
+		}
+		return "odd", nil
+	})
+	if actual := router.Shards(); !reflect.DeepEqual(actual, []string{"even", "odd"}) {
+		tt.Unexpected("shards", []string{"even", "odd"}, actual)
+	}
+
+	for _, shard := range router.Shards() {
+		db, err := router.DB(shard)
+		tt.Must(err)
+		tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER)`))
+	}
+	for id := 1; id <= 5; id++ {
+		tt.MustResult(router.ExecContext(context.Background(), `INSERT INTO users VALUES ($1)`, id))
+	}
+
+	countUsers := func(shard string) (count int) {
+		tx, err := router.BeginTx(WithShard(context.Background(), shard), nil)
+		tt.Must(err)
+		tt.Must(tx.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count))
+		tt.Must(tx.Commit())
+		return count
+	}
+	if actual := fmt.Sprintf("even=%d odd=%d", countUsers("even"), countUsers("odd")); actual != "even=2 odd=3" {
+		tt.Unexpected("users per shard", "even=2 odd=3", actual)
+	}
+
+	rows, err := router.QueryContext(context.Background(), `SELECT id FROM users WHERE id = $1`, 4)
+	tt.Must(err)
+	var ids []int
+	for rows.Next() {
+		var id int
+		tt.Must(rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	tt.Must(rows.Err())
+	tt.Must(rows.Close())
+	if !reflect.DeepEqual(ids, []int{4}) {
+		tt.Unexpected("ids", []int{4}, ids)
+	}
+
+	//statements within transactions have their own context, so only the
+	//BeginTx() carries the shard
+	expectedShards := []string{"odd", "even", "odd", "even", "odd", "even", "", "odd", "", "even"}
+	//the CREATE TABLE statements were executed on the DBs directly and have no shard in context
+	if !reflect.DeepEqual(shardsSeen[2:], expectedShards) {
+		tt.Unexpected("shards seen by hooks", expectedShards, shardsSeen[2:])
+	}
+
+	_, err = router.ExecContext(WithShard(context.Background(), "nonexistent"), `DELETE FROM users`)
+	if err == nil || err.Error() != `sqlproxy: unknown shard: "nonexistent"` {
+		t.Errorf("expected unknown shard error, got err = %v", err)
+	}
+	tt.Must(router.Close())
+}
+
+func Test_ShardRouterDefaultShardFunc(t *testing.T) {
+	router := NewShardRouter(New("sqlite3"), map[string]string{"main": "file::memory:"}, nil)
+	defer router.Close()
+	_, err := router.ExecContext(context.Background(), `SELECT 1`)
+	if err == nil || err.Error() != "sqlproxy: no shard selected in context" {
+		t.Errorf("expected missing shard error, got err = %v", err)
+	}
+	_, err = router.ExecContext(WithShard(context.Background(), "main"), `SELECT 1`)
+	TT{t}.Must(err)
+}
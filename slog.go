@@ -0,0 +1,137 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+//LogQueries produces a function that can be given to a sqlproxy.Driver as an
+//AfterQueryHook. It logs every executed statement to the given logger (or to
+//slog.Default() if nil) with the following attributes:
+//
+//	query          - the query string, with comments removed and whitespace collapsed
+//	args           - the bound arguments, formatted like in TraceQuery()
+//	duration       - see QueryEvent.Duration
+//	rows           - see QueryEvent.Rows
+//	error          - only if the statement failed
+//	connection_id  - see QueryEvent.ConnectionID
+//
+//The tenant, the query name (see QueryEvent.QueryName), the caller (see
+//Driver.CaptureCaller) and fields from the CorrelationHook are added as
+//further attributes.
+//
+//Successful statements are logged at level Info, failed ones at level Error.
+//For example:
+//
+//	sql.Register("postgres-with-logging", sqlproxy.New("postgres",
+//		sqlproxy.WithAfterQuery(sqlproxy.LogQueries(slog.Default())),
+//	))
+func LogQueries(logger *slog.Logger) func(QueryEvent) {
+	return func(e QueryEvent) {
+		l := logger
+		if l == nil {
+			l = slog.Default()
+		}
+
+		attrs := []slog.Attr{
+			slog.String("query", formatQuery(e.Query, nil)),
+			slog.Any("args", formatArgs(e.Args)),
+			slog.Duration("duration", e.Duration),
+			slog.Int64("rows", e.Rows),
+			slog.Uint64("connection_id", e.ConnectionID),
+		}
+
+		level := slog.LevelInfo
+		if e.Err != nil {
+			level = slog.LevelError
+			attrs = append(attrs, slog.String("error", e.Err.Error()))
+		}
+		attrs = append(attrs, e.fieldAttrs()...)
+		l.LogAttrs(context.Background(), level, "SQL statement executed", attrs...)
+	}
+}
+
+//LogFormat is an output format for NewQueryLogger().
+type LogFormat string
+
+const (
+	//LogFormatText is a human-readable format with one line per statement,
+	//similar to TraceQuery().
+	LogFormatText LogFormat = "text"
+	//LogFormatJSON is the format of slog.NewJSONHandler().
+	LogFormatJSON LogFormat = "json"
+	//LogFormatLogfmt is the format of slog.NewTextHandler(), which is
+	//compatible with logfmt.
+	LogFormatLogfmt LogFormat = "logfmt"
+)
+
+//NewQueryLogger is like LogQueries(), but writes directly to the given writer
+//in the given format. This is useful when the query log shall go to a
+//separate file or into a log pipeline, independently of the application's
+//own logging. An error is returned for unknown formats.
+//
+//In LogFormatText, each statement is written as a single line like this:
+//
+//	2026-01-02T15:04:05Z SQL 1.234ms conn=3 rows=2: SELECT * FROM users WHERE id = $1 [42]
+//
+//Failed statements have " -> error: <message>" appended to the line. The
+//tenant, query name, caller and fields from the CorrelationHook are inserted
+//after the row count.
+func NewQueryLogger(w io.Writer, format LogFormat) (func(QueryEvent), error) {
+	switch format {
+	case LogFormatText:
+		var mutex sync.Mutex
+		return func(e QueryEvent) {
+			line := formatQueryLogLine(time.Now(), e)
+			mutex.Lock()
+			defer mutex.Unlock()
+			io.WriteString(w, line)
+		}, nil
+	case LogFormatJSON:
+		return LogQueries(slog.New(slog.NewJSONHandler(w, nil))), nil
+	case LogFormatLogfmt:
+		return LogQueries(slog.New(slog.NewTextHandler(w, nil))), nil
+	default:
+		return nil, fmt.Errorf("sqlproxy: unknown log format: %q", format)
+	}
+}
+
+func formatQueryLogLine(now time.Time, e QueryEvent) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s SQL %s conn=%d rows=%d", now.UTC().Format(time.RFC3339), e.Duration, e.ConnectionID, e.Rows)
+	for _, attr := range e.fieldAttrs() {
+		fmt.Fprintf(&b, " %s=%s", attr.Key, attr.Value.String())
+	}
+	b.WriteString(": ")
+	b.WriteString(formatQuery(e.Query, e.Args))
+	if e.Err != nil {
+		b.WriteString(" -> error: ")
+		b.WriteString(strings.ReplaceAll(e.Err.Error(), "\n", " "))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,143 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_LogQueries(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			//remove nondeterministic attributes
+			if a.Key == slog.TimeKey || a.Key == "duration" || a.Key == "connection_id" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	type requestIDKey struct{}
+	d := New("sqlite3",
+		WithAfterQuery(LogQueries(logger)),
+		WithCorrelation(func(ctx context.Context) map[string]string {
+			if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+				return map[string]string{"request_id": id}
+			}
+			return nil
+		}),
+	)
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	db.SetMaxOpenConns(1)
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES ($1, $2)`, 42, "truth"))
+	var thing string
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc123")
+	tt.Must(db.QueryRowContext(ctx, `SELECT thing FROM knowledge WHERE number = $1`, 42).Scan(&thing))
+	_, err := db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Error("expected DELETE on nonexistent table to fail, but it succeeded")
+	}
+	tt.Must(db.Close())
+
+	expected := []string{
+		`level=INFO msg="SQL statement executed" query="CREATE TABLE knowledge (number INTEGER, thing TEXT)" args=[] rows=0`,
+		`level=INFO msg="SQL statement executed" query="INSERT INTO knowledge VALUES ($1, $2)" args="[42 \"truth\"]" rows=1`,
+		`level=INFO msg="SQL statement executed" query="SELECT thing FROM knowledge WHERE number = $1" args=[42] rows=1 request_id=abc123`,
+		`level=ERROR msg="SQL statement executed" query="DELETE FROM nonexistent" args=[] rows=0 error="no such table: nonexistent"`,
+	}
+	actual := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(actual) != len(expected) {
+		tt.Unexpected("log lines", expected, actual)
+	} else {
+		for idx := range expected {
+			if actual[idx] != expected[idx] {
+				tt.Unexpected("log line", expected[idx], actual[idx])
+			}
+		}
+	}
+
+	tt.CleanupDB()
+}
+
+func Test_NewQueryLogger(t *testing.T) {
+	tt := TT{t}
+
+	e := QueryEvent{
+		Query:        "SELECT *\n  FROM users WHERE id = $1",
+		Args:         []interface{}{int64(42)},
+		Duration:     1234 * time.Microsecond,
+		Rows:         1,
+		ConnectionID: 3,
+		Fields:       map[string]string{"request_id": "abc123"},
+	}
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	expected := "2026-01-02T15:04:05Z SQL 1.234ms conn=3 rows=1 request_id=abc123: SELECT * FROM users WHERE id = $1 [42]\n"
+	if actual := formatQueryLogLine(now, e); actual != expected {
+		tt.Unexpected("text log line", expected, actual)
+	}
+	e.Err = errors.New("connection reset")
+	expected = strings.TrimSuffix(expected, "\n") + " -> error: connection reset\n"
+	if actual := formatQueryLogLine(now, e); actual != expected {
+		tt.Unexpected("text log line", expected, actual)
+	}
+
+	var buf bytes.Buffer
+	logger, err := NewQueryLogger(&buf, LogFormatJSON)
+	tt.Must(err)
+	logger(e)
+	var record map[string]interface{}
+	tt.Must(json.Unmarshal(buf.Bytes(), &record))
+	for key, value := range map[string]interface{}{
+		"level":      "ERROR",
+		"query":      "SELECT * FROM users WHERE id = $1",
+		"error":      "connection reset",
+		"request_id": "abc123",
+	} {
+		if record[key] != value {
+			tt.Unexpected(key, value, record[key])
+		}
+	}
+
+	buf.Reset()
+	logger, err = NewQueryLogger(&buf, LogFormatLogfmt)
+	tt.Must(err)
+	logger(e)
+	if !strings.Contains(buf.String(), ` query="SELECT * FROM users WHERE id = $1" args=[42] duration=1.234ms rows=1 connection_id=3 error="connection reset" request_id=abc123`) {
+		t.Errorf("unexpected logfmt output: %q", buf.String())
+	}
+
+	_, err = NewQueryLogger(&buf, LogFormat("xml"))
+	if err == nil {
+		t.Error("expected NewQueryLogger() to fail for unknown format, but it succeeded")
+	}
+}
@@ -0,0 +1,291 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"sort"
+	"strings"
+)
+
+//SoftDeleteFilter returns a BeforePrepareHook that enforces soft-delete
+//semantics: SELECT statements that read from one of the given tables are
+//rewritten to only see rows that have not been deleted. The map contains the
+//name of the deletion marker column for each table, e.g.
+//
+//	hook := sqlproxy.SoftDeleteFilter(map[string]string{
+//		"users":    "deleted_at",
+//		"projects": "deleted_at",
+//		"invoices": "cancelled_at",
+//	}, "/* include deleted */")
+//
+//turns "SELECT * FROM users u JOIN projects p ON p.owner_id = u.id WHERE u.id
+//= $1" into "SELECT * FROM users u JOIN projects p ON p.deleted_at IS NULL AND
+//(p.owner_id = u.id) WHERE u.deleted_at IS NULL AND (u.id = $1)". Conditions
+//for joined tables go into the ON clause, so that outer joins keep their
+//meaning. Statements that shall see deleted rows can be exempted by including
+//the given marker. Table names are matched case-insensitively, either with or
+//without schema name.
+//
+//This is a best-effort rewrite, not a full SQL parser: Only the outermost
+//SELECT (or each part of a UNION etc.) is rewritten, not subqueries or CTEs,
+//and tables joined with USING or NATURAL JOIN get their condition in the WHERE
+//clause.
+func SoftDeleteFilter(columns map[string]string, marker string) func(query string) (string, error) {
+	columnFor := make(map[string]string, len(columns))
+	for table, column := range columns {
+		columnFor[strings.ToLower(table)] = column
+	}
+	predicateFor := func(table, qualifier string) (string, bool) {
+		column, exists := columnFor[table]
+		return qualifier + "." + column + " IS NULL", exists
+	}
+	return func(query string) (string, error) {
+		if StatementType(query) != "select" || (marker != "" && strings.Contains(query, marker)) {
+			return query, nil
+		}
+		return injectPredicates(query, predicateFor), nil
+	}
+}
+
+//injectPredicates adds conditions to the WHERE clause (or, for joined tables,
+//the ON clause) of the given SELECT, UPDATE or DELETE statement, like
+//SoftDeleteFilter describes. For each table that the statement reads from or
+//modifies, predicateFor is called with the table name (in lower case and
+//without quotes) and the name or alias that the table is referred to by in the
+//statement. It returns the condition for this table, or false if the table
+//shall not be restricted. If the table name includes a schema name and no
+//condition is returned for it, predicateFor is called again with the
+//unqualified table name.
+func injectPredicates(query string, predicateFor func(table, qualifier string) (string, bool)) string {
+	var insertions []sqlInsertion
+	tokens := tokenizeSQL(query)
+	segmentStart, depth := 0, 0
+	for idx, token := range tokens {
+		switch token.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth == 0 && token.kind == sqlTokenWord && setOperationKeywords[strings.ToUpper(token.text)] {
+			insertions = append(insertions, predicateInsertions(tokens[segmentStart:idx], predicateFor)...)
+			segmentStart = idx + 1
+		}
+	}
+	insertions = append(insertions, predicateInsertions(tokens[segmentStart:], predicateFor)...)
+	return applyInsertions(query, insertions)
+}
+
+var (
+	setOperationKeywords = map[string]bool{"UNION": true, "INTERSECT": true, "EXCEPT": true}
+	joinKeywords         = map[string]bool{
+		"JOIN": true, "LEFT": true, "RIGHT": true, "INNER": true, "OUTER": true,
+		"FULL": true, "CROSS": true, "NATURAL": true, "LATERAL": true, "STRAIGHT_JOIN": true,
+	}
+	//keywords that end a WHERE clause (or the FROM clause, if there is no WHERE)
+	whereClauseEnd = map[string]bool{
+		"GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true, "OFFSET": true,
+		"FETCH": true, "FOR": true, "WINDOW": true, "RETURNING": true,
+	}
+)
+
+//sqlInsertion is a piece of text that shall be inserted into a query at the
+//given offset.
+type sqlInsertion struct {
+	offset int
+	text   string
+}
+
+//applyInsertions applies the given insertions to the query. Insertions at the
+//same offset are applied in the given order.
+func applyInsertions(query string, insertions []sqlInsertion) string {
+	if len(insertions) == 0 {
+		return query
+	}
+	sort.SliceStable(insertions, func(i, j int) bool {
+		return insertions[i].offset < insertions[j].offset
+	})
+	var b strings.Builder
+	offset := 0
+	for _, ins := range insertions {
+		b.WriteString(query[offset:ins.offset])
+		b.WriteString(ins.text)
+		offset = ins.offset
+	}
+	b.WriteString(query[offset:])
+	return b.String()
+}
+
+//predicateInsertions implements injectPredicates for one statement (without
+//set operations like UNION).
+func predicateInsertions(tokens []sqlToken, predicateFor func(table, qualifier string) (string, bool)) []sqlInsertion {
+	//ignore a trailing semicolon
+	if len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	endOf := func(idx int) int {
+		return tokens[idx].offset + len(tokens[idx].text)
+	}
+	//clauseEnd returns the index of the first token at depth 0 after idx
+	//that matches the predicate, or len(tokens).
+	clauseEnd := func(idx int, isEnd func(keyword string) bool) int {
+		depth := 0
+		for idx++; idx < len(tokens); idx++ {
+			switch tokens[idx].text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			if depth == 0 && (tokens[idx].text == "," || (tokens[idx].kind == sqlTokenWord && isEnd(strings.ToUpper(tokens[idx].text)))) {
+				break
+			}
+		}
+		return idx
+	}
+
+	var (
+		result        []sqlInsertion
+		whereConds    []string
+		whereIdx      = -1
+		fromEndIdx    = -1
+		inFromList    = false
+		expectTable   = false
+		isJoinedTable = false
+		depth         = 0
+	)
+	for idx := 0; idx < len(tokens); idx++ {
+		token := tokens[idx]
+		switch token.text {
+		case "(":
+			depth++
+			expectTable = false
+		case ")":
+			depth--
+		}
+		if depth > 0 || token.text == ")" {
+			continue
+		}
+		keyword := ""
+		if token.kind == sqlTokenWord {
+			keyword = strings.ToUpper(token.text)
+		}
+
+		switch {
+		case keyword == "FROM":
+			inFromList, expectTable, isJoinedTable = true, true, false
+		case keyword == "UPDATE" && idx == 0:
+			//"UPDATE a, b SET ..." lists tables like a FROM clause
+			inFromList, expectTable, isJoinedTable = true, true, false
+		case keyword == "JOIN" || keyword == "STRAIGHT_JOIN":
+			inFromList, expectTable, isJoinedTable = false, true, true
+		case token.text == "," && inFromList:
+			expectTable, isJoinedTable = true, false
+		case keyword == "SET" && inFromList:
+			inFromList = false
+		case keyword == "WHERE":
+			inFromList = false
+			whereIdx = idx
+		case whereClauseEnd[keyword]:
+			inFromList = false
+			if fromEndIdx == -1 {
+				fromEndIdx = idx
+			}
+		case expectTable && keyword == "ONLY":
+			//"FROM ONLY table" (PostgreSQL): the table name follows
+		case expectTable && (keyword != "" || strings.HasPrefix(token.text, `"`) || strings.HasPrefix(token.text, "`")):
+			expectTable = false
+			if joinKeywords[keyword] {
+				continue
+			}
+			//table name, possibly qualified with a schema name
+			nameStart := idx
+			for idx+2 < len(tokens) && tokens[idx+1].text == "." {
+				idx += 2
+			}
+			name := strings.NewReplacer(`"`, "", "`", "").Replace(strings.ToLower(tokens[nameStart].text))
+			for i := nameStart + 2; i <= idx; i += 2 {
+				name += "." + strings.NewReplacer(`"`, "", "`", "").Replace(strings.ToLower(tokens[i].text))
+			}
+			qualifier := tokens[idx].text
+			//optional alias
+			aliasIdx := idx + 1
+			if aliasIdx < len(tokens) && strings.EqualFold(tokens[aliasIdx].text, "AS") {
+				aliasIdx++
+			}
+			if aliasIdx < len(tokens) && isAlias(tokens[aliasIdx]) {
+				qualifier = tokens[aliasIdx].text
+				idx = aliasIdx
+			}
+
+			condition, exists := predicateFor(name, qualifier)
+			if !exists {
+				if dot := strings.LastIndexByte(name, '.'); dot >= 0 {
+					condition, exists = predicateFor(name[dot+1:], qualifier)
+				}
+			}
+			if !exists {
+				continue
+			}
+
+			if isJoinedTable && idx+2 < len(tokens) && strings.EqualFold(tokens[idx+1].text, "ON") {
+				end := clauseEnd(idx+1, func(keyword string) bool {
+					return joinKeywords[keyword] || keyword == "WHERE" || whereClauseEnd[keyword]
+				})
+				result = append(result,
+					sqlInsertion{tokens[idx+2].offset, condition + " AND ("},
+					sqlInsertion{endOf(end - 1), ")"},
+				)
+			} else {
+				whereConds = append(whereConds, condition)
+			}
+		}
+	}
+	if len(whereConds) == 0 {
+		return result
+	}
+
+	conditions := strings.Join(whereConds, " AND ")
+	if whereIdx >= 0 && whereIdx+1 < len(tokens) {
+		end := clauseEnd(whereIdx, func(keyword string) bool { return whereClauseEnd[keyword] })
+		return append(result,
+			sqlInsertion{tokens[whereIdx+1].offset, conditions + " AND ("},
+			sqlInsertion{endOf(end - 1), ")"},
+		)
+	}
+	if fromEndIdx == -1 {
+		fromEndIdx = len(tokens)
+	}
+	return append(result, sqlInsertion{endOf(fromEndIdx - 1), " WHERE " + conditions})
+}
+
+//isAlias returns whether the token after a table name is an alias.
+func isAlias(t sqlToken) bool {
+	switch t.kind {
+	case sqlTokenWord:
+		keyword := strings.ToUpper(t.text)
+		return !joinKeywords[keyword] && !fromClauseEnd[keyword] && !whereClauseEnd[keyword] &&
+			!setOperationKeywords[keyword] && keyword != "WHERE" && keyword != "ON" && keyword != "USING"
+	case sqlTokenOther:
+		return strings.HasPrefix(t.text, `"`) || strings.HasPrefix(t.text, "`")
+	default:
+		return false
+	}
+}
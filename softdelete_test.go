@@ -0,0 +1,87 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func Test_SoftDeleteFilter(t *testing.T) {
+	hook := SoftDeleteFilter(map[string]string{
+		"users":    "deleted_at",
+		"Projects": "removed_at",
+	}, "/* include deleted */")
+
+	testCases := map[string]string{
+		//not affected
+		`SELECT 1`:                                  `SELECT 1`,
+		`SELECT * FROM groups WHERE id = $1`:        `SELECT * FROM groups WHERE id = $1`,
+		`UPDATE users SET name = $1`:                `UPDATE users SET name = $1`,
+		`SELECT * FROM users /* include deleted */`: `SELECT * FROM users /* include deleted */`,
+		//without WHERE clause
+		`SELECT * FROM users`:                   `SELECT * FROM users WHERE users.deleted_at IS NULL`,
+		`SELECT * FROM users;`:                  `SELECT * FROM users WHERE users.deleted_at IS NULL;`,
+		`SELECT * FROM users -- all of them`:    `SELECT * FROM users WHERE users.deleted_at IS NULL -- all of them`,
+		`SELECT * FROM users u ORDER BY u.name`: `SELECT * FROM users u WHERE u.deleted_at IS NULL ORDER BY u.name`,
+		`SELECT * FROM public."users" LIMIT 10`: `SELECT * FROM public."users" WHERE "users".deleted_at IS NULL LIMIT 10`,
+		//with WHERE clause
+		`SELECT * FROM users AS u WHERE u.id = $1 OR u.id = $2 LIMIT 1`: `SELECT * FROM users AS u WHERE u.deleted_at IS NULL AND (u.id = $1 OR u.id = $2) LIMIT 1`,
+		`SELECT * FROM groups g, users WHERE g.id = users.group_id`:     `SELECT * FROM groups g, users WHERE users.deleted_at IS NULL AND (g.id = users.group_id)`,
+		`SELECT * FROM users WHERE id IN (SELECT user_id FROM users)`:   `SELECT * FROM users WHERE users.deleted_at IS NULL AND (id IN (SELECT user_id FROM users))`,
+		//with joins
+		`SELECT * FROM users u LEFT JOIN projects p ON p.owner_id = u.id WHERE u.id = $1`: `SELECT * FROM users u LEFT JOIN projects p ON p.removed_at IS NULL AND (p.owner_id = u.id) WHERE u.deleted_at IS NULL AND (u.id = $1)`,
+		`SELECT * FROM groups g JOIN users USING (group_id)`:                              `SELECT * FROM groups g JOIN users USING (group_id) WHERE users.deleted_at IS NULL`,
+		//with set operations
+		`SELECT id FROM users UNION SELECT id FROM projects WHERE x = 1`: `SELECT id FROM users WHERE users.deleted_at IS NULL UNION SELECT id FROM projects WHERE projects.removed_at IS NULL AND (x = 1)`,
+	}
+	for query, expected := range testCases {
+		actual, err := hook(query)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", query, err.Error())
+		}
+		if actual != expected {
+			TT{t}.Unexpected("rewrite of "+query, expected, actual)
+		}
+	}
+}
+
+func Test_SoftDeleteFilterIntegration(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	hook := SoftDeleteFilter(map[string]string{"users": "deleted_at"}, "/* include deleted */")
+	db := sql.OpenDB(NewConnector(New("sqlite3", WithBeforePrepare(hook)), "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE users (name TEXT, deleted_at TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO users VALUES ('alice', NULL), ('bob', '2026-01-01')`))
+
+	var count int
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count))
+	if count != 1 {
+		t.Errorf("expected 1 visible user, got %d", count)
+	}
+	tt.Must(db.QueryRow(`SELECT COUNT(*) FROM users /* include deleted */`).Scan(&count))
+	if count != 2 {
+		t.Errorf("expected 2 users including deleted ones, got %d", count)
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
@@ -0,0 +1,184 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package containers starts database servers in Docker containers for
+//integration tests, and connects to them through a sqlproxy.Driver that
+//records all statements:
+//
+//	import _ "github.com/lib/pq"
+//
+//	func TestFailover(t *testing.T) {
+//		db := containers.StartPostgres(t, sqlproxy.WithChaos(...))
+//		... //exercise the code under test with db.DB
+//		db.Driver.Stats() //or replay db.Recording with sqlproxy.NewReplayDriver()
+//	}
+//
+//The proxied driver ("postgres" or "mysql") must be imported by the test. The
+//docker CLI must be installed; otherwise the test is skipped. Containers are
+//removed when the test finishes. This package is intentionally small, so that
+//it can also serve as a template for projects with different needs.
+package containers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/majewsky/sqlproxy"
+)
+
+//PostgresImage and MySQLImage are the container images used by StartPostgres
+//and StartMySQL.
+var (
+	PostgresImage = "postgres:17-alpine"
+	MySQLImage    = "mysql:8.4"
+)
+
+//StartupTimeout is how long to wait for the database server in the container
+//to accept connections.
+var StartupTimeout = time.Minute
+
+//Database is a database server running in a container.
+type Database struct {
+	//DataSource connects to the database directly with the proxied driver.
+	DataSource string
+	//Driver is the sqlproxy.Driver that DB connects through.
+	Driver *sqlproxy.Driver
+	//DB connects to the database through Driver.
+	DB *sql.DB
+	//Recorder is attached to Driver (see sqlproxy.Driver.Recorder) and writes
+	//into Recording. Read the Recording only after the statements under test
+	//have completed.
+	Recorder  *sqlproxy.Recorder
+	Recording *bytes.Buffer
+}
+
+//StartPostgres starts a PostgreSQL server in a container, and returns a
+//Database that connects to it through a sqlproxy.Driver with the given
+//options. The database is empty.
+func StartPostgres(t testing.TB, opts ...sqlproxy.Option) *Database {
+	t.Helper()
+	port := startContainer(t, PostgresImage, "5432/tcp",
+		"POSTGRES_PASSWORD=sqlproxy", "POSTGRES_DB=test")
+	dsn := fmt.Sprintf("postgres://postgres:sqlproxy@%s/test?sslmode=disable", port)
+	return connect(t, "postgres", dsn, opts)
+}
+
+//StartMySQL starts a MySQL server in a container, and returns a Database that
+//connects to it through a sqlproxy.Driver with the given options. The
+//database is empty.
+func StartMySQL(t testing.TB, opts ...sqlproxy.Option) *Database {
+	t.Helper()
+	port := startContainer(t, MySQLImage, "3306/tcp",
+		"MYSQL_ROOT_PASSWORD=sqlproxy", "MYSQL_DATABASE=test")
+	dsn := fmt.Sprintf("root:sqlproxy@tcp(%s)/test", port)
+	return connect(t, "mysql", dsn, opts)
+}
+
+//startContainer runs the given image in the background, and returns the
+//host address ("127.0.0.1:port") that the given container port is published
+//on. The container is removed when the test finishes.
+func startContainer(t testing.TB, image, containerPort string, env ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not installed")
+	}
+	args := []string{"run", "--detach", "--rm", "--publish", "127.0.0.1::" + containerPort}
+	for _, e := range env {
+		args = append(args, "--env", e)
+	}
+	containerID, err := docker(append(args, image)...)
+	if err != nil {
+		t.Fatalf("cannot start container from %s: %s", image, err.Error())
+	}
+	t.Cleanup(func() {
+		_, err := docker("rm", "--force", "--volumes", containerID)
+		if err != nil {
+			t.Errorf("cannot remove container %s: %s", containerID, err.Error())
+		}
+	})
+
+	//"docker port" prints one line per address family, e.g. "127.0.0.1:49153"
+	output, err := docker("port", containerID, containerPort)
+	if err != nil {
+		t.Fatalf("cannot find published port of container %s: %s", containerID, err.Error())
+	}
+	address, _, _ := strings.Cut(output, "\n")
+	return address
+}
+
+//docker runs the docker CLI and returns its trimmed standard output.
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+//connect waits until the database server accepts connections, then opens the
+//proxied sql.DB.
+func connect(t testing.TB, driverName, dsn string, opts []sqlproxy.Option) *Database {
+	t.Helper()
+	direct, err := sql.Open(driverName, dsn)
+	if err != nil {
+		t.Fatalf("cannot connect to %s: %s (is the driver imported?)", driverName, err.Error())
+	}
+	defer direct.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), StartupTimeout)
+	defer cancel()
+	for {
+		err := direct.PingContext(ctx)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("%s did not become ready within %s: %s", driverName, StartupTimeout, err.Error())
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	db := &Database{DataSource: dsn, Recording: &bytes.Buffer{}}
+	db.Recorder, err = sqlproxy.NewRecorder(db.Recording)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	db.Driver = sqlproxy.New(driverName, append(slices.Clip(opts), sqlproxy.WithRecorder(db.Recorder))...)
+	db.DB = sql.OpenDB(sqlproxy.NewConnector(db.Driver, dsn))
+	t.Cleanup(func() {
+		err := db.DB.Close()
+		if err != nil {
+			t.Errorf("cannot close connection to %s: %s", driverName, err.Error())
+		}
+		if err := db.Recorder.Err(); err != nil {
+			t.Errorf("cannot record statements: %s", err.Error())
+		}
+	})
+	return db
+}
@@ -0,0 +1,60 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package containers
+
+import (
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/majewsky/sqlproxy"
+)
+
+func TestStartPostgres(t *testing.T) {
+	var statements []string
+	db := StartPostgres(t, sqlproxy.WithAfterQuery(func(e sqlproxy.QueryEvent) {
+		statements = append(statements, e.Query)
+	}))
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.DB.Exec(`CREATE TABLE things (name TEXT)`)
+	must(err)
+	_, err = db.DB.Exec(`INSERT INTO things (name) VALUES ($1)`, "foo")
+	must(err)
+	var name string
+	must(db.DB.QueryRow(`SELECT name FROM things`).Scan(&name))
+	if name != "foo" {
+		t.Errorf("expected name = %q, got %q", "foo", name)
+	}
+
+	//statements went through the proxy and into the recording
+	if len(statements) != 3 {
+		t.Errorf("expected 3 statements in AfterQueryHook, got %#v", statements)
+	}
+	recording := db.Recording.String()
+	if !strings.Contains(recording, "INSERT INTO things") {
+		t.Errorf("expected INSERT in recording, got:\n%s", recording)
+	}
+}
@@ -0,0 +1,265 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxytest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/majewsky/sqlproxy"
+)
+
+//Expectations declares the sequence of statements that a test expects to be
+//executed, in the style of github.com/DATA-DOG/go-sqlmock. Unlike with a mock,
+//the statements are still executed against the real database, so the test
+//keeps the realism of an integration test:
+//
+//	exp := sqlproxytest.NewExpectations()
+//	exp.Expect("SELECT stock FROM items WHERE id = ?").WithArgs(42)
+//	exp.Expect("UPDATE items SET stock = stock - 1 WHERE id = ?").WithArgs(sqlproxytest.AnyArg())
+//	db := sql.OpenDB(sqlproxy.NewConnector(
+//		sqlproxy.New("sqlite3", sqlproxy.WithHooks(exp.Hooks())),
+//		dsn,
+//	))
+//	... //exercise the code under test
+//	exp.AssertMet(t)
+//
+//Statements are compared by fingerprint (see sqlproxy.Normalize), and by their
+//arguments if WithArgs() was used. Like with QueryLog, statements are recorded
+//in the order in which they finish. If Driver.Redactor is set, the redacted
+//arguments are compared.
+type Expectations struct {
+	mutex    sync.Mutex
+	expected []*ExpectedStatement
+	actual   []actualStatement
+}
+
+//ExpectedStatement is returned by Expectations.Expect().
+type ExpectedStatement struct {
+	fingerprint string
+	//nil if any arguments are accepted
+	args  []ArgMatcher
+	fails bool
+}
+
+type actualStatement struct {
+	fingerprint string
+	args        []interface{}
+	failed      bool
+}
+
+//ArgMatcher can be given to ExpectedStatement.WithArgs() to accept a range of
+//argument values instead of a specific one.
+type ArgMatcher interface {
+	//MatchArg returns whether the given argument value is acceptable. The
+	//value is of one of the types permitted by driver.Value, or a
+	//sql.NamedArg for named arguments.
+	MatchArg(value interface{}) bool
+	//String describes the accepted values in the diff reported by
+	//Expectations.AssertMet().
+	String() string
+}
+
+//AnyArg returns an ArgMatcher that accepts any value.
+func AnyArg() ArgMatcher {
+	return anyArg{}
+}
+
+type anyArg struct{}
+
+func (anyArg) MatchArg(value interface{}) bool { return true }
+func (anyArg) String() string                  { return "<any>" }
+
+//equalArg is the ArgMatcher for plain values given to WithArgs().
+type equalArg struct {
+	value interface{}
+}
+
+func (a equalArg) MatchArg(value interface{}) bool { return reflect.DeepEqual(a.value, value) }
+func (a equalArg) String() string                  { return formatArg(a.value) }
+
+//NewExpectations returns a new Expectations without any expected statements.
+func NewExpectations() *Expectations {
+	return &Expectations{}
+}
+
+//Expect appends a statement to the expected sequence.
+func (e *Expectations) Expect(statement string) *ExpectedStatement {
+	s := &ExpectedStatement{fingerprint: sqlproxy.Normalize(statement)}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.expected = append(e.expected, s)
+	return s
+}
+
+//WithArgs restricts the expected statement to the given arguments. Each
+//argument can be an ArgMatcher, or a value that is converted like the
+//arguments of sql.DB.Exec() (so that e.g. an int matches an int64) and then
+//compared for equality.
+func (s *ExpectedStatement) WithArgs(args ...interface{}) *ExpectedStatement {
+	s.args = make([]ArgMatcher, len(args))
+	for idx, arg := range args {
+		if matcher, ok := arg.(ArgMatcher); ok {
+			s.args[idx] = matcher
+		} else {
+			s.args[idx] = equalArg{convertArg(arg)}
+		}
+	}
+	return s
+}
+
+//WillFail declares that the expected statement shall fail. Without it, a
+//statement that fails does not match the expectation.
+func (s *ExpectedStatement) WillFail() *ExpectedStatement {
+	s.fails = true
+	return s
+}
+
+func (s *ExpectedStatement) matches(a actualStatement) bool {
+	if s.fingerprint != a.fingerprint || s.fails != a.failed {
+		return false
+	}
+	if s.args == nil {
+		return true
+	}
+	if len(s.args) != len(a.args) {
+		return false
+	}
+	for idx, matcher := range s.args {
+		if !matcher.MatchArg(a.args[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *ExpectedStatement) String() string {
+	var sb strings.Builder
+	sb.WriteString(s.fingerprint)
+	if s.args != nil {
+		args := make([]string, len(s.args))
+		for idx, matcher := range s.args {
+			args[idx] = matcher.String()
+		}
+		fmt.Fprintf(&sb, " [args: %s]", strings.Join(args, ", "))
+	}
+	if s.fails {
+		sb.WriteString(" -- error")
+	}
+	return sb.String()
+}
+
+func (a actualStatement) String() string {
+	var sb strings.Builder
+	sb.WriteString(a.fingerprint)
+	if len(a.args) > 0 {
+		args := make([]string, len(a.args))
+		for idx, arg := range a.args {
+			args[idx] = formatArg(arg)
+		}
+		fmt.Fprintf(&sb, " [args: %s]", strings.Join(args, ", "))
+	}
+	if a.failed {
+		sb.WriteString(" -- error")
+	}
+	return sb.String()
+}
+
+func convertArg(arg interface{}) interface{} {
+	if named, ok := arg.(sql.NamedArg); ok {
+		named.Value = convertArg(named.Value)
+		return named
+	}
+	value, err := driver.DefaultParameterConverter.ConvertValue(arg)
+	if err != nil {
+		//cannot match any actual argument, but will show up in the diff
+		return arg
+	}
+	return value
+}
+
+func formatArg(arg interface{}) string {
+	switch arg := arg.(type) {
+	case sql.NamedArg:
+		return fmt.Sprintf("%s=%s", arg.Name, formatArg(arg.Value))
+	case string:
+		return fmt.Sprintf("%q", arg)
+	case []byte:
+		return fmt.Sprintf("[]byte(%q)", arg)
+	default:
+		return fmt.Sprint(arg)
+	}
+}
+
+//Hooks returns the hooks that record statements for comparison with the
+//expectations. Use sqlproxy.WithHooks() to combine them with other hooks.
+func (e *Expectations) Hooks() sqlproxy.Hooks {
+	return sqlproxy.Hooks{AfterQueryHook: e.record}
+}
+
+func (e *Expectations) record(event sqlproxy.QueryEvent) {
+	a := actualStatement{
+		fingerprint: sqlproxy.Normalize(event.Query),
+		args:        append([]interface{}(nil), event.Args...),
+		failed:      event.Err != nil,
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.actual = append(e.actual, a)
+}
+
+//Reset forgets all statements executed so far (but not the expectations),
+//e.g. to exclude the setup phase of a test from the comparison.
+func (e *Expectations) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.actual = nil
+}
+
+//AssertMet fails the test if the executed statements do not match the
+//expected statements exactly and in order. The failure message contains a
+//line-by-line diff, with missing statements prefixed by "-" and unexpected
+//statements prefixed by "+".
+func (e *Expectations) AssertMet(t TestingT) {
+	t.Helper()
+	e.mutex.Lock()
+	expected := append([]*ExpectedStatement(nil), e.expected...)
+	actual := append([]actualStatement(nil), e.actual...)
+	e.mutex.Unlock()
+
+	expectedLines := make([]string, len(expected))
+	for idx, s := range expected {
+		expectedLines[idx] = s.String()
+	}
+	actualLines := make([]string, len(actual))
+	for idx, a := range actual {
+		actualLines[idx] = a.String()
+	}
+	diff := diffLinesFunc(expectedLines, actualLines, func(i, j int) bool {
+		return expected[i].matches(actual[j])
+	})
+	if diff != "" {
+		t.Errorf("executed statements do not match expectations:\n%s", diff)
+	}
+}
@@ -0,0 +1,92 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxytest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/majewsky/sqlproxy"
+)
+
+func TestExpectations(t *testing.T) {
+	exp := NewExpectations()
+	exp.Expect(`INSERT INTO users (id, name) VALUES (?, ?)`).WithArgs(1, "alice")
+	exp.Expect(`INSERT INTO users (id, name) VALUES (?, ?)`).WithArgs(AnyArg(), AnyArg())
+	exp.Expect(`SELECT name FROM users WHERE id = 42`)
+	exp.Expect(`DELETE FROM nonexistent`).WillFail()
+
+	db := sql.OpenDB(sqlproxy.NewConnector(
+		sqlproxy.New("sqlite3", sqlproxy.WithHooks(exp.Hooks())),
+		"file:"+filepath.Join(t.TempDir(), "test.sqlite"),
+	))
+	defer db.Close()
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`)
+	must(err)
+	exp.Reset()
+
+	//statements are executed against the real database
+	_, err = db.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, 1, "alice")
+	must(err)
+	_, err = db.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, 2, "bob")
+	must(err)
+	var name string
+	err = db.QueryRow(`SELECT name FROM users WHERE id = 1`).Scan(&name)
+	must(err)
+	if name != "alice" {
+		t.Errorf("expected to read %q, got %q", "alice", name)
+	}
+	_, err = db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Fatal("expected DELETE on nonexistent table to fail")
+	}
+	ft := &fakeT{}
+	exp.AssertMet(ft)
+	if len(ft.errors) != 0 {
+		t.Errorf("unexpected failures: %#v", ft.errors)
+	}
+
+	//mismatching arguments, a missing and an unexpected statement are shown in
+	//the diff
+	exp = NewExpectations()
+	exp.Expect(`SELECT name FROM users WHERE id = ?`).WithArgs(2)
+	exp.Expect(`DELETE FROM users`)
+	exp.record(sqlproxy.QueryEvent{Query: `SELECT name FROM users WHERE id = ?`, Args: []interface{}{int64(1)}})
+	exp.record(sqlproxy.QueryEvent{Query: `UPDATE users SET name = ?`, Args: []interface{}{"carol"}})
+	ft = &fakeT{}
+	exp.AssertMet(ft)
+	expected := []string{"executed statements do not match expectations:\n" +
+		"- SELECT name FROM users WHERE id = ? [args: 2]\n" +
+		"- DELETE FROM users\n" +
+		"+ SELECT name FROM users WHERE id = ? [args: 1]\n" +
+		"+ UPDATE users SET name = ? [args: \"carol\"]\n",
+	}
+	if !reflect.DeepEqual(ft.errors, expected) {
+		t.Errorf("expected failures %#v, got %#v", expected, ft.errors)
+	}
+}
@@ -0,0 +1,290 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+//Package sqlproxytest provides test helpers for applications that execute
+//their statements through a sqlproxy.Driver. It lives in a separate package
+//such that sqlproxy itself does not contain any test-only code.
+//
+//The main helper is QueryLog, which records the sequence of statements
+//executed during a test. Tests can assert on the recorded statements with
+//methods like AssertQueryCount(), or compare them against a golden file, to
+//catch accidental changes in the number or shape of statements (e.g. after
+//upgrading an ORM or refactoring data access code):
+//
+//	func TestCheckout(t *testing.T) {
+//		log := sqlproxytest.NewQueryLog()
+//		db := sql.OpenDB(sqlproxy.NewConnector(
+//			sqlproxy.New("sqlite3", sqlproxy.WithHooks(log.Hooks())),
+//			dsn,
+//		))
+//		... //exercise the code under test
+//		log.AssertExecuted(t, "UPDATE stock SET count = count - ? WHERE item_id = ?")
+//		log.AssertGolden(t, "testdata/checkout.sql")
+//	}
+//
+//To create or update the golden files, run the tests with the environment
+//variable SQLPROXY_UPDATE_GOLDEN=1.
+//
+//For tests that want to declare the expected statements up front, including
+//their arguments, Expectations offers an API in the style of sqlmock, while
+//still executing the statements against the real database.
+package sqlproxytest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/majewsky/sqlproxy"
+)
+
+//UpdateGoldenEnvVar is the environment variable that makes AssertGolden()
+//write golden files instead of comparing against them.
+const UpdateGoldenEnvVar = "SQLPROXY_UPDATE_GOLDEN"
+
+//TestingT is the subset of testing.TB that is used by this package.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+//QueryLog records the statements executed through a sqlproxy.Driver, in the
+//form returned by sqlproxy.Normalize(), such that literals and argument values
+//do not cause spurious differences. Statements are recorded in the order in
+//which they finish, so tests should not execute statements concurrently when
+//their sequence is compared. Failed statements are recorded as well, with an
+//"-- error" suffix.
+type QueryLog struct {
+	mutex   sync.Mutex
+	entries []logEntry
+}
+
+type logEntry struct {
+	query       string
+	fingerprint string
+	failed      bool
+}
+
+func (e logEntry) String() string {
+	if e.failed {
+		return e.fingerprint + " -- error"
+	}
+	return e.fingerprint
+}
+
+//NewQueryLog returns a new, empty QueryLog.
+func NewQueryLog() *QueryLog {
+	return &QueryLog{}
+}
+
+//Hooks returns the hooks that record statements into this log. Use
+//sqlproxy.WithHooks() to combine them with other hooks.
+func (l *QueryLog) Hooks() sqlproxy.Hooks {
+	return sqlproxy.Hooks{AfterQueryHook: l.record}
+}
+
+func (l *QueryLog) record(e sqlproxy.QueryEvent) {
+	entry := logEntry{
+		query:       e.Query,
+		fingerprint: sqlproxy.Normalize(e.Query),
+		failed:      e.Err != nil,
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+func (l *QueryLog) snapshot() []logEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]logEntry(nil), l.entries...)
+}
+
+//Statements returns the statements recorded so far.
+func (l *QueryLog) Statements() []string {
+	entries := l.snapshot()
+	result := make([]string, len(entries))
+	for idx, entry := range entries {
+		result[idx] = entry.String()
+	}
+	return result
+}
+
+//Reset forgets all statements recorded so far, e.g. to exclude the setup
+//phase of a test from the comparison.
+func (l *QueryLog) Reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.entries = nil
+}
+
+//AssertQueryCount fails the test if the number of recorded statements
+//(including failed ones) is not equal to the given number.
+func (l *QueryLog) AssertQueryCount(t TestingT, expected int) {
+	t.Helper()
+	if actual := l.Statements(); len(actual) != expected {
+		t.Errorf("expected %d statements to be executed, got %d:\n%s", expected, len(actual), indentLines(actual))
+	}
+}
+
+//AssertNoWrites fails the test if any of the recorded statements modifies
+//data or the schema, as decided by sqlproxy.IsReadOnlyStatement().
+func (l *QueryLog) AssertNoWrites(t TestingT) {
+	t.Helper()
+	var writes []string
+	for _, entry := range l.snapshot() {
+		if !sqlproxy.IsReadOnlyStatement(entry.query) {
+			writes = append(writes, entry.String())
+		}
+	}
+	if len(writes) > 0 {
+		t.Errorf("expected no writes, but the following statements were executed:\n%s", indentLines(writes))
+	}
+}
+
+//AssertExecuted fails the test if no statement with the same fingerprint as
+//the given statement (see sqlproxy.Normalize) was recorded. Failed
+//statements count as well.
+func (l *QueryLog) AssertExecuted(t TestingT, statement string) {
+	t.Helper()
+	fingerprint := sqlproxy.Normalize(statement)
+	for _, entry := range l.snapshot() {
+		if entry.fingerprint == fingerprint {
+			return
+		}
+	}
+	t.Errorf("expected statement to be executed: %s\nexecuted statements were:\n%s", fingerprint, indentLines(l.Statements()))
+}
+
+func indentLines(lines []string) string {
+	if len(lines) == 0 {
+		return "  (none)\n"
+	}
+	return "  " + strings.Join(lines, "\n  ") + "\n"
+}
+
+//AssertGolden compares the recorded statements against the golden file at the
+//given path, which contains one statement per line. If they differ, the test
+//fails with a line-by-line diff. If the environment variable
+//SQLPROXY_UPDATE_GOLDEN is set to a non-empty value, the golden file (and its
+//parent directories) are written instead.
+func (l *QueryLog) AssertGolden(t TestingT, path string) {
+	t.Helper()
+	actual := l.Statements()
+
+	if os.Getenv(UpdateGoldenEnvVar) != "" {
+		err := os.MkdirAll(filepath.Dir(path), 0777)
+		if err == nil {
+			err = os.WriteFile(path, []byte(joinLines(actual)), 0666)
+		}
+		if err != nil {
+			t.Fatalf("cannot write golden file: %s", err.Error())
+		}
+		return
+	}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("golden file %s does not exist (run with %s=1 to create it)", path, UpdateGoldenEnvVar)
+		return
+	}
+	if err != nil {
+		t.Fatalf("cannot read golden file: %s", err.Error())
+		return
+	}
+	expected := splitLines(string(buf))
+	if diff := diffLines(expected, actual); diff != "" {
+		t.Errorf("executed statements do not match golden file %s (run with %s=1 to update it):\n%s", path, UpdateGoldenEnvVar, diff)
+	}
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+//diffLines renders a minimal line diff between expected and actual, with
+//lines prefixed by "-" (only in expected), "+" (only in actual) or " " (in
+//both). An empty string is returned if both are equal.
+func diffLines(expected, actual []string) string {
+	return diffLinesFunc(expected, actual, func(i, j int) bool {
+		return expected[i] == actual[j]
+	})
+}
+
+//diffLinesFunc is like diffLines, but decides with the given function whether
+//expected[i] matches actual[j]. Matching lines are rendered as in expected.
+func diffLinesFunc(expected, actual []string, matches func(i, j int) bool) string {
+	//lcs[i][j] is the length of the longest common subsequence of
+	//expected[i:] and actual[j:]
+	lcs := make([][]int, len(expected)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(actual)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if matches(i, j) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var (
+		sb      strings.Builder
+		changed bool
+	)
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && matches(i, j):
+			fmt.Fprintf(&sb, "  %s\n", expected[i])
+			i++
+			j++
+		case i < len(expected) && (j == len(actual) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&sb, "- %s\n", expected[i])
+			changed = true
+			i++
+		default:
+			fmt.Fprintf(&sb, "+ %s\n", actual[j])
+			changed = true
+			j++
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return sb.String()
+}
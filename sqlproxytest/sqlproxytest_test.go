@@ -0,0 +1,181 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxytest
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/majewsky/sqlproxy"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//fakeT records the failures reported through TestingT.
+type fakeT struct {
+	errors []string
+	fatal  bool
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.fatal = true
+}
+
+func TestQueryLog(t *testing.T) {
+	dir := t.TempDir()
+	goldenPath := filepath.Join(dir, "testdata", "workload.sql")
+	log := NewQueryLog()
+	db := sql.OpenDB(sqlproxy.NewConnector(
+		sqlproxy.New("sqlite3", sqlproxy.WithHooks(log.Hooks())),
+		"file:"+filepath.Join(dir, "test.sqlite"),
+	))
+	defer db.Close()
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`)
+	must(err)
+	log.Reset()
+	for idx, name := range []string{"alice", "bob"} {
+		_, err := db.Exec(`INSERT INTO users (id, name) VALUES (?, ?)`, idx, name)
+		must(err)
+	}
+	_, err = db.Exec(`DELETE FROM nonexistent WHERE id = 42`)
+	if err == nil {
+		t.Fatal("expected DELETE on nonexistent table to fail")
+	}
+	expected := []string{
+		"INSERT INTO users (id, name) VALUES (?, ?)",
+		"INSERT INTO users (id, name) VALUES (?, ?)",
+		"DELETE FROM nonexistent WHERE id = ? -- error",
+	}
+	if actual := log.Statements(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected statements %#v, got %#v", expected, actual)
+	}
+
+	//without golden file
+	var ft fakeT
+	log.AssertGolden(&ft, goldenPath)
+	if !ft.fatal || !strings.Contains(ft.errors[0], "does not exist") {
+		t.Errorf("expected missing golden file to be reported, got %#v", ft)
+	}
+
+	//update mode creates the golden file
+	t.Setenv(UpdateGoldenEnvVar, "1")
+	ft = fakeT{}
+	log.AssertGolden(&ft, goldenPath)
+	if len(ft.errors) > 0 {
+		t.Errorf("unexpected failures in update mode: %#v", ft.errors)
+	}
+	buf, err := os.ReadFile(goldenPath)
+	must(err)
+	if string(buf) != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("unexpected golden file contents: %q", string(buf))
+	}
+	t.Setenv(UpdateGoldenEnvVar, "")
+
+	//compare mode
+	ft = fakeT{}
+	log.AssertGolden(&ft, goldenPath)
+	if len(ft.errors) > 0 {
+		t.Errorf("unexpected failures when comparing against golden file: %#v", ft.errors)
+	}
+	rows, err := db.Query(`SELECT * FROM users`)
+	must(err)
+	must(rows.Close())
+	ft = fakeT{}
+	log.AssertGolden(&ft, goldenPath)
+	if len(ft.errors) != 1 || ft.fatal || !strings.Contains(ft.errors[0], "\n+ SELECT * FROM users\n") {
+		t.Errorf("expected additional statement to be reported, got %#v", ft.errors)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	expected := "  a\n- b\n+ x\n  c\n+ d\n"
+	actual := diffLines([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"})
+	if actual != expected {
+		t.Errorf("expected diff %q, got %q", expected, actual)
+	}
+	if diff := diffLines([]string{"a"}, []string{"a"}); diff != "" {
+		t.Errorf("expected no diff for equal lines, got %q", diff)
+	}
+}
+
+func TestQueryLogAssertions(t *testing.T) {
+	dir := t.TempDir()
+	log := NewQueryLog()
+	db := sql.OpenDB(sqlproxy.NewConnector(
+		sqlproxy.New("sqlite3", sqlproxy.WithHooks(log.Hooks())),
+		"file:"+filepath.Join(dir, "test.sqlite"),
+	))
+	defer db.Close()
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER, name TEXT)`)
+	must(err)
+	log.Reset()
+	var count int
+	must(db.QueryRow(`SELECT COUNT(*) FROM users WHERE name = 'alice'`).Scan(&count))
+
+	//passing assertions
+	var ft fakeT
+	log.AssertQueryCount(&ft, 1)
+	log.AssertNoWrites(&ft)
+	log.AssertExecuted(&ft, `SELECT COUNT(*) FROM users WHERE name = ?`)
+	if len(ft.errors) > 0 {
+		t.Errorf("unexpected failures: %#v", ft.errors)
+	}
+
+	//failing assertions
+	_, err = db.Exec(`INSERT INTO users (id, name) VALUES (1, 'bob')`)
+	must(err)
+	ft = fakeT{}
+	log.AssertQueryCount(&ft, 1)
+	log.AssertNoWrites(&ft)
+	log.AssertExecuted(&ft, `DELETE FROM users`)
+	expected := []string{
+		"expected 1 statements to be executed, got 2:\n  SELECT COUNT(*) FROM users WHERE name = ?\n  INSERT INTO users (id, name) VALUES (?, ?)\n",
+		"expected no writes, but the following statements were executed:\n  INSERT INTO users (id, name) VALUES (?, ?)\n",
+		"expected statement to be executed: DELETE FROM users\nexecuted statements were:\n  SELECT COUNT(*) FROM users WHERE name = ?\n  INSERT INTO users (id, name) VALUES (?, ?)\n",
+	}
+	if !reflect.DeepEqual(ft.errors, expected) {
+		t.Errorf("expected failures %#v, got %#v", expected, ft.errors)
+	}
+}
@@ -0,0 +1,546 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql/driver"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//DriverStats contains statistics about all connections opened through a
+//Driver. It is returned by Driver.Stats().
+type DriverStats struct {
+	//OpenConnections is the number of connections that are currently open.
+	OpenConnections int64
+	//Prepares is the number of statements that were prepared, either
+	//explicitly through sql.DB.Prepare() etc. or implicitly by database/sql.
+	Prepares uint64
+	//Executions is the number of statements that were executed.
+	Executions uint64
+	//Errors is the number of prepares and executions that failed.
+	Errors uint64
+	//ErrorsByCategory breaks down Errors by ClassifyError(). Categories
+	//without errors are omitted.
+	ErrorsByCategory map[ErrorCategory]uint64
+	//RowBytes is the approximate size of all rows that were returned to the
+	//caller, counting the length of strings and byte slices and 8 bytes for
+	//all other values.
+	RowBytes uint64
+	//Commits and Rollbacks count the transactions that were committed or
+	//rolled back, respectively (including failed attempts).
+	Commits   uint64
+	Rollbacks uint64
+	//Tables counts successful statements per table that they read from or
+	//wrote to. It is only filled if Driver.CountTables is set.
+	Tables map[string]TableStats
+	//Connects is the number of attempts to open a connection (including
+	//failed ones), and ConnectDuration is the total time that they took.
+	Connects        uint64
+	ConnectDuration time.Duration
+	//ConnectBuckets and ConnectCounts are a histogram of the time that each
+	//connection attempt took, in the same format as LatencyHistogram.Buckets
+	//and LatencyHistogram.Counts. The buckets are DefaultLatencyBuckets.
+	ConnectBuckets []time.Duration
+	ConnectCounts  []uint64
+}
+
+type driverCounters struct {
+	openConnections atomic.Int64
+	prepares        atomic.Uint64
+	executions      atomic.Uint64
+	errors          atomic.Uint64
+	rowBytes        atomic.Uint64
+	commits         atomic.Uint64
+	rollbacks       atomic.Uint64
+
+	//indexed like errorCategories
+	errorsByCategory [len(errorCategories)]atomic.Uint64
+	//map[string]*tableCounters, see countTables
+	tables sync.Map
+
+	//see countConnect
+	connectMutex    sync.Mutex
+	connects        uint64
+	connectDuration time.Duration
+	connectBuckets  []time.Duration
+	connectCounts   []uint64
+
+	//see ResetStats and RecentStats
+	snapshotMutex sync.Mutex
+	baseline      DriverStats
+	resetAt       time.Time
+	snapshots     []driverStatsSnapshot
+	nextSnapshot  atomic.Int64
+	//for unit tests
+	now func() time.Time
+}
+
+//countConnect records the duration of a connection attempt.
+func (c *driverCounters) countConnect(duration time.Duration) {
+	c.connectMutex.Lock()
+	defer c.connectMutex.Unlock()
+	if c.connectBuckets == nil {
+		c.connectBuckets = append([]time.Duration(nil), DefaultLatencyBuckets...)
+		c.connectCounts = make([]uint64, len(c.connectBuckets)+1)
+	}
+	c.connects++
+	c.connectDuration += duration
+	bucketIdx := sort.Search(len(c.connectBuckets), func(idx int) bool {
+		return duration <= c.connectBuckets[idx]
+	})
+	c.connectCounts[bucketIdx]++
+}
+
+func (c *driverCounters) countError(err error) {
+	c.errors.Add(1)
+	category := ClassifyError(err)
+	for idx, candidate := range errorCategories {
+		if candidate == category {
+			c.errorsByCategory[idx].Add(1)
+		}
+	}
+}
+
+//Stats returns statistics about all connections opened through this Driver
+//since it was created or since the last call to ResetStats(). Unlike
+//sql.DB.Stats(), these statistics are aggregated across all sql.DB instances
+//using this Driver. For statistics about the recent past, see RecentStats().
+func (d *Driver) Stats() DriverStats {
+	d.stats.snapshotMutex.Lock()
+	baseline := d.stats.baseline
+	d.stats.snapshotMutex.Unlock()
+	return diffDriverStats(d.cumulativeStats(), baseline)
+}
+
+//cumulativeStats returns the statistics since this Driver was created.
+func (d *Driver) cumulativeStats() DriverStats {
+	stats := DriverStats{
+		OpenConnections: d.stats.openConnections.Load(),
+		Prepares:        d.stats.prepares.Load(),
+		Executions:      d.stats.executions.Load(),
+		Errors:          d.stats.errors.Load(),
+		RowBytes:        d.stats.rowBytes.Load(),
+		Commits:         d.stats.commits.Load(),
+		Rollbacks:       d.stats.rollbacks.Load(),
+	}
+	stats.ErrorsByCategory = make(map[ErrorCategory]uint64)
+	for idx, category := range errorCategories {
+		if count := d.stats.errorsByCategory[idx].Load(); count > 0 {
+			stats.ErrorsByCategory[category] = count
+		}
+	}
+	if d.CountTables {
+		stats.Tables = d.stats.tableStats()
+	}
+	d.stats.connectMutex.Lock()
+	stats.Connects = d.stats.connects
+	stats.ConnectDuration = d.stats.connectDuration
+	stats.ConnectBuckets = append([]time.Duration(nil), d.stats.connectBuckets...)
+	stats.ConnectCounts = append([]uint64(nil), d.stats.connectCounts...)
+	d.stats.connectMutex.Unlock()
+	return stats
+}
+
+func estimateRowSize(row []driver.Value) uint64 {
+	var size uint64
+	for _, value := range row {
+		switch value := value.(type) {
+		case nil:
+		case string:
+			size += uint64(len(value))
+		case []byte:
+			size += uint64(len(value))
+		default:
+			size += 8
+		}
+	}
+	return size
+}
+
+//DefaultLatencyBuckets are the bucket boundaries used by NewFingerprintStats()
+//if no buckets are given.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+//DefaultRowBuckets are the bucket boundaries for the number of rows returned
+//or affected by a statement that are used by FingerprintStats.
+var DefaultRowBuckets = []int64{0, 1, 10, 100, 1000, 10000, 100000}
+
+//FingerprintStats aggregates statement latencies per fingerprint, as computed
+//by Normalize(). Unlike logging every statement, this gives a compact overview
+//of which kinds of statements take how long:
+//
+//	stats := sqlproxy.NewFingerprintStats()
+//	sql.Register("postgres-with-stats", sqlproxy.New("postgres",
+//		sqlproxy.WithHooks(stats.Hooks()),
+//	))
+//	...
+//	for _, h := range stats.Stats() {
+//		fmt.Printf("%s: %d calls, %s total\n", h.Fingerprint, h.Count, h.Sum)
+//	}
+type FingerprintStats struct {
+	//Limiter (optional) caps the number of fingerprints that are tracked
+	//individually (see type CardinalityLimiter). Statements with other
+	//fingerprints are aggregated into a histogram with the fingerprint
+	//OtherFingerprint. It must be set before the hooks are used.
+	Limiter *CardinalityLimiter
+
+	buckets    []time.Duration
+	rowBuckets []int64
+	mutex      sync.Mutex
+	byFP       map[string]*LatencyHistogram
+	//the tenants that have a histogram in byFP for each fingerprint (only
+	//maintained when Limiter is set, see evict)
+	tenantsByFP map[string][]string
+	//when the collection of the current statistics started (see Report)
+	since time.Time
+	//see Recent
+	slots []fingerprintSlot
+	now   func() time.Time
+}
+
+//LatencyHistogram is the latency distribution of all statements with the same
+//fingerprint (and the same tenant, if Driver.TenantFromContext is set). It is
+//returned by FingerprintStats.Stats().
+type LatencyHistogram struct {
+	Fingerprint string
+	//Tenant is the same as in QueryEvent.
+	Tenant string
+	//Count is the number of statements, Sum is their total duration.
+	Count uint64
+	Sum   time.Duration
+	//Rows is the total number of rows returned or affected by the statements.
+	Rows int64
+	//Errors is the number of statements that failed.
+	Errors uint64
+	//Buckets contains the upper bounds of the histogram buckets. Counts[i] is
+	//the number of statements with Buckets[i-1] < duration <= Buckets[i].
+	//Counts has one more element than Buckets, for statements that took
+	//longer than the last bucket boundary.
+	Buckets []time.Duration
+	Counts  []uint64
+	//RowBuckets and RowCounts are a histogram of QueryEvent.Rows in the same
+	//format as Buckets and Counts. MaxRows is the largest QueryEvent.Rows
+	//seen.
+	RowBuckets []int64
+	RowCounts  []uint64
+	MaxRows    int64
+}
+
+//NewFingerprintStats creates a new FingerprintStats. The given bucket
+//boundaries must be sorted in ascending order. If none are given,
+//DefaultLatencyBuckets is used.
+func NewFingerprintStats(buckets ...time.Duration) *FingerprintStats {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	return &FingerprintStats{
+		buckets:     append([]time.Duration(nil), buckets...),
+		rowBuckets:  append([]int64(nil), DefaultRowBuckets...),
+		byFP:        make(map[string]*LatencyHistogram),
+		tenantsByFP: make(map[string][]string),
+		since:       time.Now(),
+		now:         time.Now,
+	}
+}
+
+//Hooks returns the hooks that feed this FingerprintStats. Use WithHooks() to
+//combine them with other hooks.
+func (s *FingerprintStats) Hooks() Hooks {
+	return Hooks{AfterQueryHook: s.observe}
+}
+
+func (s *FingerprintStats) observe(e QueryEvent) {
+	fp := Normalize(e.Query)
+	key := e.Tenant + "\x00" + fp
+	bucketIdx := sort.Search(len(s.buckets), func(idx int) bool {
+		return e.Duration <= s.buckets[idx]
+	})
+	rowBucketIdx := sort.Search(len(s.rowBuckets), func(idx int) bool {
+		return e.Rows <= s.rowBuckets[idx]
+	})
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.Limiter != nil {
+		tracked, evicted := s.Limiter.admit(fp)
+		if evicted != "" {
+			s.evict(evicted)
+		}
+		if !tracked {
+			fp = OtherFingerprint
+			key = e.Tenant + "\x00" + fp
+		} else if s.byFP[key] == nil {
+			s.tenantsByFP[fp] = append(s.tenantsByFP[fp], e.Tenant)
+		}
+	}
+	s.histogram(s.byFP, key, fp, e.Tenant).add(e, bucketIdx, rowBucketIdx)
+	s.histogram(s.currentSlot(), key, fp, e.Tenant).add(e, bucketIdx, rowBucketIdx)
+}
+
+//histogram returns the histogram with the given key from the given map,
+//creating it if necessary.
+func (s *FingerprintStats) histogram(byFP map[string]*LatencyHistogram, key, fp, tenant string) *LatencyHistogram {
+	h, exists := byFP[key]
+	if !exists {
+		h = &LatencyHistogram{
+			Fingerprint: fp,
+			Tenant:      tenant,
+			Buckets:     s.buckets,
+			Counts:      make([]uint64, len(s.buckets)+1),
+			RowBuckets:  s.rowBuckets,
+			RowCounts:   make([]uint64, len(s.rowBuckets)+1),
+		}
+		byFP[key] = h
+	}
+	return h
+}
+
+func (h *LatencyHistogram) add(e QueryEvent, bucketIdx, rowBucketIdx int) {
+	h.Count++
+	h.Sum += e.Duration
+	h.Rows += e.Rows
+	if e.Err != nil {
+		h.Errors++
+	}
+	h.Counts[bucketIdx]++
+	h.RowCounts[rowBucketIdx]++
+	if e.Rows > h.MaxRows {
+		h.MaxRows = e.Rows
+	}
+}
+
+//evict folds the histograms of the given fingerprint into the
+//OtherFingerprint histogram of the same tenant.
+func (s *FingerprintStats) evict(fp string) {
+	for _, tenant := range s.tenantsByFP[fp] {
+		key := tenant + "\x00" + fp
+		h := s.byFP[key]
+		if h == nil {
+			continue
+		}
+		delete(s.byFP, key)
+		otherKey := tenant + "\x00" + OtherFingerprint
+		other := s.byFP[otherKey]
+		if other == nil {
+			h.Fingerprint = OtherFingerprint
+			s.byFP[otherKey] = h
+			continue
+		}
+		other.merge(*h)
+	}
+	delete(s.tenantsByFP, fp)
+}
+
+//merge adds the statements in the other histogram to this one. Both must have
+//the same buckets.
+func (h *LatencyHistogram) merge(other LatencyHistogram) {
+	h.Count += other.Count
+	h.Sum += other.Sum
+	h.Rows += other.Rows
+	h.Errors += other.Errors
+	for idx, c := range other.Counts {
+		h.Counts[idx] += c
+	}
+	for idx, c := range other.RowCounts {
+		h.RowCounts[idx] += c
+	}
+	h.MaxRows = max(h.MaxRows, other.MaxRows)
+}
+
+//Stats returns a snapshot of the histograms for all fingerprints seen so far,
+//sorted by tenant and fingerprint.
+func (s *FingerprintStats) Stats() []LatencyHistogram {
+	result, _ := s.snapshot()
+	return result
+}
+
+//snapshot is like Stats, but also returns when the collection of these
+//statistics started.
+func (s *FingerprintStats) snapshot() ([]LatencyHistogram, time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := make([]LatencyHistogram, 0, len(s.byFP))
+	for _, h := range s.byFP {
+		snapshot := *h
+		snapshot.Counts = append([]uint64(nil), h.Counts...)
+		snapshot.RowCounts = append([]uint64(nil), h.RowCounts...)
+		result = append(result, snapshot)
+	}
+	sortLatencyHistograms(result)
+	return result, s.since
+}
+
+//sortLatencyHistograms sorts by tenant and fingerprint.
+func sortLatencyHistograms(result []LatencyHistogram) {
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Tenant != result[j].Tenant {
+			return result[i].Tenant < result[j].Tenant
+		}
+		return result[i].Fingerprint < result[j].Fingerprint
+	})
+}
+
+//Mean returns the average duration of the statements in this histogram.
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+//Quantile estimates the given quantile (between 0 and 1) of the statement
+//durations in this histogram, by interpolating linearly within the bucket that
+//contains it. If the quantile falls beyond the last bucket boundary, the last
+//bucket boundary is returned.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Buckets) == 0 {
+		return 0
+	}
+	rank := q * float64(h.Count)
+	var cumulative float64
+	for idx, c := range h.Counts {
+		if c == 0 || cumulative+float64(c) < rank {
+			cumulative += float64(c)
+			continue
+		}
+		if idx == len(h.Buckets) {
+			break
+		}
+		var lower time.Duration
+		if idx > 0 {
+			lower = h.Buckets[idx-1]
+		}
+		upper := h.Buckets[idx]
+		fraction := (rank - cumulative) / float64(c)
+		return lower + time.Duration(fraction*float64(upper-lower))
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+//ShareAbove returns the share (between 0 and 1) of statements in this
+//histogram that returned or affected more than the given number of rows. This
+//is computed from RowCounts, so if the given number is not one of the
+//RowBuckets, it is rounded up to the next bucket boundary.
+func (h LatencyHistogram) ShareAbove(rows int64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	var count uint64
+	for idx, c := range h.RowCounts {
+		//RowCounts[idx] counts statements with more than RowBuckets[idx-1] rows
+		if idx > 0 && h.RowBuckets[idx-1] >= rows {
+			count += c
+		}
+	}
+	return float64(count) / float64(h.Count)
+}
+
+//LargeResults returns a snapshot of the histograms for all fingerprints where
+//at least the given share (between 0 and 1) of statements returned or
+//affected more than the given number of rows (see ShareAbove), sorted by
+//tenant and fingerprint. This finds statements that regularly return very
+//large result sets, e.g. because of a missing LIMIT clause:
+//
+//	for _, h := range stats.LargeResults(10000, 0.1) {
+//		log.Printf("more than 10000 rows in %.0f%% of executions: %s", 100*h.ShareAbove(10000), h.Fingerprint)
+//	}
+func (s *FingerprintStats) LargeResults(rows int64, minShare float64) []LatencyHistogram {
+	var result []LatencyHistogram
+	for _, h := range s.Stats() {
+		if h.ShareAbove(rows) >= minShare {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+//StatsOrder is a sort order for FingerprintStats.Top().
+type StatsOrder int
+
+const (
+	//ByTotalTime sorts by LatencyHistogram.Sum.
+	ByTotalTime StatsOrder = iota
+	//ByMeanTime sorts by LatencyHistogram.Mean().
+	ByMeanTime
+	//ByCalls sorts by LatencyHistogram.Count.
+	ByCalls
+	//ByRows sorts by LatencyHistogram.Rows.
+	ByRows
+)
+
+//Top returns a snapshot of the n most expensive fingerprints by the given
+//order, most expensive first. Together with Reset(), this gives an overview
+//similar to PostgreSQL's pg_stat_statements:
+//
+//	for _, h := range stats.Top(10, sqlproxy.ByTotalTime) {
+//		fmt.Printf("%10s total %10s mean %6d calls %8d rows  %s\n",
+//			h.Sum, h.Mean(), h.Count, h.Rows, h.Fingerprint)
+//	}
+func (s *FingerprintStats) Top(n int, order StatsOrder) []LatencyHistogram {
+	return topLatencyHistograms(s.Stats(), n, order)
+}
+
+func topLatencyHistograms(result []LatencyHistogram, n int, order StatsOrder) []LatencyHistogram {
+	key := func(h LatencyHistogram) int64 {
+		switch order {
+		case ByMeanTime:
+			return int64(h.Mean())
+		case ByCalls:
+			return int64(h.Count)
+		case ByRows:
+			return h.Rows
+		default:
+			return int64(h.Sum)
+		}
+	}
+	//stable sort, so that ties remain ordered by tenant and fingerprint
+	sort.SliceStable(result, func(i, j int) bool {
+		return key(result[i]) > key(result[j])
+	})
+	if n < len(result) {
+		result = result[:n]
+	}
+	return result
+}
+
+//Reset discards all statistics collected so far.
+func (s *FingerprintStats) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.byFP = make(map[string]*LatencyHistogram)
+	s.tenantsByFP = make(map[string][]string)
+	s.since = s.now()
+	s.slots = nil
+	if s.Limiter != nil {
+		s.Limiter.reset()
+	}
+}
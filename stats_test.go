@@ -0,0 +1,209 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_FingerprintStats(t *testing.T) {
+	tt := TT{t}
+
+	s := NewFingerprintStats(10*time.Millisecond, 100*time.Millisecond)
+	hook := s.Hooks().AfterQueryHook
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = $1`, Duration: 5 * time.Millisecond, Rows: 1})
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 42`, Duration: 50 * time.Millisecond})
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id IN (1, 2, 3)`, Duration: 500 * time.Millisecond})
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 23`, Duration: 10 * time.Millisecond})
+
+	buckets := []time.Duration{10 * time.Millisecond, 100 * time.Millisecond}
+	expected := []LatencyHistogram{
+		{
+			Fingerprint: `SELECT * FROM users WHERE id = ?`,
+			Count:       3,
+			Sum:         65 * time.Millisecond,
+			Rows:        1,
+			Buckets:     buckets,
+			Counts:      []uint64{2, 1, 0},
+			RowBuckets:  DefaultRowBuckets,
+			RowCounts:   []uint64{2, 1, 0, 0, 0, 0, 0, 0},
+			MaxRows:     1,
+		},
+		{
+			Fingerprint: `SELECT * FROM users WHERE id IN (?)`,
+			Count:       1,
+			Sum:         500 * time.Millisecond,
+			Buckets:     buckets,
+			Counts:      []uint64{0, 0, 1},
+			RowBuckets:  DefaultRowBuckets,
+			RowCounts:   []uint64{1, 0, 0, 0, 0, 0, 0, 0},
+		},
+	}
+	actual := s.Stats()
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("stats", expected, actual)
+	}
+
+	//snapshots are not affected by later statements
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 5`, Duration: time.Millisecond})
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("stats", expected, actual)
+	}
+}
+
+func Test_FingerprintStatsLargeResults(t *testing.T) {
+	s := NewFingerprintStats()
+	hook := s.Hooks().AfterQueryHook
+	for idx := 0; idx < 10; idx++ {
+		hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 1`, Rows: 1})
+		hook(QueryEvent{Query: `SELECT * FROM events`, Rows: int64(500 * idx)})
+	}
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id IN (1, 2, 3)`, Rows: 50000})
+
+	var actual []string
+	for _, h := range s.LargeResults(1000, 0.5) {
+		actual = append(actual, fmt.Sprintf("%s: %g above 1000, max %d", h.Fingerprint, h.ShareAbove(1000), h.MaxRows))
+	}
+	expected := []string{
+		"SELECT * FROM events: 0.7 above 1000, max 4500",
+		"SELECT * FROM users WHERE id IN (?): 1 above 1000, max 50000",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		TT{t}.Unexpected("large results", expected, actual)
+	}
+}
+
+func Test_FingerprintStatsByTenant(t *testing.T) {
+	s := NewFingerprintStats()
+	hook := s.Hooks().AfterQueryHook
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 1`, Tenant: "globex"})
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 2`, Tenant: "acme"})
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 3`, Tenant: "acme"})
+
+	var actual []string
+	for _, h := range s.Stats() {
+		actual = append(actual, fmt.Sprintf("%s: %s (%d calls)", h.Tenant, h.Fingerprint, h.Count))
+	}
+	expected := []string{
+		"acme: SELECT * FROM users WHERE id = ? (2 calls)",
+		"globex: SELECT * FROM users WHERE id = ? (1 calls)",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		TT{t}.Unexpected("stats", expected, actual)
+	}
+}
+
+func Test_FingerprintStatsTop(t *testing.T) {
+	tt := TT{t}
+
+	s := NewFingerprintStats()
+	hook := s.Hooks().AfterQueryHook
+	for idx := 0; idx < 10; idx++ {
+		hook(QueryEvent{Query: `SELECT 1`, Duration: time.Millisecond, Rows: 1})
+	}
+	hook(QueryEvent{Query: `SELECT * FROM big_table`, Duration: 50 * time.Millisecond, Rows: 10000})
+	hook(QueryEvent{Query: `UPDATE t SET x = 1`, Duration: 3 * time.Millisecond})
+	hook(QueryEvent{Query: `UPDATE t SET x = 2`, Duration: 3 * time.Millisecond})
+
+	fingerprints := func(hs []LatencyHistogram) []string {
+		var result []string
+		for _, h := range hs {
+			result = append(result, h.Fingerprint)
+		}
+		return result
+	}
+	testCases := []struct {
+		Order    StatsOrder
+		N        int
+		Expected []string
+	}{
+		{ByTotalTime, 2, []string{`SELECT * FROM big_table`, `SELECT ?`}},
+		{ByMeanTime, 3, []string{`SELECT * FROM big_table`, `UPDATE t SET x = ?`, `SELECT ?`}},
+		{ByCalls, 1, []string{`SELECT ?`}},
+		{ByRows, 10, []string{`SELECT * FROM big_table`, `SELECT ?`, `UPDATE t SET x = ?`}},
+	}
+	for _, tc := range testCases {
+		actual := fingerprints(s.Top(tc.N, tc.Order))
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			tt.Unexpected("Top()", tc.Expected, actual)
+		}
+	}
+
+	s.Reset()
+	if stats := s.Stats(); len(stats) != 0 {
+		tt.Unexpected("Stats() after Reset()", []LatencyHistogram{}, stats)
+	}
+}
+
+func Test_DriverStats(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	d := &Driver{ProxiedDriverName: "sqlite3"}
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	db.SetMaxOpenConns(1)
+	tt.MustResult(db.Exec(`CREATE TABLE knowledge (number INTEGER, thing TEXT)`))
+	tt.MustResult(db.Exec(`INSERT INTO knowledge VALUES (23, 'conspiracy'), (42, 'truth')`))
+	stmt, err := db.Prepare(`SELECT * FROM knowledge`)
+	tt.Must(err)
+	rows := tt.MustRows(stmt.Query())
+	for rows.Next() {
+	}
+	tt.Must(rows.Close())
+	tt.Must(stmt.Close())
+	_, err = db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Error("expected DELETE on nonexistent table to fail, but it succeeded")
+	}
+
+	expected := DriverStats{
+		OpenConnections: 1,
+		Prepares:        1,
+		Executions:      4,
+		Errors:          1,
+		RowBytes:        8 + 10 + 8 + 5,
+		Connects:        1,
+		ConnectBuckets:  DefaultLatencyBuckets,
+	}
+	expected.ErrorsByCategory = map[ErrorCategory]uint64{ErrorCategorySyntax: 1}
+	actual := d.Stats()
+	//the connect latency varies, so only check that it was counted once
+	var connectCount uint64
+	for _, count := range actual.ConnectCounts {
+		connectCount += count
+	}
+	if actual.ConnectDuration <= 0 || connectCount != 1 || len(actual.ConnectCounts) != len(DefaultLatencyBuckets)+1 {
+		t.Errorf("unexpected connect latency: %s, %v", actual.ConnectDuration, actual.ConnectCounts)
+	}
+	actual.ConnectDuration, actual.ConnectCounts = 0, nil
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("stats", expected, actual)
+	}
+	tt.Must(db.Close())
+	if actual := d.Stats().OpenConnections; actual != 0 {
+		tt.Unexpected("OpenConnections", int64(0), actual)
+	}
+
+	tt.CleanupDB()
+}
@@ -0,0 +1,134 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+//StatsdSink sends metrics about executed statements to a statsd or DogStatsD
+//server over UDP. This is an alternative to the promhooks package for
+//push-based metrics pipelines:
+//
+//	sink, err := sqlproxy.NewStatsdSink("localhost:8125", "myapp.sql")
+//	sink.DogStatsD = true
+//	sql.Register("postgres-with-metrics", sqlproxy.New("postgres",
+//		sqlproxy.WithHooks(sink.Hooks()),
+//	))
+//
+//For each statement, the following metrics are sent (with the statement type
+//from StatementType() as "type"):
+//
+//	<prefix>.statements  - counter, incremented for each statement
+//	<prefix>.errors      - counter, incremented for each failed statement
+//	<prefix>.duration    - timer, see QueryEvent.Duration
+//	<prefix>.rows        - counter, see QueryEvent.Rows
+//
+//With DogStatsD enabled, the statement type is sent as a tag ("type:select"),
+//and so is the statement's fingerprint if FingerprintTags is enabled, and the
+//tenant if Driver.TenantFromContext is set. With
+//plain statsd, which does not support tags, the statement type is inserted
+//into the metric name instead (e.g. "<prefix>.select.statements").
+type StatsdSink struct {
+	//DogStatsD enables tags in the DogStatsD format.
+	DogStatsD bool
+	//FingerprintTags adds a "fingerprint" tag with the Normalize()d statement
+	//(only with DogStatsD). Beware that this can produce a large number of
+	//distinct metrics.
+	FingerprintTags bool
+	//Limiter (optional) caps the number of distinct values of the
+	//"fingerprint" tag (see type CardinalityLimiter). Statements with other
+	//fingerprints are tagged with OtherFingerprint instead.
+	Limiter *CardinalityLimiter
+
+	conn   net.Conn
+	prefix string
+}
+
+//NewStatsdSink creates a StatsdSink that sends to the given UDP address. All
+//metric names are prefixed with the given prefix.
+func NewStatsdSink(address, prefix string) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdSink{conn: conn, prefix: prefix}, nil
+}
+
+//Close closes the UDP socket. The hooks must not be used afterwards.
+func (s *StatsdSink) Close() error {
+	return s.conn.Close()
+}
+
+//Hooks returns the hooks that feed this sink. Use WithHooks() to combine them
+//with other hooks.
+func (s *StatsdSink) Hooks() Hooks {
+	return Hooks{AfterQueryHook: s.send}
+}
+
+func (s *StatsdSink) send(e QueryEvent) {
+	//UDP errors are not reported since statsd is fire-and-forget by design
+	s.conn.Write([]byte(s.format(e)))
+}
+
+//format renders the metrics for one statement into a single packet, with one
+//metric per line.
+func (s *StatsdSink) format(e QueryEvent) string {
+	statementType := StatementType(e.Query)
+	prefix := s.prefix + "."
+	suffix := ""
+	if s.DogStatsD {
+		suffix = "|#type:" + statementType
+		if s.FingerprintTags {
+			fp := Normalize(e.Query)
+			if s.Limiter != nil {
+				if tracked, _ := s.Limiter.admit(fp); !tracked {
+					fp = OtherFingerprint
+				}
+			}
+			suffix += ",fingerprint:" + sanitizeStatsdTag(fp)
+		}
+		if e.Tenant != "" {
+			suffix += ",tenant:" + sanitizeStatsdTag(e.Tenant)
+		}
+	} else {
+		prefix += statementType + "."
+	}
+
+	lines := []string{
+		prefix + "statements:1|c" + suffix,
+		fmt.Sprintf("%sduration:%g|ms%s", prefix, float64(e.Duration.Microseconds())/1000, suffix),
+		fmt.Sprintf("%srows:%d|c%s", prefix, e.Rows, suffix),
+	}
+	if e.Err != nil {
+		lines = append(lines, prefix+"errors:1|c"+suffix)
+	}
+	return strings.Join(lines, "\n")
+}
+
+var statsdTagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", " ")
+
+//sanitizeStatsdTag removes characters with special meaning in the DogStatsD
+//protocol from a tag value.
+func sanitizeStatsdTag(value string) string {
+	return statsdTagReplacer.Replace(value)
+}
@@ -0,0 +1,63 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_StatsdSink(t *testing.T) {
+	tt := TT{t}
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tt.Must(err)
+	defer listener.Close()
+	sink, err := NewStatsdSink(listener.LocalAddr().String(), "test.sql")
+	tt.Must(err)
+	defer sink.Close()
+
+	receive := func() string {
+		buf := make([]byte, 65536)
+		tt.Must(listener.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := listener.ReadFrom(buf)
+		tt.Must(err)
+		return string(buf[:n])
+	}
+
+	hook := sink.Hooks().AfterQueryHook
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = $1`, Duration: 1500 * time.Microsecond, Rows: 1})
+	expected := "test.sql.select.statements:1|c\ntest.sql.select.duration:1.5|ms\ntest.sql.select.rows:1|c"
+	if actual := receive(); actual != expected {
+		tt.Unexpected("packet", expected, actual)
+	}
+
+	sink.DogStatsD = true
+	sink.FingerprintTags = true
+	hook(QueryEvent{Query: `DELETE FROM users WHERE id IN (1, 2)`, Duration: 2 * time.Millisecond, Err: errors.New("locked")})
+	tags := "|#type:delete,fingerprint:DELETE FROM users WHERE id IN (?)"
+	expected = "test.sql.statements:1|c" + tags + "\ntest.sql.duration:2|ms" + tags +
+		"\ntest.sql.rows:0|c" + tags + "\ntest.sql.errors:1|c" + tags
+	if actual := receive(); actual != expected {
+		tt.Unexpected("packet", expected, actual)
+	}
+}
@@ -0,0 +1,89 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"strings"
+)
+
+//stripComments implements Driver.StripComments. Comments are removed and
+//whitespace is collapsed into single spaces, except within string literals,
+//quoted identifiers and optimizer hints ("/*+ ... */").
+func stripComments(query string) string {
+	var (
+		b            strings.Builder
+		pendingSpace = false
+	)
+	b.Grow(len(query))
+	write := func(s string) {
+		if pendingSpace && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		pendingSpace = false
+		b.WriteString(s)
+	}
+
+	for idx := 0; idx < len(query); {
+		rest := query[idx:]
+		switch c := query[idx]; {
+		case c == '\'' || c == '"' || c == '`':
+			end := strings.IndexByte(rest[1:], c)
+			if end == -1 {
+				end = len(rest) - 2
+			}
+			write(rest[:end+2])
+			idx += end + 2
+		case c == '$' && dollarQuoteLength(rest) > 0:
+			length := dollarQuoteLength(rest)
+			write(rest[:length])
+			idx += length
+		case strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end == -1 {
+				end = len(rest)
+			}
+			idx += end
+			pendingSpace = true
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			length := len(rest)
+			if end != -1 {
+				length = end + 4
+			}
+			if strings.HasPrefix(rest, "/*+") {
+				write(rest[:length])
+			} else {
+				pendingSpace = true
+			}
+			idx += length
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			pendingSpace = true
+			idx++
+		default:
+			end := 1 + strings.IndexAny(rest[1:], "'\"`$-/ \t\n\r\f")
+			if end == 0 {
+				end = len(rest)
+			}
+			write(rest[:end])
+			idx += end
+		}
+	}
+	return b.String()
+}
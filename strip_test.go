@@ -0,0 +1,78 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func Test_StripComments(t *testing.T) {
+	testCases := map[string]string{
+		"SELECT 1": "SELECT 1",
+		"  SELECT *\n\tFROM users\n  WHERE id = $1  ":        "SELECT * FROM users WHERE id = $1",
+		"SELECT * FROM users -- look up users\nWHERE id = ?": "SELECT * FROM users WHERE id = ?",
+		"/* controller=users */ SELECT 1":                    "SELECT 1",
+		"SELECT/**/1":                                        "SELECT 1",
+		"SELECT a-b, 4/2 FROM t":                             "SELECT a-b, 4/2 FROM t",
+		"SELECT /*+ INDEX(t idx) */ * FROM t":                "SELECT /*+ INDEX(t idx) */ * FROM t",
+		"SELECT '-- not  a comment', \"/* nor */\" FROM t":   "SELECT '-- not  a comment', \"/* nor */\" FROM t",
+		"SELECT $tag$ -- kept\n  $tag$, $1 FROM t":           "SELECT $tag$ -- kept\n  $tag$, $1 FROM t",
+		"SELECT 1 -- trailing comment":                       "SELECT 1",
+		"SELECT 'unterminated  ":                             "SELECT 'unterminated  ",
+	}
+	for query, expected := range testCases {
+		actual := stripComments(query)
+		if actual != expected {
+			TT{t}.Unexpected("stripComments("+query+")", expected, actual)
+		}
+	}
+}
+
+func Test_StripCommentsIntegration(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var queries []string
+	d := New("sqlite3", WithCommentStripping(), WithAfterQuery(func(e QueryEvent) {
+		queries = append(queries, e.Query)
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec("CREATE TABLE users (name TEXT)"))
+	tt.MustResult(db.Exec("/* request=1 */ INSERT INTO users\n  (name) VALUES (?)", "alice"))
+	tt.MustResult(db.Exec("INSERT INTO users (name) -- request=2\nVALUES (?)", "bob"))
+
+	expected := []string{
+		"CREATE TABLE users (name TEXT)",
+		"INSERT INTO users (name) VALUES (?)",
+		"INSERT INTO users (name) VALUES (?)",
+	}
+	if len(queries) != len(expected) {
+		t.Fatalf("expected %d statements, got %d: %q", len(expected), len(queries), queries)
+	}
+	for idx, query := range queries {
+		if query != expected[idx] {
+			tt.Unexpected("statement", expected[idx], query)
+		}
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
@@ -0,0 +1,228 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+//TableStats counts the statements that accessed a table. It is part of
+//DriverStats.
+type TableStats struct {
+	//Reads is the number of statements that read from the table (e.g.
+	//SELECT ... FROM table, or JOIN table).
+	Reads uint64
+	//Writes is the number of statements that modified the table or its
+	//schema (e.g. INSERT INTO, UPDATE, DELETE FROM, TRUNCATE, CREATE/ALTER/DROP
+	//TABLE).
+	Writes uint64
+}
+
+type tableCounters struct {
+	reads  atomic.Uint64
+	writes atomic.Uint64
+}
+
+//countTables counts a successful statement towards the tables that it
+//accesses.
+func (c *driverCounters) countTables(refs []TableRef) {
+	for _, ref := range refs {
+		value, ok := c.tables.Load(ref.Table)
+		if !ok {
+			value, _ = c.tables.LoadOrStore(ref.Table, &tableCounters{})
+		}
+		counters := value.(*tableCounters)
+		if ref.Write {
+			counters.writes.Add(1)
+		} else {
+			counters.reads.Add(1)
+		}
+	}
+}
+
+func (c *driverCounters) tableStats() map[string]TableStats {
+	result := make(map[string]TableStats)
+	c.tables.Range(func(key, value interface{}) bool {
+		counters := value.(*tableCounters)
+		result[key.(string)] = TableStats{
+			Reads:  counters.reads.Load(),
+			Writes: counters.writes.Load(),
+		}
+		return true
+	})
+	return result
+}
+
+var (
+	//The first group is the keyword that introduces the table name, the second
+	//group is the table name.
+	tableRefRx = regexp.MustCompile("(?i)\\b(FROM|JOIN|INTO|UPDATE|DELETE\\s+FROM|TRUNCATE(?:\\s+TABLE)?|TABLE(?:\\s+IF(?:\\s+NOT)?\\s+EXISTS)?|COPY)\\s+(?:ONLY\\s+)?([A-Za-z_][\\w.$]*|\"[^\"]+\"|`[^`]+`)")
+	//COPY table FROM ... writes into the table, COPY table TO ... reads from it
+	copyFromRx = regexp.MustCompile(`(?is)^\s*COPY\b.*\bFROM\b`)
+	//UPDATE keywords that are not followed by a table name (SELECT ... FOR
+	//UPDATE, INSERT ... ON CONFLICT DO UPDATE, INSERT ... ON DUPLICATE KEY
+	//UPDATE)
+	nonTableUpdateRx = regexp.MustCompile(`(?i)\b(?:FOR(?:\s+NO\s+KEY)?|DO|KEY)\s+UPDATE\b`)
+)
+
+//TableRef is a table that a statement refers to. It is returned by
+//ExtractTables() and appears in QueryEvent.Tables.
+type TableRef struct {
+	//Table is the name of the table as written in the statement (including
+	//the schema name, if any, but without quotes).
+	Table string
+	//Write is true if the statement modifies the table or its schema.
+	Write bool
+}
+
+//ExtractTables returns the tables that the given statement refers to, in
+//order of first appearance. This is a best-effort guess based on the keywords
+//preceding each table name (FROM, JOIN, INTO, UPDATE etc.), not a full SQL
+//parser; for exact results, use a Parser that implements TableExtractor. A
+//table that is both read and written by the same statement is returned twice.
+func ExtractTables(query string) []TableRef {
+	query = nonTableUpdateRx.ReplaceAllString(query, " ")
+
+	var result []TableRef
+	seen := make(map[TableRef]bool)
+	for _, match := range tableRefRx.FindAllStringSubmatch(query, -1) {
+		keyword := strings.ToUpper(match[1])
+		ref := TableRef{
+			Table: strings.Trim(match[2], "\"`"),
+			Write: keyword != "FROM" && keyword != "JOIN",
+		}
+		if keyword == "COPY" {
+			//the rest is about the source or destination (e.g. "FROM STDIN")
+			ref.Write = copyFromRx.MatchString(query)
+			return append(result, ref)
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			result = append(result, ref)
+		}
+	}
+	return result
+}
+
+//tablesInQuery returns the names of the tables that the given query refers
+//to, in order of first appearance and without duplicates.
+func tablesInQuery(query string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, ref := range ExtractTables(query) {
+		if !seen[ref.Table] {
+			seen[ref.Table] = true
+			result = append(result, ref.Table)
+		}
+	}
+	return result
+}
+
+//TableExtractor can be implemented by a Parser (see Driver.Parser) to provide
+//the tables that a parsed statement refers to. If the Driver's Parser
+//implements this interface, its result is used instead of ExtractTables() for
+//QueryEvent.Tables and for Driver.CountTables.
+type TableExtractor interface {
+	ExtractTables(ast interface{}) []TableRef
+}
+
+//tablesForStatement implements Driver.ListTables and Driver.CountTables.
+func (c *connection) tablesForStatement(e QueryEvent) []TableRef {
+	if extractor, ok := c.driver.Parser.(TableExtractor); ok && e.AST != nil {
+		return extractor.ExtractTables(e.AST)
+	}
+	return ExtractTables(e.Query)
+}
+
+//ExtractColumns returns the columns that the given statement compares (e.g.
+//"WHERE id = ?", "name LIKE ?", "created_at BETWEEN ? AND ?"), assigns (e.g.
+//"SET name = ?") or inserts into (e.g. "INSERT INTO users (id, name)"), in
+//order of first appearance and without duplicates. Columns are returned as
+//written in the statement, i.e. possibly qualified with a table name or alias
+//(like "u.id"), but without quotes. Like ExtractTables(), this is a
+//best-effort guess, not a full SQL parser.
+func ExtractColumns(query string) []string {
+	var (
+		result []string
+		seen   = make(map[string]bool)
+		tokens = tokenizeSQL(query)
+	)
+	add := func(column string) {
+		column = strings.NewReplacer(`"`, "", "`", "").Replace(strings.TrimSpace(column))
+		if column != "" && !seen[column] {
+			seen[column] = true
+			result = append(result, column)
+		}
+	}
+
+	//INSERT INTO table (a, b, c) VALUES ...
+	if loc := insertColumnsRx.FindStringSubmatchIndex(query); loc != nil {
+		for _, column := range strings.Split(query[loc[2]:loc[3]], ",") {
+			add(column)
+		}
+	}
+
+	for idx, token := range tokens {
+		if idx == 0 {
+			continue
+		}
+		isComparison := token.kind == sqlTokenOperator
+		if token.kind == sqlTokenWord {
+			switch strings.ToUpper(token.text) {
+			case "LIKE", "ILIKE", "IN", "BETWEEN", "IS":
+				isComparison = true
+			}
+		}
+		if !isComparison {
+			continue
+		}
+		//find the column name before the operator, including a qualifier like
+		//"table." or "schema.table."
+		end := idx - 1
+		if end > 0 && strings.EqualFold(tokens[end].text, "NOT") {
+			end-- //"x NOT IN", "x NOT LIKE" etc.
+		}
+		if !isColumnToken(tokens[end]) {
+			continue
+		}
+		start := end
+		for start >= 2 && tokens[start-1].text == "." && isColumnToken(tokens[start-2]) {
+			start -= 2
+		}
+		add(query[tokens[start].offset : tokens[end].offset+len(tokens[end].text)])
+	}
+	return result
+}
+
+//keywords that can appear before a comparison operator, but are not columns
+var columnLikeKeywords = map[string]bool{"NOT": true, "NULL": true, "TRUE": true, "FALSE": true, "END": true}
+
+func isColumnToken(t sqlToken) bool {
+	switch t.kind {
+	case sqlTokenWord:
+		return !isDigit(t.text[0]) && !columnLikeKeywords[strings.ToUpper(t.text)]
+	case sqlTokenOther:
+		return t.text[0] == '"' || t.text[0] == '`'
+	default:
+		return false
+	}
+}
@@ -0,0 +1,166 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ExtractTables(t *testing.T) {
+	testCases := []struct {
+		Query    string
+		Expected []TableRef
+	}{
+		{`SELECT * FROM users u JOIN groups g ON u.group_id = g.id`,
+			[]TableRef{{"users", false}, {"groups", false}}},
+		{`INSERT INTO archive SELECT * FROM events WHERE id = $1`,
+			[]TableRef{{"archive", true}, {"events", false}}},
+		{`UPDATE "users" SET name = $1 WHERE id IN (SELECT user_id FROM banned)`,
+			[]TableRef{{"users", true}, {"banned", false}}},
+		{"DELETE FROM `sessions` WHERE expires_at < NOW()",
+			[]TableRef{{"sessions", true}}},
+		{`SELECT * FROM jobs WHERE state = 'new' FOR UPDATE SKIP LOCKED`,
+			[]TableRef{{"jobs", false}}},
+		{`INSERT INTO counters (k, v) VALUES ($1, 1) ON CONFLICT (k) DO UPDATE SET v = counters.v + 1`,
+			[]TableRef{{"counters", true}}},
+		{`CREATE TABLE IF NOT EXISTS public.migrations (version TEXT)`,
+			[]TableRef{{"public.migrations", true}}},
+		{`TRUNCATE TABLE cache`, []TableRef{{"cache", true}}},
+		{`SELECT * FROM ONLY measurements`, []TableRef{{"measurements", false}}},
+		{`COPY users TO STDOUT`, []TableRef{{"users", false}}},
+		{`COPY users (id, name) FROM STDIN`, []TableRef{{"users", true}}},
+		{`SELECT 1`, nil},
+	}
+	for _, tc := range testCases {
+		actual := ExtractTables(tc.Query)
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			TT{t}.Unexpected("tables in "+tc.Query, tc.Expected, actual)
+		}
+	}
+}
+
+func Test_DriverStatsTables(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	d := New("sqlite3", WithTableStats())
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE things (id INTEGER)`))
+	tt.MustResult(db.Exec(`INSERT INTO things VALUES (1), (2)`))
+	for idx := 0; idx < 3; idx++ {
+		rows := tt.MustRows(db.Query(`SELECT * FROM things`))
+		tt.Must(rows.Close())
+	}
+	_, err := db.Exec(`DELETE FROM nonexistent`)
+	if err == nil {
+		t.Error("expected DELETE on nonexistent table to fail, but it succeeded")
+	}
+
+	expected := map[string]TableStats{
+		"things": {Reads: 3, Writes: 2},
+	}
+	if actual := d.Stats().Tables; !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("table stats", expected, actual)
+	}
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_ExtractColumns(t *testing.T) {
+	testCases := map[string][]string{
+		`SELECT 1`:                          nil,
+		`SELECT * FROM users WHERE id = $1`: {"id"},
+		`SELECT * FROM users u WHERE u."name" LIKE ? AND age >= 18`: {"u.name", "age"},
+		`SELECT * FROM t WHERE x NOT IN (1, 2) AND y IS NULL`:       {"x", "y"},
+		`SELECT * FROM t WHERE d BETWEEN ? AND ? AND 1 = 1`:         {"d"},
+		`UPDATE users SET name = ?, email = ? WHERE id = ?`:         {"name", "email", "id"},
+		`INSERT INTO users (id, "name") VALUES (?, ?)`:              {"id", "name"},
+	}
+	for query, expected := range testCases {
+		actual := ExtractColumns(query)
+		if !reflect.DeepEqual(actual, expected) {
+			TT{t}.Unexpected("columns in "+query, expected, actual)
+		}
+	}
+}
+
+//tableParser wraps toyParser and implements TableExtractor by reporting
+//every word after FROM.
+type tableParser struct{}
+
+func (tableParser) Parse(query string) (interface{}, error) {
+	return toyParser.Parse(query)
+}
+
+func (tableParser) ExtractTables(ast interface{}) []TableRef {
+	var result []TableRef
+	words := ast.([]string)
+	for idx := 1; idx < len(words); idx++ {
+		if words[idx-1] == "FROM" {
+			result = append(result, TableRef{Table: strings.ToLower(words[idx])})
+		}
+	}
+	return result
+}
+
+func Test_ListTables(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	var events []QueryEvent
+	d := New("sqlite3", WithTableList(), WithAfterQuery(func(e QueryEvent) {
+		events = append(events, e)
+	}))
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	tt.MustResult(db.Exec(`CREATE TABLE things (id INTEGER)`))
+	tt.MustResult(db.Exec(`INSERT INTO things VALUES (?)`, 1))
+	tt.Must(db.Close())
+
+	//with a TableExtractor, the parser decides (for statements that it can
+	//parse)
+	d = New("sqlite3", WithTableList(), WithParser(tableParser{}), WithAfterQuery(func(e QueryEvent) {
+		events = append(events, e)
+	}))
+	db = sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	rows := tt.MustRows(db.Query(`SELECT * FROM things`))
+	tt.Must(rows.Close())
+	rows = tt.MustRows(db.Query(`SELECT * FROM things WHERE id = ?`, 1))
+	tt.Must(rows.Close())
+	tt.Must(db.Close())
+
+	expected := [][]TableRef{
+		{{"things", true}},
+		{{"things", true}},
+		{{"things", false}},
+		{{"things", false}},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+	for idx, e := range events {
+		if !reflect.DeepEqual(e.Tables, expected[idx]) {
+			tt.Unexpected("tables for "+e.Query, expected[idx], e.Tables)
+		}
+	}
+	tt.CleanupDB()
+}
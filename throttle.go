@@ -0,0 +1,133 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+//LogThrottle limits how often statements with the same fingerprint (see
+//Normalize) are passed on to a logging hook. This avoids flooding the log when
+//a hot loop issues the same statement over and over:
+//
+//	throttle := sqlproxy.NewLogThrottle(10, time.Minute)
+//	d := &sqlproxy.Driver{
+//		ProxiedDriverName: "postgres",
+//		Hooks: sqlproxy.Hooks{
+//			BeforeQueryHook: throttle.WrapBeforeQuery(sqlproxy.TraceQuery(func(msg string) { log.Println(msg) })),
+//		},
+//	}
+//
+//At most limit statements per fingerprint are let through in each interval.
+//When an interval has ended, the number of suppressed statements per
+//fingerprint is reported to the SummaryHook. Since there is no background
+//goroutine, this report happens when the next statement arrives after the
+//interval has ended.
+type LogThrottle struct {
+	limit    int
+	interval time.Duration
+	//SummaryHook (optional) receives the number of suppressed statements per
+	//fingerprint at the end of each interval in which statements were
+	//suppressed. If not set, the summary is logged through log/slog.
+	SummaryHook func(suppressed map[string]int)
+
+	mutex       sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+}
+
+//NewLogThrottle creates a LogThrottle that lets through at most limit
+//statements with the same fingerprint per interval.
+func NewLogThrottle(limit int, interval time.Duration) *LogThrottle {
+	return &LogThrottle{limit: limit, interval: interval}
+}
+
+//Allow returns whether a log message for the given query may be emitted.
+func (t *LogThrottle) Allow(query string) bool {
+	fp := Normalize(query)
+	now := time.Now()
+
+	t.mutex.Lock()
+	var suppressed map[string]int
+	if t.counts == nil || now.Sub(t.windowStart) >= t.interval {
+		for fp, count := range t.counts {
+			if count > t.limit {
+				if suppressed == nil {
+					suppressed = make(map[string]int)
+				}
+				suppressed[fp] = count - t.limit
+			}
+		}
+		t.windowStart = now
+		t.counts = make(map[string]int)
+	}
+	t.counts[fp]++
+	allowed := t.counts[fp] <= t.limit
+	t.mutex.Unlock()
+
+	//report outside of the lock, since the hook might be slow
+	if suppressed != nil {
+		t.reportSuppressed(suppressed)
+	}
+	return allowed
+}
+
+func (t *LogThrottle) reportSuppressed(suppressed map[string]int) {
+	if t.SummaryHook != nil {
+		t.SummaryHook(suppressed)
+		return
+	}
+	fingerprints := make([]string, 0, len(suppressed))
+	for fp := range suppressed {
+		fingerprints = append(fingerprints, fp)
+	}
+	sort.Strings(fingerprints)
+	for _, fp := range fingerprints {
+		slog.Default().LogAttrs(context.Background(), slog.LevelWarn, "suppressed repeated SQL log messages",
+			slog.String("fingerprint", fp),
+			slog.Int("count", suppressed[fp]),
+			slog.Duration("interval", t.interval),
+		)
+	}
+}
+
+//WrapBeforeQuery returns a BeforeQueryHook that calls the given hook only if
+//Allow() permits it.
+func (t *LogThrottle) WrapBeforeQuery(hook func(query string, args []interface{})) func(query string, args []interface{}) {
+	return func(query string, args []interface{}) {
+		if t.Allow(query) {
+			hook(query, args)
+		}
+	}
+}
+
+//WrapAfterQuery returns an AfterQueryHook (or SlowQueryHook) that calls the
+//given hook only if Allow() permits it.
+func (t *LogThrottle) WrapAfterQuery(hook func(e QueryEvent)) func(e QueryEvent) {
+	return func(e QueryEvent) {
+		if t.Allow(e.Query) {
+			hook(e)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*******************************************************************************
+*
+* Copyright 2017 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_LogThrottle(t *testing.T) {
+	tt := TT{t}
+
+	var (
+		logged    []string
+		summaries []map[string]int
+	)
+	throttle := NewLogThrottle(2, 50*time.Millisecond)
+	throttle.SummaryHook = func(suppressed map[string]int) {
+		summaries = append(summaries, suppressed)
+	}
+	hook := throttle.WrapBeforeQuery(func(query string, args []interface{}) {
+		logged = append(logged, query)
+	})
+
+	for idx := 0; idx < 5; idx++ {
+		hook(`SELECT * FROM things WHERE id = $1`, []interface{}{idx})
+	}
+	hook(`SELECT 1`, nil)
+	expected := []string{
+		`SELECT * FROM things WHERE id = $1`,
+		`SELECT * FROM things WHERE id = $1`,
+		`SELECT 1`,
+	}
+	if !reflect.DeepEqual(logged, expected) {
+		tt.Unexpected("logged", expected, logged)
+	}
+	if len(summaries) != 0 {
+		tt.Unexpected("summaries", []map[string]int(nil), summaries)
+	}
+
+	//after the interval, statements are let through again, and the summary is reported
+	time.Sleep(60 * time.Millisecond)
+	logged = nil
+	hook(`SELECT * FROM things WHERE id = $1`, []interface{}{5})
+	if !reflect.DeepEqual(logged, expected[:1]) {
+		tt.Unexpected("logged", expected[:1], logged)
+	}
+	expectedSummaries := []map[string]int{{`SELECT * FROM things WHERE id = ?`: 3}}
+	if !reflect.DeepEqual(summaries, expectedSummaries) {
+		tt.Unexpected("summaries", expectedSummaries, summaries)
+	}
+}
@@ -0,0 +1,117 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ServerTimeoutStyle selects how the deadline of a statement's context is
+//passed on to the database server (see Driver.ServerTimeout).
+type ServerTimeoutStyle string
+
+const (
+	//ServerTimeoutPostgres issues "SET statement_timeout = <ms>" on the
+	//connection before each statement that is executed with a context
+	//deadline, and "RESET statement_timeout" before the next statement without
+	//a deadline. This costs an extra round trip per statement.
+	ServerTimeoutPostgres ServerTimeoutStyle = "postgres"
+	//ServerTimeoutMySQL adds the optimizer hint "/*+ MAX_EXECUTION_TIME(<ms>)
+	//*/" to SELECT statements that are executed with a context deadline.
+	//MySQL does not support timeouts for other types of statements.
+	ServerTimeoutMySQL ServerTimeoutStyle = "mysql"
+)
+
+//timeoutMillis returns the time until the context's deadline in milliseconds
+//(rounded up), or 0 if the context does not have a deadline or if it has
+//already expired.
+func timeoutMillis(ctx context.Context) int64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return 0
+	}
+	return int64((remaining + time.Millisecond - 1) / time.Millisecond)
+}
+
+var executionTimeHintRx = regexp.MustCompile(`(?i)\bMAX_EXECUTION_TIME\s*\(`)
+
+//injectTimeoutHint implements ServerTimeoutMySQL. If the statement already
+//has an optimizer hint comment after SELECT, the timeout is added to it,
+//since MySQL only considers the first hint comment.
+func (c *connection) injectTimeoutHint(ctx context.Context, query string) string {
+	if c.driver.ServerTimeout != ServerTimeoutMySQL || StatementType(query) != "select" {
+		return query
+	}
+	ms := timeoutMillis(ctx)
+	if ms == 0 || executionTimeHintRx.MatchString(query) {
+		return query
+	}
+	hint := "MAX_EXECUTION_TIME(" + strconv.FormatInt(ms, 10) + ")"
+	loc := leadingKeywordRx.FindStringIndex(query)
+	rest := query[loc[1]:]
+	if trimmed := strings.TrimLeft(rest, " \t\r\n"); strings.HasPrefix(trimmed, "/*+") {
+		offset := loc[1] + len(rest) - len(trimmed) + 3
+		return query[:offset] + " " + hint + query[offset:]
+	}
+	return query[:loc[1]] + " /*+ " + hint + " */" + rest
+}
+
+//setServerTimeout implements ServerTimeoutPostgres for the given proxied
+//connection.
+func (c *connection) setServerTimeout(ctx context.Context, conn driver.Conn) error {
+	if c.driver.ServerTimeout != ServerTimeoutPostgres {
+		return nil
+	}
+	ms := timeoutMillis(ctx)
+	if ms == 0 {
+		if !c.timeoutSet[conn] {
+			return nil
+		}
+		delete(c.timeoutSet, conn)
+		return c.execCommand(ctx, conn, "RESET statement_timeout")
+	}
+	if c.timeoutSet == nil {
+		c.timeoutSet = make(map[driver.Conn]bool)
+	}
+	c.timeoutSet[conn] = true
+	return c.execCommand(ctx, conn, "SET statement_timeout = "+strconv.FormatInt(ms, 10))
+}
+
+//execCommand executes a statement that the proxy itself issues on the given
+//proxied connection, without running any hooks.
+func (c *connection) execCommand(ctx context.Context, conn driver.Conn, command string) error {
+	_, err := proxiedExec(ctx, conn, command, nil)
+	if err == driver.ErrSkip {
+		_, err = execPrepared(ctx, conn, command, nil)
+	}
+	if err != nil {
+		return c.checkError(err)
+	}
+	return nil
+}
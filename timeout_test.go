@@ -0,0 +1,92 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func Test_ServerTimeoutPostgres(t *testing.T) {
+	tt := TT{t}
+	var queries []string
+	fakeExec = func(ctx context.Context, query string, args []driver.NamedValue) error {
+		queries = append(queries, query)
+		return nil
+	}
+	d := New("", WithProxiedDriver(fakeDriver{}), WithServerTimeout(ServerTimeoutPostgres))
+	db := sql.OpenDB(NewConnector(d, ""))
+	db.SetMaxOpenConns(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	tt.MustResult(db.ExecContext(ctx, `DELETE FROM knowledge WHERE id = 1`))
+	tt.MustResult(db.ExecContext(ctx, `DELETE FROM knowledge WHERE id = 2`))
+	tt.MustResult(db.Exec(`DELETE FROM knowledge WHERE id = 3`))
+	tt.MustResult(db.Exec(`DELETE FROM knowledge WHERE id = 4`))
+
+	timeoutRx := regexp.MustCompile(`^SET statement_timeout = (59\d\d\d|60000)$`)
+	if len(queries) != 7 || !timeoutRx.MatchString(queries[0]) || !timeoutRx.MatchString(queries[2]) {
+		t.Fatalf("unexpected statements: %q", queries)
+	}
+	expected := []string{
+		`DELETE FROM knowledge WHERE id = 1`,
+		`DELETE FROM knowledge WHERE id = 2`,
+		`RESET statement_timeout`,
+		`DELETE FROM knowledge WHERE id = 3`,
+		`DELETE FROM knowledge WHERE id = 4`,
+	}
+	actual := []string{queries[1], queries[3], queries[4], queries[5], queries[6]}
+	if !reflect.DeepEqual(actual, expected) {
+		tt.Unexpected("statements", expected, actual)
+	}
+	tt.Must(db.Close())
+}
+
+func Test_ServerTimeoutMySQL(t *testing.T) {
+	c := &connection{driver: New("mysql", WithServerTimeout(ServerTimeoutMySQL))}
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+
+	testCases := map[string]string{
+		`SELECT * FROM users`:                               `SELECT /*+ MAX_EXECUTION_TIME(1500) */ * FROM users`,
+		`/* comment */ select * FROM users`:                 `/* comment */ select /*+ MAX_EXECUTION_TIME(1500) */ * FROM users`,
+		`SELECT /*+ INDEX(users idx) */ * FROM users`:       `SELECT /*+ MAX_EXECUTION_TIME(1500) INDEX(users idx) */ * FROM users`,
+		`SELECT /*+ MAX_EXECUTION_TIME(10) */ * FROM users`: `SELECT /*+ MAX_EXECUTION_TIME(10) */ * FROM users`,
+		`UPDATE users SET name = ?`:                         `UPDATE users SET name = ?`,
+	}
+	for query, expected := range testCases {
+		actual := c.injectTimeoutHint(ctx, query)
+		//the remaining time may have dropped slightly below 1500 ms
+		actual = regexp.MustCompile(`MAX_EXECUTION_TIME\(1[45]\d\d\)`).ReplaceAllString(actual, "MAX_EXECUTION_TIME(1500)")
+		if actual != expected {
+			TT{t}.Unexpected("rewrite of "+query, expected, actual)
+		}
+	}
+
+	if actual := c.injectTimeoutHint(context.Background(), `SELECT 1`); actual != `SELECT 1` {
+		t.Errorf("expected no hint without deadline, got %q", actual)
+	}
+}
@@ -21,6 +21,7 @@
 package sqlproxy
 
 import (
+	"database/sql"
 	"fmt"
 	"regexp"
 	"strings"
@@ -37,33 +38,49 @@ var sqlWhitespaceRx = regexp.MustCompile(`(?:\s|--.*)+`) // `.*` matches until e
 //
 //	sql.Register("postgres-with-logging", &sqlproxy.Driver {
 //		ProxiedDriverName: "postgres",
-//		BeforeQueryHook:   sqlproxy.TraceQuery(func(msg string) { log.Println(msg) }),
+//		Hooks: sqlproxy.Hooks{
+//			BeforeQueryHook: sqlproxy.TraceQuery(func(msg string) { log.Println(msg) }),
+//		},
 //	})
 //
 func TraceQuery(printer func(string)) func(string, []interface{}) {
 	return func(query string, args []interface{}) {
-		//simplify query string - remove comments and reduce whitespace
-		//(This logic assumes that there are no arbitrary strings in the SQL
-		//statement, which is okay since values should be given as args anyway.)
-		query = strings.TrimSpace(sqlWhitespaceRx.ReplaceAllString(query, " "))
+		printer(formatQuery(query, args))
+	}
+}
+
+//formatQuery renders a query and its arguments into a single line.
+func formatQuery(query string, args []interface{}) string {
+	//simplify query string - remove comments and reduce whitespace
+	//(This logic assumes that there are no arbitrary strings in the SQL
+	//statement, which is okay since values should be given as args anyway.)
+	query = strings.TrimSpace(sqlWhitespaceRx.ReplaceAllString(query, " "))
+
+	//early exit for easy option
+	if len(args) == 0 {
+		return query
+	}
 
-		//early exit for easy option
-		if len(args) == 0 {
-			printer(query)
-			return
-		}
+	return query + " [" + strings.Join(formatArgs(args), ", ") + "]"
+}
+
+func formatArgs(args []interface{}) []string {
+	result := make([]string, len(args))
+	for idx, argument := range args {
+		result[idx] = formatArg(argument)
+	}
+	return result
+}
 
-		//if args contains time.Time objects, pretty-print these; use
-		//fmt.Sprintf("%#v") for all other types of values
-		argStrings := make([]string, len(args))
-		for idx, argument := range args {
-			switch arg := argument.(type) {
-			case time.Time:
-				argStrings[idx] = "time.Time [" + arg.Local().String() + "]"
-			default:
-				argStrings[idx] = fmt.Sprintf("%#v", arg)
-			}
-		}
-		printer(query + " [" + strings.Join(argStrings, ", ") + "]")
+//formatArg pretty-prints time.Time objects and named arguments, and uses
+//fmt.Sprintf("%#v") for all other types of values.
+func formatArg(argument interface{}) string {
+	switch arg := argument.(type) {
+	case time.Time:
+		return "time.Time [" + arg.Local().String() + "]"
+	case sql.NamedArg:
+		return arg.Name + "=" + formatArg(arg.Value)
+	default:
+		return fmt.Sprintf("%#v", arg)
 	}
 }
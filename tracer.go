@@ -0,0 +1,40 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import "context"
+
+//Tracer is the interface through which a Driver reports spans for distributed
+//tracing. It is deliberately small, such that this package does not depend on
+//any particular tracing library. Adapters for OpenTelemetry and OpenTracing
+//are provided by the packages otelhooks and opentracinghooks.
+//
+//For each statement, StartSpan is called just before the statement is given
+//to the proxied driver, and EndSpan is called once the statement has finished
+//(for queries, when their rows are closed). The context returned by
+//StartSpan is given to the proxied driver, and is also given to EndSpan, such
+//that implementations can store the span in it.
+//
+//In the QueryEvent given to StartSpan, only Query, Args, ConnectionID, Fields,
+//Caller and Tenant are filled. The QueryEvent given to EndSpan is complete.
+type Tracer interface {
+	StartSpan(ctx context.Context, e QueryEvent) context.Context
+	EndSpan(ctx context.Context, e QueryEvent)
+}
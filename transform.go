@@ -0,0 +1,141 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql/driver"
+	"errors"
+)
+
+//ErrSkipRow can be returned by RowTransform.TransformRow to drop the current
+//row from the result set.
+var ErrSkipRow = errors.New("skip this row")
+
+//RowTransform is a stage in the pipeline that sits between the result rows of
+//the proxied driver and the caller. See Hooks.RowTransformHook for details.
+type RowTransform interface {
+	//TransformColumns is called once per result set with the column names
+	//produced by the previous stage, and returns the column names produced by
+	//this stage.
+	TransformColumns(columns []string) []string
+	//TransformRow is called for each row with the column names and values
+	//produced by the previous stage, and returns the values produced by this
+	//stage. Return ErrSkipRow to drop the row from the result set. Any other
+	//error will be propagated to the caller of rows.Next().
+	TransformRow(columns []string, row []driver.Value) ([]driver.Value, error)
+}
+
+//FilterRows returns a RowTransform that only passes on those rows for which
+//the given predicate returns true.
+func FilterRows(predicate func(columns []string, row []driver.Value) bool) RowTransform {
+	return filterTransform{predicate}
+}
+
+type filterTransform struct {
+	predicate func([]string, []driver.Value) bool
+}
+
+func (t filterTransform) TransformColumns(columns []string) []string {
+	return columns
+}
+
+func (t filterTransform) TransformRow(columns []string, row []driver.Value) ([]driver.Value, error) {
+	if t.predicate(columns, row) {
+		return row, nil
+	}
+	return nil, ErrSkipRow
+}
+
+//MapRows returns a RowTransform that calls the given function on each row.
+//The function may modify the values in the row in-place.
+func MapRows(action func(columns []string, row []driver.Value) error) RowTransform {
+	return mapTransform{action}
+}
+
+type mapTransform struct {
+	action func([]string, []driver.Value) error
+}
+
+func (t mapTransform) TransformColumns(columns []string) []string {
+	return columns
+}
+
+func (t mapTransform) TransformRow(columns []string, row []driver.Value) ([]driver.Value, error) {
+	return row, t.action(columns, row)
+}
+
+//ProjectColumns returns a RowTransform that only passes on the columns with
+//the given names, in the given order. Names which do not appear in the result
+//set are ignored.
+func ProjectColumns(names ...string) RowTransform {
+	return projectTransform{func(columns []string) []int {
+		var indexes []int
+		for _, name := range names {
+			for idx, column := range columns {
+				if column == name {
+					indexes = append(indexes, idx)
+					break
+				}
+			}
+		}
+		return indexes
+	}}
+}
+
+//DropColumns returns a RowTransform that removes the columns with the given
+//names from the result set.
+func DropColumns(names ...string) RowTransform {
+	isDropped := make(map[string]bool, len(names))
+	for _, name := range names {
+		isDropped[name] = true
+	}
+	return projectTransform{func(columns []string) []int {
+		var indexes []int
+		for idx, column := range columns {
+			if !isDropped[column] {
+				indexes = append(indexes, idx)
+			}
+		}
+		return indexes
+	}}
+}
+
+type projectTransform struct {
+	//returns the indexes of the input columns that shall be kept, in order
+	selectIndexes func(columns []string) []int
+}
+
+func (t projectTransform) TransformColumns(columns []string) []string {
+	indexes := t.selectIndexes(columns)
+	result := make([]string, len(indexes))
+	for idx, inputIdx := range indexes {
+		result[idx] = columns[inputIdx]
+	}
+	return result
+}
+
+func (t projectTransform) TransformRow(columns []string, row []driver.Value) ([]driver.Value, error) {
+	indexes := t.selectIndexes(columns)
+	result := make([]driver.Value, len(indexes))
+	for idx, inputIdx := range indexes {
+		result[idx] = row[inputIdx]
+	}
+	return result, nil
+}
@@ -0,0 +1,111 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"time"
+)
+
+//ReplicaWarmupEvent describes the progress of the warm-up of a replica (see
+//Driver.ReplicaWarmup). It is given to the ReplicaWarmupHook.
+type ReplicaWarmupEvent struct {
+	//Replica is the index of the replica in Driver.ReplicaDataSources. (The
+	//data source name itself is not given since it could contain
+	//credentials.)
+	Replica int
+	//Query is the warm-up statement that was executed, or empty if
+	//connecting to the replica failed. (Failed connection attempts are
+	//retried with increasing delays.)
+	Query string
+	//Completed is the number of warm-up statements that have been executed
+	//so far (including failed ones), out of Total.
+	Completed int
+	Total     int
+	//Duration is how long the warm-up statement took.
+	Duration time.Duration
+	//Err is the error returned by the warm-up statement, or by the attempt to
+	//connect to the replica.
+	Err error
+	//Done is set on the event for the last warm-up statement of this
+	//replica. From now on, statements are routed to it.
+	Done bool
+}
+
+const (
+	//replicaConnectBackoff is how long the warm-up waits before connecting to
+	//a replica again after a failed attempt. The wait doubles after each
+	//failed attempt, up to replicaConnectMaxBackoff.
+	replicaConnectBackoff    = 250 * time.Millisecond
+	replicaConnectMaxBackoff = 30 * time.Second
+)
+
+//warmup implements Driver.ReplicaWarmup for the replica with the given index.
+func (r *replicaSet) warmup(ctx context.Context, d *Driver, idx int) {
+	defer r.warmups.Done()
+	total := len(d.ReplicaWarmup)
+	report := func(e ReplicaWarmupEvent) {
+		if e.Done {
+			r.ready[idx].Store(true)
+		}
+		if hook := d.hooks().ReplicaWarmupHook; hook != nil {
+			hook(e)
+		} else if e.Err != nil {
+			slog.Warn("sqlproxy: replica warm-up failed",
+				slog.Int("replica", e.Replica), slog.String("query", e.Query), slog.String("error", e.Err.Error()))
+		}
+	}
+
+	//an unreachable replica does not get any statements until it can be
+	//connected to and warmed up
+	backoff := replicaConnectBackoff
+	conn, err := r.connectors[idx].Connect(ctx)
+	for err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		report(ReplicaWarmupEvent{Replica: idx, Total: total, Err: err})
+		if sleepContext(ctx, backoff) != nil {
+			return
+		}
+		backoff = min(2*backoff, replicaConnectMaxBackoff)
+		conn, err = r.connectors[idx].Connect(ctx)
+	}
+	defer conn.Close()
+
+	for completed, query := range d.ReplicaWarmup {
+		startedAt := time.Now()
+		err := queryDirect(ctx, conn, query, nil, func([]driver.Value) {})
+		if ctx.Err() != nil {
+			return //the connector was closed, so the rest of the warm-up is moot
+		}
+		report(ReplicaWarmupEvent{
+			Replica:   idx,
+			Query:     query,
+			Completed: completed + 1,
+			Total:     total,
+			Duration:  time.Since(startedAt),
+			Err:       err,
+			Done:      completed+1 == total,
+		})
+	}
+}
@@ -0,0 +1,215 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"time"
+)
+
+//MaxStatsWindow is the longest window supported by Driver.RecentStats() and
+//FingerprintStats.Recent().
+const MaxStatsWindow = time.Hour
+
+const (
+	//how often Driver.RecentStats() snapshots the cumulative statistics
+	statsSnapshotInterval = 10 * time.Second
+	//the width of the time slots in FingerprintStats.Recent()
+	fingerprintSlotWidth = time.Minute
+)
+
+type driverStatsSnapshot struct {
+	at    time.Time
+	stats DriverStats
+}
+
+func (c *driverCounters) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+//ResetStats resets the statistics returned by Stats() and RecentStats() to
+//zero, except for DriverStats.OpenConnections. This is useful for debug
+//endpoints that shall show what the Driver has been doing since an operator
+//started looking, instead of since the process started.
+func (d *Driver) ResetStats() {
+	d.stats.snapshotMutex.Lock()
+	defer d.stats.snapshotMutex.Unlock()
+	d.stats.baseline = d.cumulativeStats()
+	d.stats.resetAt = d.stats.clock()
+}
+
+//RecentStats is like Stats(), but only covers the given window up to now,
+//e.g. the last 5 minutes. The window cannot be longer than MaxStatsWindow,
+//and not reach back before the last ResetStats(). Since there is no
+//background goroutine, the statistics are divided into intervals of 10
+//seconds by snapshotting them when the first connection is opened or the
+//first statement is prepared or executed in each interval. The window is
+//thus extended to the start of the interval that it starts in.
+func (d *Driver) RecentStats(window time.Duration) DriverStats {
+	current := d.cumulativeStats()
+	start := d.stats.clock().Add(-min(window, MaxStatsWindow))
+
+	d.stats.snapshotMutex.Lock()
+	defer d.stats.snapshotMutex.Unlock()
+	//the baseline is the snapshot at the start of the first interval with
+	//statements in the window; if there is none, nothing happened
+	baseline := current
+	for _, snapshot := range d.stats.snapshots {
+		if snapshot.at.Add(statsSnapshotInterval).After(start) {
+			baseline = snapshot.stats
+			if d.stats.resetAt.After(snapshot.at) {
+				baseline = d.stats.baseline
+			}
+			break
+		}
+	}
+	return diffDriverStats(current, baseline)
+}
+
+//snapshotStats records a snapshot of the cumulative statistics for
+//RecentStats() at the start of each interval. It is called before the event
+//that triggers it is counted, so the snapshot contains everything that
+//happened before this interval.
+func (d *Driver) snapshotStats() {
+	now := d.stats.clock()
+	if now.UnixNano() < d.stats.nextSnapshot.Load() {
+		return
+	}
+	d.stats.snapshotMutex.Lock()
+	defer d.stats.snapshotMutex.Unlock()
+	if now.UnixNano() < d.stats.nextSnapshot.Load() {
+		return //another goroutine was faster
+	}
+	intervalStart := now.Truncate(statsSnapshotInterval)
+	d.stats.nextSnapshot.Store(intervalStart.Add(statsSnapshotInterval).UnixNano())
+
+	cutoff := now.Add(-MaxStatsWindow)
+	drop := 0
+	for drop < len(d.stats.snapshots) && !d.stats.snapshots[drop].at.Add(statsSnapshotInterval).After(cutoff) {
+		drop++
+	}
+	d.stats.snapshots = append(d.stats.snapshots[drop:], driverStatsSnapshot{intervalStart, d.cumulativeStats()})
+}
+
+//diffDriverStats returns the statistics that were collected between the
+//given baseline and the current statistics.
+func diffDriverStats(current, baseline DriverStats) DriverStats {
+	result := current
+	result.Prepares -= baseline.Prepares
+	result.Executions -= baseline.Executions
+	result.Errors -= baseline.Errors
+	result.RowBytes -= baseline.RowBytes
+	result.Commits -= baseline.Commits
+	result.Rollbacks -= baseline.Rollbacks
+	result.Connects -= baseline.Connects
+	result.ConnectDuration -= baseline.ConnectDuration
+
+	result.ErrorsByCategory = make(map[ErrorCategory]uint64)
+	for category, count := range current.ErrorsByCategory {
+		if count > baseline.ErrorsByCategory[category] {
+			result.ErrorsByCategory[category] = count - baseline.ErrorsByCategory[category]
+		}
+	}
+	if current.Tables != nil {
+		result.Tables = make(map[string]TableStats)
+		for table, stats := range current.Tables {
+			stats.Reads -= baseline.Tables[table].Reads
+			stats.Writes -= baseline.Tables[table].Writes
+			if stats.Reads > 0 || stats.Writes > 0 {
+				result.Tables[table] = stats
+			}
+		}
+	}
+	result.ConnectCounts = append([]uint64(nil), current.ConnectCounts...)
+	for idx, count := range baseline.ConnectCounts {
+		result.ConnectCounts[idx] -= count
+	}
+	return result
+}
+
+//fingerprintSlot contains the statistics of one fingerprintSlotWidth for
+//FingerprintStats.Recent().
+type fingerprintSlot struct {
+	start time.Time
+	byFP  map[string]*LatencyHistogram
+}
+
+//currentSlot returns the histograms for the current time slot, creating it
+//if necessary and discarding slots that are older than MaxStatsWindow. The
+//caller must hold s.mutex.
+func (s *FingerprintStats) currentSlot() map[string]*LatencyHistogram {
+	start := s.now().Truncate(fingerprintSlotWidth)
+	if len(s.slots) > 0 && s.slots[len(s.slots)-1].start.Equal(start) {
+		return s.slots[len(s.slots)-1].byFP
+	}
+	cutoff := start.Add(-MaxStatsWindow)
+	drop := 0
+	for drop < len(s.slots) && !s.slots[drop].start.Add(fingerprintSlotWidth).After(cutoff) {
+		drop++
+	}
+	slot := fingerprintSlot{start, make(map[string]*LatencyHistogram)}
+	s.slots = append(s.slots[drop:], slot)
+	return slot.byFP
+}
+
+//Recent is like Stats(), but only covers the given window up to now, e.g.
+//the last 5 minutes. The statistics are kept in slots of one minute, so the
+//window is rounded up to whole minutes, and it cannot be longer than
+//MaxStatsWindow or reach back before the last Reset(). When a Limiter is
+//set, fingerprints that were evicted from Stats() may still show up here
+//for the time before their eviction.
+func (s *FingerprintStats) Recent(window time.Duration) []LatencyHistogram {
+	result, _ := s.recentSnapshot(window)
+	return result
+}
+
+//recentSnapshot is like Recent, but also returns when the window starts.
+func (s *FingerprintStats) recentSnapshot(window time.Duration) ([]LatencyHistogram, time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	start := s.now().Add(-min(window, MaxStatsWindow))
+	merged := make(map[string]*LatencyHistogram)
+	for _, slot := range s.slots {
+		if !slot.start.Add(fingerprintSlotWidth).After(start) {
+			continue
+		}
+		for key, h := range slot.byFP {
+			s.histogram(merged, key, h.Fingerprint, h.Tenant).merge(*h)
+		}
+	}
+	result := make([]LatencyHistogram, 0, len(merged))
+	for _, h := range merged {
+		result = append(result, *h)
+	}
+	sortLatencyHistograms(result)
+	if start.Before(s.since) {
+		start = s.since
+	}
+	return result, start
+}
+
+//RecentReport is like Report(), but only covers the given window up to now
+//(see Recent).
+func (s *FingerprintStats) RecentReport(n int, window time.Duration) ActivityReport {
+	stats, start := s.recentSnapshot(window)
+	return buildActivityReport(stats, start, s.now(), n)
+}
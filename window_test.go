@@ -0,0 +1,123 @@
+/*******************************************************************************
+*
+* Copyright 2026 Stefan Majewsky <majewsky@gmx.net>
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package sqlproxy
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func Test_DriverRecentStats(t *testing.T) {
+	tt := TT{t}
+	tt.CleanupDB()
+
+	startedAt := time.Unix(0, 0)
+	now := startedAt
+	d := New("sqlite3")
+	d.stats.now = func() time.Time { return now }
+	db := sql.OpenDB(NewConnector(d, "file:"+sqliteFile))
+	db.SetMaxOpenConns(1)
+	tt.MustResult(db.Exec(`CREATE TABLE users (id INTEGER)`))
+	tt.MustResult(db.Exec(`INSERT INTO users (id) VALUES (1)`))
+
+	now = startedAt.Add(2 * time.Minute)
+	tt.MustResult(db.Exec(`INSERT INTO users (id) VALUES (2)`))
+
+	expectExecutions := func(description string, actual DriverStats, expected uint64) {
+		t.Helper()
+		if actual.Executions != expected {
+			tt.Unexpected(description, expected, actual.Executions)
+		}
+	}
+	expectExecutions("executions in the last minute", d.RecentStats(time.Minute), 1)
+	expectExecutions("executions in the last hour", d.RecentStats(time.Hour), 3)
+	expectExecutions("executions in total", d.Stats(), 3)
+	if d.RecentStats(time.Minute).Connects != 0 || d.RecentStats(time.Hour).Connects != 1 {
+		t.Error("expected the connect to only be included in the last hour")
+	}
+
+	//windows do not reach back before a reset
+	d.ResetStats()
+	tt.MustResult(db.Exec(`INSERT INTO users (id) VALUES (3)`))
+	expectExecutions("executions since reset", d.Stats(), 1)
+	expectExecutions("executions in the last hour after reset", d.RecentStats(time.Hour), 1)
+	if actual := d.Stats().OpenConnections; actual != 1 {
+		tt.Unexpected("OpenConnections after reset", int64(1), actual)
+	}
+
+	//nothing happened in the last hour
+	now = startedAt.Add(2 * time.Hour)
+	expectExecutions("executions in the last hour after a quiet period", d.RecentStats(time.Hour), 0)
+	tt.MustResult(db.Exec(`INSERT INTO users (id) VALUES (4)`))
+	expectExecutions("executions in the last minute after a quiet period", d.RecentStats(time.Minute), 1)
+	expectExecutions("executions in total after a quiet period", d.Stats(), 2)
+	if len(d.stats.snapshots) != 1 {
+		t.Errorf("expected old snapshots to be discarded, got %d snapshots", len(d.stats.snapshots))
+	}
+
+	tt.Must(db.Close())
+	tt.CleanupDB()
+}
+
+func Test_FingerprintStatsRecent(t *testing.T) {
+	tt := TT{t}
+
+	startedAt := time.Unix(0, 0)
+	now := startedAt
+	s := NewFingerprintStats()
+	s.now = func() time.Time { return now }
+	s.Reset()
+	hook := s.Hooks().AfterQueryHook
+
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 1`, Duration: time.Second})
+	now = startedAt.Add(10 * time.Minute)
+	hook(QueryEvent{Query: `SELECT * FROM users WHERE id = 2`, Duration: time.Second})
+	hook(QueryEvent{Query: `SELECT * FROM groups`, Duration: time.Second})
+
+	recent := s.Recent(5 * time.Minute)
+	if len(recent) != 2 || recent[0].Fingerprint != `SELECT * FROM groups` || recent[1].Count != 1 {
+		t.Errorf("unexpected stats for the last 5 minutes: %#v", recent)
+	}
+	recent = s.Recent(time.Hour)
+	if len(recent) != 2 || recent[1].Count != 2 || recent[1].Sum != 2*time.Second {
+		t.Errorf("unexpected stats for the last hour: %#v", recent)
+	}
+
+	report := s.RecentReport(10, 5*time.Minute)
+	if report.Statements != 2 || !report.Start.Equal(startedAt.Add(5*time.Minute)) || !report.End.Equal(now) {
+		t.Errorf("unexpected report for the last 5 minutes: %#v", report)
+	}
+	//the report does not reach back before the last Reset()
+	report = s.RecentReport(10, 24*time.Hour)
+	if report.Statements != 3 || !report.Start.Equal(startedAt) {
+		t.Errorf("unexpected report for the last day: %#v", report)
+	}
+
+	//old slots are discarded
+	now = startedAt.Add(3 * time.Hour)
+	hook(QueryEvent{Query: `SELECT 1`})
+	if len(s.slots) != 1 {
+		t.Errorf("expected old slots to be discarded, got %d slots", len(s.slots))
+	}
+	if actual := len(s.Stats()); actual != 3 {
+		tt.Unexpected("number of fingerprints in Stats()", 3, actual)
+	}
+}